@@ -1,27 +1,74 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/tshojoshua/jtnt-agent/internal/agent"
 	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/enroll"
+	"github.com/tshojoshua/jtnt-agent/internal/sandbox"
+	"github.com/tshojoshua/jtnt-agent/internal/store"
 )
 
-const version = "1.0.0"
+const (
+	version              = "1.0.0"
+	cloneRecoveryTimeout = time.Minute
+)
 
 func main() {
-	if err := run(); err != nil {
+	// Job children are re-executed through this binary to enter the sandbox
+	sandbox.RunHelperIfRequested()
+
+	// --enroll-only consumes the enrollment seed and exits. Service
+	// managers that run the daemon unprivileged run it first as root.
+	enrollOnly := len(os.Args) > 1 && os.Args[1] == "--enroll-only"
+
+	if err := run(enrollOnly); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-func run() error {
-	// Load configuration
+func run(enrollOnly bool) error {
+	// Setup signal handling for graceful shutdown
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	// Move a token left in the config file by an older version into the
+	// secure store; Load reads it from either place
+	if err := config.Migrate(config.GetConfigPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "Warning: failed to move the agent token into the secure store: %v\n", err)
+	}
+
+	// Load configuration, enrolling from a seed on first boot
 	cfg, err := config.Load(config.GetConfigPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		cfg, err = enrollFromSeed(sigChan)
+	}
+	if err == nil {
+		cfg = recoverIfCloned(cfg)
+	}
+	if enrollOnly {
+		// Run as root by the service manager; the daemon that follows is not
+		if ownErr := handOverFiles(); err == nil {
+			err = ownErr
+		}
+		return err
+	}
+	if errors.Is(err, store.ErrDecrypt) {
+		// A store wrapped by an older version for another machine ID: the
+		// copied token is gone, so the hub cannot be asked for recovery
+		return fmt.Errorf("the secure store cannot be read on this machine, which may be a clone of an "+
+			"enrolled image; give it its own identity with jtnt-agent reenroll --hub <URL> --token-file <FILE>: %w", err)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
@@ -37,12 +84,22 @@ func run() error {
 		return fmt.Errorf("failed to start agent: %w", err)
 	}
 
-	// Setup signal handling for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	// SIGHUP reloads the configuration, reopening the log file after an
+	// external rotation
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
 
 	// Wait for shutdown signal
-	sig := <-sigChan
+	var sig os.Signal
+	for sig == nil {
+		select {
+		case sig = <-sigChan:
+		case <-hupChan:
+			if err := agentInstance.Reload(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: reload failed: %v\n", err)
+			}
+		}
+	}
 	fmt.Printf("Received signal: %v\n", sig)
 
 	// Gracefully stop agent
@@ -52,3 +109,90 @@ func run() error {
 
 	return nil
 }
+
+// enrollFromSeed enrolls the agent from the deferred enrollment seed left by
+// an installer or image, retrying until the hub accepts it or a shutdown
+// signal arrives
+func enrollFromSeed(sigChan <-chan os.Signal) (*config.Config, error) {
+	seedPath := config.GetEnrollSeedPath()
+	if _, err := os.Stat(seedPath); err != nil {
+		return nil, fmt.Errorf("agent is not enrolled and no enrollment seed found at %s: %w", seedPath, err)
+	}
+
+	s, err := store.NewStore(config.GetCertsDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create store: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case sig := <-sigChan:
+			fmt.Printf("Received signal: %v\n", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	fmt.Printf("Enrolling from seed %s\n", seedPath)
+	cfg, err := enroll.EnrollFromSeed(ctx, seedPath, s, func(err error, next time.Duration) {
+		fmt.Fprintf(os.Stderr, "Enrollment failed, retrying in %s: %v\n", next.Round(time.Second), err)
+	})
+	if cfg == nil {
+		return nil, fmt.Errorf("enrollment from seed failed: %w", err)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; delete %s by hand\n", err, seedPath)
+	}
+	if err := enroll.RecordEnrollment(s, cfg, enroll.MethodSeed); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	fmt.Printf("Enrolled as agent %s with %s\n", cfg.AgentID, cfg.HubURL)
+	return cfg, nil
+}
+
+// recoverIfCloned asks the hub for a new identity when the machine does not
+// match the one the agent enrolled on. If recovery is disabled or fails the
+// original config is returned and the agent refuses to run jobs.
+func recoverIfCloned(cfg *config.Config) *config.Config {
+	s, err := store.NewStore(config.GetCertsDir())
+	if err != nil {
+		return cfg
+	}
+
+	identity, err := enroll.CheckIdentity(s)
+	if err != nil || !identity.Cloned {
+		return cfg
+	}
+
+	fmt.Fprintf(os.Stderr, "Machine fingerprint changed (%s); this agent appears to be a clone of %s\n",
+		strings.Join(identity.Changed, ", "), cfg.AgentID)
+	if cfg.CloneAction == enroll.CloneActionStop {
+		fmt.Fprintln(os.Stderr, "clone_action is stop; re-enroll with jtnt-agent reenroll")
+		return cfg
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cloneRecoveryTimeout)
+	defer cancel()
+
+	recovered, err := enroll.RecoverClone(ctx, cfg, s, identity)
+	if recovered == nil {
+		fmt.Fprintf(os.Stderr, "Clone recovery failed, re-enroll with jtnt-agent reenroll: %v\n", err)
+		return cfg
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if err := enroll.RecordEnrollment(s, recovered, enroll.MethodCloneRecovery); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	// Results and deferred jobs belong to the original agent
+	os.RemoveAll(agent.ResultCacheDir())
+	os.RemoveAll(agent.ScheduledJobsDir())
+
+	fmt.Printf("Recovered from clone as agent %s\n", recovered.AgentID)
+	return recovered
+}
@@ -0,0 +1,75 @@
+// +build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/store"
+)
+
+// handOverFiles gives what --enroll-only wrote as root to the service user,
+// so the unprivileged daemon can read and update it. The service user is
+// the owner of the state directory; if that is root, nothing changes.
+func handOverFiles() error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	return handOver(config.GetStateDir(), config.GetConfigPath(), store.HostKeyFile())
+}
+
+// handOver changes root-owned files under stateDir, and configPath, to the
+// owner of stateDir. hostKey stays root's but gets the service group, which
+// only needs to read it.
+func handOver(stateDir, configPath, hostKey string) error {
+	info, err := os.Stat(stateDir)
+	if err != nil {
+		return fmt.Errorf("failed to stat state directory: %w", err)
+	}
+	owner, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || owner.Uid == 0 {
+		return nil
+	}
+	uid, gid := int(owner.Uid), int(owner.Gid)
+
+	err = filepath.WalkDir(stateDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return chownRootOwned(path, uid, gid)
+	})
+	if err == nil {
+		err = chownRootOwned(configPath, uid, gid)
+	}
+	if err == nil {
+		if err = os.Chown(hostKey, 0, gid); errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to hand files over to the service user: %w", err)
+	}
+	return nil
+}
+
+// chownRootOwned changes path to uid and gid if root owns it. Files already
+// owned by someone else were not written by --enroll-only.
+func chownRootOwned(path string, uid, gid int) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); !ok || stat.Uid != 0 {
+		return nil
+	}
+	return os.Lchown(path, uid, gid)
+}
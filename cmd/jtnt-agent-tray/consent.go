@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/consent"
+	"github.com/tshojoshua/jtnt-agent/internal/ipc"
+)
+
+const (
+	consentPollWait  = 30 * time.Second
+	consentRetryWait = 10 * time.Second
+)
+
+// errNoAnswer means the user dismissed or ignored the prompt
+var errNoAnswer = errors.New("no answer")
+
+// watchConsentRequests long-polls the agent for consent prompts and shows
+// each one to the user until the tray exits
+func watchConsentRequests() {
+	client := ipc.NewHTTPClient(config.GetRuntimeDir(), ipc.ConsentChannel, consentPollWait+10*time.Second)
+	seen := make(map[string]bool)
+
+	for {
+		requests, err := fetchConsentRequests(client)
+		if err != nil {
+			// Agent not running or consent channel disabled
+			time.Sleep(consentRetryWait)
+			continue
+		}
+
+		for _, req := range requests {
+			if seen[req.ID] {
+				continue
+			}
+			seen[req.ID] = true
+			go handleConsentRequest(client, req)
+		}
+	}
+}
+
+func fetchConsentRequests(client *http.Client) ([]*consent.Request, error) {
+	url := ipc.URL(fmt.Sprintf("/v1/consent/pending?wait=%s", consentPollWait))
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agent returned %d", resp.StatusCode)
+	}
+
+	var requests []*consent.Request
+	if err := json.NewDecoder(resp.Body).Decode(&requests); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// handleConsentRequest prompts the user and posts the answer. An ignored
+// prompt is left to expire on the agent, which records it as a timeout.
+func handleConsentRequest(client *http.Client, req *consent.Request) {
+	remaining := time.Until(req.ExpiresAt)
+	if remaining <= 0 {
+		return
+	}
+
+	message := fmt.Sprintf(
+		"%s requested a remote action on this computer:\n\n%s\n\nJob: %s (%s)\n\nAllow it to run?",
+		req.RequestedBy, req.Summary, req.JobID, req.JobType,
+	)
+
+	approve, err := promptConsent("JTNT Agent: Approval Required", message, remaining)
+	if err != nil {
+		return
+	}
+
+	// The agent records who answered from the connection
+	body, _ := json.Marshal(consent.Answer{Approve: approve})
+	resp, err := client.Post(ipc.URL("/v1/consent/"+req.ID), "application/json", bytes.NewReader(body))
+	if err != nil {
+		showNotification("Error", fmt.Sprintf("Failed to send answer: %v", err))
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		showNotification("Approval Expired", "The request expired before your answer arrived")
+	}
+}
+
+// promptConsent shows a yes/no dialog that closes itself after timeout
+func promptConsent(title, message string, timeout time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	seconds := strconv.Itoa(int(timeout.Seconds()))
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		// WScript.Shell Popup: 4 = Yes/No buttons, 32 = question icon;
+		// returns 6 for Yes, 7 for No and -1 on timeout
+		cmd = exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command",
+			"exit (New-Object -ComObject WScript.Shell).Popup($env:JTNT_CONSENT_TEXT, "+seconds+", $env:JTNT_CONSENT_TITLE, 36)")
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "osascript",
+			"-e", "on run argv",
+			"-e", `display dialog (item 1 of argv) with title (item 2 of argv) buttons {"Deny", "Allow"} default button "Deny" giving up after `+seconds,
+			"-e", "end run",
+			"--", message, title)
+	default:
+		cmd = exec.CommandContext(ctx, "zenity", "--question", "--no-markup",
+			"--title", title, "--text", message,
+			"--ok-label", "Allow", "--cancel-label", "Deny",
+			"--timeout", seconds)
+	}
+
+	cmd.Env = append(os.Environ(), "JTNT_CONSENT_TEXT="+message, "JTNT_CONSENT_TITLE="+title)
+
+	output, err := cmd.Output()
+	code := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		return false, err
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		switch code {
+		case 6:
+			return true, nil
+		case 7:
+			return false, nil
+		}
+	case "darwin":
+		out := string(output)
+		if strings.Contains(out, "gave up:true") {
+			return false, errNoAnswer
+		}
+		if err != nil {
+			return false, err
+		}
+		return strings.Contains(out, "button returned:Allow"), nil
+	default:
+		switch code {
+		case 0:
+			return true, nil
+		case 1:
+			return false, nil
+		}
+	}
+
+	return false, errNoAnswer
+}
@@ -84,6 +84,9 @@ func onReady() {
 	// Update status immediately
 	go updateAgentStatus(mStatus)
 
+	// Show consent prompts for jobs that need the user's approval
+	go watchConsentRequests()
+
 	// Start background refresh timer
 	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/audit"
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/enroll"
+	"github.com/tshojoshua/jtnt-agent/internal/store"
+)
+
+func auditCmd(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: jtnt-agent audit (verify | query) [flags]")
+	}
+
+	switch args[0] {
+	case "verify":
+		return auditVerifyCmd(args[1:])
+	case "query":
+		return auditQueryCmd(args[1:])
+	default:
+		return fmt.Errorf("unknown audit command: %s", args[0])
+	}
+}
+
+// auditVerifyCmd checks every signature and the hash chain across the
+// audit directory
+func auditVerifyCmd(args []string) error {
+	flags := flag.NewFlagSet("audit verify", flag.ExitOnError)
+	dir := flags.String("dir", audit.Dir(), "Audit log directory")
+	keyPath := flags.String("public-key", "", "File with the base64 Ed25519 public key (default: this agent's key)")
+	jsonOutput := flags.Bool("json", false, "Print the report as JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	publicKey, err := auditPublicKey(*keyPath)
+	if err != nil {
+		return err
+	}
+
+	report, err := audit.Verify(*dir, publicKey)
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Files:        %d\n", report.Files)
+		fmt.Printf("Entries:      %d (%d unchained)\n", report.Entries, report.Unchained)
+		if report.LastSeq > 0 {
+			fmt.Printf("Chain:        seq %d to %d\n", report.FirstSeq, report.LastSeq)
+		}
+		fmt.Printf("Checkpoints:  %d\n", report.Checkpoints)
+		fmt.Println()
+		if report.Break == nil {
+			fmt.Println("✓ Audit log intact")
+		} else {
+			fmt.Printf("✗ %s\n", report.Break.Error())
+		}
+
+		for _, archive := range report.Archives {
+			printArchive(archive)
+		}
+	}
+
+	if !report.Intact() {
+		return fmt.Errorf("audit log verification failed")
+	}
+	return nil
+}
+
+// printArchive prints the verification of an archived chain
+func printArchive(archive *audit.ArchiveReport) {
+	fmt.Println()
+	fmt.Printf("Archive %s\n", archive.Name)
+	fmt.Printf("  Entries:    %d", archive.Entries)
+	if archive.LastSeq > 0 {
+		fmt.Printf(", seq %d to %d", archive.FirstSeq, archive.LastSeq)
+	}
+	fmt.Println()
+	if !archive.SignaturesChecked {
+		key := "a previous key"
+		if archive.KeyID != "" {
+			key = "key " + archive.KeyID
+		}
+		fmt.Printf("  Signed by %s; only the chain links were checked.\n", key)
+		fmt.Println("  Verify signatures with --dir <archive> --public-key <previous key>.")
+	}
+	if archive.Break == nil {
+		fmt.Println("  ✓ intact")
+	} else {
+		fmt.Printf("  ✗ %s\n", archive.Break.Error())
+	}
+}
+
+// auditQueryCmd prints the entries matching the filters
+func auditQueryCmd(args []string) error {
+	flags := flag.NewFlagSet("audit query", flag.ExitOnError)
+	dir := flags.String("dir", audit.Dir(), "Audit log directory")
+	since := flags.String("since", "", "Entries at or after this time (RFC 3339, YYYY-MM-DD, or a duration such as 24h or 7d)")
+	until := flags.String("until", "", "Entries before this time (same formats as --since)")
+	events := flags.String("event", "", "Comma-separated event types, e.g. job_executed,policy_violation")
+	jobID := flags.String("job", "", "Job ID")
+	status := flags.String("status", "", "Status, e.g. success or failed")
+	limit := flags.Int("limit", 0, "Show only the newest N entries")
+	jsonOutput := flags.Bool("json", false, "Print entries as JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	q := &audit.Query{JobID: *jobID, Status: *status, Limit: *limit}
+	var err error
+	if *since != "" {
+		if q.Since, err = audit.ParseTime(*since, now); err != nil {
+			return fmt.Errorf("--since: %w", err)
+		}
+	}
+	if *until != "" {
+		if q.Until, err = audit.ParseTime(*until, now); err != nil {
+			return fmt.Errorf("--until: %w", err)
+		}
+	}
+	if *events != "" {
+		q.Events = strings.Split(*events, ",")
+	}
+
+	entries, err := audit.Search(*dir, q)
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		if entries == nil {
+			entries = []*audit.Entry{}
+		}
+		return printJSON(entries)
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No matching audit entries")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tSEQ\tEVENT\tJOB\tSTATUS\tCOMMAND")
+	for _, entry := range entries {
+		seq := "-"
+		if entry.Seq > 0 {
+			seq = fmt.Sprint(entry.Seq)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", localTime(entry.Timestamp), seq, entry.Event,
+			dash(entry.JobID), dash(entry.Status), dash(entry.Command))
+	}
+	return w.Flush()
+}
+
+// auditPublicKey reads the verification key from path, or derives it from
+// the agent's own key in the secure store
+func auditPublicKey(path string) (ed25519.PublicKey, error) {
+	if path == "" {
+		s, err := store.NewStore(config.GetCertsDir())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create store: %w", err)
+		}
+		keypair, err := enroll.LoadStoredKeyPair(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load agent key (run as root or pass --public-key): %w", err)
+		}
+		return keypair.PublicKey, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key size %d", len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// localTime shows an RFC 3339 timestamp in local time
+func localTime(timestamp string) string {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return timestamp
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
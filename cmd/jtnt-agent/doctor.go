@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/doctor"
+	"github.com/tshojoshua/jtnt-agent/internal/health"
+)
+
+// doctorCmd runs the self-diagnosis checks and prints remediation for
+// anything that is not passing
+func doctorCmd(args []string) error {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	jsonOutput := flags.Bool("json", false, "Print results as JSON")
+	timeout := flags.Duration("timeout", 10*time.Second, "Timeout for each network check")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	report := doctor.Run(context.Background(), doctor.Options{Timeout: *timeout})
+
+	if *jsonOutput {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		for _, result := range report.Results {
+			fmt.Printf("%s %-24s %s\n", statusMark(result.Status), result.Name, result.Message)
+			for _, detail := range result.Details {
+				fmt.Printf("      %s\n", detail)
+			}
+			if result.Remediation != "" {
+				fmt.Printf("      → %s\n", result.Remediation)
+			}
+		}
+
+		fmt.Println()
+		fmt.Printf("%d checks: %d failed, %d %s\n", len(report.Results), report.Failed,
+			report.Warned, plural(report.Warned, "warning", "warnings"))
+	}
+
+	if report.Failed > 0 {
+		return fmt.Errorf("%d %s failed", report.Failed, plural(report.Failed, "check", "checks"))
+	}
+	return nil
+}
+
+func statusMark(status health.Status) string {
+	switch status {
+	case health.StatusPass:
+		return "✓"
+	case health.StatusWarn:
+		return "!"
+	default:
+		return "✗"
+	}
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/control"
+)
+
+// logLevelCmd shows the daemon's log settings or, given a level, changes
+// the level until the daemon's next reload or restart
+func logLevelCmd(args []string) error {
+	flags := flag.NewFlagSet("log-level", flag.ExitOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		return fmt.Errorf("usage: jtnt-agent log-level [debug|info|warn|error]")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), daemonQueryTimeout)
+	defer cancel()
+
+	client := control.NewClient(config.GetRuntimeDir())
+
+	if flags.NArg() == 1 {
+		level := flags.Arg(0)
+		if err := client.SetLogLevel(ctx, level); err != nil {
+			if errors.Is(err, control.ErrPermissionDenied) {
+				return fmt.Errorf("changing the log level requires root or the agent's service account")
+			}
+			return err
+		}
+		fmt.Printf("Log level set to %s until the agent is reloaded or restarted\n", level)
+		return nil
+	}
+
+	info, err := client.Logging(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Level:    %s\n", info.Level)
+	fmt.Printf("Outputs:  %s\n", strings.Join(info.Outputs, ", "))
+	if info.File != "" {
+		fmt.Printf("Log File: %s\n", info.File)
+	}
+	return nil
+}
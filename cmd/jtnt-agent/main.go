@@ -29,8 +29,18 @@ func main() {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
+	case "unenroll":
+		if err := unenrollCmd(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "reenroll":
+		if err := reenrollCmd(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 	case "status":
-		if err := statusCmd(); err != nil {
+		if err := statusCmd(os.Args[2:]); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -41,6 +51,31 @@ func main() {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
+	case "doctor":
+		if err := doctorCmd(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "support-bundle":
+		if err := supportBundleCmd(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "audit":
+		if err := auditCmd(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "policy":
+		if err := policyCmd(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "log-level":
+		if err := logLevelCmd(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
 		printUsage()
@@ -52,35 +87,62 @@ func printUsage() {
 	fmt.Println("JTNT Agent CLI")
 	fmt.Println()
 	fmt.Println("Usage:")
-	fmt.Println("  jtnt-agent enroll --token <TOKEN> --hub <URL>")
-	fmt.Println("  jtnt-agent status")
+	fmt.Println("  jtnt-agent enroll --token-file <FILE|-> --hub <URL> [--defer]")
+	fmt.Println("  jtnt-agent unenroll [--force] [--yes] [--reason <TEXT>]")
+	fmt.Println("  jtnt-agent reenroll --token-file <FILE|-> --hub <URL> [--keep-id] [--force] [--yes]")
+	fmt.Println("  jtnt-agent status [--json]")
 	fmt.Println("  jtnt-agent version")
 	fmt.Println("  jtnt-agent test-connection")
+	fmt.Println("  jtnt-agent doctor [--json] [--timeout <DURATION>]")
+	fmt.Println("  jtnt-agent support-bundle [--output <FILE>] [--upload] [--json]")
+	fmt.Println("  jtnt-agent audit verify [--dir <DIR>] [--public-key <FILE>] [--json]")
+	fmt.Println("  jtnt-agent audit query [--since <TIME>] [--until <TIME>] [--event <TYPES>] [--job <ID>] [--status <STATUS>] [--limit <N>] [--json]")
+	fmt.Println("  jtnt-agent policy show [--json]")
+	fmt.Println("  jtnt-agent policy test --policy <FILE> --job <FILE> [--json]")
+	fmt.Println("  jtnt-agent policy test --policy <FILE> --jobs <DIR> [--json]")
+	fmt.Println("  jtnt-agent log-level [debug|info|warn|error]")
 	fmt.Println()
 	fmt.Println("Commands:")
 	fmt.Println("  enroll            Enroll agent with hub")
+	fmt.Println("  unenroll          Remove agent from its hub and wipe credentials")
+	fmt.Println("  reenroll          Move agent to a hub, keeping the audit trail")
 	fmt.Println("  status            Show agent status")
 	fmt.Println("  version           Show agent version")
 	fmt.Println("  test-connection   Test connection to hub")
+	fmt.Println("  doctor            Diagnose common problems and suggest fixes")
+	fmt.Println("  support-bundle    Collect a redacted support bundle for escalations")
+	fmt.Println("  audit verify      Check audit log signatures and hash chain")
+	fmt.Println("  audit query       Search the audit log")
+	fmt.Println("  policy show       Show the effective merged policy")
+	fmt.Println("  policy test       Check jobs against a policy without running them")
+	fmt.Println("  log-level         Show or change the running agent's log level")
 }
 
 func enrollCmd() error {
 	fs := flag.NewFlagSet("enroll", flag.ExitOnError)
-	token := fs.String("token", "", "Enrollment token")
-	hub := fs.String("hub", "", "Hub URL")
+	enrollment := addEnrollmentFlags(fs)
+	deferred := fs.Bool("defer", false, "Write an enrollment seed for the daemon to use on its next start instead of enrolling now")
 
 	if err := fs.Parse(os.Args[2:]); err != nil {
 		return err
 	}
 
-	if *token == "" {
-		return fmt.Errorf("--token is required")
+	hub, token, err := enrollment.resolve()
+	if err != nil {
+		return err
 	}
-	if *hub == "" {
-		return fmt.Errorf("--hub is required")
+
+	if *deferred {
+		seedPath := config.GetEnrollSeedPath()
+		if err := writeSeed(seedPath, hub, token); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Enrollment seed written to %s\n", seedPath)
+		fmt.Println("  The agent enrolls itself with", hub, "when the service next starts")
+		return nil
 	}
 
-	fmt.Printf("Enrolling agent with hub: %s\n", *hub)
+	fmt.Printf("Enrolling agent with hub: %s\n", hub)
 
 	// Create store
 	s, err := store.NewStore(config.GetCertsDir())
@@ -89,16 +151,19 @@ func enrollCmd() error {
 	}
 
 	// Create enroller
-	enroller := enroll.NewEnroller(*hub, s)
+	enroller := enroll.NewEnroller(hub, s)
 
 	// Enroll
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	cfg, err := enroller.Enroll(ctx, *token)
+	cfg, err := enroller.Enroll(ctx, token)
 	if err != nil {
 		return fmt.Errorf("enrollment failed: %w", err)
 	}
+	if err := enroll.RecordEnrollment(s, cfg, enroll.MethodToken); err != nil {
+		fmt.Printf("! %v\n", err)
+	}
 
 	fmt.Println("✓ Enrollment successful!")
 	fmt.Printf("  Agent ID: %s\n", cfg.AgentID)
@@ -112,34 +177,6 @@ func enrollCmd() error {
 	return nil
 }
 
-func statusCmd() error {
-	// Check if enrolled
-	configPath := config.GetConfigPath()
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		fmt.Println("Agent is not enrolled")
-		fmt.Println()
-		fmt.Println("Enroll with:")
-		fmt.Println("  jtnt-agent enroll --token <TOKEN> --hub <URL>")
-		return nil
-	}
-
-	// Load config
-	cfg, err := config.Load(configPath)
-	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
-	}
-
-	fmt.Println("Agent Status:")
-	fmt.Printf("  Agent ID:         %s\n", cfg.AgentID)
-	fmt.Printf("  Hub URL:          %s\n", cfg.HubURL)
-	fmt.Printf("  Heartbeat:        %ds\n", cfg.HeartbeatSec)
-	fmt.Printf("  Poll Interval:    %ds\n", cfg.PollIntervalSec)
-	fmt.Printf("  Config File:      %s\n", configPath)
-	fmt.Printf("  Token:            %s\n", maskToken(cfg.AgentToken))
-
-	return nil
-}
-
 func maskToken(token string) string {
 	if len(token) <= 8 {
 		return "****"
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/jobs"
+	"github.com/tshojoshua/jtnt-agent/internal/policy"
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+// policyTestResult is one job's simulated outcome
+type policyTestResult struct {
+	File     string           `json:"file"`
+	JobID    string           `json:"job_id,omitempty"`
+	Type     api.JobType      `json:"type,omitempty"`
+	Decision *policy.Decision `json:"decision"`
+}
+
+func policyCmd() error {
+	if len(os.Args) < 3 {
+		return fmt.Errorf("usage: jtnt-agent policy (show | test) [flags]")
+	}
+
+	switch os.Args[2] {
+	case "test":
+		return policyTestCmd(os.Args[3:])
+	case "show":
+		return policyShowCmd(os.Args[3:])
+	default:
+		return fmt.Errorf("unknown policy command: %s", os.Args[2])
+	}
+}
+
+// policyTestCmd evaluates jobs against a policy file without executing them
+func policyTestCmd(args []string) error {
+	fs := flag.NewFlagSet("policy test", flag.ExitOnError)
+	policyPath := fs.String("policy", "", "Policy JSON file")
+	jobPath := fs.String("job", "", "Job JSON file")
+	jobsDir := fs.String("jobs", "", "Directory of job JSON files")
+	jsonOutput := fs.Bool("json", false, "Print results as JSON")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *policyPath == "" {
+		return fmt.Errorf("--policy is required")
+	}
+	if (*jobPath == "") == (*jobsDir == "") {
+		return fmt.Errorf("exactly one of --job or --jobs is required")
+	}
+
+	data, err := os.ReadFile(*policyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read policy: %w", err)
+	}
+
+	pol, err := policy.Load(data)
+	if err != nil {
+		return err
+	}
+
+	enforcer, err := policy.NewEnforcer(pol)
+	if err != nil {
+		return fmt.Errorf("invalid policy: %w", err)
+	}
+
+	files := []string{*jobPath}
+	if *jobsDir != "" {
+		files, err = filepath.Glob(filepath.Join(*jobsDir, "*.json"))
+		if err != nil {
+			return fmt.Errorf("failed to list jobs: %w", err)
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("no job files found in %s", *jobsDir)
+		}
+		sort.Strings(files)
+	}
+
+	var results []policyTestResult
+	for _, file := range files {
+		results = append(results, evaluateJobFile(enforcer, file))
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+
+	fmt.Printf("Policy version %d (expires %s)\n", pol.Version, pol.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"))
+	fmt.Println()
+
+	denied := 0
+	for _, r := range results {
+		verdict := "ALLOW"
+		if !r.Decision.Allowed {
+			verdict = "DENY"
+			denied++
+		}
+
+		name := r.JobID
+		if name == "" {
+			name = filepath.Base(r.File)
+		}
+
+		if r.Type != "" {
+			name = fmt.Sprintf("%s (%s)", name, r.Type)
+		}
+
+		fmt.Printf("%-5s  %s\n", verdict, name)
+		if r.Decision.Rule != "" {
+			fmt.Printf("       rule:   %s\n", r.Decision.Rule)
+		}
+		fmt.Printf("       reason: %s\n", r.Decision.Reason)
+	}
+
+	fmt.Println()
+	fmt.Printf("%d allowed, %d denied\n", len(results)-denied, denied)
+
+	return nil
+}
+
+// evaluateJobFile loads a job from file and runs the executor's policy checks
+func evaluateJobFile(enforcer *policy.Enforcer, file string) policyTestResult {
+	result := policyTestResult{File: file}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		result.Decision = policy.Deny(fmt.Errorf("failed to read job: %w", err))
+		return result
+	}
+
+	var job api.Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		result.Decision = policy.Deny(fmt.Errorf("failed to parse job: %w", err))
+		return result
+	}
+
+	result.JobID = job.JobID
+	result.Type = job.Type
+	result.Decision = jobs.Evaluate(enforcer, &job)
+	return result
+}
+
+// policyShowCmd prints the effective policy merged from the installed layers
+func policyShowCmd(args []string) error {
+	fs := flag.NewFlagSet("policy show", flag.ExitOnError)
+	dir := fs.String("dir", config.GetPolicyDir(), "Directory of policy layers")
+	keyPath := fs.String("key", config.GetPolicyKeyPath(), "Policy signing public key")
+	jsonOutput := fs.Bool("json", false, "Print the merged result as JSON")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var publicKey []byte
+	if data, err := os.ReadFile(*keyPath); err == nil {
+		publicKey, err = policy.LoadPublicKey(data)
+		if err != nil {
+			return fmt.Errorf("invalid policy signing key: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read policy signing key: %w", err)
+	}
+
+	merged, err := policy.LoadEffective(*dir, publicKey)
+	if err != nil {
+		return err
+	}
+	if merged == nil {
+		fmt.Printf("No policy layers in %s; the agent uses its built-in default policy\n", *dir)
+		return nil
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(merged)
+	}
+
+	fmt.Println("Policy Layers:")
+	for _, layer := range merged.Layers {
+		fmt.Printf("  %-20s version %d, expires %s\n", layer.Name, layer.Version,
+			layer.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"))
+	}
+
+	if len(merged.Ignored) > 0 {
+		fmt.Println()
+		fmt.Println("Ignored (not extendable in parent layer):")
+		for _, entry := range merged.Ignored {
+			fmt.Printf("  %s\n", entry)
+		}
+	}
+
+	data, err := merged.Policy.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println("Effective Policy:")
+	fmt.Println(string(data))
+
+	return nil
+}
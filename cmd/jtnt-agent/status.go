@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/agent"
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/control"
+	"github.com/tshojoshua/jtnt-agent/internal/health"
+	"github.com/tshojoshua/jtnt-agent/internal/jobs"
+	"github.com/tshojoshua/jtnt-agent/internal/policy"
+)
+
+const daemonQueryTimeout = 3 * time.Second
+
+// statusReport is the output of the status command. The embedded fields
+// agent_id, status, enrolled, last_heartbeat and hub_url match the tray
+// app's AgentStatus.
+type statusReport struct {
+	control.Status
+	DaemonRunning   bool          `json:"daemon_running"`
+	HubConnection   *health.Check `json:"hub_connection,omitempty"`
+	CertExpiresAt   *time.Time    `json:"cert_expires_at,omitempty"`
+	PolicyVersion   int           `json:"policy_version,omitempty"`
+	PolicyExpiresAt *time.Time    `json:"policy_expires_at,omitempty"`
+	HeartbeatSec    int           `json:"heartbeat_sec,omitempty"`
+	PollIntervalSec int           `json:"poll_interval_sec,omitempty"`
+	Warnings        []string      `json:"warnings,omitempty"` // State that could not be read
+}
+
+func statusCmd(args []string) error {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	jsonOutput := flags.Bool("json", false, "Print status as JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	report := &statusReport{}
+
+	// Any local user may query the daemon, so ask it before touching the
+	// root-only config and store
+	ctx, cancel := context.WithTimeout(context.Background(), daemonQueryTimeout)
+	defer cancel()
+	daemonErr := daemonStatus(ctx, report)
+
+	configPath := config.GetConfigPath()
+	cfg, err := loadStatusConfig(configPath)
+	if daemonErr != nil && errors.Is(err, fs.ErrNotExist) {
+		if *jsonOutput {
+			return printJSON(&statusReport{Status: control.Status{Status: "not_enrolled"}})
+		}
+		fmt.Println("Agent is not enrolled")
+		fmt.Println()
+		fmt.Println("Enroll with:")
+		fmt.Println("  jtnt-agent enroll --token <TOKEN> --hub <URL>")
+		return nil
+	}
+	if err != nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("config: %v", err))
+	}
+	if cfg != nil {
+		report.HeartbeatSec = cfg.HeartbeatSec
+		report.PollIntervalSec = cfg.PollIntervalSec
+	}
+
+	// Fall back to what is on disk when the daemon is not reachable
+	if daemonErr != nil {
+		diskStatus(cfg, err == nil, report)
+	}
+
+	if expiry, err := health.CertificateExpiry(config.GetCertPath()); err == nil {
+		report.CertExpiresAt = &expiry
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("certificate: %v", err))
+	}
+
+	if *jsonOutput {
+		return printJSON(report)
+	}
+
+	fmt.Println("Agent Status:")
+	fmt.Printf("  Agent ID:         %s\n", report.AgentID)
+	fmt.Printf("  Hub URL:          %s\n", report.HubURL)
+	fmt.Printf("  Enrolled:         %s\n", yesNo(report.Enrolled))
+	if report.DaemonRunning {
+		fmt.Printf("  Daemon:           %s (version %s, up %s)\n", report.Status.Status, report.Version,
+			time.Since(report.StartedAt).Round(time.Second))
+	} else {
+		fmt.Printf("  Daemon:           not running\n")
+	}
+	fmt.Printf("  Last Heartbeat:   %s\n", formatSince(report.LastHeartbeat))
+	if report.HubConnection != nil {
+		fmt.Printf("  Hub Connection:   %s (%s)\n", report.HubConnection.Status, report.HubConnection.Message)
+	} else {
+		fmt.Printf("  Hub Connection:   unknown\n")
+	}
+	fmt.Printf("  Certificate:      %s\n", formatExpiry(report.CertExpiresAt))
+	if report.PolicyExpiresAt != nil {
+		fmt.Printf("  Policy:           version %d, %s\n", report.PolicyVersion, formatExpiry(report.PolicyExpiresAt))
+	} else {
+		fmt.Printf("  Policy:           built-in default\n")
+	}
+	if job := report.CurrentJob; job != nil {
+		// The command is only shown to privileged callers
+		kind := string(job.Type)
+		if job.Summary != "" {
+			kind += ": " + job.Summary
+		}
+		fmt.Printf("  Current Job:      %s (%s, running %s)\n", job.JobID, kind,
+			time.Since(job.StartedAt).Round(time.Second))
+	} else {
+		fmt.Printf("  Current Job:      none\n")
+	}
+	fmt.Printf("  Pending Results:  %d\n", report.PendingResults)
+	fmt.Printf("  Scheduled Jobs:   %d\n", report.ScheduledJobs)
+	if cfg != nil {
+		fmt.Printf("  Heartbeat:        %ds\n", cfg.HeartbeatSec)
+		fmt.Printf("  Poll Interval:    %ds\n", cfg.PollIntervalSec)
+	}
+	fmt.Printf("  Config File:      %s\n", configPath)
+	if cfg != nil && cfg.AgentToken != "" {
+		fmt.Printf("  Token:            %s\n", maskToken(cfg.AgentToken))
+	}
+
+	for _, warning := range report.Warnings {
+		fmt.Printf("  Warning:          %s\n", warning)
+	}
+
+	return nil
+}
+
+// daemonStatus fills report from the running daemon's control API
+func daemonStatus(ctx context.Context, report *statusReport) error {
+	client := control.NewClient(config.GetRuntimeDir())
+
+	status, err := client.Status(ctx)
+	if err != nil {
+		return err
+	}
+	report.Status = *status
+	report.DaemonRunning = true
+
+	if healthReport, err := client.Health(ctx); err == nil {
+		report.HubConnection = healthReport.Checks["hub_connection"]
+	} else {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("health: %v", err))
+	}
+
+	if summary, err := client.Policy(ctx); err == nil {
+		report.PolicyVersion = summary.Version
+		report.PolicyExpiresAt = &summary.ExpiresAt
+	} else {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("policy: %v", err))
+	}
+
+	return nil
+}
+
+// loadStatusConfig loads the agent config for display. When the secure
+// store holding the token cannot be read the config file alone is parsed,
+// so callers without access to the store still see its other fields; the
+// returned error then describes what was missed.
+func loadStatusConfig(path string) (*config.Config, error) {
+	cfg, err := config.Load(path)
+	if err == nil {
+		return cfg, nil
+	}
+
+	data, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return nil, err
+	}
+	var partial config.Config
+	if json.Unmarshal(data, &partial) != nil {
+		return nil, err
+	}
+	return &partial, err
+}
+
+// diskStatus fills report from the config and state directories when the
+// daemon is not reachable. cfg is nil when the config could not be read and
+// complete is false when it was read without the token in the secure store.
+func diskStatus(cfg *config.Config, complete bool, report *statusReport) {
+	report.Status.Status = "stopped"
+	if cfg != nil {
+		report.AgentID = cfg.AgentID
+		report.HubURL = cfg.HubURL
+		if complete {
+			report.Enrolled = health.CheckEnrolled(cfg).Status == health.StatusPass
+		} else {
+			// The token cannot be checked; an agent ID means enrollment ran
+			report.Enrolled = cfg.AgentID != ""
+		}
+	}
+
+	if count, err := agent.CountCachedResults(); err == nil {
+		report.PendingResults = count
+	} else {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("cached results: %v", err))
+	}
+
+	if _, err := os.Stat(agent.ScheduledJobsDir()); err == nil {
+		if queue, err := jobs.NewScheduleQueue(agent.ScheduledJobsDir()); err == nil {
+			if scheduled, err := queue.List(); err == nil {
+				report.ScheduledJobs = len(scheduled)
+			} else {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("scheduled jobs: %v", err))
+			}
+		}
+	}
+
+	var publicKey []byte
+	if data, err := os.ReadFile(config.GetPolicyKeyPath()); err == nil {
+		publicKey, _ = policy.LoadPublicKey(data)
+	}
+	merged, err := policy.LoadEffective(config.GetPolicyDir(), publicKey)
+	if err != nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("policy: %v", err))
+	}
+	if merged != nil {
+		report.PolicyVersion = merged.Policy.Version
+		report.PolicyExpiresAt = &merged.Policy.ExpiresAt
+	}
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func formatSince(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return fmt.Sprintf("%s (%s ago)", t.Format(time.RFC3339), time.Since(t).Round(time.Second))
+}
+
+func formatExpiry(t *time.Time) string {
+	if t == nil {
+		return "unknown"
+	}
+	days := int(time.Until(*t).Hours() / 24)
+	if days < 0 {
+		return fmt.Sprintf("EXPIRED %s", t.Format("2006-01-02"))
+	}
+	return fmt.Sprintf("expires %s (%d days)", t.Format("2006-01-02"), days)
+}
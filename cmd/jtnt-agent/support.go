@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/agent"
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/control"
+	"github.com/tshojoshua/jtnt-agent/internal/health"
+	"github.com/tshojoshua/jtnt-agent/internal/jobs"
+	"github.com/tshojoshua/jtnt-agent/internal/support"
+	"github.com/tshojoshua/jtnt-agent/internal/transport"
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+const supportUploadTimeout = 5 * time.Minute
+
+// supportBundleResult is the output of support-bundle --json
+type supportBundleResult struct {
+	Path     string            `json:"path"`
+	Manifest *support.Manifest `json:"manifest"`
+	Artifact *api.ArtifactInfo `json:"artifact,omitempty"`
+}
+
+// supportBundleCmd writes a redacted support bundle and optionally uploads
+// it to the hub
+func supportBundleCmd(args []string) error {
+	flags := flag.NewFlagSet("support-bundle", flag.ExitOnError)
+	output := flags.String("output", "", "Bundle path (default: jtnt-support-<agent>-<time>.zip in the current directory)")
+	upload := flags.Bool("upload", false, "Upload the bundle to the hub as an artifact")
+	jsonOutput := flags.Bool("json", false, "Print the result as JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// The bundle is still useful before enrollment
+	cfg, err := config.Load(config.GetConfigPath())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if *upload && cfg == nil {
+		return fmt.Errorf("agent is not enrolled; cannot upload")
+	}
+
+	agentID := ""
+	if cfg != nil {
+		agentID = cfg.AgentID
+	}
+
+	now := time.Now()
+	path := *output
+	if path == "" {
+		path = support.FileName(agentID, now)
+	}
+
+	manifest, err := support.WriteFile(context.Background(), path, support.Options{
+		Version:        version,
+		ResultCacheDir: agent.ResultCacheDir(),
+		Health:         daemonHealth,
+	})
+	if err != nil {
+		return err
+	}
+
+	result := &supportBundleResult{Path: path, Manifest: manifest}
+
+	if *upload {
+		artifact, err := uploadBundle(cfg, path)
+		if err != nil {
+			return fmt.Errorf("bundle written to %s but upload failed: %w", path, err)
+		}
+		result.Artifact = artifact
+	}
+
+	if *jsonOutput {
+		return printJSON(result)
+	}
+
+	fmt.Printf("Support bundle written to %s\n", path)
+	fmt.Println()
+	for _, name := range manifest.Files {
+		fmt.Printf("  %s\n", name)
+	}
+	if len(manifest.Errors) > 0 {
+		fmt.Println()
+		fmt.Println("Not collected:")
+		for _, missing := range manifest.Errors {
+			fmt.Printf("  %s\n", missing)
+		}
+	}
+	if result.Artifact != nil {
+		fmt.Println()
+		fmt.Printf("Uploaded as artifact %s (%d bytes, sha256 %s)\n",
+			result.Artifact.Name, result.Artifact.Size, result.Artifact.SHA256)
+	}
+
+	return nil
+}
+
+// daemonHealth asks the running daemon for its health report; the bundle
+// notes its absence when the daemon is down
+func daemonHealth(ctx context.Context) (*health.Report, error) {
+	ctx, cancel := context.WithTimeout(ctx, daemonQueryTimeout)
+	defer cancel()
+
+	report, err := control.NewClient(config.GetRuntimeDir()).Health(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &report.Report, nil
+}
+
+func uploadBundle(cfg *config.Config, path string) (*api.ArtifactInfo, error) {
+	client, err := transport.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), supportUploadTimeout)
+	defer cancel()
+
+	// Bundles requested locally are not tied to a hub job
+	jobID := fmt.Sprintf("support-%s-%d", cfg.AgentID, time.Now().Unix())
+	return jobs.UploadArtifact(ctx, client, jobID, filepath.Base(path), file)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Environment variables read when the flags are not given
+const (
+	envEnrollToken = "JTNT_ENROLL_TOKEN"
+	envHubURL      = "JTNT_HUB_URL"
+)
+
+// enrollmentFlags are the hub and token flags shared by enroll and reenroll
+type enrollmentFlags struct {
+	token     *string
+	tokenFile *string
+	hub       *string
+}
+
+func addEnrollmentFlags(flags *flag.FlagSet) *enrollmentFlags {
+	return &enrollmentFlags{
+		token:     flags.String("token", "", "Enrollment token (visible in process listings; prefer --token-file)"),
+		tokenFile: flags.String("token-file", "", "Read the enrollment token from a file, or - for stdin"),
+		hub:       flags.String("hub", "", "Hub URL (default $"+envHubURL+")"),
+	}
+}
+
+// resolve returns the hub URL and token from the flags, falling back to
+// the environment
+func (f *enrollmentFlags) resolve() (string, string, error) {
+	hub := *f.hub
+	if hub == "" {
+		hub = os.Getenv(envHubURL)
+	}
+	if hub == "" {
+		return "", "", fmt.Errorf("--hub is required")
+	}
+
+	var token string
+	switch {
+	case *f.token != "" && *f.tokenFile != "":
+		return "", "", fmt.Errorf("--token and --token-file are mutually exclusive")
+	case *f.token != "":
+		token = *f.token
+	case *f.tokenFile != "":
+		var err error
+		token, err = readToken(*f.tokenFile)
+		if err != nil {
+			return "", "", err
+		}
+	default:
+		token = strings.TrimSpace(os.Getenv(envEnrollToken))
+	}
+	if token == "" {
+		return "", "", fmt.Errorf("an enrollment token is required: use --token-file, $%s or --token", envEnrollToken)
+	}
+
+	return hub, token, nil
+}
+
+func readToken(path string) (string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(io.LimitReader(os.Stdin, 64*1024))
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read token: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if strings.ContainsAny(token, "\r\n") {
+		return "", fmt.Errorf("token file must contain a single line")
+	}
+	return token, nil
+}
+
+// writeSeed leaves a deferred enrollment seed for the daemon to consume on
+// its next start
+func writeSeed(path, hub, token string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create seed: %w", err)
+	}
+
+	_, err = fmt.Fprintf(file, "hub_url=%s\ntoken=%s\n", hub, token)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to write seed: %w", err)
+	}
+	return nil
+}
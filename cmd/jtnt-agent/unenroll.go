@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/agent"
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/enroll"
+	"github.com/tshojoshua/jtnt-agent/internal/service"
+	"github.com/tshojoshua/jtnt-agent/internal/store"
+	"github.com/tshojoshua/jtnt-agent/internal/transport"
+)
+
+const hubNotifyTimeout = 30 * time.Second
+
+// unenrollCmd removes the agent from its hub and wipes its credentials
+func unenrollCmd(args []string) error {
+	flags := flag.NewFlagSet("unenroll", flag.ExitOnError)
+	force := flags.Bool("force", false, "Wipe locally even if the hub cannot be notified")
+	yes := flags.Bool("yes", false, "Do not ask for confirmation")
+	reason := flags.String("reason", "", "Reason recorded by the hub")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadEnrolledConfig(*force)
+	if err != nil {
+		return err
+	}
+
+	if cfg != nil {
+		fmt.Printf("This removes agent %s from %s and deletes its token, keys,\n", cfg.AgentID, cfg.HubURL)
+	} else {
+		fmt.Println("This deletes the agent's token, keys,")
+	}
+	fmt.Println("certificates, policy and cached results. The audit trail and logs are kept.")
+	if !*yes && !confirm("Unenroll this agent?") {
+		return fmt.Errorf("aborted")
+	}
+
+	if cfg != nil {
+		if err := notifyHub(cfg, *reason, *force); err != nil {
+			return err
+		}
+	}
+
+	if err := service.Stop(); err != nil {
+		fmt.Printf("! Could not stop %s: %v\n", service.Name(), err)
+	} else {
+		fmt.Printf("✓ Stopped %s\n", service.Name())
+	}
+
+	if err := wipeEnrollment(false); err != nil {
+		return err
+	}
+
+	fmt.Println("✓ Agent unenrolled")
+	fmt.Println()
+	fmt.Println("Enroll again with:")
+	fmt.Println("  jtnt-agent enroll --token-file <FILE> --hub <URL>")
+	return nil
+}
+
+// reenrollCmd moves the agent to a hub, optionally keeping its agent ID
+func reenrollCmd(args []string) error {
+	flags := flag.NewFlagSet("reenroll", flag.ExitOnError)
+	enrollment := addEnrollmentFlags(flags)
+	keepID := flags.Bool("keep-id", false, "Ask the hub to keep the current agent ID and key")
+	force := flags.Bool("force", false, "Continue even if the current hub cannot be notified")
+	yes := flags.Bool("yes", false, "Do not ask for confirmation")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	hub, token, err := enrollment.resolve()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadEnrolledConfig(*force)
+	if err != nil {
+		return err
+	}
+
+	var keypair *enroll.KeyPair
+	if *keepID {
+		if cfg == nil {
+			return fmt.Errorf("--keep-id needs the current config; it is missing or unreadable")
+		}
+
+		// Nothing may be written before the user confirms
+		opts := cfg.StoreOptions()
+		opts.ReadOnly = true
+		current, err := store.NewStoreWithOptions(config.GetCertsDir(), opts)
+		if err != nil {
+			return fmt.Errorf("failed to open store: %w", err)
+		}
+		keypair, err = enroll.LoadStoredKeyPair(current)
+		if err != nil {
+			return fmt.Errorf("no stored agent key to keep (agents enrolled before this version have none); re-enroll without --keep-id: %w", err)
+		}
+	}
+
+	if cfg != nil {
+		fmt.Printf("This moves agent %s from %s to %s.\n", cfg.AgentID, cfg.HubURL, hub)
+	} else {
+		fmt.Printf("This enrolls the agent with %s.\n", hub)
+	}
+	fmt.Println("Certificates, policy and cached results for the current hub are deleted.")
+	fmt.Println("The audit trail and logs are kept.")
+	if !*yes && !confirm("Re-enroll this agent?") {
+		return fmt.Errorf("aborted")
+	}
+
+	if cfg != nil {
+		if err := notifyHub(cfg, "reenroll", *force); err != nil {
+			return err
+		}
+	}
+
+	if err := service.Stop(); err != nil {
+		fmt.Printf("! Could not stop %s: %v\n", service.Name(), err)
+	}
+
+	if err := wipeEnrollment(*keepID); err != nil {
+		return err
+	}
+
+	s, err := store.NewStore(config.GetCertsDir())
+	if err != nil {
+		return fmt.Errorf("failed to create store: %w", err)
+	}
+
+	enroller := enroll.NewEnroller(hub, s)
+	if keypair != nil {
+		enroller.KeepIdentity(cfg.AgentID, keypair)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	newCfg, err := enroller.Enroll(ctx, token)
+	if err != nil {
+		return fmt.Errorf("enrollment failed; the agent is now unenrolled, retry with jtnt-agent enroll: %w", err)
+	}
+	if err := enroll.RecordEnrollment(s, newCfg, enroll.MethodReenroll); err != nil {
+		fmt.Printf("! %v\n", err)
+	}
+
+	fmt.Println("✓ Re-enrollment successful!")
+	fmt.Printf("  Agent ID: %s\n", newCfg.AgentID)
+	fmt.Printf("  Hub URL:  %s\n", newCfg.HubURL)
+	if keypair != nil && newCfg.AgentID != cfg.AgentID {
+		fmt.Printf("! The hub assigned a new agent ID (previously %s)\n", cfg.AgentID)
+	}
+
+	if err := service.Start(); err != nil {
+		fmt.Printf("! Could not start %s: %v\n", service.Name(), err)
+		fmt.Println("  Start it manually: sudo jtnt-agentd")
+	} else {
+		fmt.Printf("✓ Started %s\n", service.Name())
+	}
+
+	return nil
+}
+
+// loadEnrolledConfig returns the current config. With force a missing or
+// unreadable config is tolerated and nil is returned.
+func loadEnrolledConfig(force bool) (*config.Config, error) {
+	cfg, err := config.Load(config.GetConfigPath())
+	if err == nil {
+		return cfg, nil
+	}
+	if force {
+		fmt.Printf("! %v; continuing\n", err)
+		return nil, nil
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("agent is not enrolled")
+	}
+	return nil, fmt.Errorf("failed to load config (use --force to wipe anyway): %w", err)
+}
+
+// notifyHub tells the current hub the agent is leaving. Without force a
+// failure stops the command before anything is changed.
+func notifyHub(cfg *config.Config, reason string, force bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hubNotifyTimeout)
+	defer cancel()
+
+	client, err := transport.NewClient(cfg)
+	if err == nil {
+		err = enroll.Notify(ctx, client, cfg.AgentID, reason)
+	}
+	if err != nil {
+		if !force {
+			return fmt.Errorf("%w (use --force to continue offline; the hub will still list the agent)", err)
+		}
+		fmt.Printf("! Hub not notified: %v\n", err)
+		return nil
+	}
+
+	fmt.Printf("✓ Hub %s notified\n", cfg.HubURL)
+	return nil
+}
+
+func wipeEnrollment(keepKey bool) error {
+	removed, err := enroll.Wipe(enroll.WipeOptions{
+		KeepKey:          keepKey,
+		ResultCacheDir:   agent.ResultCacheDir(),
+		ScheduledJobsDir: agent.ScheduledJobsDir(),
+	})
+	for _, path := range removed {
+		fmt.Printf("  removed %s\n", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to wipe enrollment: %w", err)
+	}
+	return nil
+}
+
+// confirm asks a yes/no question on the terminal, defaulting to no
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Println()
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
@@ -3,16 +3,38 @@ package agent
 import (
 	"context"
 	"fmt"
+	"net"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/tshojoshua/jtnt-agent/internal/audit"
 	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/consent"
+	"github.com/tshojoshua/jtnt-agent/internal/control"
+	"github.com/tshojoshua/jtnt-agent/internal/enroll"
+	"github.com/tshojoshua/jtnt-agent/internal/health"
+	"github.com/tshojoshua/jtnt-agent/internal/ipc"
 	"github.com/tshojoshua/jtnt-agent/internal/jobs"
+	"github.com/tshojoshua/jtnt-agent/internal/metrics"
 	"github.com/tshojoshua/jtnt-agent/internal/policy"
+	"github.com/tshojoshua/jtnt-agent/internal/sandbox"
+	"github.com/tshojoshua/jtnt-agent/internal/siem"
 	"github.com/tshojoshua/jtnt-agent/internal/store"
+	"github.com/tshojoshua/jtnt-agent/internal/support"
 	"github.com/tshojoshua/jtnt-agent/internal/sysinfo"
 	"github.com/tshojoshua/jtnt-agent/internal/transport"
 )
 
+const (
+	// Version is the agent version reported in health checks
+	Version = "1.0.0"
+
+	// scheduledJobsDir holds jobs deferred by maintenance windows
+	scheduledJobsDir = "jobs_scheduled"
+)
+
 // Agent is the main agent orchestrator
 type Agent struct {
 	config            *config.Config
@@ -28,8 +50,26 @@ type Agent struct {
 	mu                sync.RWMutex
 	currentJob        context.Context
 	jobPollingStopped bool
-	metricsServer     *MetricsServer
-	healthServer      *MetricsServer
+	metrics           *metrics.Metrics
+	metricsServer     *metrics.Server
+	auditLog          *audit.Logger
+	auditClose        sync.Once
+	auditForwarder    *audit.Forwarder
+	siem              *siem.Exporter
+	syslogConnected   atomic.Bool
+	healthServer      *health.Server
+	health            *health.Checker
+	policy            *policy.Merged
+	consentServer     *consent.Server
+	consentListener   net.Listener
+	controlServer     *control.Server
+	controlListener   net.Listener
+	startedAt         time.Time
+	heartbeat         control.HeartbeatInfo
+	activeJob         *control.JobInfo
+	pollNow           chan struct{}
+	cloned            *enroll.IdentityStatus // Set when running on a cloned machine
+	encryptionKey     string                 // X25519 public key job secrets are encrypted to
 }
 
 // New creates a new agent instance
@@ -46,7 +86,7 @@ func New(cfg *config.Config) (*Agent, error) {
 	}
 
 	// Create store
-	store, err := store.NewStore(config.GetCertsDir())
+	store, err := store.NewStoreWithOptions(config.GetCertsDir(), cfg.StoreOptions())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create store: %w", err)
 	}
@@ -56,6 +96,12 @@ func New(cfg *config.Config) (*Agent, error) {
 
 	// Create logger
 	logger := NewLogger(cfg.AgentID, LogLevelInfo)
+	if err := logger.Configure(cfg.Logging()); err != nil {
+		logger.Warn("agent", map[string]interface{}{
+			"message": "log settings not fully applied",
+			"error":   err.Error(),
+		})
+	}
 
 	// Create result cache
 	resultCache, err := NewResultCache()
@@ -63,36 +109,196 @@ func New(cfg *config.Config) (*Agent, error) {
 		return nil, fmt.Errorf("failed to create result cache: %w", err)
 	}
 
-	// Load or create default policy
-	pol := policy.DefaultPolicy()
-	// TODO: Load policy from hub or local cache if available
+	// Create health checker
+	checker := health.NewChecker(Version, cfg.AgentID)
+	checker.UpdateCheck("enrolled", health.CheckEnrolled(cfg))
+
+	// A cloned image carries the original's identity; talking to the hub
+	// with it would make the two machines flap as one agent
+	identity, err := enroll.CheckIdentity(store)
+	if err != nil {
+		logger.Warn("identity", map[string]interface{}{
+			"message": "failed to check machine fingerprint",
+			"error":   err.Error(),
+		})
+	}
+	if identity != nil {
+		checker.UpdateCheck("identity", health.CheckIdentity(identity.Cloned, identity.Changed))
+		if identity.Cloned {
+			logger.Error("identity", map[string]interface{}{
+				"message": "machine fingerprint does not match enrollment, agent appears to be cloned",
+				"changed": identity.Changed,
+			})
+		}
+	}
+
+	// Load hub's public key for policy and script signature verification
+	hubPublicKey, err := loadPolicyKey()
+	if err != nil {
+		logger.Warn("policy", map[string]interface{}{
+			"message": "failed to load policy signing key",
+			"error":   err.Error(),
+		})
+	}
+
+	// Merge signed policy layers, falling back to the default policy when
+	// there are none and to deny-all when they are rejected
+	merged, err := loadEffectivePolicy(hubPublicKey)
+	if merged == nil {
+		return nil, fmt.Errorf("failed to load policy: %w", err)
+	}
+	if err != nil {
+		logger.Error("policy", map[string]interface{}{
+			"message": "policy layers rejected, denying all jobs",
+			"error":   err.Error(),
+		})
+		checker.UpdateCheck("policy_layers", &health.Check{
+			Status:  health.StatusFail,
+			Message: fmt.Sprintf("policy layers rejected, denying all jobs: %v", err),
+		})
+	}
+	for _, ignored := range merged.Ignored {
+		logger.Warn("policy", map[string]interface{}{
+			"message": "policy layer entry not permitted by parent layer",
+			"entry":   ignored,
+		})
+	}
+	checker.UpdateCheck("policy", health.CheckPolicy(merged.Policy.ExpiresAt))
+	checker.SetPolicy(merged)
 
 	// Create policy enforcer
-	enforcer, err := policy.NewEnforcer(pol)
+	enforcer, err := policy.NewEnforcer(merged.Policy)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create policy enforcer: %w", err)
 	}
 
-	// Load hub's public key for script signature verification
-	// TODO: Load from secure storage or configuration
-	var hubPublicKey []byte // This should be loaded from config
+	// Report whether file policy can be extended to job children
+	if enabled, required := enforcer.SandboxMode(); enabled {
+		if abi, err := sandbox.ABIVersion(); err != nil {
+			message := "filesystem sandbox unavailable, exec and script children run unrestricted"
+			if required {
+				message = "filesystem sandbox unavailable, exec and script jobs will be rejected"
+			}
+			logger.Warn("sandbox", map[string]interface{}{
+				"message": message,
+				"error":   err.Error(),
+			})
+		} else {
+			logger.Info("sandbox", map[string]interface{}{
+				"message": "filesystem sandbox available",
+				"abi":     abi,
+			})
+		}
+	}
+
+	// Create queue for jobs deferred by maintenance windows
+	scheduleQueue, err := jobs.NewScheduleQueue(ScheduledJobsDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schedule queue: %w", err)
+	}
+
+	// Open the local channel the tray app answers consent prompts on. Without
+	// it, jobs that require consent fail instead of waiting.
+	var broker *consent.Broker
+	var consentServer *consent.Server
+	consentListener, err := ipc.Listen(config.GetRuntimeDir(), ipc.ConsentChannel)
+	if err != nil {
+		logger.Warn("consent", map[string]interface{}{
+			"message": "consent channel unavailable, jobs requiring consent will fail",
+			"error":   err.Error(),
+		})
+	} else {
+		broker = consent.NewBroker()
+		consentServer = consent.NewServer(broker)
+	}
+
+	// Open the local control API used by the CLI and tray app
+	controlListener, err := ipc.Listen(config.GetRuntimeDir(), ipc.ControlChannel)
+	if err != nil {
+		logger.Warn("control", map[string]interface{}{
+			"message": "control channel unavailable",
+			"error":   err.Error(),
+		})
+	}
 
 	// Create job executor
-	jobExecutor := jobs.NewExecutor(cfg.AgentID, enforcer, client, hubPublicKey, logger)
+	jobExecutor := jobs.NewExecutor(cfg.AgentID, enforcer, client, hubPublicKey, scheduleQueue, broker, logger)
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &Agent{
-		config:      cfg,
-		client:      client,
-		store:       store,
-		sysinfo:     collector,
-		logger:      logger,
-		jobExecutor: jobExecutor,
-		resultCache: resultCache,
-		ctx:         ctx,
-		cancel:      cancel,
-	}, nil
+	a := &Agent{
+		config:          cfg,
+		client:          client,
+		store:           store,
+		sysinfo:         collector,
+		logger:          logger,
+		jobExecutor:     jobExecutor,
+		resultCache:     resultCache,
+		health:          checker,
+		policy:          merged,
+		consentServer:   consentServer,
+		consentListener: consentListener,
+		controlListener: controlListener,
+		pollNow:         make(chan struct{}, 1),
+		ctx:             ctx,
+		cancel:          cancel,
+	}
+	a.heartbeat.IntervalSec = cfg.HeartbeatSec
+	if identity != nil && identity.Cloned {
+		a.cloned = identity
+	}
+	if controlListener != nil {
+		a.controlServer = control.NewServer(&controlProvider{agent: a})
+	}
+
+	// Copy audit entries and log events to the customer's SIEM
+	a.openSyslogExporter()
+
+	// Record jobs, violations and lifecycle events in the signed audit log.
+	// It is opened first because it may archive the forwarding state of a
+	// chain signed by a previous key.
+	a.openAuditLog()
+
+	// Decrypt job secrets with a key derived from the agent key
+	a.loadSecretKey()
+
+	// Ship the audit trail to the hub so it outlives the machine
+	a.metrics = metrics.NewMetrics(Version)
+	a.auditForwarder, err = audit.NewForwarder(cfg.AgentID, client, audit.ForwarderOptions{
+		OnLag: a.recordAuditLag,
+		OnGap: a.recordAuditGap,
+	})
+	if err != nil {
+		logger.Warn("audit", map[string]interface{}{
+			"message": "audit forwarding disabled",
+			"error":   err.Error(),
+		})
+	}
+	jobExecutor.SetSupportOptions(support.Options{
+		Version:        Version,
+		ResultCacheDir: ResultCacheDir(),
+		Health: func(ctx context.Context) (*health.Report, error) {
+			return checker.GetReport(), nil
+		},
+		Policy: func() (*policy.Merged, error) {
+			a.mu.RLock()
+			defer a.mu.RUnlock()
+			return a.policy, nil
+		},
+	})
+
+	return a, nil
+}
+
+// recordAuditLag reports audit forwarding lag as a metric and health check
+func (a *Agent) recordAuditLag(lag audit.Lag) {
+	a.metrics.SetAuditForwardLag(lag.Entries, lag.Age())
+	a.health.UpdateCheck("audit_forwarding", health.CheckAuditForwarding(lag.Entries, lag.Age(), lag.LastError))
+}
+
+// ScheduledJobsDir returns the directory of the deferred job queue
+func ScheduledJobsDir() string {
+	return filepath.Join(config.GetStateDir(), scheduledJobsDir)
 }
 
 // Start starts the agent
@@ -101,8 +307,74 @@ func (a *Agent) Start() error {
 		"message":  "starting agent",
 		"agent_id": a.config.AgentID,
 	})
+	// Start SIEM export before the startup entry is written
+	if a.siem != nil {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.siem.Run(a.ctx)
+		}()
+	}
 
-	// Start heartbeat loop
+	a.recordStartup()
+
+	// Rotate the audit log daily and apply retention
+	if a.auditLog != nil {
+		a.wg.Add(1)
+		go a.auditMaintenanceLoop()
+	}
+
+	// Start the local Prometheus endpoint when one is configured
+	if a.config.MetricsAddr != "" {
+		a.metricsServer = metrics.NewServer(a.config.MetricsAddr)
+		if err := a.metricsServer.Start(); err != nil {
+			return fmt.Errorf("failed to start metrics server: %w", err)
+		}
+	}
+
+	// Start local health endpoint
+	a.healthServer = health.NewServer("", a.health)
+	if err := a.healthServer.Start(); err != nil {
+		return fmt.Errorf("failed to start health server: %w", err)
+	}
+
+	// Serve consent prompts to the tray app
+	if a.consentServer != nil {
+		go func() {
+			if err := a.consentServer.Serve(a.consentListener); err != nil {
+				a.logger.Error("consent", map[string]interface{}{
+					"message": "consent server stopped",
+					"error":   err.Error(),
+				})
+			}
+		}()
+	}
+
+	// Serve status and actions to the CLI and tray app
+	a.startedAt = time.Now()
+	if a.controlServer != nil {
+		go func() {
+			if err := a.controlServer.Serve(a.controlListener); err != nil {
+				a.logger.Error("control", map[string]interface{}{
+					"message": "control server stopped",
+					"error":   err.Error(),
+				})
+			}
+		}()
+	}
+
+	// A clone stays reachable locally for diagnosis but does not act as
+	// the original agent
+	if a.cloned != nil {
+		a.logger.Error("agent", map[string]interface{}{
+			"message": "agent started without heartbeats or jobs: cloned machine, re-enroll with jtnt-agent reenroll",
+		})
+		return nil
+	}
+
+	// Start heartbeat loop; hub_connection fails on heartbeat errors and
+	// once heartbeats stop succeeding
+	a.health.SetCheckFunc("hub_connection", a.hubConnectionCheck)
 	a.wg.Add(1)
 	go a.heartbeatLoop()
 
@@ -113,6 +385,15 @@ func (a *Agent) Start() error {
 		a.jobPollLoop(a.ctx)
 	}()
 
+	// Start audit forwarding
+	if a.auditForwarder != nil {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.auditForwarder.Run(a.ctx)
+		}()
+	}
+
 	a.logger.Info("agent", map[string]interface{}{
 		"message": "agent started successfully",
 	})
@@ -132,10 +413,20 @@ func (a *Agent) Stop() error {
 	// Wait for all goroutines to finish
 	a.wg.Wait()
 
+	a.closeAuditLog("agent stopped")
+
+	// Keep undelivered SIEM messages for the next start
+	if a.siem != nil {
+		a.siem.Close()
+	}
+
 	a.logger.Info("agent", map[string]interface{}{
 		"message": "agent stopped successfully",
 	})
 
+	// Flush compression of rotated log files
+	a.logger.Close()
+
 	return nil
 }
 
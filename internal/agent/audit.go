@@ -0,0 +1,200 @@
+package agent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/audit"
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/enroll"
+)
+
+// versionFile records the agent version that last started, so an update is
+// audited once
+const versionFile = "agent_version"
+
+// openAuditLog opens the signed audit log with the agent key. Without a key
+// (agents enrolled before keys were kept) events are only logged to stdout.
+func (a *Agent) openAuditLog() {
+	keypair, err := enroll.LoadStoredKeyPair(a.store)
+	if err != nil {
+		a.logger.Warn("audit", map[string]interface{}{
+			"message": "signed audit log disabled, re-enroll to issue an agent key",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	a.auditLog, err = audit.NewLoggerWithOptions(a.config.AgentID, keypair.PrivateKey, audit.Options{
+		OnWrite: a.notifyAuditForwarder,
+		OnEntry: a.exportAudit,
+
+		// Retention waits for the forwarder, which always runs
+		KeepUnforwarded: true,
+	})
+	var malformed *audit.MalformedError
+	switch {
+	case errors.As(err, &malformed):
+		a.logger.Error("audit", map[string]interface{}{
+			"message": "signed audit log disabled: its last entry is damaged, check it with jtnt-agent audit verify and move the file aside",
+			"file":    malformed.File,
+			"error":   err.Error(),
+		})
+		return
+	case errors.Is(err, audit.ErrHeadInvalid):
+		a.logger.Error("audit", map[string]interface{}{
+			"message": "signed audit log disabled: the log was modified, check it with jtnt-agent audit verify",
+			"error":   err.Error(),
+		})
+		return
+	case err != nil:
+		a.logger.Error("audit", map[string]interface{}{
+			"message": "signed audit log disabled",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if archived := a.auditLog.Archived(); archived != "" {
+		a.logger.Warn("audit", map[string]interface{}{
+			"message": "audit chain signed by a previous agent key archived, a new chain was started",
+			"archive": archived,
+		})
+	}
+
+	a.jobExecutor.SetAuditLogger(a.auditLog)
+}
+
+// notifyAuditForwarder wakes the forwarder after entries are written
+func (a *Agent) notifyAuditForwarder() {
+	if a.auditForwarder != nil {
+		a.auditForwarder.Notify()
+	}
+}
+
+// recordAuditGap audits chained entries that were removed before the hub
+// acknowledged them
+func (a *Agent) recordAuditGap(fromSeq, toSeq uint64) {
+	a.logger.Warn("audit", map[string]interface{}{
+		"message":  "audit entries were removed before the hub acknowledged them",
+		"from_seq": fromSeq,
+		"to_seq":   toSeq,
+	})
+	a.recordAudit(audit.EventForwardGap, func(l *audit.Logger) error {
+		return l.LogForwardGap(fromSeq, toSeq)
+	})
+}
+
+// recordAudit writes an entry with log, reporting rather than returning a
+// failure so it never stops the agent
+func (a *Agent) recordAudit(event audit.EventType, log func(*audit.Logger) error) {
+	if a.auditLog == nil {
+		return
+	}
+	if err := log(a.auditLog); err != nil {
+		a.logger.Error("audit", map[string]interface{}{
+			"message": "failed to write audit entry",
+			"event":   string(event),
+			"error":   err.Error(),
+		})
+	}
+}
+
+// recordStartup audits the agent starting and, when the version changed
+// since the last start, the update
+func (a *Agent) recordStartup() {
+	path := filepath.Join(config.GetStateDir(), versionFile)
+	data, err := os.ReadFile(path)
+	previous := strings.TrimSpace(string(data))
+
+	if err == nil && previous != Version {
+		a.recordAudit(audit.EventUpdateApplied, func(l *audit.Logger) error {
+			return l.LogUpdate(Version, true)
+		})
+	}
+	if previous != Version {
+		if err := os.WriteFile(path, []byte(Version+"\n"), 0644); err != nil {
+			a.logger.Warn("audit", map[string]interface{}{
+				"message": "failed to record agent version",
+				"error":   err.Error(),
+			})
+		}
+	}
+
+	a.recordAudit(audit.EventStartup, func(l *audit.Logger) error {
+		return l.LogStartup(Version)
+	})
+}
+
+// closeAuditLog audits the agent stopping and closes the log. Later calls
+// do nothing.
+func (a *Agent) closeAuditLog(reason string) {
+	a.auditClose.Do(func() {
+		if a.auditLog == nil {
+			return
+		}
+		a.recordAudit(audit.EventShutdown, func(l *audit.Logger) error {
+			return l.LogShutdown(reason)
+		})
+		if err := a.auditLog.Close(); err != nil {
+			a.logger.Error("audit", map[string]interface{}{
+				"message": "failed to close audit log",
+				"error":   err.Error(),
+			})
+		}
+	})
+}
+
+// auditMaintenanceLoop applies retention at startup and rotates the log to
+// a new daily file at each local midnight
+func (a *Agent) auditMaintenanceLoop() {
+	defer a.wg.Done()
+
+	a.pruneAuditLog()
+
+	for {
+		now := time.Now()
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+		timer := time.NewTimer(midnight.Sub(now))
+
+		select {
+		case <-a.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := a.auditLog.Rotate(); err != nil {
+			a.logger.Error("audit", map[string]interface{}{
+				"message": "failed to rotate audit log",
+				"error":   err.Error(),
+			})
+		}
+		a.pruneAuditLog()
+	}
+}
+
+// pruneAuditLog removes daily files older than the configured retention
+func (a *Agent) pruneAuditLog() {
+	a.mu.RLock()
+	retention := a.config.AuditRetention()
+	a.mu.RUnlock()
+
+	removed, err := a.auditLog.Prune(retention)
+	if err != nil {
+		a.logger.Error("audit", map[string]interface{}{
+			"message": "failed to apply audit log retention",
+			"error":   err.Error(),
+		})
+	}
+	if len(removed) > 0 {
+		a.logger.Info("audit", map[string]interface{}{
+			"message":        "removed expired audit logs",
+			"files":          len(removed),
+			"retention_days": retention,
+		})
+	}
+}
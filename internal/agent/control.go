@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/control"
+	"github.com/tshojoshua/jtnt-agent/internal/health"
+	"github.com/tshojoshua/jtnt-agent/internal/jobs"
+	"github.com/tshojoshua/jtnt-agent/internal/policy"
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+// controlProvider answers control API requests from the agent's state
+type controlProvider struct {
+	agent *Agent
+}
+
+func (p *controlProvider) Status() *control.Status {
+	a := p.agent
+
+	a.mu.RLock()
+	status := &control.Status{
+		AgentID:       a.config.AgentID,
+		Status:        "running",
+		Enrolled:      health.CheckEnrolled(a.config).Status == health.StatusPass,
+		LastHeartbeat: a.heartbeat.LastSuccess,
+		HubURL:        a.config.HubURL,
+		Version:       Version,
+		StartedAt:     a.startedAt,
+		CurrentJob:    a.activeJob,
+	}
+	if a.cloned != nil {
+		status.Status = "cloned"
+	}
+	if a.jobPollingStopped {
+		status.Status = "shutting_down"
+	}
+	a.mu.RUnlock()
+
+	if queue := a.jobExecutor.Queue(); queue != nil {
+		if scheduled, err := queue.List(); err == nil {
+			status.ScheduledJobs = len(scheduled)
+		}
+	}
+	if a.resultCache != nil {
+		if results, err := a.resultCache.List(); err == nil {
+			status.PendingResults = len(results)
+		}
+	}
+
+	return status
+}
+
+func (p *controlProvider) Heartbeat() *control.HeartbeatInfo {
+	p.agent.mu.RLock()
+	defer p.agent.mu.RUnlock()
+
+	info := p.agent.heartbeat
+	return &info
+}
+
+func (p *controlProvider) Jobs() *control.JobsInfo {
+	a := p.agent
+
+	a.mu.RLock()
+	info := &control.JobsInfo{Current: a.activeJob, Scheduled: []*jobs.ScheduledJob{}}
+	a.mu.RUnlock()
+
+	if queue := a.jobExecutor.Queue(); queue != nil {
+		if scheduled, err := queue.List(); err == nil && scheduled != nil {
+			info.Scheduled = scheduled
+		}
+	}
+
+	return info
+}
+
+func (p *controlProvider) Policy() *policy.Merged {
+	p.agent.mu.RLock()
+	defer p.agent.mu.RUnlock()
+	return p.agent.policy
+}
+
+func (p *controlProvider) Health() *health.Report {
+	return p.agent.health.GetReport()
+}
+
+func (p *controlProvider) Logging() *control.LogInfo {
+	outputs, file := p.agent.logger.Outputs()
+	return &control.LogInfo{
+		Level:   string(p.agent.logger.Level()),
+		Outputs: outputs,
+		File:    file,
+	}
+}
+
+func (p *controlProvider) SetLogLevel(level string) error {
+	parsed, err := ParseLogLevel(level)
+	if err != nil {
+		return err
+	}
+
+	previous := p.agent.logger.Level()
+	p.agent.logger.SetLevel(parsed)
+	p.agent.logger.Info("control", map[string]interface{}{
+		"message":  "log level changed",
+		"level":    level,
+		"previous": string(previous),
+	})
+	return nil
+}
+
+func (p *controlProvider) PollNow() error {
+	if p.agent.isJobPollingStopped() {
+		return fmt.Errorf("job polling stopped")
+	}
+
+	// A poll already requested covers this one
+	select {
+	case p.agent.pollNow <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (p *controlProvider) Reload() error {
+	return p.agent.Reload()
+}
+
+// setActiveJob records the job being run, or clears it when job is nil
+func (a *Agent) setActiveJob(job *api.Job) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if job == nil {
+		a.activeJob = nil
+		return
+	}
+
+	a.activeJob = &control.JobInfo{
+		JobID:     job.JobID,
+		Type:      string(job.Type),
+		Summary:   jobs.Describe(job),
+		StartedAt: time.Now(),
+	}
+}
+
+// recordHeartbeat records the outcome of a heartbeat attempted at start
+func (a *Agent) recordHeartbeat(start time.Time, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.heartbeat.LastAttempt = start
+	a.heartbeat.IntervalSec = a.config.HeartbeatSec
+	if err != nil {
+		a.heartbeat.LastError = err.Error()
+		a.heartbeat.ConsecutiveFailures++
+		return
+	}
+
+	a.heartbeat.LastSuccess = start
+	a.heartbeat.LastError = ""
+	a.heartbeat.ConsecutiveFailures = 0
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/tshojoshua/jtnt-agent/internal/health"
 	"github.com/tshojoshua/jtnt-agent/pkg/api"
 )
 
@@ -30,9 +31,23 @@ func (a *Agent) sendHeartbeat(ctx context.Context) error {
 
 	// Create heartbeat request
 	req := api.HeartbeatRequest{
-		AgentID:   a.config.AgentID,
-		Timestamp: time.Now(),
-		SysInfo:   *sysInfo,
+		AgentID:       a.config.AgentID,
+		Timestamp:     time.Now(),
+		SysInfo:       *sysInfo,
+		EncryptionKey: a.encryptionKey,
+	}
+
+	// Report jobs waiting for a maintenance window
+	if queue := a.jobExecutor.Queue(); queue != nil {
+		if scheduled, err := queue.List(); err == nil {
+			for _, s := range scheduled {
+				req.DeferredJobs = append(req.DeferredJobs, api.DeferredJob{
+					JobID:  s.Job.JobID,
+					RunAt:  s.RunAt,
+					Reason: s.Reason,
+				})
+			}
+		}
 	}
 
 	// Send heartbeat
@@ -64,6 +79,15 @@ func (a *Agent) sendHeartbeat(ctx context.Context) error {
 	return nil
 }
 
+// hubConnectionCheck reports hub connectivity from the heartbeat state
+func (a *Agent) hubConnectionCheck() *health.Check {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	interval := time.Duration(a.config.HeartbeatSec) * time.Second
+	return health.CheckHubConnection(a.heartbeat.LastSuccess, a.startedAt, interval, a.heartbeat.LastError)
+}
+
 // heartbeatLoop continuously sends heartbeats
 func (a *Agent) heartbeatLoop() {
 	defer a.wg.Done()
@@ -97,7 +121,10 @@ func (a *Agent) heartbeatLoop() {
 		case <-ticker.C:
 			start := time.Now()
 
-			if err := a.sendHeartbeat(a.ctx); err != nil {
+			err := a.sendHeartbeat(a.ctx)
+			a.recordHeartbeat(start, err)
+
+			if err != nil {
 				a.logger.Error("heartbeat", map[string]interface{}{
 					"message": "heartbeat failed",
 					"error":   err.Error(),
@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/jobs"
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
 )
 
 const (
@@ -38,35 +41,44 @@ func (a *Agent) jobPollLoop(ctx context.Context) {
 			return
 
 		case <-jobTicker.C:
-			// Attempt to upload cached results periodically
-			if time.Since(lastCacheUpload) >= cacheUploadInterval {
-				a.uploadCachedResults(ctx)
-				lastCacheUpload = time.Now()
-			}
 
-			// Fetch and execute next job
-			if err := a.processNextJob(ctx); err != nil {
-				a.logger.Error("job-poll", map[string]interface{}{
-					"message": "job processing error",
-					"error":   err.Error(),
-				})
+		case <-a.pollNow:
+			a.logger.Info("job-poll", map[string]interface{}{
+				"message": "polling for jobs on request",
+			})
+		}
 
-				// Apply exponential backoff on errors
-				errorBackoff = time.Duration(float64(errorBackoff) * errorBackoffMultiplier)
-				if errorBackoff > maxErrorBackoff {
-					errorBackoff = maxErrorBackoff
-				}
+		// Attempt to upload cached results periodically
+		if time.Since(lastCacheUpload) >= cacheUploadInterval {
+			a.uploadCachedResults(ctx)
+			lastCacheUpload = time.Now()
+		}
 
-				jobTicker.Reset(errorBackoff)
-				a.logger.Debug("job-poll", map[string]interface{}{
-					"message":       "applying error backoff",
-					"next_poll_in":  errorBackoff.String(),
-				})
-			} else {
-				// Reset backoff on success
-				errorBackoff = minJobPollInterval
-				jobTicker.Reset(pollInterval)
+		// Run deferred jobs whose maintenance window has opened
+		a.runScheduledJobs(ctx)
+
+		// Fetch and execute next job
+		if err := a.processNextJob(ctx); err != nil {
+			a.logger.Error("job-poll", map[string]interface{}{
+				"message": "job processing error",
+				"error":   err.Error(),
+			})
+
+			// Apply exponential backoff on errors
+			errorBackoff = time.Duration(float64(errorBackoff) * errorBackoffMultiplier)
+			if errorBackoff > maxErrorBackoff {
+				errorBackoff = maxErrorBackoff
 			}
+
+			jobTicker.Reset(errorBackoff)
+			a.logger.Debug("job-poll", map[string]interface{}{
+				"message":       "applying error backoff",
+				"next_poll_in":  errorBackoff.String(),
+			})
+		} else {
+			// Reset backoff on success
+			errorBackoff = minJobPollInterval
+			jobTicker.Reset(pollInterval)
 		}
 	}
 }
@@ -93,6 +105,102 @@ func (a *Agent) processNextJob(ctx context.Context) error {
 		"type":    job.Type,
 	})
 
+	return a.runJob(ctx, job)
+}
+
+// runScheduledJobs executes queued jobs that have become due. Each job is
+// marked running before it starts and removed only once its result is
+// reported or cached, so a job is neither lost nor started twice.
+func (a *Agent) runScheduledJobs(ctx context.Context) {
+	queue := a.jobExecutor.Queue()
+	if queue == nil {
+		return
+	}
+
+	due, err := queue.Due(time.Now())
+	if err != nil {
+		a.logger.Error("job-schedule", map[string]interface{}{
+			"message": "failed to read schedule queue",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	for _, scheduled := range due {
+		if ctx.Err() != nil || a.isJobPollingStopped() {
+			return
+		}
+
+		// Started before but its result never reported, e.g. the agent
+		// stopped while it ran; it may have had effects, so it is not rerun
+		if scheduled.StartedAt != nil {
+			a.logger.Warn("job-schedule", map[string]interface{}{
+				"message":    "scheduled job was interrupted, reporting it as failed",
+				"job_id":     scheduled.Job.JobID,
+				"started_at": scheduled.StartedAt.Format(time.RFC3339),
+			})
+			result := jobs.FormatResult(a.config.AgentID, api.StatusError, *scheduled.StartedAt, time.Now(),
+				-1, nil, nil, fmt.Errorf("scheduled job was interrupted before its result was reported"), nil)
+			a.finishScheduledJob(ctx, queue, scheduled.Job, result)
+			continue
+		}
+
+		if err := queue.MarkRunning(scheduled.Job.JobID); err != nil {
+			a.logger.Error("job-schedule", map[string]interface{}{
+				"message": "failed to mark scheduled job running",
+				"job_id":  scheduled.Job.JobID,
+				"error":   err.Error(),
+			})
+			continue
+		}
+
+		a.logger.Info("job-schedule", map[string]interface{}{
+			"message":   "running scheduled job",
+			"job_id":    scheduled.Job.JobID,
+			"type":      scheduled.Job.Type,
+			"queued_at": scheduled.QueuedAt.Format(time.RFC3339),
+		})
+
+		a.finishScheduledJob(ctx, queue, scheduled.Job, a.executeJob(ctx, scheduled.Job))
+	}
+}
+
+// finishScheduledJob reports the result of a scheduled job and removes it
+// from the queue once the hub or the result cache has the result. A job
+// deferred again was queued anew by the executor and is kept.
+func (a *Agent) finishScheduledJob(ctx context.Context, queue *jobs.ScheduleQueue, job *api.Job, result *api.JobResult) {
+	stored, err := a.reportResult(ctx, job.JobID, result)
+	if err != nil {
+		a.logger.Error("job-schedule", map[string]interface{}{
+			"message": "scheduled job processing error",
+			"job_id":  job.JobID,
+			"error":   err.Error(),
+		})
+	}
+	if !stored || result.Status == api.StatusDeferred {
+		return
+	}
+
+	if err := queue.Remove(job.JobID); err != nil {
+		a.logger.Error("job-schedule", map[string]interface{}{
+			"message": "failed to dequeue scheduled job",
+			"job_id":  job.JobID,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// runJob executes job and reports its result, caching it on failure
+func (a *Agent) runJob(ctx context.Context, job *api.Job) error {
+	_, err := a.reportResult(ctx, job.JobID, a.executeJob(ctx, job))
+	return err
+}
+
+// executeJob runs job within its timeout
+func (a *Agent) executeJob(ctx context.Context, job *api.Job) *api.JobResult {
+	a.setActiveJob(job)
+	defer a.setActiveJob(nil)
+
 	// Execute job with timeout context
 	execCtx := ctx
 	if job.TimeoutSec > 0 {
@@ -110,39 +218,45 @@ func (a *Agent) processNextJob(ctx context.Context) error {
 		"exit_code":  result.ExitCode,
 	})
 
-	// Report result to hub
-	if err := a.jobExecutor.ReportResult(ctx, job.JobID, result); err != nil {
+	return result
+}
+
+// reportResult sends result to the hub, caching it for later upload when
+// that fails. stored reports whether the hub or the cache has the result.
+func (a *Agent) reportResult(ctx context.Context, jobID string, result *api.JobResult) (stored bool, err error) {
+	if err := a.jobExecutor.ReportResult(ctx, jobID, result); err != nil {
 		a.logger.Error("job-execute", map[string]interface{}{
 			"message": "failed to report job result",
-			"job_id":  job.JobID,
+			"job_id":  jobID,
 			"error":   err.Error(),
 		})
 
 		// Cache result for later upload
 		if a.resultCache != nil {
-			if cacheErr := a.resultCache.Store(job.JobID, result); cacheErr != nil {
+			if cacheErr := a.resultCache.Store(jobID, result); cacheErr != nil {
 				a.logger.Error("job-execute", map[string]interface{}{
 					"message": "failed to cache job result",
-					"job_id":  job.JobID,
+					"job_id":  jobID,
 					"error":   cacheErr.Error(),
 				})
 			} else {
+				stored = true
 				a.logger.Info("job-execute", map[string]interface{}{
 					"message": "cached job result for later upload",
-					"job_id":  job.JobID,
+					"job_id":  jobID,
 				})
 			}
 		}
 
-		return fmt.Errorf("failed to report result: %w", err)
+		return stored, fmt.Errorf("failed to report result: %w", err)
 	}
 
 	a.logger.Info("job-execute", map[string]interface{}{
 		"message": "job result reported successfully",
-		"job_id":  job.JobID,
+		"job_id":  jobID,
 	})
 
-	return nil
+	return true, nil
 }
 
 // updatePollInterval updates the job polling interval from hub configuration
@@ -4,12 +4,13 @@ import (
 	"fmt"
 
 	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/health"
 )
 
 // Lifecycle management functions for the agent
 // This module handles start, stop, reload operations
 
-// Reload reloads the agent configuration
+// Reload reloads the agent configuration and policy layers
 func (a *Agent) Reload() error {
 	a.logger.Info("lifecycle", map[string]interface{}{
 		"message": "reloading agent configuration",
@@ -27,12 +28,29 @@ func (a *Agent) Reload() error {
 	}
 
 	// Update configuration
+	a.mu.Lock()
 	a.config = newConfig
+	a.mu.Unlock()
+	a.health.UpdateCheck("enrolled", health.CheckEnrolled(newConfig))
+
+	// Apply log settings and reopen the log file, which also undoes a
+	// level set at runtime
+	if err := a.logger.Configure(newConfig.Logging()); err != nil {
+		a.logger.Warn("lifecycle", map[string]interface{}{
+			"message": "log settings not fully applied",
+			"error":   err.Error(),
+		})
+	}
 
 	a.logger.Info("lifecycle", map[string]interface{}{
 		"message": "configuration reloaded successfully",
 	})
 
+	// Re-merge policy layers
+	if err := a.reloadPolicy(); err != nil {
+		return fmt.Errorf("failed to reload policy: %w", err)
+	}
+
 	return nil
 }
 
@@ -5,7 +5,16 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/logfile"
+	"github.com/tshojoshua/jtnt-agent/internal/redact"
 )
 
 // LogLevel represents log severity
@@ -19,20 +28,70 @@ const (
 	LogLevelFatal LogLevel = "fatal"
 )
 
-// Logger provides structured JSON logging
-type Logger struct {
+// Log outputs
+const (
+	LogOutputStdout   = "stdout"
+	LogOutputFile     = "file"
+	LogOutputJournald = "journald"
+
+	// logFileName is the agent log in the log directory
+	logFileName = "agent.log"
+)
+
+// logLevels orders the levels from least to most severe
+var logLevels = []LogLevel{LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError, LogLevelFatal}
+
+// journaldPriorities are the syslog priorities journald reads from a "<N>"
+// line prefix
+var journaldPriorities = map[LogLevel]int{
+	LogLevelDebug: 7,
+	LogLevelInfo:  6,
+	LogLevelWarn:  4,
+	LogLevelError: 3,
+	LogLevelFatal: 2,
+}
+
+// ParseLogLevel returns the level named s
+func ParseLogLevel(s string) (LogLevel, error) {
+	for _, level := range logLevels {
+		if string(level) == s && level != LogLevelFatal {
+			return level, nil
+		}
+	}
+	return "", fmt.Errorf("unknown log level %q, want debug, info, warn or error", s)
+}
+
+// logOutput is one destination of log entries
+type logOutput struct {
+	name     string
 	writer   io.Writer
+	journald bool
+}
+
+// Logger provides structured JSON logging. Its level and outputs can be
+// changed while other goroutines log; entries are written whole, one at a
+// time, so none is lost or interleaved during the change.
+type Logger struct {
 	agentID  string
-	minLevel LogLevel
+	minLevel atomic.Int32
+
+	// mu serializes writes and changes of outputs
+	mu      sync.Mutex
+	outputs []logOutput
+	file    *logfile.File
+
+	// hook also receives every entry, whatever the level
+	hook func(level LogLevel, entry *LogEntry)
 }
 
-// NewLogger creates a new logger
+// NewLogger creates a new logger writing JSON lines to stdout
 func NewLogger(agentID string, minLevel LogLevel) *Logger {
-	return &Logger{
-		writer:   os.Stdout,
-		agentID:  agentID,
-		minLevel: minLevel,
+	l := &Logger{
+		agentID: agentID,
+		outputs: []logOutput{{name: LogOutputStdout, writer: os.Stdout}},
 	}
+	l.SetLevel(minLevel)
+	return l
 }
 
 // LogEntry represents a structured log entry
@@ -45,8 +104,134 @@ type LogEntry struct {
 	Fields    map[string]interface{} `json:"fields,omitempty"`
 }
 
+// SetHook sends every entry to hook as well, e.g. to export it. Call it
+// before the logger is shared between goroutines.
+func (l *Logger) SetHook(hook func(level LogLevel, entry *LogEntry)) {
+	l.hook = hook
+}
+
+// SetLevel changes the lowest level logged
+func (l *Logger) SetLevel(level LogLevel) {
+	l.minLevel.Store(int32(levelIndex(level)))
+}
+
+// Level returns the lowest level logged
+func (l *Logger) Level() LogLevel {
+	return logLevels[l.minLevel.Load()]
+}
+
+// Outputs returns the names of the current outputs and the path of the log
+// file, if one is open
+func (l *Logger) Outputs() ([]string, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	names := make([]string, 0, len(l.outputs))
+	for _, output := range l.outputs {
+		names = append(names, output.name)
+	}
+
+	path := ""
+	if l.file != nil {
+		path = LogFilePath()
+	}
+	return names, path
+}
+
+// LogFilePath returns the path of the agent log file
+func LogFilePath() string {
+	return filepath.Join(config.GetLogDir(), logFileName)
+}
+
+// Configure applies settings: the level and the outputs, reopening the log
+// file. Invalid settings are rejected without changing anything. If the log
+// file cannot be opened the other outputs are still applied and the error
+// is returned.
+func (l *Logger) Configure(settings config.LogConfig) error {
+	level := LogLevelInfo
+	if settings.Level != "" {
+		var err error
+		if level, err = ParseLogLevel(settings.Level); err != nil {
+			return err
+		}
+	}
+
+	names := settings.Outputs
+	if len(names) == 0 {
+		names = []string{LogOutputStdout, LogOutputFile}
+	}
+
+	var outputs []logOutput
+	var file *logfile.File
+	var fileErr error
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		switch name {
+		case LogOutputStdout:
+			outputs = append(outputs, logOutput{name: name, writer: os.Stdout})
+		case LogOutputJournald:
+			outputs = append(outputs, logOutput{name: name, writer: os.Stdout, journald: true})
+		case LogOutputFile:
+		default:
+			return fmt.Errorf("unknown log output %q, want %s, %s or %s", name, LogOutputStdout, LogOutputFile, LogOutputJournald)
+		}
+	}
+	if seen[LogOutputStdout] && seen[LogOutputJournald] {
+		return fmt.Errorf("log outputs %s and %s both write to stdout, choose one", LogOutputStdout, LogOutputJournald)
+	}
+
+	if seen[LogOutputFile] {
+		file, fileErr = logfile.Open(LogFilePath(), logfile.Options{
+			MaxSize:  int64(settings.MaxSizeMB) << 20,
+			MaxAge:   time.Duration(settings.MaxAgeDays) * 24 * time.Hour,
+			MaxFiles: settings.MaxFiles,
+		})
+		if fileErr == nil {
+			outputs = append(outputs, logOutput{name: LogOutputFile, writer: file})
+		}
+	}
+
+	l.mu.Lock()
+	previous := l.file
+	l.outputs = outputs
+	l.file = file
+	l.mu.Unlock()
+
+	l.SetLevel(level)
+
+	if previous != nil {
+		previous.Close()
+	}
+	return fileErr
+}
+
+// Close closes the log file; later entries go to the other outputs only
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	file := l.file
+	l.file = nil
+	outputs := l.outputs[:0:0]
+	for _, output := range l.outputs {
+		if output.name != LogOutputFile {
+			outputs = append(outputs, output)
+		}
+	}
+	l.outputs = outputs
+	l.mu.Unlock()
+
+	if file == nil {
+		return nil
+	}
+	return file.Close()
+}
+
 func (l *Logger) log(level LogLevel, component string, fields map[string]interface{}) {
-	if !l.shouldLog(level) {
+	if !l.shouldLog(level) && l.hook == nil {
 		return
 	}
 
@@ -56,16 +241,24 @@ func (l *Logger) log(level LogLevel, component string, fields map[string]interfa
 		delete(fields, "message")
 	}
 
+	// Job arguments, output and errors can carry credentials
 	entry := LogEntry{
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 		Level:     string(level),
 		Component: component,
 		AgentID:   l.agentID,
-		Message:   message,
+		Message:   redact.String(message),
 	}
 
 	if len(fields) > 0 {
-		entry.Fields = fields
+		entry.Fields = redact.Fields(fields)
+	}
+
+	if l.hook != nil {
+		l.hook(level, &entry)
+	}
+	if !l.shouldLog(level) {
+		return
 	}
 
 	data, err := json.Marshal(entry)
@@ -73,26 +266,54 @@ func (l *Logger) log(level LogLevel, component string, fields map[string]interfa
 		fmt.Fprintf(os.Stderr, "failed to marshal log entry: %v\n", err)
 		return
 	}
+	data = append(data, '\n')
 
-	fmt.Fprintln(l.writer, string(data))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, output := range l.outputs {
+		line := data
+		if output.journald {
+			line = journaldLine(level, &entry)
+		}
+		if _, err := output.writer.Write(line); err != nil && output.name == LogOutputFile {
+			fmt.Fprintf(os.Stderr, "failed to write log file: %v\n", err)
+		}
+	}
+}
+
+// journaldLine formats entry as "<priority>component: message key=value"
+func journaldLine(level LogLevel, entry *LogEntry) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>%s: %s", journaldPriorities[level], entry.Component, entry.Message)
+
+	keys := make([]string, 0, len(entry.Fields))
+	for key := range entry.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, " %s=%v", key, entry.Fields[key])
+	}
+
+	// One entry per line, whatever the message holds
+	line := strings.ReplaceAll(b.String(), "\n", " ")
+	return []byte(line + "\n")
 }
 
 func (l *Logger) shouldLog(level LogLevel) bool {
-	levels := []LogLevel{LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError, LogLevelFatal}
-	
-	minIdx := 0
-	levelIdx := 0
-	
-	for i, lvl := range levels {
-		if lvl == l.minLevel {
-			minIdx = i
-		}
+	return levelIndex(level) >= int(l.minLevel.Load())
+}
+
+// levelIndex returns the position of level in logLevels, treating unknown
+// levels as debug
+func levelIndex(level LogLevel) int {
+	for i, lvl := range logLevels {
 		if lvl == level {
-			levelIdx = i
+			return i
 		}
 	}
-	
-	return levelIdx >= minIdx
+	return 0
 }
 
 // Debug logs a debug message
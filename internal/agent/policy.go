@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"os"
+
+	"github.com/tshojoshua/jtnt-agent/internal/audit"
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/health"
+	"github.com/tshojoshua/jtnt-agent/internal/policy"
+)
+
+// loadPolicyKey reads the hub's policy signing key. It returns nil when the
+// key has not been provisioned.
+func loadPolicyKey() (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(config.GetPolicyKeyPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return policy.LoadPublicKey(data)
+}
+
+// loadEffectivePolicy merges the signed layers in the policy dir. It falls
+// back to the built-in default when there are no layers, and to a deny-all
+// policy when they are rejected, returning the rejection error alongside it.
+func loadEffectivePolicy(publicKey ed25519.PublicKey) (*policy.Merged, error) {
+	merged, err := policy.LoadEffective(config.GetPolicyDir(), publicKey)
+	if merged != nil {
+		return merged, nil
+	}
+
+	fallback := policy.DenyAllPolicy()
+	if err == nil {
+		fallback = policy.DefaultPolicy()
+		fallback.Layer = "default"
+	}
+	result, mergeErr := policy.Merge([]*policy.Policy{fallback})
+	if mergeErr != nil {
+		return nil, mergeErr
+	}
+	return result, err
+}
+
+// reloadPolicy re-merges the policy layers and switches new jobs to the
+// result. Unlike startup, rejected layers keep the current policy in force
+// rather than falling back to deny-all.
+func (a *Agent) reloadPolicy() error {
+	publicKey, err := loadPolicyKey()
+	if err != nil {
+		return fmt.Errorf("failed to load policy signing key: %w", err)
+	}
+
+	merged, err := loadEffectivePolicy(publicKey)
+	if err != nil {
+		return err
+	}
+
+	enforcer, err := policy.NewEnforcer(merged.Policy)
+	if err != nil {
+		return fmt.Errorf("failed to create policy enforcer: %w", err)
+	}
+
+	a.jobExecutor.SetEnforcer(enforcer)
+
+	a.mu.Lock()
+	previous := a.policy
+	a.policy = merged
+	a.mu.Unlock()
+
+	if previous.Policy.Version != merged.Policy.Version {
+		a.recordAudit(audit.EventPolicyChanged, func(l *audit.Logger) error {
+			return l.LogPolicyChange(previous.Policy.Version, merged.Policy.Version)
+		})
+	}
+
+	a.health.SetPolicy(merged)
+	a.health.UpdateCheck("policy", health.CheckPolicy(merged.Policy.ExpiresAt))
+	a.health.UpdateCheck("policy_layers", &health.Check{
+		Status:  health.StatusPass,
+		Message: fmt.Sprintf("%d policy layers merged", len(merged.Layers)),
+	})
+
+	for _, ignored := range merged.Ignored {
+		a.logger.Warn("policy", map[string]interface{}{
+			"message": "policy layer entry not permitted by parent layer",
+			"entry":   ignored,
+		})
+	}
+
+	a.logger.Info("policy", map[string]interface{}{
+		"message": "policy reloaded",
+		"version": merged.Policy.Version,
+		"layers":  len(merged.Layers),
+	})
+
+	return nil
+}
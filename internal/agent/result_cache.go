@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/jobs"
 	"github.com/tshojoshua/jtnt-agent/pkg/api"
 )
 
@@ -24,7 +25,7 @@ type ResultCache struct {
 
 // NewResultCache creates a new result cache
 func NewResultCache() (*ResultCache, error) {
-	cacheDir := filepath.Join(config.GetStateDir(), resultCacheDir)
+	cacheDir := ResultCacheDir()
 	if err := os.MkdirAll(cacheDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create cache directory: %w", err)
 	}
@@ -32,8 +33,10 @@ func NewResultCache() (*ResultCache, error) {
 	return &ResultCache{cacheDir: cacheDir}, nil
 }
 
-// Store saves a result to cache
+// Store saves a result to cache, with secrets masked
 func (rc *ResultCache) Store(jobID string, result *api.JobResult) error {
+	jobs.RedactResult(result)
+
 	data, err := json.MarshalIndent(result, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal result: %w", err)
@@ -74,6 +77,9 @@ func (rc *ResultCache) List() (map[string]*api.JobResult, error) {
 			continue
 		}
 
+		// Results cached by earlier versions were not masked
+		jobs.RedactResult(&result)
+
 		results[path] = &result
 	}
 
@@ -113,6 +119,31 @@ func (rc *ResultCache) Purge(maxAge time.Duration) error {
 	return nil
 }
 
+// ResultCacheDir returns the directory of results waiting for upload
+func ResultCacheDir() string {
+	return filepath.Join(config.GetStateDir(), resultCacheDir)
+}
+
+// CountCachedResults returns how many results are waiting for upload without
+// creating the cache. It is used when the daemon is not running.
+func CountCachedResults() (int, error) {
+	entries, err := os.ReadDir(ResultCacheDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	count := 0
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".json" {
+			count++
+		}
+	}
+	return count, nil
+}
+
 // ExtractJobID extracts job ID from cache filename
 func ExtractJobID(filename string) string {
 	base := filepath.Base(filename)
@@ -0,0 +1,28 @@
+package agent
+
+import (
+	"encoding/base64"
+
+	"github.com/tshojoshua/jtnt-agent/internal/enroll"
+	"github.com/tshojoshua/jtnt-agent/internal/secrets"
+)
+
+// loadSecretKey derives the key job secrets are decrypted with from the
+// agent key. Without a key (agents enrolled before keys were kept) jobs
+// carrying secrets fail.
+func (a *Agent) loadSecretKey() {
+	keypair, err := enroll.LoadStoredKeyPair(a.store)
+	if err == nil {
+		key, derr := secrets.DeriveKey(keypair.PrivateKey)
+		if err = derr; err == nil {
+			a.jobExecutor.SetSecretKey(key)
+			a.encryptionKey = base64.StdEncoding.EncodeToString(key.PublicKey().Bytes())
+			return
+		}
+	}
+
+	a.logger.Warn("job", map[string]interface{}{
+		"message": "job secrets cannot be decrypted, re-enroll to issue an agent key",
+		"error":   err.Error(),
+	})
+}
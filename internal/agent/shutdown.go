@@ -2,6 +2,7 @@ package agent
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
@@ -77,6 +78,9 @@ func (a *Agent) Shutdown(timeout time.Duration) error {
 		"message": "closing connections",
 	})
 
+	// Step 7: Seal the audit log
+	a.closeAuditLog(fmt.Sprintf("graceful shutdown (timeout %s)", timeout))
+
 	a.logger.Info("shutdown", map[string]interface{}{
 		"message": "shutdown complete",
 	})
@@ -91,6 +95,13 @@ func (a *Agent) stopJobPolling() {
 	a.mu.Unlock()
 }
 
+// isJobPollingStopped reports whether shutdown has stopped job intake
+func (a *Agent) isJobPollingStopped() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.jobPollingStopped
+}
+
 // waitForCurrentJob waits for the current job to complete
 func (a *Agent) waitForCurrentJob() {
 	a.mu.RLock()
@@ -149,8 +160,26 @@ func (a *Agent) sendHeartbeatWithStatus(ctx context.Context, status string) erro
 	return nil
 }
 
-// stopServers stops the metrics and health servers
+// stopServers stops the metrics, health, consent and control servers
 func (a *Agent) stopServers(timeout time.Duration) {
+	if a.controlServer != nil {
+		if err := a.controlServer.Stop(timeout); err != nil {
+			a.logger.Error("shutdown", map[string]interface{}{
+				"message": "failed to stop control server",
+				"error":   err.Error(),
+			})
+		}
+	}
+
+	if a.consentServer != nil {
+		if err := a.consentServer.Stop(timeout); err != nil {
+			a.logger.Error("shutdown", map[string]interface{}{
+				"message": "failed to stop consent server",
+				"error":   err.Error(),
+			})
+		}
+	}
+
 	if a.metricsServer != nil {
 		if err := a.metricsServer.Stop(timeout); err != nil {
 			a.logger.Error("shutdown", map[string]interface{}{
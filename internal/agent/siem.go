@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"github.com/tshojoshua/jtnt-agent/internal/audit"
+	"github.com/tshojoshua/jtnt-agent/internal/health"
+	"github.com/tshojoshua/jtnt-agent/internal/siem"
+)
+
+// openSyslogExporter starts exporting log events to the configured SIEM
+// collector. Audit entries are added when the audit log opens.
+func (a *Agent) openSyslogExporter() {
+	if a.config.Syslog == nil {
+		return
+	}
+
+	exporter, err := siem.NewExporter(*a.config.Syslog, siem.Options{
+		Version:  Version,
+		OnStatus: a.recordSyslogStatus,
+	})
+	if err != nil {
+		a.logger.Error("siem", map[string]interface{}{
+			"message": "syslog export disabled",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	a.siem = exporter
+	a.logger.SetHook(func(level LogLevel, entry *LogEntry) {
+		exporter.ExportLog(string(level), entry.Component, entry.Message, entry.Fields)
+	})
+}
+
+// exportAudit sends an audit entry to the SIEM collector
+func (a *Agent) exportAudit(entry *audit.Entry, line []byte) {
+	if a.siem != nil {
+		a.siem.ExportAudit(entry, line)
+	}
+}
+
+// recordSyslogStatus reports syslog delivery as a health check and logs
+// when the collector is lost or comes back
+func (a *Agent) recordSyslogStatus(status siem.Status) {
+	a.health.UpdateCheck("syslog", health.CheckSyslogExport(status.Connected, status.Buffered, status.Dropped, status.LastError))
+
+	// Called from any goroutine that logs, some holding a.mu
+	if a.syslogConnected.Swap(status.Connected) == status.Connected {
+		return
+	}
+
+	if status.Connected {
+		a.logger.Info("siem", map[string]interface{}{
+			"message": "connected to syslog collector",
+		})
+	} else {
+		a.logger.Warn("siem", map[string]interface{}{
+			"message":  "syslog collector unreachable, buffering to disk",
+			"buffered": status.Buffered,
+			"error":    status.LastError,
+		})
+	}
+}
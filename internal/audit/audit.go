@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/redact"
 )
 
 // EventType represents the type of audit event
@@ -25,8 +26,16 @@ const (
 	EventPolicyViolation   EventType = "policy_violation"
 	EventShutdown          EventType = "shutdown"
 	EventStartup           EventType = "startup"
+	EventCheckpoint        EventType = "checkpoint"
+	EventLogPruned         EventType = "log_pruned"
+	EventConsent           EventType = "consent"
+	EventForwardGap        EventType = "audit_forward_gap"
 )
 
+// defaultCheckpointInterval is how many entries are written between signed
+// checkpoints
+const defaultCheckpointInterval = 100
+
 // Entry represents a single audit log entry
 type Entry struct {
 	Timestamp     string                 `json:"timestamp"`
@@ -39,7 +48,40 @@ type Entry struct {
 	User          string                 `json:"user,omitempty"`
 	PolicyVersion int                    `json:"policy_version,omitempty"`
 	Details       map[string]interface{} `json:"details,omitempty"`
-	Signature     string                 `json:"signature"`
+
+	// Seq numbers entries across all files and PrevHash is the SHA-256 of
+	// the previous entry's line, so removed or reordered entries break the
+	// chain. Both are empty in entries written before chaining.
+	Seq      uint64 `json:"seq,omitempty"`
+	PrevHash string `json:"prev_hash,omitempty"`
+
+	// KeyID identifies the key that signed the entry, so a chain can be
+	// told apart from one signed by a previous agent key. Empty in entries
+	// written before it was recorded.
+	KeyID string `json:"key_id,omitempty"`
+
+	Signature string `json:"signature"`
+}
+
+// Options configures an audit logger
+type Options struct {
+	// Dir is the audit directory; default Dir()
+	Dir string
+
+	// CheckpointInterval is how many entries are written between signed
+	// checkpoints; default 100
+	CheckpointInterval int
+
+	// OnWrite is called after entries are written, e.g. to wake a Forwarder
+	OnWrite func()
+
+	// OnEntry is called with every entry and its line as written,
+	// including checkpoints. It must not block or log to this logger.
+	OnEntry func(entry *Entry, line []byte)
+
+	// KeepUnforwarded stops Prune from removing files the hub has not
+	// acknowledged, as recorded by a Forwarder in the same directory
+	KeepUnforwarded bool
 }
 
 // Logger handles audit logging with signatures
@@ -48,16 +90,78 @@ type Logger struct {
 	file       *os.File
 	filePath   string
 	privateKey ed25519.PrivateKey
+	keyID      string
 	agentID    string
+
+	// Head of the hash chain
+	seq      uint64
+	lastHash string
+
+	checkpointInterval int
+	sinceCheckpoint    int
+	onWrite            func()
+	onEntry            func(entry *Entry, line []byte)
+	keepUnforwarded    bool
+
+	// Where a chain signed by another key was moved on open
+	archived string
+}
+
+// Dir returns the audit log directory
+func Dir() string {
+	return filepath.Join(config.GetStateDir(), "audit")
 }
 
 // NewLogger creates a new audit logger
 func NewLogger(agentID string, privateKey ed25519.PrivateKey) (*Logger, error) {
-	auditDir := filepath.Join(config.GetStateDir(), "audit")
+	return NewLoggerWithOptions(agentID, privateKey, Options{})
+}
+
+// NewLoggerWithOptions creates a new audit logger with options. The hash
+// chain continues from the last entry already in the directory.
+func NewLoggerWithOptions(agentID string, privateKey ed25519.PrivateKey, opts Options) (*Logger, error) {
+	auditDir := opts.Dir
+	if auditDir == "" {
+		auditDir = Dir()
+	}
+	if opts.CheckpointInterval <= 0 {
+		opts.CheckpointInterval = defaultCheckpointInterval
+	}
+
 	if err := os.MkdirAll(auditDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create audit directory: %w", err)
 	}
 
+	head, lastHash, err := recoverHead(auditDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover audit chain: %w", err)
+	}
+
+	// A new identity signs with a new key; continuing the old chain would
+	// leave it verifiable by neither key
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	var archived string
+	if head != nil {
+		other, err := signedByOtherKey(auditDir, head, publicKey)
+		if err != nil {
+			return nil, err
+		}
+		if other {
+			if archived, err = archiveChain(auditDir, head.AgentID); err != nil {
+				return nil, fmt.Errorf("failed to archive audit chain: %w", err)
+			}
+			head = nil
+		}
+	}
+
+	var seq uint64
+	if head != nil && head.Seq != 0 {
+		seq = head.Seq
+	} else {
+		// Empty, or only entries from before chaining; start a new chain
+		lastHash = genesisHash
+	}
+
 	// Create audit log file with date
 	filename := fmt.Sprintf("audit-%s.log", time.Now().Format("2006-01-02"))
 	filePath := filepath.Join(auditDir, filename)
@@ -68,18 +172,52 @@ func NewLogger(agentID string, privateKey ed25519.PrivateKey) (*Logger, error) {
 	}
 
 	return &Logger{
-		file:       file,
-		filePath:   filePath,
-		privateKey: privateKey,
-		agentID:    agentID,
+		file:               file,
+		filePath:           filePath,
+		privateKey:         privateKey,
+		keyID:              KeyID(publicKey),
+		agentID:            agentID,
+		seq:                seq,
+		lastHash:           lastHash,
+		checkpointInterval: opts.CheckpointInterval,
+		onWrite:            opts.OnWrite,
+		onEntry:            opts.OnEntry,
+		keepUnforwarded:    opts.KeepUnforwarded,
+		archived:           archived,
 	}, nil
 }
 
-// Log writes an audit entry
+// Archived returns the directory the previous chain was moved to because it
+// was signed by another key, or "" if the chain was continued
+func (l *Logger) Archived() string {
+	return l.archived
+}
+
+// Log writes an audit entry, followed by a signed checkpoint every
+// CheckpointInterval entries
 func (l *Logger) Log(event EventType, details map[string]interface{}) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if err := l.log(event, details); err != nil {
+		return err
+	}
+	if l.onWrite != nil {
+		defer l.onWrite()
+	}
+
+	l.sinceCheckpoint++
+	if l.sinceCheckpoint >= l.checkpointInterval {
+		return l.checkpoint()
+	}
+	return nil
+}
+
+// log appends one entry to the chain; the caller holds l.mu
+func (l *Logger) log(event EventType, details map[string]interface{}) error {
+	// Commands and errors can carry credentials; mask them before signing
+	details = redact.Fields(details)
+
 	// Create entry without signature first
 	entry := &Entry{
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
@@ -87,6 +225,9 @@ func (l *Logger) Log(event EventType, details map[string]interface{}) error {
 		Event:     string(event),
 		AgentID:   l.agentID,
 		Details:   details,
+		Seq:       l.seq + 1,
+		PrevHash:  l.lastHash,
+		KeyID:     l.keyID,
 	}
 
 	// Extract common fields from details
@@ -128,13 +269,25 @@ func (l *Logger) Log(event EventType, details map[string]interface{}) error {
 	}
 
 	// Sync to disk
-	return l.file.Sync()
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+
+	l.seq = entry.Seq
+	l.lastHash = hashLine(data)
+
+	if l.onEntry != nil {
+		l.onEntry(entry, data)
+	}
+	return nil
 }
 
-// signEntry creates a signature for an audit entry
-func (l *Logger) signEntry(entry *Entry) (string, error) {
-	// Create canonical representation for signing (without signature field)
-	data, err := json.Marshal(map[string]interface{}{
+// canonicalEntry returns the signed representation of an entry (without
+// the signature field). Chain fields are only covered when present so
+// entries written before chaining still verify; the same goes for the key
+// ID.
+func canonicalEntry(entry *Entry) ([]byte, error) {
+	fields := map[string]interface{}{
 		"timestamp":      entry.Timestamp,
 		"type":           entry.Type,
 		"event":          entry.Event,
@@ -145,7 +298,20 @@ func (l *Logger) signEntry(entry *Entry) (string, error) {
 		"user":           entry.User,
 		"policy_version": entry.PolicyVersion,
 		"details":        entry.Details,
-	})
+	}
+	if entry.Seq != 0 {
+		fields["seq"] = entry.Seq
+		fields["prev_hash"] = entry.PrevHash
+	}
+	if entry.KeyID != "" {
+		fields["key_id"] = entry.KeyID
+	}
+	return json.Marshal(fields)
+}
+
+// signEntry creates a signature for an audit entry
+func (l *Logger) signEntry(entry *Entry) (string, error) {
+	data, err := canonicalEntry(entry)
 	if err != nil {
 		return "", err
 	}
@@ -166,18 +332,7 @@ func VerifyEntry(entry *Entry, publicKey ed25519.PublicKey) error {
 	}
 
 	// Create canonical data (same as signing)
-	data, err := json.Marshal(map[string]interface{}{
-		"timestamp":      entry.Timestamp,
-		"type":           entry.Type,
-		"event":          entry.Event,
-		"agent_id":       entry.AgentID,
-		"job_id":         entry.JobID,
-		"command":        entry.Command,
-		"status":         entry.Status,
-		"user":           entry.User,
-		"policy_version": entry.PolicyVersion,
-		"details":        entry.Details,
-	})
+	data, err := canonicalEntry(entry)
 	if err != nil {
 		return fmt.Errorf("failed to marshal entry: %w", err)
 	}
@@ -190,13 +345,18 @@ func VerifyEntry(entry *Entry, publicKey ed25519.PublicKey) error {
 	return nil
 }
 
-// Close closes the audit log file
+// Close writes a final checkpoint and closes the audit log file
 func (l *Logger) Close() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	if l.file != nil {
-		return l.file.Close()
+		err := l.checkpointIfDirty()
+		if closeErr := l.file.Close(); err == nil {
+			err = closeErr
+		}
+		l.file = nil
+		return err
 	}
 	return nil
 }
@@ -206,8 +366,11 @@ func (l *Logger) Rotate() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	// Close current file
+	// Close current file; the checkpoint seals its last entries
 	if l.file != nil {
+		if err := l.checkpointIfDirty(); err != nil {
+			return err
+		}
 		if err := l.file.Close(); err != nil {
 			return err
 		}
@@ -228,7 +391,9 @@ func (l *Logger) Rotate() error {
 	return nil
 }
 
-// CleanupOldLogs removes audit logs older than retention period
+// CleanupOldLogs removes audit logs older than retention period. It leaves
+// no record of what it removed, so the verifier reports the start of the
+// chain as missing; loggers should use Prune instead.
 func CleanupOldLogs(retentionDays int) error {
 	auditDir := filepath.Join(config.GetStateDir(), "audit")
 	
@@ -303,6 +468,53 @@ func (l *Logger) LogUpdate(version string, success bool) error {
 	})
 }
 
+// LogStartup logs the agent starting
+func (l *Logger) LogStartup(version string) error {
+	return l.Log(EventStartup, map[string]interface{}{
+		"version": version,
+	})
+}
+
+// LogShutdown logs the agent stopping
+func (l *Logger) LogShutdown(reason string) error {
+	return l.Log(EventShutdown, map[string]interface{}{
+		"reason": reason,
+	})
+}
+
+// LogEnrollment logs the agent taking an identity from the hub. method is
+// how it was obtained, e.g. "token", "seed" or "clone_recovery".
+func (l *Logger) LogEnrollment(method, hubURL string) error {
+	return l.Log(EventEnrollment, map[string]interface{}{
+		"method":  method,
+		"hub_url": hubURL,
+	})
+}
+
+// LogConsent logs the local user's answer to a consent prompt. outcome is
+// approved, denied or timeout; responder is the account that answered.
+func (l *Logger) LogConsent(jobID, outcome, summary, responder, requestedBy string) error {
+	details := map[string]interface{}{
+		"job_id":       jobID,
+		"status":       outcome,
+		"command":      summary,
+		"requested_by": requestedBy,
+	}
+	if responder != "" {
+		details["user"] = responder
+	}
+	return l.Log(EventConsent, details)
+}
+
+// LogForwardGap logs chained entries that were removed before the hub
+// acknowledged them
+func (l *Logger) LogForwardGap(fromSeq, toSeq uint64) error {
+	return l.Log(EventForwardGap, map[string]interface{}{
+		"from_seq": fromSeq,
+		"to_seq":   toSeq,
+	})
+}
+
 // LogPolicyViolation logs a policy violation event
 func (l *Logger) LogPolicyViolation(violationType, resource string, jobID string) error {
 	return l.Log(EventPolicyViolation, map[string]interface{}{
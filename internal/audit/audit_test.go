@@ -0,0 +1,388 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLogger(t *testing.T, dir string, key ed25519.PrivateKey) *Logger {
+	t.Helper()
+	l, err := NewLoggerWithOptions("agent-1", key, Options{Dir: dir, CheckpointInterval: 3})
+	if err != nil {
+		t.Fatalf("NewLoggerWithOptions() error = %v", err)
+	}
+	return l
+}
+
+func newKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub, priv
+}
+
+// writeEntries logs n job entries and closes the logger
+func writeEntries(t *testing.T, dir string, key ed25519.PrivateKey, n int) {
+	t.Helper()
+	l := newTestLogger(t, dir, key)
+	for i := 0; i < n; i++ {
+		if err := l.LogJobExecution("job", "exec", "success", "whoami", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// currentLog returns the path of today's log file
+func currentLog(dir string) string {
+	return filepath.Join(dir, "audit-"+time.Now().Format("2006-01-02")+".log")
+}
+
+func readLines(t *testing.T, path string) [][]byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+}
+
+func writeLines(t *testing.T, path string, lines [][]byte) {
+	t.Helper()
+	data := append(bytes.Join(lines, []byte("\n")), '\n')
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustVerify(t *testing.T, dir string, pub ed25519.PublicKey) *VerifyReport {
+	t.Helper()
+	report, err := Verify(dir, pub)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	return report
+}
+
+func TestVerify_IntactChainAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv := newKey(t)
+
+	writeEntries(t, dir, priv, 4)
+	// Yesterday's file; the chain continues into today's
+	if err := os.Rename(currentLog(dir), filepath.Join(dir, "audit-2000-01-01.log")); err != nil {
+		t.Fatal(err)
+	}
+	writeEntries(t, dir, priv, 2)
+
+	report := mustVerify(t, dir, pub)
+	if report.Break != nil {
+		t.Fatalf("Verify() break = %v", report.Break)
+	}
+	if report.Files != 2 || report.FirstSeq != 1 || report.LastSeq != uint64(report.Entries) {
+		t.Errorf("report = %+v", report)
+	}
+	if report.Checkpoints == 0 {
+		t.Error("no checkpoints written")
+	}
+}
+
+func TestVerify_DetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(lines [][]byte) [][]byte
+		reason string
+	}{
+		{
+			name: "deleted entry",
+			tamper: func(lines [][]byte) [][]byte {
+				return append(lines[:1:1], lines[2:]...)
+			},
+			reason: "expected seq 2",
+		},
+		{
+			name: "reordered entries",
+			tamper: func(lines [][]byte) [][]byte {
+				lines[0], lines[1] = lines[1], lines[0]
+				return lines
+			},
+			reason: "removed or reordered",
+		},
+		{
+			name: "modified entry",
+			tamper: func(lines [][]byte) [][]byte {
+				lines[1] = bytes.Replace(lines[1], []byte("whoami"), []byte("id"), 1)
+				return lines
+			},
+			reason: "invalid signature",
+		},
+		{
+			name: "removed newest entries",
+			tamper: func(lines [][]byte) [][]byte {
+				return lines[:2]
+			},
+			reason: "newest entries removed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			pub, priv := newKey(t)
+			writeEntries(t, dir, priv, 5)
+
+			path := currentLog(dir)
+			writeLines(t, path, tt.tamper(readLines(t, path)))
+
+			report := mustVerify(t, dir, pub)
+			if report.Break == nil {
+				t.Fatal("Verify() found no break")
+			}
+			if !strings.Contains(report.Break.Reason, tt.reason) {
+				t.Errorf("Break = %v, want reason containing %q", report.Break, tt.reason)
+			}
+		})
+	}
+}
+
+func TestVerify_RemovedOldFile(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv := newKey(t)
+
+	writeEntries(t, dir, priv, 2)
+	old := filepath.Join(dir, "audit-2000-01-01.log")
+	if err := os.Rename(currentLog(dir), old); err != nil {
+		t.Fatal(err)
+	}
+	writeEntries(t, dir, priv, 2)
+
+	// Removed by hand: reported
+	saved, err := os.ReadFile(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(old); err != nil {
+		t.Fatal(err)
+	}
+	if report := mustVerify(t, dir, pub); report.Break == nil || !strings.Contains(report.Break.Reason, "missing") {
+		t.Errorf("Break = %v, want missing entries", report.Break)
+	}
+
+	// Removed by retention: recorded in the chain and accepted
+	if err := os.WriteFile(old, saved, 0600); err != nil {
+		t.Fatal(err)
+	}
+	l := newTestLogger(t, dir, priv)
+	removed, err := l.Prune(30)
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if len(removed) != 1 || removed[0] != filepath.Base(old) {
+		t.Errorf("Prune() removed %v", removed)
+	}
+	l.Close()
+
+	if report := mustVerify(t, dir, pub); report.Break != nil {
+		t.Errorf("Verify() after Prune break = %v", report.Break)
+	}
+}
+
+func TestNewLogger_RecoversTornEntry(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv := newKey(t)
+	writeEntries(t, dir, priv, 2)
+
+	// A crash mid-write leaves half a line
+	f, err := os.OpenFile(currentLog(dir), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"timestamp":"2026-`)
+	f.Close()
+
+	writeEntries(t, dir, priv, 2)
+
+	if report := mustVerify(t, dir, pub); report.Break != nil {
+		t.Errorf("Verify() break = %v", report.Break)
+	}
+}
+
+func TestVerify_AcceptsUnchainedEntries(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv := newKey(t)
+
+	// An entry as written before chaining
+	legacy := &Entry{Timestamp: "2025-01-01T00:00:00Z", Type: "audit", Event: string(EventStartup), User: "SYSTEM"}
+	l := &Logger{privateKey: priv}
+	signature, err := l.signEntry(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy.Signature = signature
+	data, err := jsonLine(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLines(t, filepath.Join(dir, "audit-2000-01-01.log"), [][]byte{data})
+
+	writeEntries(t, dir, priv, 2)
+
+	report := mustVerify(t, dir, pub)
+	if report.Break != nil {
+		t.Fatalf("Verify() break = %v", report.Break)
+	}
+	if report.Unchained != 1 || report.FirstSeq != 1 {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestNewLogger_ArchivesChainOfPreviousKey(t *testing.T) {
+	dir := t.TempDir()
+	oldPub, oldPriv := newKey(t)
+	newPub, newPriv := newKey(t)
+	writeEntries(t, dir, oldPriv, 2)
+
+	l := newTestLogger(t, dir, newPriv)
+	archived := l.Archived()
+	if archived == "" {
+		t.Fatal("Archived() is empty, want the old chain moved aside")
+	}
+	if err := l.LogEnrollment("reenroll", "https://hub.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	report := mustVerify(t, dir, newPub)
+	if report.Break != nil || report.FirstSeq != 1 {
+		t.Errorf("Verify(new chain) = %+v", report)
+	}
+	if report := mustVerify(t, archived, oldPub); report.Break != nil || report.LastSeq == 0 {
+		t.Errorf("Verify(archive) = %+v", report)
+	}
+
+	// The same key continues the chain
+	l = newTestLogger(t, dir, newPriv)
+	if l.Archived() != "" {
+		t.Errorf("Archived() = %q for the signing key of the chain", l.Archived())
+	}
+	l.Close()
+
+	// Verify reports the archive, checking only its links under the new key
+	report = mustVerify(t, dir, newPub)
+	if len(report.Archives) != 1 {
+		t.Fatalf("Verify() archives = %d, want 1", len(report.Archives))
+	}
+	archive := report.Archives[0]
+	if archive.Name != filepath.Base(archived) || archive.SignaturesChecked || archive.KeyID != KeyID(oldPub) {
+		t.Errorf("archive = %+v", archive)
+	}
+	if !report.Intact() || archive.LastSeq == 0 {
+		t.Errorf("archive report = %+v, break = %v", archive.VerifyReport, archive.Break)
+	}
+
+	// A broken link in the archive fails the whole verification
+	path := filepath.Join(archived, filepath.Base(currentLog(dir)))
+	lines := readLines(t, path)
+	writeLines(t, path, append(lines[:1:1], lines[2:]...))
+	if report := mustVerify(t, dir, newPub); report.Intact() {
+		t.Error("Intact() with an entry removed from the archive")
+	}
+}
+
+func TestNewLogger_RejectsModifiedHead(t *testing.T) {
+	dir := t.TempDir()
+	_, priv := newKey(t)
+	writeEntries(t, dir, priv, 2)
+
+	// Same key, but the last entry no longer verifies: tampering, not a
+	// new identity
+	path := currentLog(dir)
+	lines := readLines(t, path)
+	lines[len(lines)-1] = bytes.Replace(lines[len(lines)-1], []byte(`"type":"audit"`), []byte(`"type":"forged"`), 1)
+	writeLines(t, path, lines)
+
+	_, err := NewLoggerWithOptions("agent-1", priv, Options{Dir: dir})
+	if !errors.Is(err, ErrHeadInvalid) {
+		t.Fatalf("NewLoggerWithOptions() error = %v, want ErrHeadInvalid", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ArchiveDir)); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("modified chain was archived")
+	}
+}
+
+func TestNewLogger_MalformedHead(t *testing.T) {
+	dir := t.TempDir()
+	_, priv := newKey(t)
+	writeEntries(t, dir, priv, 2)
+
+	f, err := os.OpenFile(currentLog(dir), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("not json\n")
+	f.Close()
+
+	_, err = NewLoggerWithOptions("agent-1", priv, Options{Dir: dir})
+	var malformed *MalformedError
+	if !errors.As(err, &malformed) {
+		t.Fatalf("NewLoggerWithOptions() error = %v, want *MalformedError", err)
+	}
+	if malformed.File != filepath.Base(currentLog(dir)) || malformed.Line != len(readLines(t, currentLog(dir))) {
+		t.Errorf("MalformedError = %+v", malformed)
+	}
+}
+
+func TestLog_CallsOnWrite(t *testing.T) {
+	_, priv := newKey(t)
+	writes := 0
+	l, err := NewLoggerWithOptions("agent-1", priv, Options{Dir: t.TempDir(), OnWrite: func() { writes++ }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	l.LogStartup("1.0.0")
+	l.LogShutdown("test")
+	if writes != 2 {
+		t.Errorf("OnWrite called %d times, want 2", writes)
+	}
+}
+
+func TestLogConsent(t *testing.T) {
+	pub, priv := newKey(t)
+	dir := t.TempDir()
+	l := newTestLogger(t, dir, priv)
+	if err := l.LogConsent("job-7", "approved", "systemctl restart nginx", "alice (uid 1000)", "tech@msp"); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	var entry Entry
+	if err := json.Unmarshal(readLines(t, currentLog(dir))[0], &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Event != string(EventConsent) || entry.JobID != "job-7" || entry.Status != "approved" ||
+		entry.User != "alice (uid 1000)" || entry.Details["requested_by"] != "tech@msp" {
+		t.Errorf("consent entry = %+v", entry)
+	}
+	if report := mustVerify(t, dir, pub); report.Break != nil {
+		t.Errorf("Verify() break = %v", report.Break)
+	}
+}
+
+func jsonLine(entry *Entry) ([]byte, error) {
+	return json.Marshal(entry)
+}
@@ -0,0 +1,423 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CheckpointFile holds the latest signed checkpoint. It records the head of
+// the chain outside the log files, so removing the newest entries or files
+// is detected.
+const CheckpointFile = "checkpoint.json"
+
+// ArchiveDir holds chains signed by a previous agent key, one directory
+// per chain
+const ArchiveDir = "archive"
+
+// genesisHash is the previous hash of the first chained entry
+var genesisHash = strings.Repeat("0", sha256.Size*2)
+
+// Checkpoint is a signed record of the head of the chain
+type Checkpoint struct {
+	AgentID   string `json:"agent_id"`
+	Seq       uint64 `json:"seq"`
+	Hash      string `json:"hash"`
+	Timestamp string `json:"timestamp"`
+	Signature string `json:"signature"`
+}
+
+// hashLine returns the chain hash of an entry as written, without the
+// trailing newline
+func hashLine(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// logFiles returns the audit log files in dir, oldest first
+func logFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, "audit-") && strings.HasSuffix(name, ".log") {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// recoverHead returns the last entry in dir and its chain hash, or nil if
+// there is none. A line torn by a crash mid-write is cut off so the next
+// entry starts on a line of its own. A complete last line that does not
+// parse is returned as a *MalformedError.
+func recoverHead(dir string) (*Entry, string, error) {
+	files, err := logFiles(dir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := len(files) - 1; i >= 0; i-- {
+		data, err := os.ReadFile(files[i])
+		if err != nil {
+			return nil, "", err
+		}
+
+		complete := bytes.LastIndexByte(data, '\n') + 1
+		if complete < len(data) {
+			if err := os.Truncate(files[i], int64(complete)); err != nil {
+				return nil, "", fmt.Errorf("failed to remove incomplete entry: %w", err)
+			}
+			data = data[:complete]
+		}
+
+		lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+		last := lines[len(lines)-1]
+		if len(last) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(last, &entry); err != nil {
+			return nil, "", &MalformedError{File: filepath.Base(files[i]), Line: len(lines), Err: err}
+		}
+		return &entry, hashLine(last), nil
+	}
+
+	return nil, genesisHash, nil
+}
+
+// KeyID returns the identifier of publicKey recorded in the entries it
+// signs
+func KeyID(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+// ErrHeadInvalid is returned when the last entry of a chain signed with the
+// current key does not verify, i.e. the log was modified
+var ErrHeadInvalid = errors.New("last audit entry does not verify with the agent key")
+
+// signedByOtherKey reports whether the chain ending in head was signed by
+// another key than publicKey. The head's recorded key decides; a head that
+// names publicKey but does not verify is an error, not a new key. Heads
+// written before the key was recorded count as this key's if they or the
+// checkpoint file verify with it.
+func signedByOtherKey(dir string, head *Entry, publicKey ed25519.PublicKey) (bool, error) {
+	verifyErr := VerifyEntry(head, publicKey)
+
+	if head.KeyID != "" {
+		if head.KeyID != KeyID(publicKey) {
+			return true, nil
+		}
+		if verifyErr != nil {
+			return false, fmt.Errorf("%w: %v", ErrHeadInvalid, verifyErr)
+		}
+		return false, nil
+	}
+
+	if verifyErr == nil {
+		return false, nil
+	}
+	if cp, err := LoadCheckpoint(dir, publicKey); err == nil && cp != nil {
+		return false, fmt.Errorf("%w: %v", ErrHeadInvalid, verifyErr)
+	}
+	return true, nil
+}
+
+// archiveChain moves the log files and chain state in dir to a new
+// directory under ArchiveDir, so a chain signed by another key stays
+// verifiable with that key while a new chain starts. It returns the
+// archive directory.
+func archiveChain(dir, agentID string) (string, error) {
+	files, err := logFiles(dir)
+	if err != nil {
+		return "", err
+	}
+
+	name := time.Now().UTC().Format("20060102T150405Z")
+	if agentID != "" {
+		name += "-" + agentID
+	}
+	archive := filepath.Join(dir, ArchiveDir, name)
+	if err := os.MkdirAll(archive, 0700); err != nil {
+		return "", fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	// Forwarding state belongs to the old chain; the new one starts unsent
+	for _, name := range []string{CheckpointFile, ForwardStateFile} {
+		files = append(files, filepath.Join(dir, name))
+	}
+	for _, path := range files {
+		err := os.Rename(path, filepath.Join(archive, filepath.Base(path)))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to archive %s: %w", filepath.Base(path), err)
+		}
+	}
+
+	return archive, nil
+}
+
+// checkpoint appends a signed checkpoint entry covering the chain so far
+// and records it in the checkpoint file; the caller holds l.mu
+func (l *Logger) checkpoint() error {
+	if err := l.log(EventCheckpoint, map[string]interface{}{
+		"covers_seq":  l.seq,
+		"covers_hash": l.lastHash,
+	}); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	l.sinceCheckpoint = 0
+
+	cp := &Checkpoint{
+		AgentID:   l.agentID,
+		Seq:       l.seq,
+		Hash:      l.lastHash,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	payload, err := checkpointPayload(cp)
+	if err != nil {
+		return err
+	}
+	cp.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(l.privateKey, payload))
+
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(filepath.Dir(l.filePath), CheckpointFile), data)
+}
+
+// checkpointIfDirty writes a checkpoint if entries were logged since the
+// last one; the caller holds l.mu
+func (l *Logger) checkpointIfDirty() error {
+	if l.sinceCheckpoint == 0 {
+		return nil
+	}
+	return l.checkpoint()
+}
+
+// checkpointPayload returns the signed representation of a checkpoint
+func checkpointPayload(cp *Checkpoint) ([]byte, error) {
+	unsigned := *cp
+	unsigned.Signature = ""
+	return json.Marshal(&unsigned)
+}
+
+// LoadCheckpoint reads and verifies the checkpoint file in dir. It returns
+// nil if no checkpoint has been written.
+func LoadCheckpoint(dir string, publicKey ed25519.PublicKey) (*Checkpoint, error) {
+	data, err := os.ReadFile(filepath.Join(dir, CheckpointFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(cp.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint signature: %w", err)
+	}
+	payload, err := checkpointPayload(&cp)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(publicKey, payload, signature) {
+		return nil, fmt.Errorf("invalid checkpoint signature")
+	}
+
+	return &cp, nil
+}
+
+// Prune removes daily files older than the retention period and records in
+// the chain where the retained entries start, so the verifier can tell
+// retention from tampering. The current file is never removed, nor with
+// KeepUnforwarded a file the hub has not acknowledged.
+func (l *Logger) Prune(retentionDays int) ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	files, err := logFiles(filepath.Dir(l.filePath))
+	if err != nil {
+		return nil, err
+	}
+
+	// Files from the one holding the last acknowledged entry on may hold
+	// entries still to be forwarded; all of them before anything was
+	// acknowledged
+	var hold string
+	if l.keepUnforwarded {
+		state, err := loadForwardState(filepath.Dir(l.filePath))
+		if err != nil {
+			return nil, err
+		}
+		hold = state.File
+	}
+
+	cutoff := "audit-" + time.Now().AddDate(0, 0, -retentionDays).Format("2006-01-02") + ".log"
+
+	var removed []string
+	for _, file := range files {
+		name := filepath.Base(file)
+		if file == l.filePath || name >= cutoff || (l.keepUnforwarded && name >= hold) {
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %w", filepath.Base(file), err)
+		}
+		removed = append(removed, filepath.Base(file))
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+
+	// Where the retained chain starts; the prune entry itself if no
+	// chained entries are left
+	firstSeq, firstPrev := l.seq+1, l.lastHash
+	if entry, err := firstChained(filepath.Dir(l.filePath)); err != nil {
+		return removed, err
+	} else if entry != nil {
+		firstSeq, firstPrev = entry.Seq, entry.PrevHash
+	}
+
+	names := make([]interface{}, len(removed))
+	for i, name := range removed {
+		names[i] = name
+	}
+	if err := l.log(EventLogPruned, map[string]interface{}{
+		"files":           names,
+		"retention_days":  retentionDays,
+		"first_seq":       firstSeq,
+		"first_prev_hash": firstPrev,
+	}); err != nil {
+		return removed, err
+	}
+	return removed, l.checkpoint()
+}
+
+// firstChained returns the first chained entry in dir
+func firstChained(dir string) (*Entry, error) {
+	var first *Entry
+	err := Scan(dir, func(file string, line int, entry *Entry, raw []byte) error {
+		if entry.Seq != 0 {
+			first = entry
+			return errStopScan
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return first, nil
+}
+
+// errStopScan ends a Scan early without an error
+var errStopScan = errors.New("stop scan")
+
+// Scan calls fn for every entry in dir, oldest first. raw is the line as
+// written, without the newline.
+func Scan(dir string, fn func(file string, line int, entry *Entry, raw []byte) error) error {
+	return scanFrom(dir, "", fn)
+}
+
+// scanFrom is Scan starting at the file named from; files that sort
+// before it are skipped
+func scanFrom(dir, from string, fn func(file string, line int, entry *Entry, raw []byte) error) error {
+	files, err := logFiles(dir)
+	if err != nil {
+		return fmt.Errorf("failed to list audit logs: %w", err)
+	}
+
+	for _, file := range files {
+		if filepath.Base(file) < from {
+			continue
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filepath.Base(file), err)
+		}
+
+		for i, raw := range bytes.Split(data, []byte("\n")) {
+			if len(raw) == 0 {
+				continue
+			}
+
+			var entry Entry
+			if err = json.Unmarshal(raw, &entry); err != nil {
+				err = &MalformedError{File: filepath.Base(file), Line: i + 1, Err: err}
+			} else {
+				err = fn(filepath.Base(file), i+1, &entry, raw)
+			}
+			if errors.Is(err, errStopScan) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// MalformedError reports a line that is not a valid entry
+type MalformedError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *MalformedError) Error() string {
+	return fmt.Sprintf("%s:%d: malformed entry: %v", e.File, e.Line, e.Err)
+}
+
+func (e *MalformedError) Unwrap() error {
+	return e.Err
+}
+
+// writeFileAtomic replaces path with data via a flushed temporary file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
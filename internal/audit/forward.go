@@ -0,0 +1,359 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/retry"
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+const (
+	forwardPath = "/api/v1/agent/audit"
+
+	// ForwardStateFile records the last entry the hub acknowledged
+	ForwardStateFile = "forwarded.json"
+
+	defaultForwardBatch    = 100
+	defaultForwardInterval = 30 * time.Second
+)
+
+// Poster sends a request to the hub once; implemented by
+// transport.Client. The forwarder paces retries itself.
+type Poster interface {
+	PostOnce(ctx context.Context, path string, body interface{}) ([]byte, error)
+}
+
+// ForwarderOptions configures a forwarder
+type ForwarderOptions struct {
+	// Dir is the audit directory; default Dir()
+	Dir string
+
+	// BatchSize is the most entries sent in one request; default 100
+	BatchSize int
+
+	// Interval is how often the directory is checked for new entries when
+	// the logger does not call Notify; default 30s
+	Interval time.Duration
+
+	// Retry paces attempts while the hub is unreachable; default
+	// retry.DefaultConfig()
+	Retry *retry.Config
+
+	// OnLag is called after every attempt with the forwarding lag
+	OnLag func(Lag)
+
+	// OnGap is called once with the sequence numbers of entries removed
+	// before the hub acknowledged them, e.g. by retention
+	OnGap func(fromSeq, toSeq uint64)
+}
+
+// Lag describes how far the hub is behind the local audit log
+type Lag struct {
+	AckedSeq uint64 `json:"acked_seq"`
+	HeadSeq  uint64 `json:"head_seq"`
+
+	// Entries is the number of chained entries not yet acknowledged and
+	// Oldest the timestamp of the first of them
+	Entries uint64    `json:"entries"`
+	Oldest  time.Time `json:"oldest,omitempty"`
+
+	LastSuccess time.Time `json:"last_success,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// Age returns how long the oldest unacknowledged entry has waited
+func (l Lag) Age() time.Duration {
+	if l.Entries == 0 || l.Oldest.IsZero() {
+		return 0
+	}
+	return time.Since(l.Oldest)
+}
+
+// forwardState is persisted in ForwardStateFile
+type forwardState struct {
+	AckedSeq uint64 `json:"acked_seq"`
+
+	// File holds the acknowledged entry; earlier files are not rescanned
+	File string `json:"file,omitempty"`
+}
+
+// Forwarder ships chained audit entries to the hub in order and tracks the
+// last acknowledged sequence number on disk, so entries survive restarts
+// and hub outages until the hub has them. Entries written before chaining
+// have no sequence number and are not forwarded.
+type Forwarder struct {
+	agentID string
+	client  Poster
+	opts    ForwarderOptions
+	notify  chan struct{}
+
+	mu    sync.Mutex
+	state forwardState
+	lag   Lag
+
+	// First sequence number of the last gap reported to OnGap
+	gapFrom uint64
+}
+
+// NewForwarder creates a forwarder, resuming after the last acknowledged
+// entry
+func NewForwarder(agentID string, client Poster, opts ForwarderOptions) (*Forwarder, error) {
+	if opts.Dir == "" {
+		opts.Dir = Dir()
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultForwardBatch
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultForwardInterval
+	}
+	if opts.Retry == nil {
+		opts.Retry = retry.DefaultConfig()
+	}
+
+	f := &Forwarder{
+		agentID: agentID,
+		client:  client,
+		opts:    opts,
+		notify:  make(chan struct{}, 1),
+	}
+
+	state, err := loadForwardState(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	f.state = state
+	f.lag.AckedSeq = state.AckedSeq
+
+	return f, nil
+}
+
+// loadForwardState reads the forwarding state in dir; it is empty if
+// nothing was acknowledged yet
+func loadForwardState(dir string) (forwardState, error) {
+	var state forwardState
+	data, err := os.ReadFile(filepath.Join(dir, ForwardStateFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read forwarding state: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to parse forwarding state: %w", err)
+	}
+	return state, nil
+}
+
+// Notify tells the forwarder new entries were written. It never blocks.
+func (f *Forwarder) Notify() {
+	select {
+	case f.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Lag returns the forwarding lag after the last attempt
+func (f *Forwarder) Lag() Lag {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lag
+}
+
+// Run forwards entries until ctx is cancelled, backing off while the hub
+// is unreachable
+func (f *Forwarder) Run(ctx context.Context) {
+	backoff := retry.NewBackoff(f.opts.Retry)
+	wait := time.Duration(0)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		case <-f.notify:
+			// New entries do not cut a backoff short
+			if backoff.Attempts() > 0 {
+				continue
+			}
+		}
+
+		if err := f.Flush(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			wait = backoff.Next()
+			continue
+		}
+
+		backoff.Reset()
+		wait = f.opts.Interval
+	}
+}
+
+// Flush sends every unacknowledged entry, one batch at a time
+func (f *Forwarder) Flush(ctx context.Context) error {
+	for {
+		sent, err := f.sendBatch(ctx)
+		if err != nil || sent < f.opts.BatchSize {
+			return err
+		}
+	}
+}
+
+// sendBatch sends the next batch and returns how many entries it held
+func (f *Forwarder) sendBatch(ctx context.Context) (int, error) {
+	f.mu.Lock()
+	state := f.state
+	f.mu.Unlock()
+
+	var (
+		batch   []json.RawMessage
+		files   []string
+		seqs    []uint64
+		stamps  []time.Time // of the batch, then the first entry after it
+		head    uint64
+		pending uint64
+	)
+
+	err := scanFrom(f.opts.Dir, state.File, func(file string, line int, entry *Entry, raw []byte) error {
+		if entry.Seq == 0 {
+			return nil
+		}
+		head = entry.Seq
+		if entry.Seq <= state.AckedSeq {
+			return nil
+		}
+
+		pending++
+		if len(stamps) <= len(batch) {
+			ts, _ := time.Parse(time.RFC3339, entry.Timestamp)
+			stamps = append(stamps, ts)
+		}
+		if len(batch) < f.opts.BatchSize {
+			batch = append(batch, append(json.RawMessage(nil), raw...))
+			files = append(files, file)
+			seqs = append(seqs, entry.Seq)
+		}
+		return nil
+	})
+	oldest := func(acked int) time.Time {
+		if acked < len(stamps) {
+			return stamps[acked]
+		}
+		return time.Time{}
+	}
+	if err != nil {
+		f.recordLag(state, head, pending, oldest(0), err)
+		return 0, err
+	}
+
+	// A new chain, e.g. after the audit directory was reset
+	if head < state.AckedSeq {
+		if err := f.saveState(forwardState{}); err != nil {
+			return 0, err
+		}
+		f.mu.Lock()
+		f.state = forwardState{}
+		f.mu.Unlock()
+		return f.sendBatch(ctx)
+	}
+
+	if len(batch) == 0 {
+		f.recordLag(state, head, 0, time.Time{}, nil)
+		return 0, nil
+	}
+
+	acked := 0
+	if seqs[0] > state.AckedSeq+1 {
+		f.reportGap(state.AckedSeq+1, seqs[0]-1)
+	}
+
+	respData, err := f.client.PostOnce(ctx, forwardPath, api.AuditBatch{AgentID: f.agentID, Entries: batch})
+	if err == nil {
+		var ack api.AuditAck
+		if err = json.Unmarshal(respData, &ack); err != nil {
+			err = fmt.Errorf("failed to parse audit acknowledgement: %w", err)
+		} else {
+			// The hub may store part of a batch; the rest is resent
+			for i, seq := range seqs {
+				if seq == ack.AckedSeq {
+					acked = i + 1
+				}
+			}
+		}
+		if err == nil && acked == 0 {
+			err = fmt.Errorf("hub acknowledged seq %d, expected %d to %d", ack.AckedSeq, seqs[0], seqs[len(seqs)-1])
+		}
+		if err == nil {
+			next := forwardState{AckedSeq: ack.AckedSeq, File: files[acked-1]}
+			if err = f.saveState(next); err == nil {
+				state = next
+				f.mu.Lock()
+				f.state = state
+				f.mu.Unlock()
+			}
+		}
+	}
+	if err != nil {
+		f.recordLag(state, head, pending, oldest(0), err)
+		return 0, err
+	}
+
+	pending -= uint64(acked)
+	f.recordLag(state, head, pending, oldest(acked), nil)
+	return acked, nil
+}
+
+// reportGap reports missing entries once, however often the batch after
+// them is retried
+func (f *Forwarder) reportGap(from, to uint64) {
+	f.mu.Lock()
+	reported := f.gapFrom == from
+	f.gapFrom = from
+	f.mu.Unlock()
+
+	if !reported && f.opts.OnGap != nil {
+		f.opts.OnGap(from, to)
+	}
+}
+
+// recordLag updates the lag and reports it
+func (f *Forwarder) recordLag(state forwardState, head, pending uint64, oldest time.Time, err error) {
+	f.mu.Lock()
+	f.lag.AckedSeq = state.AckedSeq
+	f.lag.HeadSeq = head
+	f.lag.Entries = pending
+	f.lag.Oldest = time.Time{}
+	if pending > 0 {
+		f.lag.Oldest = oldest
+	}
+	if err != nil {
+		f.lag.LastError = err.Error()
+	} else {
+		f.lag.LastError = ""
+		f.lag.LastSuccess = time.Now()
+	}
+	lag := f.lag
+	f.mu.Unlock()
+
+	if f.opts.OnLag != nil {
+		f.opts.OnLag(lag)
+	}
+}
+
+func (f *Forwarder) saveState(state forwardState) error {
+	data, err := json.MarshalIndent(&state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal forwarding state: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(f.opts.Dir, ForwardStateFile), data)
+}
@@ -0,0 +1,212 @@
+package audit
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+// fakeHub records forwarded entries and acknowledges up to limit per batch
+type fakeHub struct {
+	received []uint64
+	limit    int
+	err      error
+}
+
+func (h *fakeHub) PostOnce(ctx context.Context, path string, body interface{}) ([]byte, error) {
+	if h.err != nil {
+		return nil, h.err
+	}
+
+	batch := body.(api.AuditBatch)
+	var acked uint64
+	for i, raw := range batch.Entries {
+		if h.limit > 0 && i >= h.limit {
+			break
+		}
+		var entry Entry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil, err
+		}
+		h.received = append(h.received, entry.Seq)
+		acked = entry.Seq
+	}
+	return json.Marshal(api.AuditAck{AckedSeq: acked})
+}
+
+func TestForwarder_Flush(t *testing.T) {
+	dir := t.TempDir()
+	_, priv := newKey(t)
+	writeEntries(t, dir, priv, 5) // 5 entries and a checkpoint
+
+	hub := &fakeHub{}
+	f, err := NewForwarder("agent-1", hub, ForwarderOptions{Dir: dir, BatchSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if len(hub.received) != 7 {
+		t.Fatalf("hub received %v, want seq 1 to 7", hub.received)
+	}
+	for i, seq := range hub.received {
+		if seq != uint64(i+1) {
+			t.Fatalf("hub received %v out of order", hub.received)
+		}
+	}
+	if lag := f.Lag(); lag.Entries != 0 || lag.AckedSeq != 7 || lag.HeadSeq != 7 {
+		t.Errorf("Lag() = %+v", lag)
+	}
+
+	// A restarted forwarder resumes after the acknowledged entry
+	writeEntries(t, dir, priv, 1)
+	f, err = NewForwarder("agent-1", hub, ForwarderOptions{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := hub.received[7:]; len(got) != 2 || got[0] != 8 {
+		t.Errorf("after restart hub received %v, want seq 8 and 9", got)
+	}
+}
+
+func TestForwarder_OutageAndPartialAck(t *testing.T) {
+	dir := t.TempDir()
+	_, priv := newKey(t)
+	writeEntries(t, dir, priv, 3) // 3 entries and a checkpoint
+
+	hub := &fakeHub{err: errors.New("hub unreachable")}
+	var reported []Lag
+	f, err := NewForwarder("agent-1", hub, ForwarderOptions{
+		Dir:   dir,
+		OnLag: func(lag Lag) { reported = append(reported, lag) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Flush(context.Background()); err == nil {
+		t.Fatal("Flush() during outage succeeded")
+	}
+	lag := f.Lag()
+	if lag.Entries != 4 || lag.AckedSeq != 0 || lag.LastError == "" || lag.Oldest.IsZero() {
+		t.Errorf("Lag() during outage = %+v", lag)
+	}
+	if len(reported) != 1 {
+		t.Errorf("OnLag called %d times, want 1", len(reported))
+	}
+
+	// The hub comes back but stores two entries per request
+	hub.err = nil
+	hub.limit = 2
+	if err := f.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if lag := f.Lag(); lag.Entries != 2 || lag.AckedSeq != 2 {
+		t.Errorf("Lag() after partial ack = %+v", lag)
+	}
+	if err := f.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if lag := f.Lag(); lag.Entries != 0 || lag.AckedSeq != 4 {
+		t.Errorf("Lag() after second flush = %+v", lag)
+	}
+}
+
+// writeDay logs n entries into the file of a past day
+func writeDay(t *testing.T, dir string, key ed25519.PrivateKey, n int, day string) {
+	t.Helper()
+	writeEntries(t, dir, key, n)
+	if err := os.Rename(currentLog(dir), filepath.Join(dir, "audit-"+day+".log")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogger_PruneKeepsUnforwarded(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv := newKey(t)
+	writeDay(t, dir, priv, 2, "2000-01-01") // seq 1 to 3
+	writeDay(t, dir, priv, 2, "2000-01-02") // seq 4 to 6
+	writeEntries(t, dir, priv, 1)
+
+	l, err := NewLoggerWithOptions("agent-1", priv, Options{Dir: dir, CheckpointInterval: 3, KeepUnforwarded: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// Nothing acknowledged yet
+	removed, err := l.Prune(30)
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if len(removed) != 0 {
+		t.Fatalf("Prune() before forwarding removed %v", removed)
+	}
+
+	// The hub acknowledges up to seq 4, in the second file
+	f, err := NewForwarder("agent-1", &fakeHub{}, ForwarderOptions{Dir: dir, BatchSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.sendBatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err = l.Prune(30)
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if len(removed) != 1 || removed[0] != "audit-2000-01-01.log" {
+		t.Errorf("Prune() removed %v, want only the acknowledged file", removed)
+	}
+	if report := mustVerify(t, dir, pub); report.Break != nil {
+		t.Errorf("Verify() after Prune break = %v", report.Break)
+	}
+}
+
+func TestForwarder_ReportsGap(t *testing.T) {
+	dir := t.TempDir()
+	_, priv := newKey(t)
+	writeDay(t, dir, priv, 2, "2000-01-01") // seq 1 to 3
+	writeEntries(t, dir, priv, 2)           // seq 4 to 6
+
+	// Removed before the hub had it
+	if err := os.Remove(filepath.Join(dir, "audit-2000-01-01.log")); err != nil {
+		t.Fatal(err)
+	}
+
+	type gap struct{ from, to uint64 }
+	var gaps []gap
+	hub := &fakeHub{err: errors.New("hub unreachable")}
+	f, err := NewForwarder("agent-1", hub, ForwarderOptions{
+		Dir:   dir,
+		OnGap: func(from, to uint64) { gaps = append(gaps, gap{from, to}) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Retries do not report the gap again
+	f.Flush(context.Background())
+	hub.err = nil
+	if err := f.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(gaps) != 1 || gaps[0] != (gap{1, 3}) {
+		t.Errorf("OnGap calls = %v, want seq 1 to 3 once", gaps)
+	}
+	if len(hub.received) != 3 || hub.received[0] != 4 {
+		t.Errorf("hub received %v, want seq 4 to 6", hub.received)
+	}
+}
@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query selects audit entries. Zero fields match everything.
+type Query struct {
+	Since  time.Time
+	Until  time.Time
+	Events []string
+	JobID  string
+	Status string
+
+	// Limit keeps only the newest entries; zero keeps all
+	Limit int
+}
+
+// Match reports whether entry is selected by q
+func (q *Query) Match(entry *Entry) bool {
+	if !q.Since.IsZero() || !q.Until.IsZero() {
+		ts, err := time.Parse(time.RFC3339, entry.Timestamp)
+		if err != nil {
+			return false
+		}
+		if !q.Since.IsZero() && ts.Before(q.Since) {
+			return false
+		}
+		if !q.Until.IsZero() && !ts.Before(q.Until) {
+			return false
+		}
+	}
+
+	if len(q.Events) > 0 {
+		found := false
+		for _, event := range q.Events {
+			if entry.Event == event {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if q.JobID != "" && entry.JobID != q.JobID {
+		return false
+	}
+	if q.Status != "" && !strings.EqualFold(entry.Status, q.Status) {
+		return false
+	}
+	return true
+}
+
+// Search returns the entries in dir selected by q, oldest first. A
+// malformed line fails the search rather than silently hiding entries.
+func Search(dir string, q *Query) ([]*Entry, error) {
+	var matches []*Entry
+	err := Scan(dir, func(file string, line int, entry *Entry, raw []byte) error {
+		if q.Match(entry) {
+			matches = append(matches, entry)
+			if q.Limit > 0 && len(matches) > q.Limit {
+				matches = matches[1:]
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// ParseTime parses a query bound: an RFC 3339 time, a local date
+// (2006-01-02) or a duration before now ("36h", "7d")
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: use RFC 3339, YYYY-MM-DD or a duration such as 24h or 7d", value)
+}
@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSearch(t *testing.T) {
+	dir := t.TempDir()
+	_, priv := newKey(t)
+
+	l := newTestLogger(t, dir, priv)
+	l.LogJobExecution("job-1", "exec", "success", "whoami", 1)
+	l.LogJobExecution("job-2", "exec", "failed", "false", 1)
+	l.LogPolicyViolation("command", "/bin/rm", "job-3")
+	l.Close()
+
+	tests := []struct {
+		name  string
+		query Query
+		want  int
+	}{
+		{"all", Query{}, 4}, // and a checkpoint
+		{"event", Query{Events: []string{string(EventJobExecuted)}}, 2},
+		{"events", Query{Events: []string{string(EventJobExecuted), string(EventPolicyViolation)}}, 3},
+		{"job", Query{JobID: "job-3"}, 1},
+		{"status", Query{Status: "FAILED"}, 1},
+		{"limit", Query{Events: []string{string(EventJobExecuted)}, Limit: 1}, 1},
+		{"since future", Query{Since: time.Now().Add(time.Hour)}, 0},
+		{"until past", Query{Until: time.Now().Add(-time.Hour)}, 0},
+		{"window", Query{Since: time.Now().Add(-time.Hour), Until: time.Now().Add(time.Hour)}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := Search(dir, &tt.query)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			if len(entries) != tt.want {
+				t.Errorf("Search() returned %d entries, want %d", len(entries), tt.want)
+			}
+		})
+	}
+
+	entries, _ := Search(dir, &Query{Events: []string{string(EventJobExecuted)}, Limit: 1})
+	if len(entries) == 1 && entries[0].JobID != "job-2" {
+		t.Errorf("Limit kept %s, want the newest entry job-2", entries[0].JobID)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"2026-10-13T08:00:00Z", time.Date(2026, 10, 13, 8, 0, 0, 0, time.UTC), false},
+		{"2026-10-13", time.Date(2026, 10, 13, 0, 0, 0, 0, time.UTC), false},
+		{"36h", now.Add(-36 * time.Hour), false},
+		{"7d", now.AddDate(0, 0, -7), false},
+		{"last tuesday", time.Time{}, true},
+		{"-5d", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTime(tt.value, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTime(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ChainBreak locates the first entry that fails verification
+type ChainBreak struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Seq    uint64 `json:"seq,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (b *ChainBreak) Error() string {
+	if b.File == "" {
+		return b.Reason
+	}
+	return fmt.Sprintf("%s:%d: %s", b.File, b.Line, b.Reason)
+}
+
+// VerifyReport summarizes a verification run
+type VerifyReport struct {
+	Files       int    `json:"files"`
+	Entries     int    `json:"entries"`
+	Unchained   int    `json:"unchained"`
+	Checkpoints int    `json:"checkpoints"`
+	FirstSeq    uint64 `json:"first_seq,omitempty"`
+	LastSeq     uint64 `json:"last_seq,omitempty"`
+
+	// Break is the first broken link; nil if the log is intact
+	Break *ChainBreak `json:"break,omitempty"`
+
+	// Archives are the chains under ArchiveDir, oldest first
+	Archives []*ArchiveReport `json:"archives,omitempty"`
+}
+
+// ArchiveReport summarizes the verification of an archived chain
+type ArchiveReport struct {
+	Name string `json:"name"`
+
+	// KeyID is the key the chain was signed with, if recorded
+	KeyID string `json:"key_id,omitempty"`
+
+	// SignaturesChecked is false when the chain was signed by another key
+	// than the one given; only its links and sequence were checked
+	SignaturesChecked bool `json:"signatures_checked"`
+
+	*VerifyReport
+}
+
+// Intact reports whether neither the chain nor any archive is broken
+func (r *VerifyReport) Intact() bool {
+	if r.Break != nil {
+		return false
+	}
+	for _, archive := range r.Archives {
+		if archive.Break != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify checks every signature in dir and the continuity of the hash
+// chain: sequence numbers, previous hashes, checkpoints, prune records and
+// the checkpoint file. It stops at the first broken link. Entries written
+// before chaining are only checked for their signature.
+//
+// Chains archived under ArchiveDir are verified the same way when they were
+// signed with publicKey; chains signed by a previous key only have their
+// links checked, and are reported as such.
+func Verify(dir string, publicKey ed25519.PublicKey) (*VerifyReport, error) {
+	report, err := verifyChain(dir, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, ArchiveDir))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to list audit archives: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		archive, err := verifyArchive(filepath.Join(dir, ArchiveDir, entry.Name()), publicKey)
+		if err != nil {
+			return nil, err
+		}
+		report.Archives = append(report.Archives, archive)
+	}
+
+	return report, nil
+}
+
+// verifyArchive verifies an archived chain, with publicKey if its last
+// entry was signed with it
+func verifyArchive(dir string, publicKey ed25519.PublicKey) (*ArchiveReport, error) {
+	archive := &ArchiveReport{Name: filepath.Base(dir)}
+
+	var last *Entry
+	err := Scan(dir, func(file string, line int, entry *Entry, raw []byte) error {
+		last = entry
+		return nil
+	})
+	var malformed *MalformedError
+	if err != nil && !errors.As(err, &malformed) {
+		return nil, err
+	}
+
+	var key ed25519.PublicKey
+	if last != nil {
+		archive.KeyID = last.KeyID
+		if last.KeyID == KeyID(publicKey) || (last.KeyID == "" && VerifyEntry(last, publicKey) == nil) {
+			key = publicKey
+		}
+	}
+	archive.SignaturesChecked = key != nil
+
+	archive.VerifyReport, err = verifyChain(dir, key)
+	if err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// verifyChain verifies the chain in dir. With a nil publicKey signatures
+// and the checkpoint file are not checked.
+func verifyChain(dir string, publicKey ed25519.PublicKey) (*VerifyReport, error) {
+	report := &VerifyReport{}
+
+	files, err := logFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit logs: %w", err)
+	}
+	report.Files = len(files)
+
+	var head *Checkpoint
+	if publicKey != nil {
+		if head, err = LoadCheckpoint(dir, publicKey); err != nil {
+			report.Break = &ChainBreak{File: CheckpointFile, Reason: err.Error()}
+			return report, nil
+		}
+	}
+
+	var (
+		lastHash string
+		headSeen bool
+
+		// Set while the retained chain does not start at the genesis
+		// entry, until a prune record accounts for it
+		anchor *Entry
+	)
+
+	err = Scan(dir, func(file string, line int, entry *Entry, raw []byte) error {
+		fail := func(format string, args ...interface{}) error {
+			return &ChainBreak{File: file, Line: line, Seq: entry.Seq, Reason: fmt.Sprintf(format, args...)}
+		}
+
+		if publicKey != nil {
+			if err := VerifyEntry(entry, publicKey); err != nil {
+				return fail("%v", err)
+			}
+		}
+		report.Entries++
+
+		if entry.Seq == 0 {
+			if report.LastSeq != 0 {
+				return fail("unchained entry inside the chain")
+			}
+			report.Unchained++
+			return nil
+		}
+
+		switch {
+		case report.LastSeq == 0:
+			report.FirstSeq = entry.Seq
+			if entry.Seq != 1 || entry.PrevHash != genesisHash {
+				anchor = entry
+			}
+		case entry.Seq != report.LastSeq+1:
+			return fail("expected seq %d, found %d: entries removed or reordered", report.LastSeq+1, entry.Seq)
+		case entry.PrevHash != lastHash:
+			return fail("previous hash does not match entry %d: entries modified or replaced", report.LastSeq)
+		}
+
+		switch EventType(entry.Event) {
+		case EventCheckpoint:
+			report.Checkpoints++
+			if detailUint(entry, "covers_seq") != entry.Seq-1 || entry.Details["covers_hash"] != entry.PrevHash {
+				return fail("checkpoint does not match the chain")
+			}
+		case EventLogPruned:
+			if anchor != nil && detailUint(entry, "first_seq") == anchor.Seq && entry.Details["first_prev_hash"] == anchor.PrevHash {
+				anchor = nil
+			}
+		}
+
+		report.LastSeq = entry.Seq
+		lastHash = hashLine(raw)
+
+		if head != nil && entry.Seq == head.Seq {
+			if lastHash != head.Hash {
+				return fail("entry does not match the signed checkpoint")
+			}
+			headSeen = true
+		}
+		return nil
+	})
+
+	var chainBreak *ChainBreak
+	var malformed *MalformedError
+	switch {
+	case errors.As(err, &chainBreak):
+		report.Break = chainBreak
+		return report, nil
+	case errors.As(err, &malformed):
+		report.Break = &ChainBreak{File: malformed.File, Line: malformed.Line, Reason: "malformed entry: " + malformed.Err.Error()}
+		return report, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if anchor != nil {
+		report.Break = &ChainBreak{
+			Seq:    anchor.Seq,
+			Reason: fmt.Sprintf("entries before seq %d are missing and no prune record accounts for them", anchor.Seq),
+		}
+	} else if head != nil && !headSeen && head.Seq > report.LastSeq {
+		report.Break = &ChainBreak{
+			Seq:    head.Seq,
+			Reason: fmt.Sprintf("signed checkpoint at seq %d is beyond the last entry %d: newest entries removed", head.Seq, report.LastSeq),
+		}
+	}
+
+	return report, nil
+}
+
+// detailUint reads a numeric detail, which decodes from JSON as float64
+func detailUint(entry *Entry, key string) uint64 {
+	switch v := entry.Details[key].(type) {
+	case float64:
+		return uint64(v)
+	case uint64:
+		return v
+	case int:
+		return uint64(v)
+	}
+	return 0
+}
@@ -2,20 +2,116 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+
+	"github.com/tshojoshua/jtnt-agent/internal/store"
+)
+
+const (
+	// tokenStoreKey is where the agent token lives in the secure store
+	tokenStoreKey = "agent.token"
+
+	// defaultAuditRetentionDays is how long audit logs are kept when the
+	// config does not say
+	defaultAuditRetentionDays = 30
+
+	// storeVersions is how many previous credentials the store keeps, so a
+	// bad rotation can be rolled back
+	storeVersions = 2
 )
 
 // Config holds agent configuration
 type Config struct {
-	AgentID         string `json:"agent_id"`
-	AgentToken      string `json:"agent_token"`
+	AgentID string `json:"agent_id"`
+
+	// AgentToken is kept in the encrypted secure store, never in the
+	// config file. Load fills it in and Save writes it back to the store.
+	AgentToken string `json:"agent_token,omitempty"`
+
 	HubURL          string `json:"hub_url"`
 	PollIntervalSec int    `json:"poll_interval_sec"`
 	HeartbeatSec    int    `json:"heartbeat_sec"`
+
+	// CloneAction is what the daemon does when it finds itself on a cloned
+	// machine: "recover" (default) or "stop"
+	CloneAction string `json:"clone_action,omitempty"`
+
+	// StoreKeyring caches the secure store key in the kernel keyring
+	// (Linux only)
+	StoreKeyring bool `json:"store_keyring,omitempty"`
+
+	// AuditRetentionDays is how long daily audit logs are kept; default 30
+	AuditRetentionDays int `json:"audit_retention_days,omitempty"`
+
+	// MetricsAddr is the local address the Prometheus endpoint listens on,
+	// e.g. "127.0.0.1:9090"; empty serves no metrics. Support bundles read
+	// metrics from the same address.
+	MetricsAddr string `json:"metrics_addr,omitempty"`
+
+	// Syslog exports audit entries and agent log events to a SIEM
+	Syslog *SyslogConfig `json:"syslog,omitempty"`
+
+	// Log configures the agent's own log
+	Log *LogConfig `json:"log,omitempty"`
+}
+
+// LogConfig configures where the agent logs and how much
+type LogConfig struct {
+	// Level is the lowest level logged: "debug", "info" (default), "warn"
+	// or "error"
+	Level string `json:"level,omitempty"`
+
+	// Outputs are where entries go: "stdout" (JSON lines), "file" (JSON
+	// lines in the log directory) and "journald" (plain lines with a
+	// priority prefix for systemd). Default ["stdout", "file"].
+	Outputs []string `json:"outputs,omitempty"`
+
+	// MaxSizeMB is the size at which the log file is rotated; default 10
+	MaxSizeMB int `json:"max_size_mb,omitempty"`
+
+	// MaxAgeDays is how long rotated files are kept; default 14
+	MaxAgeDays int `json:"max_age_days,omitempty"`
+
+	// MaxFiles is how many rotated files are kept; default 10
+	MaxFiles int `json:"max_files,omitempty"`
+}
+
+// SyslogConfig configures export to a remote syslog collector
+type SyslogConfig struct {
+	// Address is the collector as host:port
+	Address string `json:"address"`
+
+	// Protocol is "udp", "tcp" (default) or "tls"
+	Protocol string `json:"protocol,omitempty"`
+
+	// Format is "rfc5424" (default) or "cef" for ArcSight
+	Format string `json:"format,omitempty"`
+
+	// Facility is the syslog facility name; default "local0"
+	Facility string `json:"facility,omitempty"`
+
+	// LogLevel is the lowest agent log level exported: "debug", "info",
+	// "warn" (default), "error" or "none". Audit entries are always exported.
+	LogLevel string `json:"log_level,omitempty"`
+
+	// CAFile verifies the collector's TLS certificate instead of the system
+	// roots; CertFile and KeyFile authenticate the agent to it
+	CAFile     string `json:"ca_file,omitempty"`
+	CertFile   string `json:"cert_file,omitempty"`
+	KeyFile    string `json:"key_file,omitempty"`
+	ServerName string `json:"server_name,omitempty"`
+
+	// BufferMB bounds the disk buffer used while the collector is
+	// unreachable; default 64
+	BufferMB int `json:"buffer_mb,omitempty"`
 }
 
-// Load reads configuration from file
+// Load reads configuration from file and the agent token from the secure
+// store. It never writes: a token still present in the file is used as is
+// until Migrate moves it into the store. A token missing from the store is
+// left for Validate to report; any other store error is returned.
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -27,12 +123,70 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
 
+	if cfg.AgentToken != "" {
+		return &cfg, nil
+	}
+
+	opts := cfg.StoreOptions()
+	opts.ReadOnly = true
+	s, err := store.NewStoreWithOptions(GetCertsDir(), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open secure store: %w", err)
+	}
+
+	token, err := s.Load(tokenStoreKey)
+	if errors.Is(err, store.ErrNotFound) {
+		return &cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load agent token: %w", err)
+	}
+	cfg.AgentToken = string(token)
+
 	return &cfg, nil
 }
 
-// Save writes configuration to file
+// Migrate moves an agent token written to the config file by an older
+// version into the secure store and rewrites the file without it. It does
+// nothing when the file holds no token.
+func Migrate(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	if cfg.AgentToken == "" {
+		return nil
+	}
+	return cfg.Save(path)
+}
+
+// Save writes configuration to file and the agent token to the secure store
 func (c *Config) Save(path string) error {
-	data, err := json.MarshalIndent(c, "", "  ")
+	if c.AgentToken != "" {
+		s, err := c.store()
+		if err != nil {
+			return err
+		}
+		if err := s.Save(tokenStoreKey, []byte(c.AgentToken)); err != nil {
+			return fmt.Errorf("failed to save agent token: %w", err)
+		}
+	}
+
+	return c.writeFile(path)
+}
+
+// writeFile writes the configuration without the agent token
+func (c *Config) writeFile(path string) error {
+	fileCfg := *c
+	fileCfg.AgentToken = ""
+
+	data, err := json.MarshalIndent(&fileCfg, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
@@ -48,6 +202,35 @@ func (c *Config) Save(path string) error {
 	return nil
 }
 
+// AuditRetention returns how many days of audit logs to keep
+func (c *Config) AuditRetention() int {
+	if c.AuditRetentionDays <= 0 {
+		return defaultAuditRetentionDays
+	}
+	return c.AuditRetentionDays
+}
+
+// Logging returns the log settings, empty when the config has none
+func (c *Config) Logging() LogConfig {
+	if c.Log == nil {
+		return LogConfig{}
+	}
+	return *c.Log
+}
+
+// StoreOptions returns the options for the agent's secure store
+func (c *Config) StoreOptions() store.Options {
+	return store.Options{Keyring: c.StoreKeyring, Versions: storeVersions}
+}
+
+func (c *Config) store() (store.Store, error) {
+	s, err := store.NewStoreWithOptions(GetCertsDir(), c.StoreOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open secure store: %w", err)
+	}
+	return s, nil
+}
+
 // Validate checks if configuration is valid
 func (c *Config) Validate() error {
 	if c.AgentID == "" {
@@ -57,7 +240,7 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("hub_url is required")
 	}
 	if c.AgentToken == "" {
-		return fmt.Errorf("agent_token is required")
+		return fmt.Errorf("agent token not found in secure store %s", GetCertsDir())
 	}
 	return nil
 }
@@ -30,6 +30,11 @@ func GetConfigPath() string {
 	return filepath.Join(ConfigDir, "config.json")
 }
 
+// GetEnrollSeedPath returns the path of the deferred enrollment seed
+func GetEnrollSeedPath() string {
+	return filepath.Join(ConfigDir, "enroll.seed")
+}
+
 // GetCertsDir returns the directory for certificates
 func GetCertsDir() string {
 	return filepath.Join(StateDir, "certs")
@@ -50,6 +55,26 @@ func GetCABundlePath() string {
 	return filepath.Join(GetCertsDir(), "ca-bundle.crt")
 }
 
+// GetPolicyDir returns the directory holding signed policy layers
+func GetPolicyDir() string {
+	return filepath.Join(StateDir, "policy")
+}
+
+// GetPolicyKeyPath returns the path to the hub's policy signing public key
+func GetPolicyKeyPath() string {
+	return filepath.Join(GetCertsDir(), "policy-signing.pub")
+}
+
+// GetLogDir returns the directory for agent log files
+func GetLogDir() string {
+	return "/var/log/jtnt-agent"
+}
+
+// GetRuntimeDir returns the directory for local IPC sockets
+func GetRuntimeDir() string {
+	return "/var/run/jtnt-agent"
+}
+
 // GetBinaryPath returns the path to the agent binary
 func GetBinaryPath() string {
 	return BinaryPath
@@ -0,0 +1,159 @@
+// Package consent asks the logged-in user to approve jobs before they run.
+// The executor files a Request with the Broker and blocks; the tray app
+// long-polls the broker over a local IPC channel, prompts the user and posts
+// the answer back.
+package consent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Outcome is the result of a consent request
+type Outcome string
+
+const (
+	OutcomeApproved Outcome = "approved"
+	OutcomeDenied   Outcome = "denied"
+	OutcomeTimeout  Outcome = "timeout"
+)
+
+// ErrUnknownRequest indicates an answer for a request that is not pending
+var ErrUnknownRequest = errors.New("unknown or expired consent request")
+
+// Request describes a job awaiting the user's approval
+type Request struct {
+	ID          string    `json:"id"`
+	JobID       string    `json:"job_id"`
+	JobType     string    `json:"job_type"`
+	RequestedBy string    `json:"requested_by"`
+	Summary     string    `json:"summary"` // What the job will do, e.g. "systemctl restart nginx"
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Answer is the user's response to a Request
+type Answer struct {
+	Approve   bool   `json:"approve"`
+	Responder string `json:"responder,omitempty"` // Set by the server from the peer's credentials
+}
+
+// Result records how a Request was resolved
+type Result struct {
+	Outcome   Outcome
+	Responder string
+}
+
+type pending struct {
+	request *Request
+	answer  chan Answer
+}
+
+// Broker holds consent requests until they are answered or expire
+type Broker struct {
+	mu      sync.Mutex
+	pending map[string]*pending
+	notify  chan struct{} // Closed and replaced whenever a request is added
+}
+
+// NewBroker creates an empty broker
+func NewBroker() *Broker {
+	return &Broker{
+		pending: make(map[string]*pending),
+		notify:  make(chan struct{}),
+	}
+}
+
+// Ask files req and blocks until it is answered, timeout elapses or ctx is
+// done. ID, CreatedAt and ExpiresAt are filled in by the broker.
+func (b *Broker) Ask(ctx context.Context, req *Request, timeout time.Duration) Result {
+	req.ID = newRequestID()
+	req.CreatedAt = time.Now()
+	req.ExpiresAt = req.CreatedAt.Add(timeout)
+
+	p := &pending{request: req, answer: make(chan Answer, 1)}
+
+	b.mu.Lock()
+	b.pending[req.ID] = p
+	close(b.notify)
+	b.notify = make(chan struct{})
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.pending, req.ID)
+		b.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case answer := <-p.answer:
+		outcome := OutcomeDenied
+		if answer.Approve {
+			outcome = OutcomeApproved
+		}
+		return Result{Outcome: outcome, Responder: answer.Responder}
+	case <-timer.C:
+		return Result{Outcome: OutcomeTimeout}
+	case <-ctx.Done():
+		return Result{Outcome: OutcomeTimeout}
+	}
+}
+
+// Answer resolves the pending request id
+func (b *Broker) Answer(id string, answer Answer) error {
+	b.mu.Lock()
+	p, ok := b.pending[id]
+	if ok {
+		delete(b.pending, id)
+	}
+	b.mu.Unlock()
+
+	if !ok {
+		return ErrUnknownRequest
+	}
+
+	p.answer <- answer
+	return nil
+}
+
+// Pending returns the requests awaiting an answer, waiting up to wait for
+// one to arrive when there are none
+func (b *Broker) Pending(ctx context.Context, wait time.Duration) []*Request {
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+
+	for {
+		b.mu.Lock()
+		requests := make([]*Request, 0, len(b.pending))
+		for _, p := range b.pending {
+			requests = append(requests, p.request)
+		}
+		notify := b.notify
+		b.mu.Unlock()
+
+		if len(requests) > 0 || wait <= 0 {
+			return requests
+		}
+
+		select {
+		case <-notify:
+		case <-deadline.C:
+			return requests
+		case <-ctx.Done():
+			return requests
+		}
+	}
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
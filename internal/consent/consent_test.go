@@ -0,0 +1,136 @@
+package consent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/ipc"
+)
+
+func TestBroker_Approve(t *testing.T) {
+	broker := NewBroker()
+
+	go func() {
+		requests := broker.Pending(context.Background(), time.Second)
+		if len(requests) != 1 {
+			t.Errorf("Pending() = %d requests, want 1", len(requests))
+			return
+		}
+		broker.Answer(requests[0].ID, Answer{Approve: true, Responder: "alice"})
+	}()
+
+	result := broker.Ask(context.Background(), &Request{JobID: "job-1", Summary: "hostname"}, 5*time.Second)
+	if result.Outcome != OutcomeApproved || result.Responder != "alice" {
+		t.Errorf("Ask() = %+v, want approved by alice", result)
+	}
+
+	if err := broker.Answer("job-1", Answer{}); err != ErrUnknownRequest {
+		t.Errorf("Answer() for unknown id error = %v, want ErrUnknownRequest", err)
+	}
+}
+
+func TestBroker_Timeout(t *testing.T) {
+	broker := NewBroker()
+
+	result := broker.Ask(context.Background(), &Request{JobID: "job-2"}, 50*time.Millisecond)
+	if result.Outcome != OutcomeTimeout {
+		t.Errorf("Ask() outcome = %s, want timeout", result.Outcome)
+	}
+
+	if pending := broker.Pending(context.Background(), 0); len(pending) != 0 {
+		t.Errorf("expired request still pending: %+v", pending)
+	}
+}
+
+func TestServer_DenyOverIPC(t *testing.T) {
+	dir := t.TempDir()
+	listener, err := ipc.Listen(dir, ipc.ConsentChannel)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	broker := NewBroker()
+	server := NewServer(broker)
+	server.authorize = func(peer *ipc.Peer) bool { return peer.UID == os.Getuid() }
+	go server.Serve(listener)
+	defer server.Stop(time.Second)
+
+	client := ipc.NewHTTPClient(dir, ipc.ConsentChannel, 5*time.Second)
+
+	go func() {
+		resp, err := client.Get(ipc.URL("/v1/consent/pending?wait=2s"))
+		if err != nil {
+			t.Errorf("GET pending error = %v", err)
+			return
+		}
+		var requests []*Request
+		json.NewDecoder(resp.Body).Decode(&requests)
+		resp.Body.Close()
+		if len(requests) != 1 || requests[0].RequestedBy != "tech@msp" {
+			t.Errorf("pending = %+v", requests)
+			return
+		}
+
+		// The claimed responder is replaced with the peer's account
+		body, _ := json.Marshal(Answer{Approve: false, Responder: "bob"})
+		resp, err = client.Post(ipc.URL("/v1/consent/"+requests[0].ID), "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Errorf("POST answer error = %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("POST answer status = %d", resp.StatusCode)
+		}
+	}()
+
+	// Give the long-poll time to connect before the request is filed
+	time.Sleep(100 * time.Millisecond)
+
+	result := broker.Ask(context.Background(), &Request{JobID: "job-3", RequestedBy: "tech@msp"}, 5*time.Second)
+	uid := fmt.Sprintf("uid %d", os.Getuid())
+	if result.Outcome != OutcomeDenied || !strings.Contains(result.Responder, uid) {
+		t.Errorf("Ask() = %+v, want denied by %s", result, uid)
+	}
+}
+
+func TestServer_RejectsOtherUsers(t *testing.T) {
+	dir := t.TempDir()
+	listener, err := ipc.Listen(dir, ipc.ConsentChannel)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	broker := NewBroker()
+	server := NewServer(broker)
+	server.authorize = func(*ipc.Peer) bool { return false }
+	go server.Serve(listener)
+	defer server.Stop(time.Second)
+
+	client := ipc.NewHTTPClient(dir, ipc.ConsentChannel, 5*time.Second)
+
+	resp, err := client.Get(ipc.URL("/v1/consent/pending"))
+	if err != nil {
+		t.Fatalf("GET pending error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET pending status = %d, want 403", resp.StatusCode)
+	}
+
+	resp, err = client.Post(ipc.URL("/v1/consent/any"), "application/json", strings.NewReader(`{"approve":true}`))
+	if err != nil {
+		t.Fatalf("POST answer error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("POST answer status = %d, want 403", resp.StatusCode)
+	}
+}
@@ -0,0 +1,131 @@
+package consent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/ipc"
+)
+
+const (
+	// maxPollWait caps how long a tray long-poll is held open
+	maxPollWait = 60 * time.Second
+
+	consentReadTimeout = 10 * time.Second
+)
+
+// Server exposes a Broker over HTTP on a local IPC listener:
+//
+//	GET  /v1/consent/pending?wait=30s   pending requests (long-poll)
+//	POST /v1/consent/{id}               {"approve": true}
+//
+// Only the console user and root may use it; the responder recorded is the
+// account of the process that answered, whatever the client claims.
+type Server struct {
+	broker    *Broker
+	server    *http.Server
+	authorize func(*ipc.Peer) bool
+}
+
+// NewServer creates a consent server for broker
+func NewServer(broker *Broker) *Server {
+	s := &Server{broker: broker, authorize: consoleOrRoot}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/consent/pending", s.handlePending)
+	mux.HandleFunc("/v1/consent/", s.handleAnswer)
+
+	s.server = &http.Server{
+		Handler:     s.checkPeer(mux),
+		ReadTimeout: consentReadTimeout,
+		ConnContext: ipc.ConnContext,
+	}
+
+	return s
+}
+
+// Serve accepts connections on listener until Stop is called
+func (s *Server) Serve(listener net.Listener) error {
+	if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Stop gracefully stops the server
+func (s *Server) Stop(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// consoleOrRoot allows the user at the console, who consent prompts are
+// for, and root or an elevated administrator
+func consoleOrRoot(peer *ipc.Peer) bool {
+	return peer.Console() || peer.UID == 0 || (peer.SID != "" && peer.Elevated)
+}
+
+// checkPeer refuses connections from processes that may not see or answer
+// consent requests
+func (s *Server) checkPeer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, ok := ipc.PeerFromContext(r.Context())
+		if !ok || !s.authorize(peer) {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handlePending(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	wait, _ := time.ParseDuration(r.URL.Query().Get("wait"))
+	if wait > maxPollWait {
+		wait = maxPollWait
+	}
+
+	requests := s.broker.Pending(r.Context(), wait)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(requests)
+}
+
+func (s *Server) handleAnswer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/v1/consent/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	var answer Answer
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&answer); err != nil {
+		http.Error(w, "invalid answer", http.StatusBadRequest)
+		return
+	}
+
+	// Record who answered from the connection, not the request
+	peer, _ := ipc.PeerFromContext(r.Context())
+	answer.Responder = peer.Name()
+
+	if err := s.broker.Answer(id, answer); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
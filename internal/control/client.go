@@ -0,0 +1,125 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/ipc"
+)
+
+const defaultClientTimeout = 10 * time.Second
+
+// Client calls a daemon's control API
+type Client struct {
+	http *http.Client
+}
+
+// NewClient returns a client for the control channel in dir
+func NewClient(dir string) *Client {
+	return &Client{http: ipc.NewHTTPClient(dir, ipc.ControlChannel, defaultClientTimeout)}
+}
+
+// Status returns the daemon's live status
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var status Status
+	return &status, c.get(ctx, "/v1/status", &status)
+}
+
+// Heartbeat returns recent heartbeat state
+func (c *Client) Heartbeat(ctx context.Context) (*HeartbeatInfo, error) {
+	var info HeartbeatInfo
+	return &info, c.get(ctx, "/v1/heartbeat", &info)
+}
+
+// Jobs returns the running and scheduled jobs
+func (c *Client) Jobs(ctx context.Context) (*JobsInfo, error) {
+	var info JobsInfo
+	return &info, c.get(ctx, "/v1/jobs", &info)
+}
+
+// Policy returns the effective policy summary
+func (c *Client) Policy(ctx context.Context) (*PolicySummary, error) {
+	var summary PolicySummary
+	return &summary, c.get(ctx, "/v1/policy", &summary)
+}
+
+// Health returns the daemon's health report, with the merged policy when
+// the caller is privileged
+func (c *Client) Health(ctx context.Context) (*HealthReport, error) {
+	var report HealthReport
+	return &report, c.get(ctx, "/v1/health", &report)
+}
+
+// Logging returns the daemon's log settings in effect
+func (c *Client) Logging(ctx context.Context) (*LogInfo, error) {
+	var info LogInfo
+	return &info, c.get(ctx, "/v1/logging", &info)
+}
+
+// PollNow asks the daemon to poll the hub for jobs immediately
+func (c *Client) PollNow(ctx context.Context) error {
+	return c.post(ctx, "/v1/actions/poll-now")
+}
+
+// Reload asks the daemon to reload its configuration and policy
+func (c *Client) Reload(ctx context.Context) error {
+	return c.post(ctx, "/v1/actions/reload")
+}
+
+// SetLogLevel changes the daemon's log level until its next reload or
+// restart
+func (c *Client) SetLogLevel(ctx context.Context, level string) error {
+	return c.post(ctx, "/v1/actions/log-level?level="+url.QueryEscape(level))
+}
+
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ipc.URL(path), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("agent not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *Client) post(ctx context.Context, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ipc.URL(path), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("agent not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result ActionResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusForbidden:
+		return ErrPermissionDenied
+	case !result.OK:
+		return fmt.Errorf("%s", result.Message)
+	}
+
+	return nil
+}
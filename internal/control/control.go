@@ -0,0 +1,158 @@
+// Package control serves the daemon's local status and control API to the
+// CLI and tray app over an IPC channel. Reads are open to any local user,
+// but only a privileged peer (root or the daemon's own user, identified by
+// its socket credentials) sees job commands and payloads and the full
+// policy; others get summaries. Actions that change the daemon's behaviour
+// require a privileged peer.
+package control
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/health"
+	"github.com/tshojoshua/jtnt-agent/internal/jobs"
+	"github.com/tshojoshua/jtnt-agent/internal/policy"
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+// ErrPermissionDenied indicates the caller may not perform an action
+var ErrPermissionDenied = errors.New("permission denied")
+
+// Status is the daemon's live state. The first five fields match the tray
+// app's AgentStatus.
+type Status struct {
+	AgentID        string    `json:"agent_id"`
+	Status         string    `json:"status"` // "running" or "shutting_down"
+	Enrolled       bool      `json:"enrolled"`
+	LastHeartbeat  time.Time `json:"last_heartbeat"`
+	HubURL         string    `json:"hub_url"`
+	Version        string    `json:"version"`
+	StartedAt      time.Time `json:"started_at"`
+	CurrentJob     *JobInfo  `json:"current_job,omitempty"`
+	ScheduledJobs  int       `json:"scheduled_jobs"`
+	PendingResults int       `json:"pending_results"`
+}
+
+// HeartbeatInfo describes recent heartbeats to the hub
+type HeartbeatInfo struct {
+	LastAttempt         time.Time `json:"last_attempt"`
+	LastSuccess         time.Time `json:"last_success"`
+	LastError           string    `json:"last_error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	IntervalSec         int       `json:"interval_sec"`
+}
+
+// JobInfo describes a job the daemon is running
+type JobInfo struct {
+	JobID     string    `json:"job_id"`
+	Type      string    `json:"type"`
+	Summary   string    `json:"summary,omitempty"` // Command line; privileged callers only
+	StartedAt time.Time `json:"started_at"`
+}
+
+// JobsInfo lists the running job and jobs waiting for a maintenance window
+type JobsInfo struct {
+	Current   *JobInfo             `json:"current,omitempty"`
+	Scheduled []*jobs.ScheduledJob `json:"scheduled"`
+}
+
+// PolicySummary describes the effective policy without its allowlists
+type PolicySummary struct {
+	Version            int                `json:"version"`
+	ExpiresAt          time.Time          `json:"expires_at"`
+	Layers             []policy.LayerInfo `json:"layers"`
+	Ignored            []string           `json:"ignored,omitempty"`
+	Capabilities       map[string]bool    `json:"capabilities"` // Enabled state of exec, script and file
+	MaintenanceWindows int                `json:"maintenance_windows"`
+}
+
+// HealthReport is the daemon's health report. EffectivePolicy, the full
+// merged policy, is only sent to privileged callers.
+type HealthReport struct {
+	health.Report
+	EffectivePolicy *policy.Merged `json:"effective_policy,omitempty"`
+}
+
+// LogInfo describes the daemon's log settings in effect
+type LogInfo struct {
+	Level   string   `json:"level"`
+	Outputs []string `json:"outputs"`
+	File    string   `json:"file,omitempty"` // Path of the log file, when one is open
+}
+
+// ActionResult reports the outcome of an action
+type ActionResult struct {
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// Provider is implemented by the daemon to answer control requests
+type Provider interface {
+	Status() *Status
+	Heartbeat() *HeartbeatInfo
+	Jobs() *JobsInfo
+	Policy() *policy.Merged
+	Health() *health.Report
+	Logging() *LogInfo
+
+	// PollNow asks the job loop to poll the hub without waiting for its timer
+	PollNow() error
+	// Reload re-reads the configuration and policy layers
+	Reload() error
+	// SetLogLevel changes the log level until the next reload or restart
+	SetLogLevel(level string) error
+}
+
+// SummarizeStatus returns status without the running job's command line
+func SummarizeStatus(status *Status) *Status {
+	summary := *status
+	summary.CurrentJob = summarizeJob(status.CurrentJob)
+	return &summary
+}
+
+// SummarizeJobs returns info with each job reduced to its ID, type and
+// schedule. Payloads carry commands, scripts and encrypted secrets.
+func SummarizeJobs(info *JobsInfo) *JobsInfo {
+	summary := &JobsInfo{
+		Current:   summarizeJob(info.Current),
+		Scheduled: make([]*jobs.ScheduledJob, 0, len(info.Scheduled)),
+	}
+	for _, scheduled := range info.Scheduled {
+		entry := *scheduled
+		if scheduled.Job != nil {
+			entry.Job = &api.Job{JobID: scheduled.Job.JobID, Type: scheduled.Job.Type, CreatedAt: scheduled.Job.CreatedAt}
+		}
+		summary.Scheduled = append(summary.Scheduled, &entry)
+	}
+	return summary
+}
+
+func summarizeJob(job *JobInfo) *JobInfo {
+	if job == nil {
+		return nil
+	}
+	summary := *job
+	summary.Summary = ""
+	return &summary
+}
+
+// SummarizePolicy builds the summary of merged
+func SummarizePolicy(merged *policy.Merged) *PolicySummary {
+	p := merged.Policy
+
+	summary := &PolicySummary{
+		Version:            p.Version,
+		ExpiresAt:          p.ExpiresAt,
+		Layers:             merged.Layers,
+		Ignored:            merged.Ignored,
+		MaintenanceWindows: len(p.MaintenanceWindows),
+		Capabilities: map[string]bool{
+			"exec":   p.Capabilities.Exec.IsEnabled(),
+			"script": p.Capabilities.Script.IsEnabled(),
+			"file":   p.Capabilities.File != nil,
+		},
+	}
+
+	return summary
+}
@@ -0,0 +1,214 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/health"
+	"github.com/tshojoshua/jtnt-agent/internal/ipc"
+	"github.com/tshojoshua/jtnt-agent/internal/jobs"
+	"github.com/tshojoshua/jtnt-agent/internal/policy"
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+type fakeProvider struct {
+	polls    int
+	reloads  int
+	logLevel string
+}
+
+func (f *fakeProvider) Status() *Status {
+	return &Status{AgentID: "agent-1", Status: "running", Enrolled: true}
+}
+
+func (f *fakeProvider) Heartbeat() *HeartbeatInfo {
+	return &HeartbeatInfo{IntervalSec: 60}
+}
+
+func (f *fakeProvider) Jobs() *JobsInfo {
+	return &JobsInfo{
+		Current: &JobInfo{JobID: "job-1", Type: "exec", Summary: "/usr/bin/id"},
+		Scheduled: []*jobs.ScheduledJob{{
+			Job:    &api.Job{JobID: "job-2", Type: api.JobTypeScript, Payload: map[string]interface{}{"script": "echo secret"}},
+			Reason: "outside maintenance window",
+		}},
+	}
+}
+
+func (f *fakeProvider) Policy() *policy.Merged {
+	merged, _ := policy.Merge([]*policy.Policy{policy.DefaultPolicy()})
+	return merged
+}
+
+func (f *fakeProvider) Health() *health.Report {
+	checker := health.NewChecker("1.0.0", "agent-1")
+	checker.SetPolicy(f.Policy())
+	return checker.GetReport()
+}
+
+func (f *fakeProvider) Logging() *LogInfo {
+	return &LogInfo{Level: f.logLevel, Outputs: []string{"stdout"}}
+}
+
+func (f *fakeProvider) SetLogLevel(level string) error {
+	if level != "debug" && level != "info" {
+		return errors.New("unknown log level")
+	}
+	f.logLevel = level
+	return nil
+}
+
+func (f *fakeProvider) PollNow() error {
+	f.polls++
+	return nil
+}
+
+func (f *fakeProvider) Reload() error {
+	f.reloads++
+	return errors.New("bad config")
+}
+
+func TestServer_OverChannel(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("peer credentials not supported")
+	}
+
+	dir := t.TempDir()
+	listener, err := ipc.Listen(dir, ipc.ControlChannel)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	provider := &fakeProvider{}
+	server := NewServer(provider)
+	go server.Serve(listener)
+	defer server.Stop(time.Second)
+
+	ctx := context.Background()
+	client := NewClient(dir)
+
+	status, err := client.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.AgentID != "agent-1" || !status.Enrolled {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	// The test process is the daemon's own user, so it sees job details
+	jobs, err := client.Jobs(ctx)
+	if err != nil || jobs.Current == nil || jobs.Current.JobID != "job-1" || jobs.Current.Summary == "" {
+		t.Errorf("unexpected jobs: %+v, %v", jobs, err)
+	}
+	if err == nil && (len(jobs.Scheduled) != 1 || jobs.Scheduled[0].Job.Payload == nil) {
+		t.Errorf("scheduled jobs without payload for a privileged peer: %+v", jobs.Scheduled)
+	}
+
+	summary, err := client.Policy(ctx)
+	if err != nil || len(summary.Layers) != 1 {
+		t.Errorf("unexpected policy summary: %+v, %v", summary, err)
+	}
+
+	report, err := client.Health(ctx)
+	if err != nil || report.EffectivePolicy == nil || report.Policy == nil {
+		t.Errorf("health report without the merged policy for a privileged peer: %+v, %v", report, err)
+	}
+
+	// The test process is the daemon's own user, so actions are permitted
+	if err := client.PollNow(ctx); err != nil {
+		t.Errorf("PollNow failed: %v", err)
+	}
+	if provider.polls != 1 {
+		t.Errorf("expected 1 poll, got %d", provider.polls)
+	}
+
+	if err := client.Reload(ctx); err == nil || err.Error() != "bad config" {
+		t.Errorf("expected reload error, got %v", err)
+	}
+
+	if err := client.SetLogLevel(ctx, "debug"); err != nil {
+		t.Errorf("SetLogLevel failed: %v", err)
+	}
+	if err := client.SetLogLevel(ctx, "verbose"); err == nil {
+		t.Error("expected SetLogLevel to reject an unknown level")
+	}
+	if info, err := client.Logging(ctx); err != nil || info.Level != "debug" {
+		t.Errorf("unexpected logging info: %+v, %v", info, err)
+	}
+}
+
+func TestServer_ActionRequiresPeer(t *testing.T) {
+	provider := &fakeProvider{}
+	server := NewServer(provider)
+
+	// A request without peer credentials, as over Windows loopback
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/actions/poll-now", nil))
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+	if provider.polls != 0 {
+		t.Error("action ran without a privileged peer")
+	}
+
+	rec = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/actions/reload", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
+
+func TestServer_SummarizesForUnprivileged(t *testing.T) {
+	server := NewServer(&fakeProvider{})
+
+	// A request without peer credentials gets summaries only
+	get := func(path string, v interface{}) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d", path, rec.Code)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var info JobsInfo
+	get("/v1/jobs", &info)
+	if info.Current == nil || info.Current.JobID != "job-1" || info.Current.Summary != "" {
+		t.Errorf("current job = %+v, want ID without command", info.Current)
+	}
+	if len(info.Scheduled) != 1 {
+		t.Fatalf("scheduled = %d jobs, want 1", len(info.Scheduled))
+	}
+	if job := info.Scheduled[0].Job; job.JobID != "job-2" || job.Type != api.JobTypeScript || job.Payload != nil {
+		t.Errorf("scheduled job = %+v, want ID and type without payload", job)
+	}
+
+	var report HealthReport
+	get("/v1/health", &report)
+	if report.Policy == nil || report.EffectivePolicy != nil {
+		t.Errorf("health report = %+v, want the policy summary without the merged policy", report)
+	}
+}
+
+func TestPeer_Privileged(t *testing.T) {
+	if !(&ipc.Peer{UID: 0}).Privileged() {
+		t.Error("root should be privileged")
+	}
+	if !(&ipc.Peer{UID: os.Geteuid()}).Privileged() {
+		t.Error("daemon user should be privileged")
+	}
+	if os.Geteuid() != 65534 && (&ipc.Peer{UID: 65534}).Privileged() {
+		t.Error("unrelated user should not be privileged")
+	}
+}
@@ -0,0 +1,139 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/ipc"
+)
+
+const controlReadTimeout = 10 * time.Second
+
+// Server exposes a Provider over HTTP on a local IPC listener:
+//
+//	GET  /v1/status             live status (job command privileged)
+//	GET  /v1/heartbeat          recent heartbeats
+//	GET  /v1/jobs               running and scheduled jobs (payloads privileged)
+//	GET  /v1/policy             effective policy summary
+//	GET  /v1/health             health report (merged policy privileged)
+//	GET  /v1/logging            log level and outputs
+//	POST /v1/actions/poll-now   poll the hub for jobs now (privileged)
+//	POST /v1/actions/reload     reload config and policy (privileged)
+//	POST /v1/actions/log-level  set the log level, ?level= (privileged)
+type Server struct {
+	provider Provider
+	server   *http.Server
+}
+
+// NewServer creates a control server for provider
+func NewServer(provider Provider) *Server {
+	s := &Server{provider: provider}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/status", s.read(func(full bool) interface{} {
+		if full {
+			return provider.Status()
+		}
+		return SummarizeStatus(provider.Status())
+	}))
+	mux.HandleFunc("/v1/heartbeat", s.read(func(bool) interface{} { return provider.Heartbeat() }))
+	mux.HandleFunc("/v1/jobs", s.read(func(full bool) interface{} {
+		if full {
+			return provider.Jobs()
+		}
+		return SummarizeJobs(provider.Jobs())
+	}))
+	mux.HandleFunc("/v1/policy", s.read(func(bool) interface{} { return SummarizePolicy(provider.Policy()) }))
+	mux.HandleFunc("/v1/health", s.read(func(full bool) interface{} {
+		report := &HealthReport{Report: *provider.Health()}
+		if full {
+			report.EffectivePolicy = provider.Policy()
+		}
+		return report
+	}))
+	mux.HandleFunc("/v1/logging", s.read(func(bool) interface{} { return provider.Logging() }))
+	mux.HandleFunc("/v1/actions/poll-now", s.action("poll scheduled", provider.PollNow))
+	mux.HandleFunc("/v1/actions/reload", s.action("configuration and policy reloaded", provider.Reload))
+	mux.HandleFunc("/v1/actions/log-level", s.privileged(func(r *http.Request) (string, error) {
+		level := r.URL.Query().Get("level")
+		return "log level set to " + level, provider.SetLogLevel(level)
+	}))
+
+	s.server = &http.Server{
+		Handler:     mux,
+		ReadTimeout: controlReadTimeout,
+		ConnContext: ipc.ConnContext,
+	}
+
+	return s
+}
+
+// Serve accepts connections on listener until Stop is called
+func (s *Server) Serve(listener net.Listener) error {
+	if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Stop gracefully stops the server
+func (s *Server) Stop(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// read serves the value returned by get to any local caller. full is set
+// for privileged callers, who may see job details and the full policy.
+func (s *Server) read(get func(full bool) interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		peer, ok := ipc.PeerFromContext(r.Context())
+		writeJSON(w, http.StatusOK, get(ok && peer.Privileged()))
+	}
+}
+
+// action runs do for privileged callers only
+func (s *Server) action(message string, do func() error) http.HandlerFunc {
+	return s.privileged(func(*http.Request) (string, error) {
+		return message, do()
+	})
+}
+
+// privileged runs do for privileged callers only and reports the message it
+// returns
+func (s *Server) privileged(do func(r *http.Request) (string, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		peer, ok := ipc.PeerFromContext(r.Context())
+		if !ok || !peer.Privileged() {
+			writeJSON(w, http.StatusForbidden, &ActionResult{Message: ErrPermissionDenied.Error()})
+			return
+		}
+
+		message, err := do(r)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, &ActionResult{Message: err.Error()})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, &ActionResult{OK: true, Message: message})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,235 @@
+// Package doctor diagnoses common agent problems: enrollment, cloned
+// machines, certificates, policy, disk space, hub reachability, clock skew
+// and file permissions. Every failed or warning result carries a
+// remediation a first-line tech can act on.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/enroll"
+	"github.com/tshojoshua/jtnt-agent/internal/health"
+	"github.com/tshojoshua/jtnt-agent/internal/policy"
+	"github.com/tshojoshua/jtnt-agent/internal/store"
+	"github.com/tshojoshua/jtnt-agent/internal/sysinfo"
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// Result is the outcome of one diagnostic
+type Result struct {
+	Name        string        `json:"name"`
+	Status      health.Status `json:"status"`
+	Message     string        `json:"message"`
+	Details     []string      `json:"details,omitempty"`
+	Remediation string        `json:"remediation,omitempty"`
+}
+
+// Report collects the results of a doctor run
+type Report struct {
+	Results []*Result `json:"results"`
+	Failed  int       `json:"failed"`
+	Warned  int       `json:"warned"`
+}
+
+// Options configures a doctor run
+type Options struct {
+	// Timeout bounds each network check; default 10s
+	Timeout time.Duration
+}
+
+// Run performs all diagnostics
+func Run(ctx context.Context, opts Options) *Report {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	report := &Report{}
+
+	cfg, cfgErr := config.Load(config.GetConfigPath())
+	report.add(checkEnrolled(cfg, cfgErr))
+	report.add(checkCertificates(cfg))
+	if cfg != nil {
+		report.add(checkIdentity())
+	}
+	report.add(checkPolicy())
+	report.add(checkDiskSpace())
+
+	if cfg != nil && cfg.HubURL != "" {
+		hub, err := parseHub(cfg.HubURL)
+		if err != nil {
+			report.add(&Result{
+				Name:        "hub_url",
+				Status:      health.StatusFail,
+				Message:     err.Error(),
+				Remediation: "Fix hub_url in " + config.GetConfigPath() + " or re-enroll with the correct --hub URL.",
+			})
+		} else {
+			report.add(checkProxy(hub))
+			report.add(checkDNS(ctx, hub, opts.Timeout))
+
+			// Each step needs the one before it; later failures would only
+			// repeat the first
+			if report.add(checkTCP(ctx, hub, opts.Timeout)) &&
+				report.add(checkTLS(ctx, hub, opts.Timeout)) {
+				report.add(checkClockSkew(ctx, hub, opts.Timeout))
+			}
+		}
+	}
+
+	for _, result := range checkPermissions(permissionRules()) {
+		report.add(result)
+	}
+
+	return report
+}
+
+// add records result and reports whether it did not fail
+func (r *Report) add(result *Result) bool {
+	r.Results = append(r.Results, result)
+	switch result.Status {
+	case health.StatusFail:
+		r.Failed++
+		return false
+	case health.StatusWarn:
+		r.Warned++
+	}
+	return true
+}
+
+// fromCheck converts a health check into a result
+func fromCheck(name string, check *health.Check, remediation string) *Result {
+	result := &Result{Name: name, Status: check.Status, Message: check.Message}
+	if check.Status != health.StatusPass {
+		result.Remediation = remediation
+	}
+	return result
+}
+
+func checkEnrolled(cfg *config.Config, cfgErr error) *Result {
+	if cfgErr != nil {
+		return &Result{
+			Name:        "enrolled",
+			Status:      health.StatusFail,
+			Message:     cfgErr.Error(),
+			Remediation: "Enroll with: jtnt-agent enroll --token <TOKEN> --hub <URL>",
+		}
+	}
+	return fromCheck("enrolled", health.CheckEnrolled(cfg),
+		"Re-enroll with: jtnt-agent enroll --token <TOKEN> --hub <URL>")
+}
+
+func checkCertificates(cfg *config.Config) *Result {
+	certPath := config.GetCertPath()
+
+	// Agents authenticated by token alone have no client certificate
+	if _, err := os.Stat(certPath); errors.Is(err, fs.ErrNotExist) && cfg != nil && cfg.AgentToken != "" {
+		return &Result{
+			Name:    "certificates",
+			Status:  health.StatusPass,
+			Message: "no client certificate, agent authenticates with its token",
+		}
+	}
+
+	return fromCheck("certificates", health.CheckCertificates(certPath),
+		"Renew the certificate from the hub, or re-enroll to issue a new one. "+
+			"Check the system clock if the certificate is not yet valid.")
+}
+
+// checkIdentity compares this machine with the enrollment fingerprint
+// without updating it. The store is opened read-only so a diagnosis never
+// migrates values or creates the master key.
+func checkIdentity() *Result {
+	s, err := store.NewStoreWithOptions(config.GetCertsDir(), store.Options{ReadOnly: true})
+	if err == nil {
+		var stored *api.MachineFingerprint
+		if stored, err = enroll.LoadFingerprint(s); err == nil {
+			if stored == nil {
+				return &Result{
+					Name:    "identity",
+					Status:  health.StatusPass,
+					Message: "no fingerprint recorded yet; the daemon records one on its next start",
+				}
+			}
+
+			current := sysinfo.Fingerprint()
+			_, changed := sysinfo.FingerprintDiff(stored, current)
+			return fromCheck("identity", health.CheckIdentity(sysinfo.IsClone(stored, current), changed),
+				"If this machine was cloned from an enrolled image, give it its own identity: "+
+					"jtnt-agent reenroll --hub <URL> --token-file <FILE>. "+
+					"If it is the original machine after a hardware change, re-enroll with --keep-id.")
+		}
+	}
+
+	return &Result{
+		Name:        "identity",
+		Status:      health.StatusWarn,
+		Message:     fmt.Sprintf("cannot read enrollment fingerprint: %v", err),
+		Remediation: "Run as root.",
+	}
+}
+
+func checkPolicy() *Result {
+	var publicKey []byte
+	data, err := os.ReadFile(config.GetPolicyKeyPath())
+	if err == nil {
+		publicKey, err = policy.LoadPublicKey(data)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return &Result{
+			Name:        "policy",
+			Status:      health.StatusFail,
+			Message:     fmt.Sprintf("policy signing key unusable: %v", err),
+			Remediation: "Restore " + config.GetPolicyKeyPath() + " from the hub; the agent runs the default policy until then.",
+		}
+	}
+
+	merged, err := policy.LoadEffective(config.GetPolicyDir(), publicKey)
+	if err != nil {
+		return &Result{
+			Name:        "policy",
+			Status:      health.StatusFail,
+			Message:     fmt.Sprintf("policy layers rejected: %v", err),
+			Remediation: "Re-publish the policy from the hub. Layers must be signed with the key in " + config.GetPolicyKeyPath() + ".",
+		}
+	}
+	if merged == nil {
+		return &Result{
+			Name:    "policy",
+			Status:  health.StatusPass,
+			Message: "no policy layers, agent uses its built-in default policy",
+		}
+	}
+
+	result := fromCheck("policy", health.CheckPolicy(merged.Policy.ExpiresAt),
+		"Publish a renewed policy from the hub before it expires; expired policies reject all jobs.")
+	for _, layer := range merged.Layers {
+		result.Details = append(result.Details, fmt.Sprintf("layer %s version %d", layer.Name, layer.Version))
+	}
+	return result
+}
+
+func checkDiskSpace() *Result {
+	return fromCheck("disk_space", health.CheckDiskSpace(),
+		"Free space on the volume holding "+config.GetStateDir()+"; old logs and cached results are safe to remove.")
+}
+
+// ntpRemediation returns how to resync the clock on this platform
+func ntpRemediation() string {
+	switch runtime.GOOS {
+	case "windows":
+		return "Resync the clock: w32tm /resync, and check the Windows Time service is running."
+	case "darwin":
+		return "Enable network time in System Settings > General > Date & Time, or run: sudo sntp -sS time.apple.com"
+	default:
+		return "Enable NTP: sudo timedatectl set-ntp true, and check chronyd or systemd-timesyncd is running."
+	}
+}
@@ -0,0 +1,279 @@
+package doctor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/health"
+)
+
+const (
+	clockSkewWarn = 30 * time.Second
+	clockSkewFail = 5 * time.Minute
+)
+
+// proxyEnv lists the variables Go's HTTP stack reads for proxies
+var proxyEnv = []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy", "NO_PROXY", "no_proxy"}
+
+// hubTarget is the hub endpoint being diagnosed
+type hubTarget struct {
+	url  *url.URL
+	host string
+	addr string // host:port
+}
+
+func parseHub(hubURL string) (*hubTarget, error) {
+	u, err := url.Parse(hubURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hub URL %q: %w", hubURL, err)
+	}
+	if u.Scheme != "https" || u.Hostname() == "" {
+		return nil, fmt.Errorf("hub URL %q must be https://host[:port]", hubURL)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	return &hubTarget{url: u, host: u.Hostname(), addr: net.JoinHostPort(u.Hostname(), port)}, nil
+}
+
+// checkProxy reports proxy settings. The agent connects to the hub directly,
+// so a proxy in the environment suggests direct egress may be blocked.
+func checkProxy(hub *hubTarget) *Result {
+	var details []string
+	for _, name := range proxyEnv {
+		if value := os.Getenv(name); value != "" {
+			details = append(details, name+"="+redactProxy(value))
+		}
+	}
+
+	proxy, _ := http.ProxyFromEnvironment(&http.Request{URL: hub.url})
+	if proxy == nil {
+		return &Result{
+			Name:    "proxy",
+			Status:  health.StatusPass,
+			Message: "no proxy configured for the hub, connecting directly",
+			Details: details,
+		}
+	}
+
+	return &Result{
+		Name:    "proxy",
+		Status:  health.StatusWarn,
+		Message: fmt.Sprintf("environment routes the hub through proxy %s, but the agent connects directly", redactProxy(proxy.String())),
+		Details: details,
+		Remediation: "Allow direct HTTPS egress from this host to " + hub.addr +
+			", or add " + hub.host + " to NO_PROXY if the proxy is only for other traffic.",
+	}
+}
+
+// redactProxy hides credentials embedded in a proxy URL
+func redactProxy(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	u.User = url.User("****")
+	return u.String()
+}
+
+func checkDNS(ctx context.Context, hub *hubTarget, timeout time.Duration) *Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if ip := net.ParseIP(hub.host); ip != nil {
+		return &Result{Name: "dns", Status: health.StatusPass, Message: "hub is an IP address, no lookup needed"}
+	}
+
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, hub.host)
+	if err != nil {
+		return &Result{
+			Name:    "dns",
+			Status:  health.StatusFail,
+			Message: fmt.Sprintf("cannot resolve %s: %v", hub.host, err),
+			Remediation: "Check the host's DNS servers (/etc/resolv.conf, or ipconfig /all on Windows) and that " +
+				hub.host + " is spelled correctly in the config.",
+		}
+	}
+
+	return &Result{
+		Name:    "dns",
+		Status:  health.StatusPass,
+		Message: fmt.Sprintf("%s resolved in %s", hub.host, time.Since(start).Round(time.Millisecond)),
+		Details: addrs,
+	}
+}
+
+func checkTCP(ctx context.Context, hub *hubTarget, timeout time.Duration) *Result {
+	dialer := &net.Dialer{Timeout: timeout}
+
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", hub.addr)
+	if err != nil {
+		return &Result{
+			Name:        "tcp",
+			Status:      health.StatusFail,
+			Message:     fmt.Sprintf("cannot connect to %s: %v", hub.addr, err),
+			Remediation: "Allow outbound TCP to " + hub.addr + " in the host and network firewalls.",
+		}
+	}
+	defer conn.Close()
+
+	return &Result{
+		Name:    "tcp",
+		Status:  health.StatusPass,
+		Message: fmt.Sprintf("connected to %s in %s", conn.RemoteAddr(), time.Since(start).Round(time.Millisecond)),
+	}
+}
+
+func checkTLS(ctx context.Context, hub *hubTarget, timeout time.Duration) *Result {
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: timeout},
+		Config:    &tls.Config{ServerName: hub.host, MinVersion: tls.VersionTLS12},
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", hub.addr)
+	if err != nil {
+		result := &Result{
+			Name:    "tls",
+			Status:  health.StatusFail,
+			Message: fmt.Sprintf("TLS handshake with %s failed: %v", hub.addr, err),
+			Remediation: "If a TLS-inspecting firewall or proxy is in the path, exempt " + hub.host +
+				". Otherwise check the system clock and that the OS trust store is up to date.",
+		}
+		result.Details = describeVerifyError(err)
+		return result
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	result := &Result{
+		Name:    "tls",
+		Status:  health.StatusPass,
+		Message: fmt.Sprintf("%s, %s", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite)),
+		Details: describeChain(state.PeerCertificates),
+	}
+
+	if len(state.PeerCertificates) > 0 {
+		leaf := state.PeerCertificates[0]
+		if days := int(time.Until(leaf.NotAfter).Hours() / 24); days <= 14 {
+			result.Status = health.StatusWarn
+			result.Message += fmt.Sprintf("; hub certificate expires in %d days", days)
+			result.Remediation = "Renew the hub's TLS certificate."
+		}
+	}
+
+	return result
+}
+
+// describeChain lists subject, issuer and expiry for each certificate
+func describeChain(chain []*x509.Certificate) []string {
+	var details []string
+	for i, cert := range chain {
+		details = append(details, fmt.Sprintf("[%d] subject=%q issuer=%q expires=%s",
+			i, cert.Subject.CommonName, cert.Issuer.CommonName, cert.NotAfter.Format("2006-01-02")))
+	}
+	return details
+}
+
+// describeVerifyError extracts the offending certificate from verification errors
+func describeVerifyError(err error) []string {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+
+	switch {
+	case errors.As(err, &unknownAuthority) && unknownAuthority.Cert != nil:
+		return describeChain([]*x509.Certificate{unknownAuthority.Cert})
+	case errors.As(err, &hostname) && hostname.Certificate != nil:
+		cert := hostname.Certificate
+		return append(describeChain([]*x509.Certificate{cert}), "names="+strings.Join(cert.DNSNames, ","))
+	case errors.As(err, &invalid) && invalid.Cert != nil:
+		return describeChain([]*x509.Certificate{invalid.Cert})
+	}
+	return nil
+}
+
+// checkClockSkew compares the local clock with the hub's Date header
+func checkClockSkew(ctx context.Context, hub *hubTarget, timeout time.Duration) *Result {
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, hub.url.Scheme+"://"+hub.url.Host+"/", nil)
+	if err != nil {
+		return &Result{Name: "clock_skew", Status: health.StatusWarn, Message: err.Error()}
+	}
+
+	sent := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return &Result{
+			Name:        "clock_skew",
+			Status:      health.StatusWarn,
+			Message:     fmt.Sprintf("could not reach hub to compare clocks: %v", err),
+			Remediation: "Fix the connectivity failures above, then re-run doctor.",
+		}
+	}
+	resp.Body.Close()
+	received := time.Now()
+
+	hubTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return &Result{Name: "clock_skew", Status: health.StatusWarn, Message: "hub response has no usable Date header"}
+	}
+
+	return evaluateSkew(sent, received, hubTime)
+}
+
+// evaluateSkew compares hubTime with the midpoint of the request. The Date
+// header has one-second resolution, so smaller differences are ignored.
+func evaluateSkew(sent, received, hubTime time.Time) *Result {
+	local := sent.Add(received.Sub(sent) / 2)
+	skew := local.Sub(hubTime).Round(time.Second)
+
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+
+	direction := "ahead of"
+	if skew < 0 {
+		direction = "behind"
+	}
+
+	result := &Result{
+		Name:    "clock_skew",
+		Status:  health.StatusPass,
+		Message: fmt.Sprintf("local clock is %s %s the hub", abs, direction),
+	}
+	if abs <= time.Second {
+		result.Message = "local clock matches the hub"
+	}
+
+	switch {
+	case abs > clockSkewFail:
+		result.Status = health.StatusFail
+		result.Remediation = ntpRemediation() + " Skew breaks certificate and policy expiry checks."
+	case abs > clockSkewWarn:
+		result.Status = health.StatusWarn
+		result.Remediation = ntpRemediation()
+	}
+
+	return result
+}
@@ -0,0 +1,70 @@
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"runtime"
+
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/health"
+)
+
+// permissionRule forbids mode bits on a path
+type permissionRule struct {
+	path      string
+	forbidden os.FileMode   // Bits that must not be set
+	severity  health.Status // Status when they are
+	fix       os.FileMode   // Mode to suggest
+	reason    string
+}
+
+func permissionRules() []permissionRule {
+	return []permissionRule{
+		{config.GetConfigDir(), 0022, health.StatusFail, 0755, "others could replace the config"},
+		{config.GetConfigPath(), 0077, health.StatusFail, 0600, "the config holds the agent token"},
+		{config.GetStateDir(), 0022, health.StatusFail, 0755, "others could tamper with queued jobs and results"},
+		{config.GetCertsDir(), 0022, health.StatusFail, 0755, "others could replace certificates"},
+		{config.GetKeyPath(), 0077, health.StatusFail, 0600, "the private key must only be readable by the agent"},
+		{config.GetPolicyDir(), 0022, health.StatusWarn, 0755, "others could delete policy layers"},
+		{config.GetRuntimeDir(), 0022, health.StatusFail, 0755, "others could replace the control sockets"},
+	}
+}
+
+// checkPermissions audits the agent's directories and secrets. Windows uses
+// ACLs, which mode bits do not describe, so it is skipped there.
+func checkPermissions(rules []permissionRule) []*Result {
+	if runtime.GOOS == "windows" {
+		return []*Result{{
+			Name:    "permissions",
+			Status:  health.StatusPass,
+			Message: "not checked on Windows; ProgramData ACLs apply",
+		}}
+	}
+
+	var results []*Result
+	for _, rule := range rules {
+		info, err := os.Stat(rule.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		result := &Result{Name: "permissions " + rule.path, Status: health.StatusPass}
+		switch {
+		case err != nil:
+			result.Status = health.StatusWarn
+			result.Message = fmt.Sprintf("cannot inspect: %v", err)
+			result.Remediation = "Run doctor as root (sudo jtnt-agent doctor) to audit this path."
+		case info.Mode().Perm()&rule.forbidden != 0:
+			result.Status = rule.severity
+			result.Message = fmt.Sprintf("mode %04o is too permissive: %s", info.Mode().Perm(), rule.reason)
+			result.Remediation = fmt.Sprintf("sudo chmod %04o %s", rule.fix, rule.path)
+		default:
+			result.Message = fmt.Sprintf("mode %04o", info.Mode().Perm())
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
@@ -11,8 +11,10 @@ import (
 	"runtime"
 	"time"
 
+	"github.com/tshojoshua/jtnt-agent/internal/audit"
 	"github.com/tshojoshua/jtnt-agent/internal/config"
 	"github.com/tshojoshua/jtnt-agent/internal/store"
+	"github.com/tshojoshua/jtnt-agent/internal/sysinfo"
 	"github.com/tshojoshua/jtnt-agent/pkg/api"
 )
 
@@ -20,12 +22,25 @@ const (
 	enrollPath    = "/api/v1/agents/enroll"
 	agentVersion  = "1.0.0"
 	enrollTimeout = 30 * time.Second
+
+	// Store key for the agent's private key; the token is stored by config
+	agentKeyKey = "agent.key"
+)
+
+// How an agent obtained its identity, as recorded in the audit log
+const (
+	MethodToken         = "token"
+	MethodSeed          = "seed"
+	MethodReenroll      = "reenroll"
+	MethodCloneRecovery = "clone_recovery"
 )
 
 // Enroller handles agent enrollment
 type Enroller struct {
-	hubURL string
-	store  store.Store
+	hubURL  string
+	store   store.Store
+	agentID string
+	keypair *KeyPair
 }
 
 // NewEnroller creates a new enroller
@@ -36,12 +51,29 @@ func NewEnroller(hubURL string, store store.Store) *Enroller {
 	}
 }
 
+// KeepIdentity asks the hub to enroll the agent under an existing ID and
+// keypair instead of issuing new ones
+func (e *Enroller) KeepIdentity(agentID string, keypair *KeyPair) {
+	e.agentID = agentID
+	e.keypair = keypair
+}
+
 // Enroll performs the enrollment process
 func (e *Enroller) Enroll(ctx context.Context, token string) (*config.Config, error) {
-	// Generate Ed25519 keypair
-	keypair, err := GenerateKeyPair()
+	// Generate Ed25519 keypair unless keeping the previous identity
+	keypair := e.keypair
+	if keypair == nil {
+		var err error
+		keypair, err = GenerateKeyPair()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate keypair: %w", err)
+		}
+	}
+
+	// Job secrets are encrypted to a key derived from it
+	encryptionKey, err := keypair.EncryptionKeyBase64()
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate keypair: %w", err)
+		return nil, fmt.Errorf("failed to derive encryption key: %w", err)
 	}
 
 	// Get hostname
@@ -60,6 +92,9 @@ func (e *Enroller) Enroll(ctx context.Context, token string) (*config.Config, er
 		AgentVersion: agentVersion,
 		Capabilities: []string{"ping", "execute", "shell", "file_transfer"},
 		PublicKey:    keypair.PublicKeyBase64(),
+		AgentID:      e.agentID,
+
+		EncryptionKey: encryptionKey,
 	}
 
 	// Send enrollment request
@@ -68,9 +103,9 @@ func (e *Enroller) Enroll(ctx context.Context, token string) (*config.Config, er
 		return nil, fmt.Errorf("enrollment request failed: %w", err)
 	}
 
-	// Save agent token
-	if err := e.saveAgentToken(resp.AgentToken); err != nil {
-		return nil, fmt.Errorf("failed to save agent token: %w", err)
+	// Save keypair; the token is saved with the configuration
+	if err := e.store.Save(agentKeyKey, []byte(keypair.PrivateKeyBase64())); err != nil {
+		return nil, fmt.Errorf("failed to save agent key: %w", err)
 	}
 
 	// Create configuration
@@ -87,6 +122,11 @@ func (e *Enroller) Enroll(ctx context.Context, token string) (*config.Config, er
 		return nil, fmt.Errorf("failed to save config: %w", err)
 	}
 
+	// Record the machine so a cloned image can be recognized
+	if err := SaveFingerprint(e.store, sysinfo.Fingerprint()); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
 
@@ -140,10 +180,25 @@ func (e *Enroller) sendEnrollRequest(ctx context.Context, req api.EnrollRequest)
 	return &resp, nil
 }
 
-func (e *Enroller) saveAgentToken(token string) error {
-	// Save agent token to secure store
-	if err := e.store.Save("agent.token", []byte(token)); err != nil {
-		return fmt.Errorf("failed to save agent token: %w", err)
+// RecordEnrollment writes an enrollment entry to the audit log, signed with
+// the agent key in s. A chain signed by a previous key is archived first.
+func RecordEnrollment(s store.Store, cfg *config.Config, method string) error {
+	keypair, err := LoadStoredKeyPair(s)
+	if err != nil {
+		return fmt.Errorf("failed to load agent key: %w", err)
+	}
+
+	logger, err := audit.NewLogger(cfg.AgentID, keypair.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	err = logger.LogEnrollment(method, cfg.HubURL)
+	if closeErr := logger.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record enrollment: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,211 @@
+package enroll
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/store"
+	"github.com/tshojoshua/jtnt-agent/internal/sysinfo"
+	"github.com/tshojoshua/jtnt-agent/internal/transport"
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+const (
+	fingerprintKey    = "fingerprint.json"
+	cloneRecoveryPath = "/api/v1/agent/clone-recovery"
+)
+
+// Clone actions, set with clone_action in the config
+const (
+	CloneActionRecover = "recover" // Ask the hub for a new identity (default)
+	CloneActionStop    = "stop"    // Stay stopped until an operator re-enrolls
+)
+
+// currentFingerprint reads this machine's fingerprint; replaced in tests
+var currentFingerprint = sysinfo.Fingerprint
+
+// IdentityStatus is the result of comparing this machine with the one the
+// agent enrolled on
+type IdentityStatus struct {
+	Cloned  bool
+	Changed []string // Fingerprint components that differ
+	Stored  *api.MachineFingerprint
+	Current *api.MachineFingerprint
+}
+
+// SaveFingerprint records the current machine as the agent's own
+func SaveFingerprint(s store.Store, fp *api.MachineFingerprint) error {
+	data, err := json.Marshal(fp)
+	if err != nil {
+		return err
+	}
+	if err := s.Save(fingerprintKey, data); err != nil {
+		return fmt.Errorf("failed to save fingerprint: %w", err)
+	}
+	return nil
+}
+
+// LoadFingerprint returns the fingerprint recorded at enrollment, or nil if
+// there is none
+func LoadFingerprint(s store.Store) (*api.MachineFingerprint, error) {
+	if !s.Exists(fingerprintKey) {
+		return nil, nil
+	}
+
+	data, err := s.Load(fingerprintKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var fp api.MachineFingerprint
+	if err := json.Unmarshal(data, &fp); err != nil {
+		return nil, fmt.Errorf("failed to parse fingerprint: %w", err)
+	}
+	return &fp, nil
+}
+
+// CheckIdentity compares this machine with the recorded fingerprint.
+// Agents enrolled before fingerprints were kept record the current machine.
+// Changes too small to indicate a clone update the record, component by
+// component: one that cannot be read this time keeps its recorded value.
+func CheckIdentity(s store.Store) (*IdentityStatus, error) {
+	current := currentFingerprint()
+
+	stored, err := LoadFingerprint(s)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return &IdentityStatus{Current: current}, SaveFingerprint(s, current)
+	}
+
+	_, changed := sysinfo.FingerprintDiff(stored, current)
+	status := &IdentityStatus{
+		Cloned:  sysinfo.IsClone(stored, current),
+		Changed: changed,
+		Stored:  stored,
+		Current: current,
+	}
+
+	if merged := mergeFingerprint(stored, current); !status.Cloned && merged != *stored {
+		if err := SaveFingerprint(s, &merged); err != nil {
+			return status, err
+		}
+	}
+	return status, nil
+}
+
+// mergeFingerprint returns stored updated with the components current
+// could read. A component missing now (a removed NIC, an unreadable
+// product UUID) must not erase the recorded one, or a later clone could
+// not be told apart from this machine.
+func mergeFingerprint(stored, current *api.MachineFingerprint) api.MachineFingerprint {
+	merged := *stored
+	if current.MachineID != "" {
+		merged.MachineID = current.MachineID
+	}
+	if current.ProductUUID != "" {
+		merged.ProductUUID = current.ProductUUID
+	}
+	if current.PrimaryMAC != "" {
+		merged.PrimaryMAC = current.PrimaryMAC
+	}
+	return merged
+}
+
+// RecoverClone asks the hub for a new identity for a cloned agent using
+// the credentials copied from the original. The new token, keypair, config
+// and fingerprint replace the copied ones and the original's client
+// certificate is removed.
+func RecoverClone(ctx context.Context, cfg *config.Config, s store.Store, status *IdentityStatus) (*config.Config, error) {
+	client, err := transport.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+
+	keypair, err := GenerateKeyPair()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate keypair: %w", err)
+	}
+	encryptionKey, err := keypair.EncryptionKeyBase64()
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive encryption key: %w", err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	req := api.CloneRecoveryRequest{
+		AgentID:             cfg.AgentID,
+		Hostname:            hostname,
+		PublicKey:           keypair.PublicKeyBase64(),
+		PreviousFingerprint: *status.Stored,
+		Fingerprint:         *status.Current,
+
+		EncryptionKey: encryptionKey,
+	}
+
+	respData, err := client.Post(ctx, cloneRecoveryPath, req)
+	if err != nil {
+		return nil, fmt.Errorf("clone recovery request failed: %w", err)
+	}
+
+	var resp api.EnrollResponse
+	if err := json.Unmarshal(respData, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if resp.AgentID == "" || resp.AgentToken == "" {
+		return nil, fmt.Errorf("hub did not issue a new identity")
+	}
+	if resp.AgentID == cfg.AgentID {
+		return nil, fmt.Errorf("hub reissued the original agent ID %s", cfg.AgentID)
+	}
+
+	recovered := *cfg
+	recovered.AgentID = resp.AgentID
+	recovered.AgentToken = resp.AgentToken
+	if resp.HubBaseURL != "" {
+		recovered.HubURL = resp.HubBaseURL
+	}
+	if resp.PollIntervalSec > 0 {
+		recovered.PollIntervalSec = resp.PollIntervalSec
+	}
+	if resp.HeartbeatSec > 0 {
+		recovered.HeartbeatSec = resp.HeartbeatSec
+	}
+
+	// The config names the identity the key signs for, so it is written
+	// first and put back if the key cannot be saved; either way the agent
+	// never pairs one identity with the other's key
+	configPath := config.GetConfigPath()
+	if err := recovered.Save(configPath); err != nil {
+		// The new token may already be in the store
+		cfg.Save(configPath)
+		return nil, fmt.Errorf("failed to save config: %w", err)
+	}
+	if err := s.Save(agentKeyKey, []byte(keypair.PrivateKeyBase64())); err != nil {
+		if restoreErr := cfg.Save(configPath); restoreErr != nil {
+			return nil, fmt.Errorf("failed to save agent key: %w (restoring the original config also failed: %v)", err, restoreErr)
+		}
+		return nil, fmt.Errorf("failed to save agent key: %w", err)
+	}
+
+	if err := SaveFingerprint(s, status.Current); err != nil {
+		return &recovered, err
+	}
+
+	// The client certificate was issued to the original agent; the new
+	// identity authenticates with its token until the hub issues one
+	for _, path := range []string{config.GetCertPath(), config.GetKeyPath()} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return &recovered, fmt.Errorf("failed to remove the original agent's certificate: %w", err)
+		}
+	}
+
+	return &recovered, nil
+}
@@ -0,0 +1,111 @@
+package enroll
+
+import (
+	"testing"
+
+	"github.com/tshojoshua/jtnt-agent/internal/store"
+	"github.com/tshojoshua/jtnt-agent/internal/sysinfo"
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+func TestCheckIdentity(t *testing.T) {
+	current := sysinfo.Fingerprint()
+	if *current == (api.MachineFingerprint{}) {
+		t.Skip("no machine identifiers readable in this environment")
+	}
+
+	s, err := store.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// First run records the machine
+	status, err := CheckIdentity(s)
+	if err != nil {
+		t.Fatalf("CheckIdentity() error = %v", err)
+	}
+	if status.Cloned {
+		t.Fatal("First check should not report a clone")
+	}
+	if stored, _ := LoadFingerprint(s); stored == nil || *stored != *current {
+		t.Fatal("First check should record the current fingerprint")
+	}
+
+	// An image restored on other hardware
+	other := api.MachineFingerprint{}
+	if current.MachineID != "" {
+		other.MachineID = "other-machine-id"
+	}
+	if current.ProductUUID != "" {
+		other.ProductUUID = "other-product-uuid"
+	}
+	if current.PrimaryMAC != "" {
+		other.PrimaryMAC = "other-mac"
+	}
+	if err := SaveFingerprint(s, &other); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err = CheckIdentity(s)
+	if err != nil {
+		t.Fatalf("CheckIdentity() error = %v", err)
+	}
+	if !status.Cloned {
+		t.Error("Expected clone when every component changed")
+	}
+	if stored, _ := LoadFingerprint(s); *stored != other {
+		t.Error("A clone must not overwrite the recorded fingerprint")
+	}
+}
+
+func TestCheckIdentity_KeepsUnreadableComponents(t *testing.T) {
+	stored := api.MachineFingerprint{MachineID: "machine", ProductUUID: "product", PrimaryMAC: "mac"}
+	tests := []struct {
+		name    string
+		current api.MachineFingerprint
+		want    api.MachineFingerprint
+	}{
+		{
+			name:    "product uuid unreadable",
+			current: api.MachineFingerprint{MachineID: "machine", PrimaryMAC: "mac"},
+			want:    stored,
+		},
+		{
+			name:    "nic replaced, product uuid unreadable",
+			current: api.MachineFingerprint{MachineID: "machine", PrimaryMAC: "new-mac"},
+			want:    api.MachineFingerprint{MachineID: "machine", ProductUUID: "product", PrimaryMAC: "new-mac"},
+		},
+		{
+			name:    "nothing readable",
+			current: api.MachineFingerprint{},
+			want:    stored,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := store.NewStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := SaveFingerprint(s, &stored); err != nil {
+				t.Fatal(err)
+			}
+
+			current := tt.current
+			defer func(orig func() *api.MachineFingerprint) { currentFingerprint = orig }(currentFingerprint)
+			currentFingerprint = func() *api.MachineFingerprint { return &current }
+
+			status, err := CheckIdentity(s)
+			if err != nil {
+				t.Fatalf("CheckIdentity() error = %v", err)
+			}
+			if status.Cloned {
+				t.Fatal("CheckIdentity() reported a clone")
+			}
+			if got, _ := LoadFingerprint(s); *got != tt.want {
+				t.Errorf("recorded fingerprint = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
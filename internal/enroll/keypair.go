@@ -5,6 +5,8 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
+
+	"github.com/tshojoshua/jtnt-agent/internal/secrets"
 )
 
 // KeyPair represents an Ed25519 keypair
@@ -31,6 +33,12 @@ func (kp *KeyPair) PublicKeyBase64() string {
 	return base64.StdEncoding.EncodeToString(kp.PublicKey)
 }
 
+// EncryptionKeyBase64 returns the base64 X25519 public key the hub
+// encrypts job secrets to, derived from the keypair
+func (kp *KeyPair) EncryptionKeyBase64() (string, error) {
+	return secrets.PublicKeyBase64(kp.PrivateKey)
+}
+
 // PrivateKeyBase64 returns the base64-encoded private key
 func (kp *KeyPair) PrivateKeyBase64() string {
 	return base64.StdEncoding.EncodeToString(kp.PrivateKey)
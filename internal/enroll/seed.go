@@ -0,0 +1,171 @@
+package enroll
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/retry"
+	"github.com/tshojoshua/jtnt-agent/internal/store"
+)
+
+// Seed holds what the daemon needs to enroll itself on first boot. It is
+// written by installers and imaging scripts so the token never appears on
+// a command line.
+//
+// The file is either JSON or key=value lines (INI section headers and
+// # or ; comments are ignored, so an MSI can write it with IniFile):
+//
+//	hub_url=https://hub.jtnt.us
+//	token=enr_...
+type Seed struct {
+	HubURL string `json:"hub_url"`
+	Token  string `json:"token"`
+}
+
+// SeedRetryConfig returns the backoff used while the hub is unreachable
+func SeedRetryConfig() *retry.Config {
+	return &retry.Config{
+		InitialDelay: 10 * time.Second,
+		MaxDelay:     10 * time.Minute,
+		Multiplier:   2.0,
+		Jitter:       0.2,
+		MaxAttempts:  0, // Keep trying until enrolled or stopped
+	}
+}
+
+// LoadSeed reads and validates a seed file
+func LoadSeed(path string) (*Seed, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+	// Anyone able to rewrite the seed could point the agent at their own hub
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0022 != 0 {
+		return nil, fmt.Errorf("%s is writable by group or others (mode %04o)", path, info.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	seed, err := ParseSeed(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid seed %s: %w", path, err)
+	}
+	return seed, nil
+}
+
+// ParseSeed parses seed file contents
+func ParseSeed(data []byte) (*Seed, error) {
+	var seed Seed
+
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		if err := json.Unmarshal(trimmed, &seed); err != nil {
+			return nil, err
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || line[0] == '#' || line[0] == ';' || line[0] == '[' {
+				continue
+			}
+
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("expected key=value, got %q", line)
+			}
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "hub_url", "hub":
+				seed.HubURL = strings.TrimSpace(value)
+			case "token":
+				seed.Token = strings.TrimSpace(value)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if seed.HubURL == "" {
+		return nil, fmt.Errorf("hub_url is required")
+	}
+	if seed.Token == "" {
+		return nil, fmt.Errorf("token is required")
+	}
+	return &seed, nil
+}
+
+// RemoveSeed overwrites the seed before deleting it so the token does not
+// linger in the freed blocks
+func RemoveSeed(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if info, err := file.Stat(); err == nil {
+		file.Write(make([]byte, info.Size()))
+		file.Sync()
+	}
+	file.Close()
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove seed: %w", err)
+	}
+	return nil
+}
+
+// EnrollFromSeed enrolls using the seed at path, retrying with backoff until
+// it succeeds or ctx is done, then removes the seed. onError is called after
+// each failed attempt with the delay before the next one. If the seed
+// cannot be removed the config is returned along with the error.
+func EnrollFromSeed(ctx context.Context, path string, s store.Store, onError func(err error, next time.Duration)) (*config.Config, error) {
+	seed, err := LoadSeed(path)
+	if err != nil {
+		return nil, err
+	}
+
+	enroller := NewEnroller(seed.HubURL, s)
+	backoff := retry.NewBackoff(SeedRetryConfig())
+
+	for {
+		attemptCtx, cancel := context.WithTimeout(ctx, enrollTimeout)
+		cfg, err := enroller.Enroll(attemptCtx, seed.Token)
+		cancel()
+
+		if err == nil {
+			if err := RemoveSeed(path); err != nil {
+				return cfg, err
+			}
+			return cfg, nil
+		}
+
+		delay := backoff.Next()
+		if onError != nil {
+			onError(err, delay)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package enroll
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSeed(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Seed
+		wantErr bool
+	}{
+		{
+			name: "key value",
+			data: "hub_url=https://hub.example.com\ntoken=enr_abc\n",
+			want: Seed{HubURL: "https://hub.example.com", Token: "enr_abc"},
+		},
+		{
+			name: "ini written by msi",
+			data: "[enrollment]\r\n; written by installer\r\nhub_url = https://hub.example.com\r\ntoken = enr_abc\r\n",
+			want: Seed{HubURL: "https://hub.example.com", Token: "enr_abc"},
+		},
+		{
+			name: "json",
+			data: `{"hub_url": "https://hub.example.com", "token": "enr_abc"}`,
+			want: Seed{HubURL: "https://hub.example.com", Token: "enr_abc"},
+		},
+		{
+			name:    "missing token",
+			data:    "hub_url=https://hub.example.com\n",
+			wantErr: true,
+		},
+		{
+			name:    "not key value",
+			data:    "enr_abc\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seed, err := ParseSeed([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSeed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && *seed != tt.want {
+				t.Errorf("ParseSeed() = %+v, want %+v", *seed, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSeed_RejectsWritableByOthers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "enroll.seed")
+	if err := os.WriteFile(path, []byte("hub_url=https://hub.example.com\ntoken=enr_abc\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSeed(path); err != nil {
+		t.Fatalf("LoadSeed() error = %v", err)
+	}
+
+	if err := os.Chmod(path, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSeed(path); err == nil {
+		t.Error("Expected seed writable by others to be rejected")
+	}
+}
+
+func TestRemoveSeed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "enroll.seed")
+	if err := os.WriteFile(path, []byte("token=enr_abc\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RemoveSeed(path); err != nil {
+		t.Fatalf("RemoveSeed() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Seed should be removed")
+	}
+
+	// Already gone
+	if err := RemoveSeed(path); err != nil {
+		t.Errorf("RemoveSeed() on missing file error = %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package enroll
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/store"
+	"github.com/tshojoshua/jtnt-agent/internal/transport"
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+const unenrollPath = "/api/v1/agent/unenroll"
+
+// Notify tells the hub the agent is being removed so it can revoke the
+// agent's token and certificate
+func Notify(ctx context.Context, client *transport.Client, agentID, reason string) error {
+	req := api.UnenrollRequest{
+		AgentID: agentID,
+		Reason:  reason,
+	}
+
+	if _, err := client.Post(ctx, unenrollPath, req); err != nil {
+		return fmt.Errorf("failed to notify hub: %w", err)
+	}
+	return nil
+}
+
+// LoadStoredKeyPair loads the keypair saved at enrollment. Agents enrolled before
+// keys were kept have none.
+func LoadStoredKeyPair(s store.Store) (*KeyPair, error) {
+	data, err := s.Load(agentKeyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	priv, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode agent key: %w", err)
+	}
+	if len(priv) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid agent key size")
+	}
+
+	key := ed25519.PrivateKey(priv)
+	return &KeyPair{
+		PublicKey:  key.Public().(ed25519.PublicKey),
+		PrivateKey: key,
+	}, nil
+}
+
+// WipeOptions controls what Wipe leaves behind
+type WipeOptions struct {
+	// KeepKey leaves the agent keypair so the agent can re-enroll under
+	// the same identity
+	KeepKey bool
+	// ResultCacheDir and ScheduledJobsDir hold job state for the old hub
+	ResultCacheDir   string
+	ScheduledJobsDir string
+}
+
+// Wipe removes the agent's enrollment: config, token, keys, certificates,
+// policy and cached job state. The audit trail and logs are kept. It
+// returns the paths removed.
+func Wipe(opts WipeOptions) ([]string, error) {
+	var removed []string
+	var errs []error
+
+	remove := func(path string) {
+		if _, err := os.Lstat(path); err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			return
+		}
+		if err := os.RemoveAll(path); err != nil {
+			errs = append(errs, err)
+			return
+		}
+		removed = append(removed, path)
+	}
+
+	remove(config.GetConfigPath())
+
+	// The certs directory is also the secure store holding the token
+	entries, err := os.ReadDir(config.GetCertsDir())
+	if err != nil && !os.IsNotExist(err) {
+		errs = append(errs, err)
+	}
+	for _, entry := range entries {
+		// The key is unreadable without the store's master secret
+		if opts.KeepKey && (entry.Name() == agentKeyKey || entry.Name() == store.MasterKeyFile) {
+			continue
+		}
+		remove(filepath.Join(config.GetCertsDir(), entry.Name()))
+	}
+
+	remove(config.GetPolicyDir())
+	if opts.ResultCacheDir != "" {
+		remove(opts.ResultCacheDir)
+	}
+	if opts.ScheduledJobsDir != "" {
+		remove(opts.ScheduledJobsDir)
+	}
+
+	if len(errs) > 0 {
+		return removed, fmt.Errorf("failed to remove %d paths, first error: %w", len(errs), errs[0])
+	}
+	return removed, nil
+}
@@ -0,0 +1,45 @@
+package enroll
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tshojoshua/jtnt-agent/internal/store"
+)
+
+func TestLoadStoredKeyPair(t *testing.T) {
+	s, err := store.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadStoredKeyPair(s); err == nil {
+		t.Fatal("Expected error when no key is stored")
+	}
+
+	kp, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(agentKeyKey, []byte(kp.PrivateKeyBase64())); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadStoredKeyPair(s)
+	if err != nil {
+		t.Fatalf("LoadStoredKeyPair() error = %v", err)
+	}
+	if !bytes.Equal(loaded.PublicKey, kp.PublicKey) {
+		t.Error("Public key should be derived from the stored private key")
+	}
+	if !bytes.Equal(loaded.PrivateKey, kp.PrivateKey) {
+		t.Error("Private key mismatch")
+	}
+
+	if err := s.Save(agentKeyKey, []byte("not-base64!")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadStoredKeyPair(s); err == nil {
+		t.Error("Expected error for corrupt key")
+	}
+}
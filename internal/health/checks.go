@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/disk"
@@ -17,6 +18,8 @@ const (
 	policyWarningDays    = 7
 	heartbeatMaxAge      = 5 * time.Minute
 	diskUsageWarningPct  = 90.0
+	auditLagWarning      = time.Hour
+	auditLagFailure      = 24 * time.Hour
 )
 
 // CheckEnrolled checks if the agent is properly enrolled
@@ -35,18 +38,11 @@ func CheckEnrolled(cfg *config.Config) *Check {
 		}
 	}
 
-	// Check if certificates exist
-	if _, err := os.Stat(cfg.CertPath); os.IsNotExist(err) {
+	// The hub authenticates the agent by its bearer token
+	if cfg.AgentToken == "" {
 		return &Check{
 			Status:  StatusFail,
-			Message: "agent not enrolled - missing client certificate",
-		}
-	}
-
-	if _, err := os.Stat(cfg.KeyPath); os.IsNotExist(err) {
-		return &Check{
-			Status:  StatusFail,
-			Message: "agent not enrolled - missing private key",
+			Message: "agent not enrolled - missing agent token",
 		}
 	}
 
@@ -58,27 +54,11 @@ func CheckEnrolled(cfg *config.Config) *Check {
 
 // CheckCertificates checks certificate validity and expiration
 func CheckCertificates(certPath string) *Check {
-	certPEM, err := os.ReadFile(certPath)
+	cert, err := loadCertificate(certPath)
 	if err != nil {
 		return &Check{
 			Status:  StatusFail,
-			Message: fmt.Sprintf("failed to read certificate: %v", err),
-		}
-	}
-
-	block, _ := pem.Decode(certPEM)
-	if block == nil {
-		return &Check{
-			Status:  StatusFail,
-			Message: "failed to parse certificate PEM",
-		}
-	}
-
-	cert, err := x509.ParseCertificate(block.Bytes)
-	if err != nil {
-		return &Check{
-			Status:  StatusFail,
-			Message: fmt.Sprintf("failed to parse certificate: %v", err),
+			Message: err.Error(),
 		}
 	}
 
@@ -118,18 +98,72 @@ func CheckCertificates(certPath string) *Check {
 	}
 }
 
-// CheckHubConnection checks hub connectivity based on last heartbeat
-func CheckHubConnection(lastHeartbeat time.Time) *Check {
-	if lastHeartbeat.IsZero() {
+// CertificateExpiry returns when the certificate at certPath expires
+func CertificateExpiry(certPath string) (time.Time, error) {
+	cert, err := loadCertificate(certPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
+
+func loadCertificate(certPath string) (*x509.Certificate, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse certificate PEM")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	return cert, nil
+}
+
+// CheckHubConnection checks hub connectivity based on the last successful
+// heartbeat and the error of the last attempt, if it failed. The check fails
+// once no heartbeat succeeded for three intervals, at least heartbeatMaxAge,
+// since a heartbeat retrying through an outage does not return an error.
+// startedAt stands in for the last heartbeat until one succeeds.
+func CheckHubConnection(lastHeartbeat, startedAt time.Time, interval time.Duration, lastError string) *Check {
+	maxAge := heartbeatMaxAge
+	if 3*interval > maxAge {
+		maxAge = 3 * interval
+	}
+
+	if lastError != "" {
+		message := "heartbeat failed: " + lastError
+		if !lastHeartbeat.IsZero() {
+			message += fmt.Sprintf(", last success %.0f seconds ago", time.Since(lastHeartbeat).Seconds())
+		}
 		return &Check{
 			Status:  StatusFail,
+			Message: message,
+		}
+	}
+
+	if lastHeartbeat.IsZero() {
+		if time.Since(startedAt) > maxAge {
+			return &Check{
+				Status:  StatusFail,
+				Message: fmt.Sprintf("no heartbeat in %.0f seconds since start", time.Since(startedAt).Seconds()),
+			}
+		}
+		return &Check{
+			Status:  StatusWarn,
 			Message: "no heartbeat sent yet",
 		}
 	}
 
 	timeSinceHeartbeat := time.Since(lastHeartbeat)
 
-	if timeSinceHeartbeat > heartbeatMaxAge {
+	if timeSinceHeartbeat > maxAge {
 		return &Check{
 			Status:  StatusFail,
 			Message: fmt.Sprintf("no heartbeat for %.0f seconds", timeSinceHeartbeat.Seconds()),
@@ -175,6 +209,76 @@ func CheckPolicy(policyExpiresAt time.Time) *Check {
 	}
 }
 
+// CheckIdentity reports whether the agent is running on the machine it
+// enrolled on. changed lists the fingerprint components that differ.
+func CheckIdentity(cloned bool, changed []string) *Check {
+	if cloned {
+		return &Check{
+			Status: StatusFail,
+			Message: fmt.Sprintf("machine fingerprint changed (%s): this looks like a cloned image; "+
+				"heartbeats and jobs are stopped until the agent is re-enrolled", strings.Join(changed, ", ")),
+		}
+	}
+
+	if len(changed) > 0 {
+		return &Check{
+			Status:  StatusPass,
+			Message: fmt.Sprintf("machine matches enrollment (%s updated)", strings.Join(changed, ", ")),
+		}
+	}
+
+	return &Check{
+		Status:  StatusPass,
+		Message: "machine matches enrollment",
+	}
+}
+
+// CheckAuditForwarding checks how long audit entries have waited for the
+// hub to acknowledge them
+func CheckAuditForwarding(entries uint64, age time.Duration, lastError string) *Check {
+	if entries == 0 {
+		return &Check{
+			Status:  StatusPass,
+			Message: "audit log forwarded to hub",
+		}
+	}
+
+	message := fmt.Sprintf("%d audit entries not forwarded, oldest %s", entries, age.Round(time.Second))
+	if lastError != "" {
+		message += ": " + lastError
+	}
+
+	switch {
+	case age >= auditLagFailure:
+		return &Check{Status: StatusFail, Message: message}
+	case age >= auditLagWarning:
+		return &Check{Status: StatusWarn, Message: message}
+	}
+	return &Check{Status: StatusPass, Message: message}
+}
+
+// CheckSyslogExport checks delivery to the SIEM collector. Buffered
+// messages are still delivered later; dropped ones are lost.
+func CheckSyslogExport(connected bool, buffered int, dropped uint64, lastError string) *Check {
+	if dropped > 0 {
+		return &Check{
+			Status:  StatusFail,
+			Message: fmt.Sprintf("%d syslog messages dropped, %d buffered: %s", dropped, buffered, lastError),
+		}
+	}
+	if !connected || buffered > 0 {
+		message := fmt.Sprintf("syslog collector unreachable, %d messages buffered", buffered)
+		if lastError != "" {
+			message += ": " + lastError
+		}
+		return &Check{Status: StatusWarn, Message: message}
+	}
+	return &Check{
+		Status:  StatusPass,
+		Message: "exporting to syslog collector",
+	}
+}
+
 // CheckDiskSpace checks disk space for state directory
 func CheckDiskSpace() *Check {
 	stateDir := config.GetStateDir()
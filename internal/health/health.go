@@ -3,6 +3,8 @@ package health
 import (
 	"sync"
 	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/policy"
 )
 
 // Status represents the health status
@@ -28,20 +30,32 @@ type Report struct {
 	Checks    map[string]*Check `json:"checks"`
 	Version   string            `json:"version"`
 	AgentID   string            `json:"agent_id"`
+	Policy    *PolicyInfo       `json:"policy,omitempty"`
+}
+
+// PolicyInfo identifies the effective policy without its contents, since
+// reports are served to any local user
+type PolicyInfo struct {
+	Version   int       `json:"version"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Layers    []string  `json:"layers"`
 }
 
 // Checker performs health checks
 type Checker struct {
 	mu      sync.RWMutex
 	checks  map[string]*Check
+	funcs   map[string]func() *Check
 	version string
 	agentID string
+	policy  *PolicyInfo
 }
 
 // NewChecker creates a new health checker
 func NewChecker(version, agentID string) *Checker {
 	return &Checker{
 		checks:  make(map[string]*Check),
+		funcs:   make(map[string]func() *Check),
 		version: version,
 		agentID: agentID,
 	}
@@ -54,22 +68,65 @@ func (c *Checker) UpdateCheck(name string, check *Check) {
 	c.checks[name] = check
 }
 
-// GetReport generates a health report
-func (c *Checker) GetReport() *Report {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+// SetCheckFunc registers a check that is evaluated for every report, for
+// checks that go stale when nothing updates them
+func (c *Checker) SetCheckFunc(name string, check func() *Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.funcs[name] = check
+}
 
-	// Copy checks
-	checks := make(map[string]*Check)
-	overallHealthy := true
-	
+// current returns every check; funcs are called without c.mu held, as
+// they may take locks of their own
+func (c *Checker) current() map[string]*Check {
+	c.mu.RLock()
+	checks := make(map[string]*Check, len(c.checks)+len(c.funcs))
 	for name, check := range c.checks {
 		checks[name] = check
+	}
+	funcs := make(map[string]func() *Check, len(c.funcs))
+	for name, check := range c.funcs {
+		funcs[name] = check
+	}
+	c.mu.RUnlock()
+
+	for name, check := range funcs {
+		checks[name] = check()
+	}
+	return checks
+}
+
+// SetPolicy records the version, expiry and layer names of the effective
+// policy for reports
+func (c *Checker) SetPolicy(merged *policy.Merged) {
+	info := &PolicyInfo{
+		Version:   merged.Policy.Version,
+		ExpiresAt: merged.Policy.ExpiresAt,
+		Layers:    make([]string, 0, len(merged.Layers)),
+	}
+	for _, layer := range merged.Layers {
+		info.Layers = append(info.Layers, layer.Name)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.policy = info
+}
+
+// GetReport generates a health report
+func (c *Checker) GetReport() *Report {
+	checks := c.current()
+	overallHealthy := true
+
+	for _, check := range checks {
 		if check.Status == StatusFail {
 			overallHealthy = false
 		}
 	}
 
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	status := "healthy"
 	if !overallHealthy {
 		status = "unhealthy"
@@ -81,15 +138,13 @@ func (c *Checker) GetReport() *Report {
 		Checks:    checks,
 		Version:   c.version,
 		AgentID:   c.agentID,
+		Policy:    c.policy,
 	}
 }
 
 // IsHealthy returns true if all checks pass
 func (c *Checker) IsHealthy() bool {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	for _, check := range c.checks {
+	for _, check := range c.current() {
 		if check.Status == StatusFail {
 			return false
 		}
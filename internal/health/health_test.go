@@ -0,0 +1,84 @@
+package health
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/policy"
+)
+
+func TestCheckHubConnection(t *testing.T) {
+	now := time.Now()
+	interval := time.Minute
+
+	tests := []struct {
+		name          string
+		lastHeartbeat time.Time
+		startedAt     time.Time
+		interval      time.Duration
+		lastError     string
+		want          Status
+	}{
+		{name: "recent heartbeat", lastHeartbeat: now.Add(-30 * time.Second), startedAt: now.Add(-time.Hour), interval: interval, want: StatusPass},
+		{name: "failed heartbeat", lastHeartbeat: now.Add(-30 * time.Second), startedAt: now.Add(-time.Hour), interval: interval, lastError: "connection refused", want: StatusFail},
+		{name: "stale heartbeat", lastHeartbeat: now.Add(-10 * time.Minute), startedAt: now.Add(-time.Hour), interval: interval, want: StatusFail},
+		{name: "long interval", lastHeartbeat: now.Add(-10 * time.Minute), startedAt: now.Add(-time.Hour), interval: 5 * time.Minute, want: StatusPass},
+		{name: "just started", startedAt: now.Add(-10 * time.Second), interval: interval, want: StatusWarn},
+		{name: "never succeeded", startedAt: now.Add(-time.Hour), interval: interval, want: StatusFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := CheckHubConnection(tt.lastHeartbeat, tt.startedAt, tt.interval, tt.lastError)
+			if check.Status != tt.want {
+				t.Errorf("CheckHubConnection() = %+v, want %s", check, tt.want)
+			}
+		})
+	}
+}
+
+func TestChecker_SetCheckFunc(t *testing.T) {
+	c := NewChecker("1.0.0", "agent-1")
+	c.UpdateCheck("enrolled", &Check{Status: StatusPass})
+
+	status := StatusPass
+	c.SetCheckFunc("hub_connection", func() *Check {
+		return &Check{Status: status}
+	})
+	if !c.IsHealthy() {
+		t.Fatal("IsHealthy() = false with passing checks")
+	}
+
+	// Evaluated again for every report
+	status = StatusFail
+	report := c.GetReport()
+	if report.Status != "unhealthy" || report.Checks["hub_connection"].Status != StatusFail {
+		t.Errorf("GetReport() = %+v, want hub_connection failing", report)
+	}
+}
+
+func TestChecker_SetPolicy(t *testing.T) {
+	merged, err := policy.Merge([]*policy.Policy{policy.DefaultPolicy()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewChecker("1.0.0", "agent-1")
+	c.SetPolicy(merged)
+
+	// Served without authentication, so only the summary may be encoded
+	data, err := json.Marshal(c.GetReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Policy map[string]json.RawMessage `json:"policy"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Policy) != 3 || decoded.Policy["version"] == nil || decoded.Policy["layers"] == nil {
+		t.Errorf("report policy = %s, want version, expiry and layers only", data)
+	}
+}
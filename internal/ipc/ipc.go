@@ -0,0 +1,77 @@
+// Package ipc provides local channels between the agent daemon and
+// unprivileged clients on the same host (tray app, CLI). On Unix they are
+// Unix domain sockets in the runtime directory; on Windows they are named
+// pipes that only local interactive users and administrators can open.
+// Servers identify the client of each connection with PeerCredentials.
+package ipc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// ConsentChannel carries consent prompts to the tray app
+	ConsentChannel = "consent"
+
+	// ControlChannel serves the daemon's status and control API
+	ControlChannel = "control"
+
+	// httpHost is the placeholder host used for HTTP over a local channel
+	httpHost = "jtnt-agent"
+)
+
+// Listen opens the named channel in dir for the daemon
+func Listen(dir, name string) (net.Listener, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	return listen(dir, name)
+}
+
+// Dial connects to the named channel in dir
+func Dial(ctx context.Context, dir, name string) (net.Conn, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	return dial(ctx, dir, name)
+}
+
+// NewHTTPClient returns an HTTP client whose requests go to the named
+// channel. Request URLs use the host "jtnt-agent", e.g.
+// "http://jtnt-agent/v1/consent/pending".
+func NewHTTPClient(dir, name string, timeout time.Duration) *http.Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return Dial(ctx, dir, name)
+		},
+		DisableCompression: true,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}
+}
+
+// URL returns the HTTP URL for path on a local channel
+func URL(path string) string {
+	return "http://" + httpHost + path
+}
+
+func validateName(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\.`) {
+		return fmt.Errorf("invalid ipc channel name: %q", name)
+	}
+	return nil
+}
+
+// socketPath returns the socket file for name in dir
+func socketPath(dir, name, ext string) string {
+	return filepath.Join(dir, name+ext)
+}
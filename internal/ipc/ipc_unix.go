@@ -0,0 +1,44 @@
+// +build !windows
+
+package ipc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+)
+
+func listen(dir, name string) (net.Listener, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create runtime directory: %w", err)
+	}
+
+	path := socketPath(dir, name, ".sock")
+
+	// A stale socket from a previous run blocks bind
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("refusing to replace non-socket %s", path)
+		}
+		os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+
+	// Clients run as the logged-in user; servers authorize each request
+	if err := os.Chmod(path, 0666); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+
+	return listener, nil
+}
+
+func dial(ctx context.Context, dir, name string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "unix", socketPath(dir, name, ".sock"))
+}
@@ -0,0 +1,443 @@
+// +build windows
+
+package ipc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	pipePrefix = `\\.\pipe\jtnt-agent-`
+
+	// pipeSDDL gives LocalSystem and Administrators full access and lets
+	// interactive users connect, without FILE_CREATE_PIPE_INSTANCE so they
+	// cannot serve the pipe themselves. Servers check who connected.
+	pipeSDDL = "D:P(A;;GA;;;SY)(A;;GA;;;BA)(A;;0x12019b;;;IU)"
+
+	pipeBufferSize = 64 * 1024
+
+	// clientAccess is GENERIC_READ and GENERIC_WRITE without
+	// FILE_APPEND_DATA, which pipeSDDL does not grant interactive users
+	clientAccess = windows.GENERIC_READ | windows.FILE_WRITE_DATA | windows.FILE_WRITE_ATTRIBUTES | windows.FILE_WRITE_EA
+)
+
+// pipeName returns the pipe for name. The runtime directory is part of the
+// name so separate agents and tests do not share pipes.
+func pipeName(dir, name string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(filepath.Clean(dir))))
+	return pipePrefix + name + "-" + hex.EncodeToString(sum[:4])
+}
+
+// listen creates a named pipe that only local, interactive users and
+// administrators can open
+func listen(dir, name string) (net.Listener, error) {
+	sd, err := windows.SecurityDescriptorFromString(pipeSDDL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build pipe security descriptor: %w", err)
+	}
+	done, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &pipeListener{
+		path: pipeName(dir, name),
+		sa: &windows.SecurityAttributes{
+			Length:             uint32(unsafe.Sizeof(windows.SecurityAttributes{})),
+			SecurityDescriptor: sd,
+		},
+		done: done,
+	}
+
+	// Claim the name: fails if another process already serves it
+	if l.next, err = l.create(true); err != nil {
+		windows.CloseHandle(done)
+		return nil, fmt.Errorf("failed to listen on %s: %w", l.path, err)
+	}
+	return l, nil
+}
+
+func dial(ctx context.Context, dir, name string) (net.Conn, error) {
+	path := pipeName(dir, name)
+	path16, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		// Identification level only: the agent may check who the client
+		// is but cannot act as it
+		h, err := windows.CreateFile(path16, clientAccess, 0, nil, windows.OPEN_EXISTING,
+			windows.FILE_FLAG_OVERLAPPED|windows.SECURITY_SQOS_PRESENT|windows.SECURITY_IDENTIFICATION, 0)
+		if err == nil {
+			return newPipeConn(h, path, false)
+		}
+		if err == windows.ERROR_FILE_NOT_FOUND {
+			return nil, fmt.Errorf("agent not listening: %w", err)
+		}
+		if err != windows.ERROR_PIPE_BUSY {
+			return nil, fmt.Errorf("failed to connect to %s: %w", path, err)
+		}
+
+		// All instances are taken until the server accepts again
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// pipeListener accepts connections on a named pipe. Each connection uses its
+// own pipe instance; the next one is created before the previous is handed
+// out.
+type pipeListener struct {
+	path string
+	sa   *windows.SecurityAttributes
+	done windows.Handle // Signalled by Close
+
+	mu     sync.Mutex
+	next   windows.Handle // Instance waiting for a client, 0 if none
+	closed bool
+}
+
+func (l *pipeListener) create(first bool) (windows.Handle, error) {
+	path16, err := windows.UTF16PtrFromString(l.path)
+	if err != nil {
+		return 0, err
+	}
+	flags := uint32(windows.PIPE_ACCESS_DUPLEX | windows.FILE_FLAG_OVERLAPPED)
+	if first {
+		flags |= windows.FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+	mode := uint32(windows.PIPE_TYPE_BYTE | windows.PIPE_READMODE_BYTE | windows.PIPE_WAIT | windows.PIPE_REJECT_REMOTE_CLIENTS)
+	return windows.CreateNamedPipe(path16, flags, mode, windows.PIPE_UNLIMITED_INSTANCES,
+		pipeBufferSize, pipeBufferSize, 0, l.sa)
+}
+
+// Accept waits for a client on the next pipe instance
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	h := l.next
+	l.next = 0
+	l.mu.Unlock()
+
+	if h == 0 {
+		var err error
+		if h, err = l.create(false); err != nil {
+			return nil, fmt.Errorf("failed to create pipe instance: %w", err)
+		}
+	}
+
+	if err := l.connect(h); err != nil {
+		windows.CloseHandle(h)
+		return nil, err
+	}
+	return newPipeConn(h, l.path, true)
+}
+
+// connect waits for a client to open h or the listener to close
+func (l *pipeListener) connect(h windows.Handle) error {
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(event)
+
+	ov := &windows.Overlapped{HEvent: event}
+	switch err := windows.ConnectNamedPipe(h, ov); err {
+	case nil, windows.ERROR_PIPE_CONNECTED:
+		return nil
+	case windows.ERROR_IO_PENDING:
+	default:
+		return err
+	}
+
+	var n uint32
+	signalled, err := windows.WaitForMultipleObjects([]windows.Handle{event, l.done}, false, windows.INFINITE)
+	if err != nil || signalled != windows.WAIT_OBJECT_0 {
+		windows.CancelIoEx(h, ov)
+		windows.GetOverlappedResult(h, ov, &n, true)
+		return net.ErrClosed
+	}
+	return windows.GetOverlappedResult(h, ov, &n, false)
+}
+
+// Close stops Accept. The done event is left open for Accept calls still
+// returning.
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	windows.SetEvent(l.done)
+	if l.next != 0 {
+		windows.CloseHandle(l.next)
+		l.next = 0
+	}
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr(l.path)
+}
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// pipeConn is one end of a connected pipe instance, using overlapped I/O so
+// reads and writes can run concurrently and be interrupted by deadlines
+type pipeConn struct {
+	h      windows.Handle
+	path   string
+	server bool
+	done   windows.Handle // Signalled by Close
+
+	mu       sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup
+
+	readDeadline  *deadline
+	writeDeadline *deadline
+}
+
+func newPipeConn(h windows.Handle, path string, server bool) (*pipeConn, error) {
+	c := &pipeConn{h: h, path: path, server: server}
+
+	var err error
+	if c.done, err = windows.CreateEvent(nil, 1, 0, nil); err != nil {
+		windows.CloseHandle(h)
+		return nil, err
+	}
+	if c.readDeadline, err = newDeadline(); err == nil {
+		c.writeDeadline, err = newDeadline()
+	}
+	if err != nil {
+		c.release()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	n, err := c.do(c.readDeadline, func(ov *windows.Overlapped, n *uint32) error {
+		return windows.ReadFile(c.h, b, n, ov)
+	})
+	if err == windows.ERROR_BROKEN_PIPE || err == windows.ERROR_PIPE_NOT_CONNECTED {
+		return n, io.EOF
+	}
+	return n, c.opError("read", err)
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		n, err := c.do(c.writeDeadline, func(ov *windows.Overlapped, n *uint32) error {
+			return windows.WriteFile(c.h, b[written:], n, ov)
+		})
+		written += n
+		if err != nil {
+			return written, c.opError("write", err)
+		}
+	}
+	return written, nil
+}
+
+// do runs one overlapped operation, cancelling it when d passes or the
+// connection is closed
+func (c *pipeConn) do(d *deadline, op func(ov *windows.Overlapped, n *uint32) error) (int, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return 0, net.ErrClosed
+	}
+	c.inflight.Add(1)
+	c.mu.Unlock()
+	defer c.inflight.Done()
+
+	if d.timeout() == 0 {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(event)
+
+	ov := &windows.Overlapped{HEvent: event}
+	var n uint32
+	if err := op(ov, &n); err != nil && err != windows.ERROR_IO_PENDING {
+		return 0, err
+	}
+
+	for {
+		timeout := d.timeout()
+		if timeout == 0 {
+			return c.cancel(ov, os.ErrDeadlineExceeded)
+		}
+		signalled, err := windows.WaitForMultipleObjects([]windows.Handle{event, d.changed, c.done}, false, timeout)
+		switch {
+		case err != nil:
+			return c.cancel(ov, err)
+		case signalled == windows.WAIT_OBJECT_0:
+			err := windows.GetOverlappedResult(c.h, ov, &n, false)
+			return int(n), err
+		case signalled == windows.WAIT_OBJECT_0+1:
+			// Deadline moved; wait again with the new one
+		case signalled == windows.WAIT_OBJECT_0+2:
+			return c.cancel(ov, net.ErrClosed)
+		default:
+			return c.cancel(ov, os.ErrDeadlineExceeded)
+		}
+	}
+}
+
+// cancel stops the pending operation ov and returns reason unless it
+// completed in the meantime
+func (c *pipeConn) cancel(ov *windows.Overlapped, reason error) (int, error) {
+	windows.CancelIoEx(c.h, ov)
+	var n uint32
+	if err := windows.GetOverlappedResult(c.h, ov, &n, true); err == nil {
+		return int(n), nil
+	}
+	return int(n), reason
+}
+
+func (c *pipeConn) opError(op string, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	return &net.OpError{Op: op, Net: "pipe", Addr: pipeAddr(c.path), Err: err}
+}
+
+// Close interrupts pending reads and writes and closes the pipe. Data
+// already written stays readable by the other end.
+func (c *pipeConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	windows.SetEvent(c.done)
+	c.inflight.Wait()
+	c.release()
+	return nil
+}
+
+func (c *pipeConn) release() {
+	windows.CloseHandle(c.h)
+	windows.CloseHandle(c.done)
+	if c.readDeadline != nil {
+		c.readDeadline.close()
+	}
+	if c.writeDeadline != nil {
+		c.writeDeadline.close()
+	}
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return pipeAddr(c.path) }
+func (c *pipeConn) RemoteAddr() net.Addr { return pipeAddr(c.path) }
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// peer identifies the client process of a server connection
+func (c *pipeConn) peer() (*Peer, error) {
+	if !c.server {
+		return nil, ErrPeerUnknown
+	}
+	var pid uint32
+	if err := windows.GetNamedPipeClientProcessId(c.h, &pid); err != nil {
+		return nil, fmt.Errorf("failed to read pipe client: %w", err)
+	}
+	return processPeer(pid)
+}
+
+// deadline is a read or write deadline that wakes pending operations when
+// it changes
+type deadline struct {
+	mu      sync.Mutex
+	t       time.Time
+	changed windows.Handle // Auto-reset event
+}
+
+func newDeadline() (*deadline, error) {
+	changed, err := windows.CreateEvent(nil, 0, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &deadline{changed: changed}, nil
+}
+
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	d.t = t
+	d.mu.Unlock()
+	windows.SetEvent(d.changed)
+}
+
+// timeout returns the milliseconds left, INFINITE without a deadline and 0
+// once it has passed
+func (d *deadline) timeout() uint32 {
+	d.mu.Lock()
+	t := d.t
+	d.mu.Unlock()
+
+	if t.IsZero() {
+		return windows.INFINITE
+	}
+	left := time.Until(t)
+	if left <= 0 {
+		return 0
+	}
+	ms := (left + time.Millisecond - 1) / time.Millisecond
+	if ms >= windows.INFINITE {
+		return windows.INFINITE - 1
+	}
+	return uint32(ms)
+}
+
+func (d *deadline) close() {
+	windows.CloseHandle(d.changed)
+}
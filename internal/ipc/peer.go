@@ -0,0 +1,84 @@
+package ipc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// ErrPeerUnknown indicates the platform cannot identify the process on the
+// other end of a channel
+var ErrPeerUnknown = errors.New("peer credentials unavailable")
+
+// Peer identifies the process on the other end of a channel
+type Peer struct {
+	UID int
+	GID int
+	PID int // 0 when the platform does not report it
+
+	// Windows identifies users by SID; UID and GID are -1 there
+	SID      string
+	Session  int  // Terminal services session of the process
+	Elevated bool // LocalSystem or an elevated administrator
+}
+
+// Privileged reports whether the peer is root or runs as the daemon's user
+func (p *Peer) Privileged() bool {
+	if p.SID != "" {
+		return p.Elevated
+	}
+	return p.UID == 0 || p.UID == os.Geteuid()
+}
+
+// Console reports whether the peer runs as the user logged in at the
+// machine's console, the one consent prompts are meant for
+func (p *Peer) Console() bool {
+	return isConsole(p)
+}
+
+// Name describes the peer's account for audit records, e.g.
+// "alice (uid 1000)"
+func (p *Peer) Name() string {
+	id, label := strconv.Itoa(p.UID), "uid "+strconv.Itoa(p.UID)
+	if p.SID != "" {
+		id, label = p.SID, p.SID
+	}
+	if u, err := user.LookupId(id); err == nil {
+		return fmt.Sprintf("%s (%s)", u.Username, label)
+	}
+	return label
+}
+
+type peerKey struct{}
+
+// ConnContext records the peer of c in ctx. Use it as http.Server.ConnContext
+// so handlers can call PeerFromContext.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	peer, err := PeerCredentials(c)
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, peerKey{}, peer)
+}
+
+// PeerFromContext returns the peer recorded by ConnContext
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	peer, ok := ctx.Value(peerKey{}).(*Peer)
+	return peer, ok
+}
+
+// PeerCredentials returns the identity of the process connected on c
+func PeerCredentials(c net.Conn) (*Peer, error) {
+	if pc, ok := c.(interface{ peer() (*Peer, error) }); ok {
+		return pc.peer()
+	}
+	unixConn, ok := c.(*net.UnixConn)
+	if !ok {
+		return nil, ErrPeerUnknown
+	}
+	return peerCredentials(unixConn)
+}
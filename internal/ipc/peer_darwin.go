@@ -0,0 +1,50 @@
+// +build darwin
+
+package ipc
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCredentials reads LOCAL_PEERCRED and LOCAL_PEERPID from the socket
+func peerCredentials(c *net.UnixConn) (*Peer, error) {
+	raw, err := c.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *unix.Xucred
+	var pid int
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+		if credErr == nil {
+			// Best effort; the uid is what authorization relies on
+			pid, _ = unix.GetsockoptInt(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERPID)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, fmt.Errorf("failed to read peer credentials: %w", credErr)
+	}
+
+	peer := &Peer{UID: int(cred.Uid), PID: pid}
+	if cred.Ngroups > 0 {
+		peer.GID = int(cred.Groups[0])
+	}
+	return peer, nil
+}
+
+// isConsole compares the peer with the owner of /dev/console, the user
+// logged in at the login window
+func isConsole(p *Peer) bool {
+	var st unix.Stat_t
+	if err := unix.Stat("/dev/console", &st); err != nil {
+		return false
+	}
+	return st.Uid != 0 && int(st.Uid) == p.UID
+}
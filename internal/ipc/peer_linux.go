@@ -0,0 +1,53 @@
+// +build linux
+
+package ipc
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCredentials reads SO_PEERCRED from the socket
+func peerCredentials(c *net.UnixConn) (*Peer, error) {
+	raw, err := c.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *unix.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, fmt.Errorf("failed to read peer credentials: %w", credErr)
+	}
+
+	return &Peer{UID: int(cred.Uid), GID: int(cred.Gid), PID: int(cred.Pid)}, nil
+}
+
+// seatFile is where logind records the session active on the first seat
+const seatFile = "/run/systemd/seats/seat0"
+
+// isConsole compares the peer with the user of the active session on the
+// first seat. Without logind no one is the console user.
+func isConsole(p *Peer) bool {
+	data, err := os.ReadFile(seatFile)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "ACTIVE_UID="); ok {
+			uid, err := strconv.Atoi(value)
+			return err == nil && uid == p.UID
+		}
+	}
+	return false
+}
@@ -0,0 +1,15 @@
+// +build !linux,!darwin,!windows
+
+package ipc
+
+import "net"
+
+// peerCredentials is not implemented on this platform, so privileged
+// requests are refused
+func peerCredentials(c *net.UnixConn) (*Peer, error) {
+	return nil, ErrPeerUnknown
+}
+
+func isConsole(p *Peer) bool {
+	return false
+}
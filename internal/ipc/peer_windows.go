@@ -0,0 +1,57 @@
+// +build windows
+
+package ipc
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/windows"
+)
+
+// peerCredentials is unused on Windows, where channels are named pipes
+func peerCredentials(c *net.UnixConn) (*Peer, error) {
+	return nil, ErrPeerUnknown
+}
+
+// processPeer reads the user, session and elevation of process pid
+func processPeer(pid uint32) (*Peer, error) {
+	process, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open peer process: %w", err)
+	}
+	defer windows.CloseHandle(process)
+
+	var token windows.Token
+	if err := windows.OpenProcessToken(process, windows.TOKEN_QUERY, &token); err != nil {
+		return nil, fmt.Errorf("failed to open peer token: %w", err)
+	}
+	defer token.Close()
+
+	tokenUser, err := token.GetTokenUser()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read peer user: %w", err)
+	}
+
+	var session uint32
+	if err := windows.ProcessIdToSessionId(pid, &session); err != nil {
+		return nil, fmt.Errorf("failed to read peer session: %w", err)
+	}
+
+	sid := tokenUser.User.Sid
+	return &Peer{
+		UID:      -1,
+		GID:      -1,
+		PID:      int(pid),
+		SID:      sid.String(),
+		Session:  int(session),
+		Elevated: token.IsElevated() || sid.IsWellKnown(windows.WinLocalSystemSid),
+	}, nil
+}
+
+// isConsole reports whether the peer runs in the session attached to the
+// physical console
+func isConsole(p *Peer) bool {
+	console := windows.WTSGetActiveConsoleSessionId()
+	return console != 0xFFFFFFFF && p.SID != "" && uint32(p.Session) == console
+}
@@ -0,0 +1,172 @@
+package jobs
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/policy"
+	"github.com/tshojoshua/jtnt-agent/internal/redact"
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+// Evaluate runs the policy checks the executor applies to job before
+// running it, without executing or touching anything. Script signatures and
+// upload file sizes depend on run-time state and are checked by the handlers.
+// An allowed job that would be deferred by a maintenance window says so in
+// the reason.
+func Evaluate(enforcer *policy.Enforcer, job *api.Job) *policy.Decision {
+	decision := evaluatePolicy(enforcer, job)
+	if !decision.Allowed {
+		return decision
+	}
+
+	now := time.Now()
+	runAt, closed, err := enforcer.NextStartTime(string(job.Type), jobBinary(job), now)
+	if err != nil {
+		return policy.Deny(err)
+	}
+	if runAt.After(now) {
+		decision.Reason += fmt.Sprintf("; deferred until %s by %s",
+			runAt.Format(time.RFC3339), strings.Join(closed, ", "))
+	}
+
+	return decision
+}
+
+// evaluatePolicy runs the capability checks for job
+func evaluatePolicy(enforcer *policy.Enforcer, job *api.Job) *policy.Decision {
+	switch job.Type {
+	case api.JobTypeExec:
+		var payload api.ExecPayload
+		if err := ParsePayload(job.Payload, &payload); err != nil {
+			return policy.Deny(fmt.Errorf("invalid payload: %w", err))
+		}
+		return enforcer.ExplainExecuteBinary(payload.Binary, payload.Args, execTimeout(enforcer, job, &payload))
+
+	case api.JobTypeScript:
+		var payload api.ScriptPayload
+		if err := ParsePayload(job.Payload, &payload); err != nil {
+			return policy.Deny(fmt.Errorf("invalid payload: %w", err))
+		}
+		scriptBytes, err := base64.StdEncoding.DecodeString(payload.ScriptContent)
+		if err != nil {
+			return policy.Deny(fmt.Errorf("invalid script encoding: %w", err))
+		}
+		return enforcer.ExplainExecuteScript(payload.Interpreter, len(scriptBytes),
+			payload.ScriptSignature != "", scriptTimeout(enforcer, job, &payload))
+
+	case api.JobTypeDownload:
+		var payload api.DownloadPayload
+		if err := ParsePayload(job.Payload, &payload); err != nil {
+			return policy.Deny(fmt.Errorf("invalid payload: %w", err))
+		}
+		return enforcer.ExplainWriteFile(payload.DestPath, 0)
+
+	case api.JobTypeUpload:
+		var payload api.UploadPayload
+		if err := ParsePayload(job.Payload, &payload); err != nil {
+			return policy.Deny(fmt.Errorf("invalid payload: %w", err))
+		}
+		return enforcer.ExplainReadFile(payload.SourcePath)
+
+	case api.JobTypeSupportBundle:
+		var payload api.SupportBundlePayload
+		if err := ParsePayload(job.Payload, &payload); err != nil {
+			return policy.Deny(fmt.Errorf("invalid payload: %w", err))
+		}
+		return enforcer.ExplainCollectSupportBundle()
+
+	default:
+		return policy.Deny(fmt.Errorf("unsupported job type: %s", job.Type))
+	}
+}
+
+// Describe summarizes what job will do for people reviewing it
+func Describe(job *api.Job) string {
+	switch job.Type {
+	case api.JobTypeExec:
+		var payload api.ExecPayload
+		if err := ParsePayload(job.Payload, &payload); err == nil {
+			return strings.TrimSpace(payload.Binary + " " + strings.Join(payload.Args, " "))
+		}
+	case api.JobTypeScript:
+		var payload api.ScriptPayload
+		if err := ParsePayload(job.Payload, &payload); err == nil {
+			size := base64.StdEncoding.DecodedLen(len(payload.ScriptContent))
+			return fmt.Sprintf("run %s script (%d bytes)", payload.Interpreter, size)
+		}
+	case api.JobTypeDownload:
+		var payload api.DownloadPayload
+		if err := ParsePayload(job.Payload, &payload); err == nil {
+			return fmt.Sprintf("download %s to %s", payload.URL, payload.DestPath)
+		}
+	case api.JobTypeUpload:
+		var payload api.UploadPayload
+		if err := ParsePayload(job.Payload, &payload); err == nil {
+			return fmt.Sprintf("upload %s", payload.SourcePath)
+		}
+	case api.JobTypeSupportBundle:
+		return "collect and upload a support bundle"
+	}
+	return string(job.Type) + " job"
+}
+
+// Secrets returns the values of job to mask while it runs: those its
+// payload declares in "redact" and environment variables named like
+// secrets, such as DB_PASSWORD
+func Secrets(job *api.Job) []string {
+	var payload struct {
+		Redact  []string          `json:"redact"`
+		EnvVars map[string]string `json:"env_vars"`
+	}
+	if err := ParsePayload(job.Payload, &payload); err != nil {
+		return nil
+	}
+
+	secrets := payload.Redact
+	for name, value := range payload.EnvVars {
+		if redact.IsSensitiveKey(name) {
+			secrets = append(secrets, value)
+		}
+	}
+	return secrets
+}
+
+// jobBinary returns the binary an exec job runs, or "" for other jobs
+func jobBinary(job *api.Job) string {
+	if job.Type != api.JobTypeExec {
+		return ""
+	}
+	var payload api.ExecPayload
+	if err := ParsePayload(job.Payload, &payload); err != nil {
+		return ""
+	}
+	return payload.Binary
+}
+
+// execTimeout resolves the timeout for an exec job: payload, then job, then
+// the policy maximum
+func execTimeout(enforcer *policy.Enforcer, job *api.Job, payload *api.ExecPayload) int {
+	timeoutSec := payload.TimeoutSec
+	if timeoutSec == 0 {
+		timeoutSec = job.TimeoutSec
+	}
+	if timeoutSec == 0 {
+		timeoutSec = enforcer.GetMaxExecTimeout()
+	}
+	return timeoutSec
+}
+
+// scriptTimeout resolves the timeout for a script job like execTimeout
+func scriptTimeout(enforcer *policy.Enforcer, job *api.Job, payload *api.ScriptPayload) int {
+	timeoutSec := payload.TimeoutSec
+	if timeoutSec == 0 {
+		timeoutSec = job.TimeoutSec
+	}
+	if timeoutSec == 0 {
+		timeoutSec = enforcer.GetMaxScriptTimeout()
+	}
+	return timeoutSec
+}
@@ -0,0 +1,50 @@
+package jobs
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/consent"
+	"github.com/tshojoshua/jtnt-agent/internal/policy"
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+func TestExecutor_RedactsConsentSummary(t *testing.T) {
+	enforcer := newTestEnforcer(t, func(pol *policy.Policy) {
+		pol.Capabilities.Exec.AllowedBinaries = []string{"echo"}
+		pol.Capabilities.Exec.RequireConsent = true
+	})
+	broker := consent.NewBroker()
+	executor := NewExecutor("agent-1", enforcer, nil, nil, nil, broker, &recordingLogger{})
+
+	summaries := make(chan string, 1)
+	go func() {
+		requests := broker.Pending(context.Background(), 5*time.Second)
+		if len(requests) != 1 {
+			summaries <- ""
+			return
+		}
+		summaries <- requests[0].Summary
+		broker.Answer(requests[0].ID, consent.Answer{Approve: false, Responder: "alice"})
+	}()
+
+	result := executor.Execute(context.Background(), &api.Job{
+		JobID: "job-consent",
+		Type:  api.JobTypeExec,
+		Payload: map[string]interface{}{
+			"binary": "echo",
+			"args":   []string{"--password", "hunter22"},
+			"redact": []string{"hunter22"},
+		},
+	})
+
+	summary := <-summaries
+	if summary == "" || strings.Contains(summary, "hunter22") {
+		t.Errorf("consent summary = %q, want it without the job's secret", summary)
+	}
+	if result.Status != api.StatusError {
+		t.Errorf("Status = %s, want error after the user denied consent", result.Status)
+	}
+}
@@ -46,15 +46,22 @@ func (h *DownloadHandler) Execute(ctx context.Context, job *api.Job) *api.JobRes
 			-1, nil, nil, fmt.Errorf("policy violation: %w", err), nil)
 	}
 
+	// Work on the symlink-free path that was checked
+	destPath, err := policy.CanonicalPath(payload.DestPath)
+	if err != nil {
+		return FormatResult(h.agentID, api.StatusError, startedAt, time.Now(),
+			-1, nil, nil, fmt.Errorf("policy violation: %w", err), nil)
+	}
+
 	// Ensure directory exists
-	dir := filepath.Dir(payload.DestPath)
+	dir := filepath.Dir(destPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return FormatResult(h.agentID, api.StatusError, startedAt, time.Now(),
 			-1, nil, nil, fmt.Errorf("failed to create directory: %w", err), nil)
 	}
 
 	// Download file
-	if err := h.downloadFile(ctx, payload.URL, payload.DestPath, payload.SHA256); err != nil {
+	if err := h.downloadFile(ctx, payload.URL, destPath, payload.SHA256); err != nil {
 		return FormatResult(h.agentID, api.StatusError, startedAt, time.Now(),
 			-1, nil, nil, err, nil)
 	}
@@ -85,16 +92,13 @@ func (h *DownloadHandler) downloadFile(ctx context.Context, url, destPath, expec
 		return fmt.Errorf("download failed with status %d", resp.StatusCode)
 	}
 
-	// Create temp file
-	tempPath := destPath + ".tmp"
-	outFile, err := os.Create(tempPath)
+	// Create a temp file next to destPath through its directory as opened
+	// now, so the directory cannot be swapped before the rename
+	outFile, err := h.enforcer.CreateAtomic(destPath, 0600)
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
-	defer func() {
-		outFile.Close()
-		os.Remove(tempPath) // Clean up temp file if still exists
-	}()
+	defer outFile.Abort() // Clean up temp file unless it was committed
 
 	// Download with hash calculation
 	hasher := sha256.New()
@@ -104,7 +108,10 @@ func (h *DownloadHandler) downloadFile(ctx context.Context, url, destPath, expec
 		return fmt.Errorf("failed to write file: %w", err)
 	}
 
-	outFile.Close()
+	// Set permissions on the open handle rather than by path
+	if err := outFile.Chmod(0600); err != nil {
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
 
 	// Verify hash if provided
 	if expectedHash != "" {
@@ -114,15 +121,7 @@ func (h *DownloadHandler) downloadFile(ctx context.Context, url, destPath, expec
 		}
 	}
 
-	// Move temp file to final destination
-	if err := os.Rename(tempPath, destPath); err != nil {
-		return fmt.Errorf("failed to move file: %w", err)
-	}
-
-	// Set permissions
-	if err := os.Chmod(destPath, 0600); err != nil {
-		return fmt.Errorf("failed to set permissions: %w", err)
-	}
-
-	return nil
+	// Move temp file to final destination (rename replaces a symlink at
+	// destPath rather than following it)
+	return outFile.Commit()
 }
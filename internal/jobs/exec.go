@@ -36,16 +36,10 @@ func (h *ExecHandler) Execute(ctx context.Context, job *api.Job) *api.JobResult
 	}
 
 	// Determine timeout
-	timeoutSec := payload.TimeoutSec
-	if timeoutSec == 0 {
-		timeoutSec = job.TimeoutSec
-	}
-	if timeoutSec == 0 {
-		timeoutSec = h.enforcer.GetMaxExecTimeout()
-	}
+	timeoutSec := execTimeout(h.enforcer, job, &payload)
 
 	// Enforce policy
-	if err := h.enforcer.CanExecuteBinary(payload.Binary, timeoutSec); err != nil {
+	if err := h.enforcer.CanExecuteBinary(payload.Binary, payload.Args, timeoutSec); err != nil {
 		return FormatResult(h.agentID, api.StatusError, startedAt, time.Now(),
 			-1, nil, nil, fmt.Errorf("policy violation: %w", err), nil)
 	}
@@ -67,8 +61,30 @@ func (h *ExecHandler) Execute(ctx context.Context, job *api.Job) *api.JobResult
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 
+	// Give the child its job identity and a file for structured results
+	resultFile, err := newResultFile()
+	if err != nil {
+		return FormatResult(h.agentID, api.StatusError, startedAt, time.Now(),
+			-1, nil, nil, err, nil)
+	}
+	defer resultFile.remove()
+	resultFile.apply(cmd, job.JobID, h.agentID)
+
+	// Deliver the job's secrets
+	secretDirs := applySecrets(ctx, cmd)
+
+	// Confine the child to the policy's filesystem view
+	sandboxStatus, cleanupSandbox, err := applySandbox(h.enforcer, cmd, []string{resultFile.dir}, secretDirs...)
+	if err != nil {
+		result := FormatResult(h.agentID, api.StatusError, startedAt, time.Now(),
+			-1, nil, nil, fmt.Errorf("policy violation: %w", err), nil)
+		result.Sandbox = string(sandboxStatus)
+		return result
+	}
+	defer cleanupSandbox()
+
 	// Execute
-	err := cmd.Run()
+	err = cmd.Run()
 	finishedAt := time.Now()
 
 	// Determine status
@@ -90,6 +106,9 @@ func (h *ExecHandler) Execute(ctx context.Context, job *api.Job) *api.JobResult
 		}
 	}
 
-	return FormatResult(h.agentID, status, startedAt, finishedAt,
+	result := FormatResult(h.agentID, status, startedAt, finishedAt,
 		exitCode, stdout, stderr, err, nil)
+	result.Sandbox = string(sandboxStatus)
+	resultFile.attachData(result)
+	return result
 }
@@ -2,26 +2,47 @@ package jobs
 
 import (
 	"context"
+	"crypto/ecdh"
 	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/tshojoshua/jtnt-agent/internal/consent"
 	"github.com/tshojoshua/jtnt-agent/internal/policy"
+	"github.com/tshojoshua/jtnt-agent/internal/redact"
+	"github.com/tshojoshua/jtnt-agent/internal/secrets"
+	"github.com/tshojoshua/jtnt-agent/internal/support"
 	"github.com/tshojoshua/jtnt-agent/internal/transport"
 	"github.com/tshojoshua/jtnt-agent/pkg/api"
 )
 
 // Executor orchestrates job execution
 type Executor struct {
-	agentID       string
-	enforcer      *policy.Enforcer
-	client        *transport.Client
-	publicKey     ed25519.PublicKey
-	execHandler   *ExecHandler
-	scriptHandler *ScriptHandler
-	downloadHandler *DownloadHandler
-	uploadHandler *UploadHandler
-	logger        JobLogger
+	agentID   string
+	client    *transport.Client
+	publicKey ed25519.PublicKey
+	queue     *ScheduleQueue
+	consent   *consent.Broker
+	logger    JobLogger
+	audit     AuditLogger
+	secretKey *ecdh.PrivateKey
+
+	mu       sync.RWMutex
+	handlers *handlers
+	support  support.Options
+}
+
+// handlers are bound to one policy and replaced together when it changes
+type handlers struct {
+	enforcer *policy.Enforcer
+	exec     *ExecHandler
+	script   *ScriptHandler
+	download *DownloadHandler
+	upload   *UploadHandler
+	support  *SupportBundleHandler
 }
 
 // JobLogger interface for logging job execution
@@ -31,64 +52,300 @@ type JobLogger interface {
 	Audit(jobID string, jobType string, status string, fields map[string]interface{})
 }
 
+// AuditLogger records jobs and policy violations in the signed audit log
+type AuditLogger interface {
+	LogJobExecution(jobID, jobType, status, command string, policyVersion int) error
+	LogPolicyViolation(violationType, resource string, jobID string) error
+	LogConsent(jobID, outcome, summary, responder, requestedBy string) error
+}
+
 // NewExecutor creates a new job executor
 func NewExecutor(agentID string, enforcer *policy.Enforcer, client *transport.Client, 
-	publicKey ed25519.PublicKey, logger JobLogger) *Executor {
+	publicKey ed25519.PublicKey, queue *ScheduleQueue, broker *consent.Broker, logger JobLogger) *Executor {
 	
 	exec := &Executor{
 		agentID:   agentID,
-		enforcer:  enforcer,
 		client:    client,
 		publicKey: publicKey,
+		queue:     queue,
+		consent:   broker,
 		logger:    logger,
 	}
 
 	// Initialize handlers
-	exec.execHandler = NewExecHandler(enforcer, agentID)
-	exec.scriptHandler = NewScriptHandler(enforcer, agentID, publicKey)
-	exec.downloadHandler = NewDownloadHandler(enforcer, agentID)
-	exec.uploadHandler = NewUploadHandler(enforcer, agentID, client)
+	exec.handlers = exec.newHandlers(enforcer)
 
 	return exec
 }
 
+// SetEnforcer switches to a new policy. Jobs already running finish under
+// the policy they started with.
+func (e *Executor) SetEnforcer(enforcer *policy.Enforcer) {
+	e.mu.Lock()
+	e.handlers = e.newHandlers(enforcer)
+	e.mu.Unlock()
+}
+
+// SetAuditLogger sets the signed audit log jobs are recorded in
+func (e *Executor) SetAuditLogger(audit AuditLogger) {
+	e.mu.Lock()
+	e.audit = audit
+	e.mu.Unlock()
+}
+
+// SetSupportOptions sets the sources support bundle jobs collect from
+func (e *Executor) SetSupportOptions(options support.Options) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.support = options
+	e.handlers.support = NewSupportBundleHandler(e.handlers.enforcer, e.agentID, e.client, options)
+}
+
+// Enforcer returns the policy enforcer new jobs run under
+func (e *Executor) Enforcer() *policy.Enforcer {
+	return e.current().enforcer
+}
+
+func (e *Executor) newHandlers(enforcer *policy.Enforcer) *handlers {
+	return &handlers{
+		enforcer: enforcer,
+		exec:     NewExecHandler(enforcer, e.agentID),
+		script:   NewScriptHandler(enforcer, e.agentID, e.publicKey),
+		download: NewDownloadHandler(enforcer, e.agentID),
+		upload:   NewUploadHandler(enforcer, e.agentID, e.client),
+		support:  NewSupportBundleHandler(enforcer, e.agentID, e.client, e.support),
+	}
+}
+
+func (e *Executor) current() *handlers {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.handlers
+}
+
 // Execute executes a job based on its type
 func (e *Executor) Execute(ctx context.Context, job *api.Job) *api.JobResult {
+	// Mask the job's secrets everywhere until it is recorded
+	release := redact.Add(Secrets(job)...)
+	defer release()
+
 	e.logger.Info("job", map[string]interface{}{
 		"message": "executing job",
 		"job_id":  job.JobID,
 		"type":    job.Type,
 	})
 
-	var result *api.JobResult
-
-	switch job.Type {
-	case api.JobTypeExec:
-		result = e.execHandler.Execute(ctx, job)
-	case api.JobTypeScript:
-		result = e.scriptHandler.Execute(ctx, job)
-	case api.JobTypeDownload:
-		result = e.downloadHandler.Execute(ctx, job)
-	case api.JobTypeUpload:
-		result = e.uploadHandler.Execute(ctx, job)
-	default:
-		result = &api.JobResult{
-			AgentID:      e.agentID,
-			Status:       api.StatusError,
-			ErrorMessage: fmt.Sprintf("unsupported job type: %s", job.Type),
+	h := e.current()
+	decision := Evaluate(h.enforcer, job)
+
+	// Hold jobs whose maintenance window is closed
+	result := e.deferIfOutsideWindow(h.enforcer, job)
+
+	// Ask the logged-in user when policy requires consent
+	if result == nil {
+		result = e.requestConsent(ctx, h.enforcer, job)
+	}
+
+	// Decrypt secrets only once the job is about to run; a job policy
+	// rejected never gets that far
+	if result == nil && decision.Allowed && job.Secrets != nil {
+		var delivery *secrets.Delivery
+		if delivery, result = e.openSecrets(job); delivery != nil {
+			defer e.wipeSecrets(job, delivery)
+			defer redact.Add(delivery.Values()...)()
+			ctx = withSecrets(ctx, delivery)
 		}
 	}
 
+	if result == nil {
+		switch job.Type {
+		case api.JobTypeExec:
+			result = h.exec.Execute(ctx, job)
+		case api.JobTypeScript:
+			result = h.script.Execute(ctx, job)
+		case api.JobTypeDownload:
+			result = h.download.Execute(ctx, job)
+		case api.JobTypeUpload:
+			result = h.upload.Execute(ctx, job)
+		case api.JobTypeSupportBundle:
+			result = h.support.Execute(ctx, job)
+		default:
+			result = &api.JobResult{
+				AgentID:      e.agentID,
+				Status:       api.StatusError,
+				ErrorMessage: fmt.Sprintf("unsupported job type: %s", job.Type),
+			}
+		}
+	}
+
+	RedactResult(result)
+
 	// Audit log
-	e.logger.Audit(job.JobID, string(job.Type), string(result.Status), map[string]interface{}{
+	fields := map[string]interface{}{
 		"exit_code":      result.ExitCode,
 		"error_message":  result.ErrorMessage,
-		"policy_version": e.enforcer.Policy().Version,
-	})
+		"policy_version": h.enforcer.Policy().Version,
+	}
+	if result.DeferredUntil != nil {
+		fields["deferred_until"] = result.DeferredUntil.Format(time.RFC3339)
+		fields["deferred_reason"] = result.DeferredReason
+	}
+	e.logger.Audit(job.JobID, string(job.Type), string(result.Status), fields)
+	e.recordAudit(job, decision, result, h.enforcer.Policy().Version)
 
 	return result
 }
 
+// recordAudit writes job and, when policy rejected it, the violation to the
+// signed audit log
+func (e *Executor) recordAudit(job *api.Job, decision *policy.Decision, result *api.JobResult, policyVersion int) {
+	e.mu.RLock()
+	audit := e.audit
+	e.mu.RUnlock()
+	if audit == nil {
+		return
+	}
+
+	command := Describe(job)
+
+	if !decision.Allowed {
+		if err := audit.LogPolicyViolation(policy.ViolationType(decision.Err), command, job.JobID); err != nil {
+			e.logger.Error("audit", map[string]interface{}{
+				"message": "failed to record policy violation",
+				"job_id":  job.JobID,
+				"error":   err.Error(),
+			})
+		}
+	}
+
+	if err := audit.LogJobExecution(job.JobID, string(job.Type), string(result.Status), command, policyVersion); err != nil {
+		e.logger.Error("audit", map[string]interface{}{
+			"message": "failed to record job execution",
+			"job_id":  job.JobID,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// deferIfOutsideWindow queues job when one of its maintenance windows is
+// closed and returns the deferred result. It returns nil when the job may
+// run now or will be rejected by policy anyway.
+func (e *Executor) deferIfOutsideWindow(enforcer *policy.Enforcer, job *api.Job) *api.JobResult {
+	if !evaluatePolicy(enforcer, job).Allowed {
+		return nil
+	}
+
+	now := time.Now()
+	runAt, closed, err := enforcer.NextStartTime(string(job.Type), jobBinary(job), now)
+	if err != nil {
+		return FormatResult(e.agentID, api.StatusError, now, now,
+			-1, nil, nil, fmt.Errorf("policy violation: %w", err), nil)
+	}
+	if !runAt.After(now) {
+		return nil
+	}
+
+	reason := "outside maintenance window " + strings.Join(closed, ", ")
+
+	if e.queue == nil {
+		return FormatResult(e.agentID, api.StatusError, now, now,
+			-1, nil, nil, fmt.Errorf("%s and no schedule queue available", reason), nil)
+	}
+	if err := e.queue.Add(job, runAt, reason); err != nil {
+		return FormatResult(e.agentID, api.StatusError, now, now,
+			-1, nil, nil, fmt.Errorf("failed to defer job: %w", err), nil)
+	}
+
+	return &api.JobResult{
+		AgentID:        e.agentID,
+		Status:         api.StatusDeferred,
+		StartedAt:      now,
+		FinishedAt:     now,
+		DeferredUntil:  &runAt,
+		DeferredReason: reason,
+	}
+}
+
+// requestConsent asks the logged-in user to approve job when policy requires
+// it. It returns the failed result when the job must not run, or nil.
+func (e *Executor) requestConsent(ctx context.Context, enforcer *policy.Enforcer, job *api.Job) *api.JobResult {
+	required, timeout := enforcer.ConsentRequirement(string(job.Type))
+	if !required {
+		return nil
+	}
+
+	// Jobs the policy rejects fail in their handler without prompting
+	if !evaluatePolicy(enforcer, job).Allowed {
+		return nil
+	}
+
+	startedAt := time.Now()
+
+	requestedBy := job.RequestedBy
+	if requestedBy == "" {
+		requestedBy = "hub"
+	}
+
+	// The summary leaves the agent for the tray, so mask the job's secrets
+	req := &consent.Request{
+		JobID:       job.JobID,
+		JobType:     string(job.Type),
+		RequestedBy: requestedBy,
+		Summary:     redact.String(Describe(job)),
+	}
+
+	if e.consent == nil {
+		return FormatResult(e.agentID, api.StatusError, startedAt, time.Now(),
+			-1, nil, nil, fmt.Errorf("consent required but no consent channel available"), nil)
+	}
+
+	answer := e.consent.Ask(ctx, req, timeout)
+
+	e.logger.Audit(job.JobID, string(job.Type), "consent_"+string(answer.Outcome), map[string]interface{}{
+		"requested_by": requestedBy,
+		"summary":      req.Summary,
+		"responder":    answer.Responder,
+		"waited_ms":    time.Since(startedAt).Milliseconds(),
+	})
+	e.recordConsent(job, answer, req.Summary, requestedBy)
+
+	switch answer.Outcome {
+	case consent.OutcomeApproved:
+		return nil
+	case consent.OutcomeDenied:
+		return FormatResult(e.agentID, api.StatusError, startedAt, time.Now(),
+			-1, nil, nil, fmt.Errorf("consent denied by %s", answer.Responder), nil)
+	default:
+		return FormatResult(e.agentID, api.StatusError, startedAt, time.Now(),
+			-1, nil, nil, fmt.Errorf("consent not given within %s", timeout), nil)
+	}
+}
+
+// recordConsent writes the answer to a consent prompt to the signed audit
+// log
+func (e *Executor) recordConsent(job *api.Job, answer consent.Result, summary, requestedBy string) {
+	e.mu.RLock()
+	audit := e.audit
+	e.mu.RUnlock()
+	if audit == nil {
+		return
+	}
+
+	if err := audit.LogConsent(job.JobID, string(answer.Outcome), summary, answer.Responder, requestedBy); err != nil {
+		e.logger.Error("audit", map[string]interface{}{
+			"message": "failed to record consent",
+			"job_id":  job.JobID,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// Queue returns the queue holding deferred jobs
+func (e *Executor) Queue() *ScheduleQueue {
+	return e.queue
+}
+
 // FetchNextJob fetches the next pending job from hub
 func (e *Executor) FetchNextJob(ctx context.Context) (*api.Job, error) {
 	respData, err := e.client.Get(ctx, "/api/v1/agent/jobs/next")
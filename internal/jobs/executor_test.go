@@ -2,6 +2,8 @@ package jobs
 
 import (
 	"context"
+	"encoding/base64"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
@@ -10,64 +12,64 @@ import (
 	"github.com/tshojoshua/jtnt-agent/pkg/api"
 )
 
-// mockClient implements basic transport.Client interface for testing
-type mockClient struct {
-	jobs    []*api.Job
-	results map[string]*api.JobResult
-}
-
-func (m *mockClient) Get(ctx context.Context, path string) ([]byte, error) {
-	return nil, nil
+// newTestEnforcer returns an enforcer for the default policy after edit
+func newTestEnforcer(t *testing.T, edit func(*policy.Policy)) *policy.Enforcer {
+	t.Helper()
+	pol := policy.DefaultPolicy()
+	edit(pol)
+	enforcer, err := policy.NewEnforcer(pol)
+	if err != nil {
+		t.Fatalf("NewEnforcer() error = %v", err)
+	}
+	return enforcer
 }
 
-func (m *mockClient) Post(ctx context.Context, path string, data interface{}) ([]byte, error) {
-	return nil, nil
+// decodeTail returns the text of a base64 output tail
+func decodeTail(t *testing.T, tail string) string {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(tail)
+	if err != nil {
+		t.Fatalf("output tail is not base64: %v", err)
+	}
+	return string(data)
 }
 
-// mockLogger for testing
-type mockLogger struct{}
-
-func (m *mockLogger) Info(event string, fields map[string]interface{})  {}
-func (m *mockLogger) Error(event string, fields map[string]interface{}) {}
-func (m *mockLogger) Debug(event string, fields map[string]interface{}) {}
-
 func TestExecHandler_Execute(t *testing.T) {
-	pol := policy.DefaultPolicy()
-	pol.Capabilities.Exec.Enabled = true
-	pol.Capabilities.Exec.AllowAll = true // Allow all for testing
-	enforcer := policy.NewEnforcer(pol)
-
-	handler := NewExecHandler(enforcer, &mockLogger{})
+	if runtime.GOOS == "windows" {
+		t.Skip("uses Unix binaries")
+	}
+	enforcer := newTestEnforcer(t, func(pol *policy.Policy) {
+		pol.Capabilities.Exec.AllowedBinaries = append(pol.Capabilities.Exec.AllowedBinaries, "echo", "pwd")
+	})
+	handler := NewExecHandler(enforcer, "agent-1")
 
 	tests := []struct {
-		name       string
-		job        *api.Job
-		wantStatus api.JobStatus
+		name   string
+		job    *api.Job
+		output string
 	}{
 		{
 			name: "echo command",
 			job: &api.Job{
-				ID:      "test-1",
-				Type:    api.JobTypeExec,
-				Timeout: 5,
+				JobID: "test-1",
+				Type:  api.JobTypeExec,
 				Payload: map[string]interface{}{
 					"binary": "echo",
 					"args":   []interface{}{"hello", "world"},
 				},
 			},
-			wantStatus: api.JobStatusCompleted,
+			output: "hello world",
 		},
 		{
 			name: "pwd command",
 			job: &api.Job{
-				ID:      "test-2",
-				Type:    api.JobTypeExec,
-				Timeout: 5,
+				JobID: "test-2",
+				Type:  api.JobTypeExec,
 				Payload: map[string]interface{}{
 					"binary": "pwd",
 				},
 			},
-			wantStatus: api.JobStatusCompleted,
+			output: "/",
 		},
 	}
 
@@ -78,31 +80,24 @@ func TestExecHandler_Execute(t *testing.T) {
 
 			result := handler.Execute(ctx, tt.job)
 
-			if result.Status != tt.wantStatus {
-				t.Errorf("Execute() status = %v, want %v", result.Status, tt.wantStatus)
-			}
-
-			if result.Status == api.JobStatusCompleted && result.ExitCode != 0 {
-				t.Errorf("Execute() exitCode = %v, want 0", result.ExitCode)
+			if result.Status != api.StatusSuccess || result.ExitCode != 0 {
+				t.Fatalf("Execute() = %s exit %d: %s", result.Status, result.ExitCode, result.ErrorMessage)
 			}
-
-			if result.Output == "" {
-				t.Errorf("Execute() output is empty")
+			if output := decodeTail(t, result.StdoutTail); !strings.Contains(output, tt.output) {
+				t.Errorf("Execute() output = %q, want %q", output, tt.output)
 			}
-
-			t.Logf("Output: %s", result.Output)
 		})
 	}
 }
 
 func TestExecHandler_PolicyEnforcement(t *testing.T) {
-	pol := policy.DefaultPolicy()
-	pol.Capabilities.Exec.Enabled = true
-	pol.Capabilities.Exec.AllowAll = false
-	pol.Capabilities.Exec.BinaryAllowlist = []string{"/bin/echo"}
-	
-	enforcer := policy.NewEnforcer(pol)
-	handler := NewExecHandler(enforcer, &mockLogger{})
+	if runtime.GOOS == "windows" {
+		t.Skip("uses Unix binaries")
+	}
+	enforcer := newTestEnforcer(t, func(pol *policy.Policy) {
+		pol.Capabilities.Exec.AllowedBinaries = []string{"echo"}
+	})
+	handler := NewExecHandler(enforcer, "agent-1")
 
 	tests := []struct {
 		name       string
@@ -111,86 +106,70 @@ func TestExecHandler_PolicyEnforcement(t *testing.T) {
 	}{
 		{
 			name:       "allowed binary",
-			binary:     "/bin/echo",
-			wantStatus: api.JobStatusCompleted,
+			binary:     "echo",
+			wantStatus: api.StatusSuccess,
 		},
 		{
 			name:       "denied binary",
-			binary:     "/bin/rm",
-			wantStatus: api.JobStatusFailed,
+			binary:     "rm",
+			wantStatus: api.StatusError,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			ctx := context.Background()
 			job := &api.Job{
-				ID:      "test-policy",
-				Type:    api.JobTypeExec,
-				Timeout: 5,
+				JobID: "test-policy",
+				Type:  api.JobTypeExec,
 				Payload: map[string]interface{}{
 					"binary": tt.binary,
 					"args":   []interface{}{"test"},
 				},
 			}
 
-			result := handler.Execute(ctx, job)
+			result := handler.Execute(context.Background(), job)
 
 			if result.Status != tt.wantStatus {
-				t.Errorf("Execute() status = %v, want %v", result.Status, tt.wantStatus)
+				t.Errorf("Execute() status = %v, want %v: %s", result.Status, tt.wantStatus, result.ErrorMessage)
 			}
-
-			if tt.wantStatus == api.JobStatusFailed {
-				if !strings.Contains(result.Error, "policy") {
-					t.Errorf("Expected policy error, got: %s", result.Error)
-				}
+			if tt.wantStatus == api.StatusError && !strings.Contains(result.ErrorMessage, "policy") {
+				t.Errorf("Expected policy error, got: %s", result.ErrorMessage)
 			}
 		})
 	}
 }
 
-func TestResultFormatting(t *testing.T) {
-	result := NewJobResult()
-
-	// Test tail buffer
+func TestTailBuffer_KeepsLastBytes(t *testing.T) {
+	tail := NewTailBuffer(maxTailBytes)
 	for i := 0; i < 2000; i++ {
-		result.AppendOutput("Line %d\n", i)
+		tail.Write([]byte("Line " + strings.Repeat("x", 10) + "\n"))
 	}
+	tail.Write([]byte("Line 1999\n"))
 
-	output := result.Finalize()
-
-	// Output should be truncated
-	if len(output) > maxOutputBytes {
-		t.Errorf("Output exceeds max bytes: %d > %d", len(output), maxOutputBytes)
-	}
-
-	// Should contain truncation notice
-	if !strings.Contains(output, "[truncated]") {
-		t.Errorf("Output should contain truncation notice")
+	output := tail.Bytes()
+	if len(output) > maxTailBytes {
+		t.Errorf("Output exceeds max bytes: %d > %d", len(output), maxTailBytes)
 	}
-
-	// Should contain last lines
-	if !strings.Contains(output, "Line 1999") {
-		t.Errorf("Output should contain last line")
+	if !strings.HasSuffix(string(output), "Line 1999\n") {
+		t.Errorf("Output should end with the last line")
 	}
 }
 
 func TestScriptExecution_Basic(t *testing.T) {
-	pol := policy.DefaultPolicy()
-	pol.Capabilities.Script.Enabled = true
-	pol.Capabilities.Script.AllowAll = true
-	pol.Capabilities.Script.SignatureRequired = false // Disable for basic test
-	
-	enforcer := policy.NewEnforcer(pol)
-	handler := NewScriptHandler(enforcer, &mockLogger{})
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	enforcer := newTestEnforcer(t, func(pol *policy.Policy) {
+		pol.Capabilities.Script.RequireSignature = false // Disable for basic test
+	})
+	handler := NewScriptHandler(enforcer, "agent-1", nil)
 
 	job := &api.Job{
-		ID:      "test-script",
-		Type:    api.JobTypeScript,
-		Timeout: 5,
+		JobID: "test-script",
+		Type:  api.JobTypeScript,
 		Payload: map[string]interface{}{
-			"interpreter": "/bin/bash",
-			"script":      "#!/bin/bash\necho 'Hello from script'\n",
+			"interpreter":    "sh",
+			"script_content": base64.StdEncoding.EncodeToString([]byte("echo 'Hello from script'\n")),
 		},
 	}
 
@@ -199,11 +178,10 @@ func TestScriptExecution_Basic(t *testing.T) {
 
 	result := handler.Execute(ctx, job)
 
-	if result.Status != api.JobStatusCompleted {
-		t.Errorf("Script execution failed: %s", result.Error)
+	if result.Status != api.StatusSuccess {
+		t.Fatalf("Script execution failed: %s", result.ErrorMessage)
 	}
-
-	if !strings.Contains(result.Output, "Hello from script") {
-		t.Errorf("Script output not found, got: %s", result.Output)
+	if output := decodeTail(t, result.StdoutTail); !strings.Contains(output, "Hello from script") {
+		t.Errorf("Script output not found, got: %s", output)
 	}
 }
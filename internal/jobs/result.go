@@ -7,14 +7,19 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/tshojoshua/jtnt-agent/internal/redact"
 	"github.com/tshojoshua/jtnt-agent/pkg/api"
 )
 
 const (
 	maxTailBytes = 10 * 1024 // 10KB
+
+	// redactMargin is output kept before the tail so a secret that starts
+	// before it, such as a private key block, is still recognised whole
+	redactMargin = 4 * 1024
 )
 
-// TailBuffer captures the last N bytes of output
+// TailBuffer captures the last N bytes of output, with secrets masked
 type TailBuffer struct {
 	buf     *bytes.Buffer
 	maxSize int
@@ -35,20 +40,24 @@ func (t *TailBuffer) Write(p []byte) (n int, err error) {
 	// Write to buffer
 	t.buf.Write(p)
 	
-	// Keep only last maxSize bytes
-	if t.buf.Len() > t.maxSize {
+	// Keep only last maxSize bytes and the margin before them
+	if t.buf.Len() > t.maxSize+redactMargin {
 		// Create new buffer with last maxSize bytes
 		data := t.buf.Bytes()
-		offset := len(data) - t.maxSize
+		offset := len(data) - t.maxSize - redactMargin
 		t.buf = bytes.NewBuffer(data[offset:])
 	}
 	
 	return n, nil
 }
 
-// Bytes returns the buffered bytes
+// Bytes returns the last maxSize bytes of output with secrets masked
 func (t *TailBuffer) Bytes() []byte {
-	return t.buf.Bytes()
+	data := redact.Bytes(t.buf.Bytes())
+	if len(data) > t.maxSize {
+		data = data[len(data)-t.maxSize:]
+	}
+	return data
 }
 
 // Base64 returns base64-encoded buffer content
@@ -56,7 +65,7 @@ func (t *TailBuffer) Base64() string {
 	if t.buf.Len() == 0 {
 		return ""
 	}
-	return base64.StdEncoding.EncodeToString(t.buf.Bytes())
+	return base64.StdEncoding.EncodeToString(t.Bytes())
 }
 
 // FormatResult creates a JobResult from execution details
@@ -81,12 +90,62 @@ func FormatResult(agentID string, status api.JobStatus, startedAt, finishedAt ti
 	}
 
 	if err != nil {
-		result.ErrorMessage = err.Error()
+		result.ErrorMessage = redact.String(err.Error())
 	}
 
 	return result
 }
 
+// RedactResult masks secrets in the output tails and messages of result.
+// Results built by FormatResult are already masked; this covers results
+// built directly and results cached by earlier versions.
+func RedactResult(result *api.JobResult) {
+	result.StdoutTail = redactBase64(result.StdoutTail)
+	result.StderrTail = redactBase64(result.StderrTail)
+	result.ErrorMessage = redact.String(result.ErrorMessage)
+	result.DeferredReason = redact.String(result.DeferredReason)
+	result.Data = redactData(result.Data)
+}
+
+// redactData masks secrets in the string values of structured data and the
+// values of fields named like a secret. Data that does not decode is masked
+// as text and returned as a JSON string.
+func redactData(data json.RawMessage) json.RawMessage {
+	if len(data) == 0 {
+		return data
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		masked, _ := json.Marshal(redact.String(string(data)))
+		return masked
+	}
+	value = redact.Fields(map[string]interface{}{"data": value})["data"]
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
+
+// redactBase64 masks secrets in base64-encoded output, leaving anything
+// that does not decode as is
+func redactBase64(tail string) string {
+	if tail == "" {
+		return ""
+	}
+	data, err := base64.StdEncoding.DecodeString(tail)
+	if err != nil {
+		return tail
+	}
+	return base64.StdEncoding.EncodeToString(redact.Bytes(data))
+}
+
 // ParsePayload parses job payload into specific type
 func ParsePayload(payload map[string]interface{}, target interface{}) error {
 	// Convert map to JSON and back to struct
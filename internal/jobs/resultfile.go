@@ -0,0 +1,125 @@
+package jobs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+const (
+	// MaxResultDataSize is the largest result file returned as structured data
+	MaxResultDataSize = 64 * 1024
+
+	// Environment variables set for exec and script jobs
+	EnvResultFile = "JTNT_RESULT_FILE"
+	EnvJobID      = "JTNT_JOB_ID"
+	EnvAgentID    = "JTNT_AGENT_ID"
+)
+
+// resultFile is where a job may write JSON to return as structured data. It
+// lives in a directory of its own that only the job can write to.
+type resultFile struct {
+	dir  string
+	path string
+}
+
+// newResultFile creates the directory for a job's result file; the file
+// itself is left for the job to create
+func newResultFile() (*resultFile, error) {
+	dir, err := os.MkdirTemp("", "jtnt-result-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create result directory: %w", err)
+	}
+	return &resultFile{dir: dir, path: filepath.Join(dir, "result.json")}, nil
+}
+
+// apply tells cmd who it runs for and where to write its result
+func (f *resultFile) apply(cmd *exec.Cmd, jobID, agentID string) {
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env,
+		EnvResultFile+"="+f.path,
+		EnvJobID+"="+jobID,
+		EnvAgentID+"="+agentID,
+	)
+}
+
+// read returns the compacted JSON the job wrote, or nil when it wrote none
+func (f *resultFile) read() (json.RawMessage, error) {
+	// The job controls the directory: only read the regular file it wrote,
+	// never a link to a file of the agent's or a FIFO that blocks the open
+	link, err := os.Lstat(f.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat result file: %w", err)
+	}
+	if !link.Mode().IsRegular() {
+		return nil, fmt.Errorf("result file is not a regular file")
+	}
+	if link.Size() > MaxResultDataSize {
+		return nil, fmt.Errorf("result file is %d bytes, the limit is %d", link.Size(), MaxResultDataSize)
+	}
+
+	file, err := openResultFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open result file: %w", err)
+	}
+	defer file.Close()
+
+	// The job may have swapped the file since the Lstat
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat result file: %w", err)
+	}
+	if !info.Mode().IsRegular() || !os.SameFile(info, link) {
+		return nil, fmt.Errorf("result file was replaced while it was read")
+	}
+
+	// A process left behind by the job may still be writing
+	data, err := io.ReadAll(io.LimitReader(file, MaxResultDataSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read result file: %w", err)
+	}
+	if len(data) > MaxResultDataSize {
+		return nil, fmt.Errorf("result file exceeds %d bytes", MaxResultDataSize)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return nil, fmt.Errorf("result file is not valid JSON: %w", err)
+	}
+	return compact.Bytes(), nil
+}
+
+// remove deletes the result directory
+func (f *resultFile) remove() {
+	os.RemoveAll(f.dir)
+}
+
+// attachData adds the job's structured result to result. An invalid result
+// file is reported in the error message without changing the job's status,
+// which reflects how the process itself ended.
+func (f *resultFile) attachData(result *api.JobResult) {
+	data, err := f.read()
+	if err != nil {
+		msg := "invalid result data: " + err.Error()
+		if result.ErrorMessage != "" {
+			msg = result.ErrorMessage + "; " + msg
+		}
+		result.ErrorMessage = msg
+		return
+	}
+	result.Data = data
+}
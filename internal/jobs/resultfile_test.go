@@ -0,0 +1,98 @@
+package jobs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tshojoshua/jtnt-agent/internal/redact"
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+func TestResultFile_Read(t *testing.T) {
+	f, err := newResultFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.remove()
+
+	if data, err := f.read(); data != nil || err != nil {
+		t.Errorf("read() without a file = %s, %v", data, err)
+	}
+
+	os.WriteFile(f.path, []byte("{\n  \"installed\": [\"nginx\"],\n  \"reboot\": false\n}\n"), 0600)
+	data, err := f.read()
+	if err != nil {
+		t.Fatalf("read() error = %v", err)
+	}
+	if string(data) != `{"installed":["nginx"],"reboot":false}` {
+		t.Errorf("read() = %s", data)
+	}
+
+	for name, content := range map[string]string{
+		"invalid":   "installed nginx",
+		"truncated": `{"installed": [`,
+		"too large": `"` + strings.Repeat("x", MaxResultDataSize) + `"`,
+	} {
+		os.WriteFile(f.path, []byte(content), 0600)
+		if _, err := f.read(); err == nil {
+			t.Errorf("read() accepted a %s result file", name)
+		}
+	}
+}
+
+func TestResultFile_RejectsLinks(t *testing.T) {
+	f, err := newResultFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.remove()
+
+	target := filepath.Join(t.TempDir(), "agent.json")
+	os.WriteFile(target, []byte(`{"agent_token":"tok"}`), 0600)
+	if err := os.Symlink(target, f.path); err != nil {
+		t.Skip("symlinks unavailable:", err)
+	}
+
+	if data, err := f.read(); err == nil {
+		t.Errorf("read() followed a link to %s: %s", target, data)
+	}
+}
+
+func TestResultFile_AttachData(t *testing.T) {
+	f, err := newResultFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.remove()
+
+	os.WriteFile(f.path, []byte("not json"), 0600)
+	result := &api.JobResult{Status: api.StatusSuccess}
+	f.attachData(result)
+	if result.Status != api.StatusSuccess || result.Data != nil ||
+		!strings.Contains(result.ErrorMessage, "invalid result data") {
+		t.Errorf("attachData() = %+v", result)
+	}
+}
+
+func TestRedactResult_Data(t *testing.T) {
+	defer redact.Add("hunter22")()
+
+	result := &api.JobResult{
+		Data: json.RawMessage(`{"db_password":"plain","user":"app","note":"login hunter22","count":12345678901234567890}`),
+	}
+	RedactResult(result)
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(result.Data, &got); err != nil {
+		t.Fatalf("redacted data is not JSON: %s", result.Data)
+	}
+	if got["db_password"] != redact.Mask || got["user"] != "app" || got["note"] != "login "+redact.Mask {
+		t.Errorf("redacted data = %s", result.Data)
+	}
+	if !strings.Contains(string(result.Data), "12345678901234567890") {
+		t.Errorf("redaction changed a number: %s", result.Data)
+	}
+}
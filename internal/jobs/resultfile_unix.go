@@ -0,0 +1,14 @@
+// +build !windows
+
+package jobs
+
+import (
+	"os"
+	"syscall"
+)
+
+// openResultFile opens path for reading without following a symlink or
+// blocking on a FIFO put in its place
+func openResultFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+}
@@ -0,0 +1,36 @@
+// +build !windows
+
+package jobs
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestResultFile_RejectsFIFO(t *testing.T) {
+	f, err := newResultFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.remove()
+
+	// Opening a FIFO without a writer would block the agent forever
+	if err := syscall.Mkfifo(f.path, 0600); err != nil {
+		t.Skip("mkfifo unavailable:", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := f.read()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("read() accepted a FIFO")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read() blocked on a FIFO")
+	}
+}
@@ -0,0 +1,11 @@
+// +build windows
+
+package jobs
+
+import "os"
+
+// openResultFile opens path for reading; a reparse point put in its place
+// is caught by the file comparison in read
+func openResultFile(path string) (*os.File, error) {
+	return os.Open(path)
+}
@@ -0,0 +1,60 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/tshojoshua/jtnt-agent/internal/policy"
+	"github.com/tshojoshua/jtnt-agent/internal/sandbox"
+)
+
+// applySandbox restricts cmd to the policy's file allowlists when the policy
+// asks for it. extraWrite and extraRead list paths the child must be able to
+// write or read even if the policy does not mention them (e.g. the result
+// directory and the temporary script file). A sandboxed child also gets a
+// private TMPDIR; the returned cleanup removes it and is never nil.
+func applySandbox(enforcer *policy.Enforcer, cmd *exec.Cmd, extraWrite []string, extraRead ...string) (sandbox.Status, func(), error) {
+	noop := func() {}
+
+	enabled, required := enforcer.SandboxMode()
+	if !enabled {
+		return sandbox.StatusDisabled, noop, nil
+	}
+
+	// Binary lookup failed; cmd.Run will report it
+	if cmd.Err != nil {
+		return "", noop, nil
+	}
+
+	// /tmp is outside the sandbox, so shells need somewhere else for
+	// here-documents and mktemp
+	tmpDir, err := os.MkdirTemp("", "jtnt-tmp-")
+	if err != nil {
+		return "", noop, fmt.Errorf("failed to create job temp directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(tmpDir) }
+
+	readPaths, writePaths := enforcer.SandboxPaths()
+	spec := &sandbox.Spec{
+		ReadPaths:  append(sandbox.RootDirs(readPaths), extraRead...),
+		WritePaths: append(append(sandbox.RootDirs(writePaths), extraWrite...), tmpDir),
+	}
+
+	if err := sandbox.Wrap(cmd, spec); err != nil {
+		cleanup()
+		if !errors.Is(err, sandbox.ErrUnsupported) {
+			return "", noop, fmt.Errorf("failed to prepare sandbox: %w", err)
+		}
+		if required {
+			return sandbox.StatusUnavailable, noop, fmt.Errorf("%w: %v", policy.ErrSandboxUnavailable, err)
+		}
+		return sandbox.StatusUnavailable, noop, nil
+	}
+
+	// Wrap has filled in cmd.Env
+	cmd.Env = append(cmd.Env, "TMPDIR="+tmpDir)
+
+	return sandbox.StatusEnforced, cleanup, nil
+}
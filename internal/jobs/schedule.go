@@ -0,0 +1,177 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+// ScheduledJob is a job deferred until its maintenance window opens
+type ScheduledJob struct {
+	Job      *api.Job  `json:"job"`
+	RunAt    time.Time `json:"run_at"`
+	Reason   string    `json:"reason"`
+	QueuedAt time.Time `json:"queued_at"`
+
+	// StartedAt is set while the job runs; the entry is removed once its
+	// result is reported
+	StartedAt *time.Time `json:"started_at,omitempty"`
+}
+
+// ScheduleQueue persists deferred jobs on disk so they survive restarts
+type ScheduleQueue struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewScheduleQueue creates a queue stored in dir
+func NewScheduleQueue(dir string) (*ScheduleQueue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create schedule directory: %w", err)
+	}
+
+	return &ScheduleQueue{dir: dir}, nil
+}
+
+// Add queues job to run at runAt, replacing any earlier entry for the job
+func (q *ScheduleQueue) Add(job *api.Job, runAt time.Time, reason string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.write(&ScheduledJob{
+		Job:      job,
+		RunAt:    runAt,
+		Reason:   reason,
+		QueuedAt: time.Now(),
+	})
+}
+
+// MarkRunning records that the queued job was started
+func (q *ScheduleQueue) MarkRunning(jobID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	path, err := q.path(jobID)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read scheduled job: %w", err)
+	}
+
+	var s ScheduledJob
+	if err := json.Unmarshal(data, &s); err != nil || s.Job == nil {
+		return fmt.Errorf("invalid scheduled job %s", jobID)
+	}
+	now := time.Now()
+	s.StartedAt = &now
+	return q.write(&s)
+}
+
+// write stores s atomically; the caller holds q.mu
+func (q *ScheduleQueue) write(s *ScheduledJob) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal scheduled job: %w", err)
+	}
+
+	path, err := q.path(s.Job.JobID)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write scheduled job: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write scheduled job: %w", err)
+	}
+
+	return nil
+}
+
+// Remove drops job from the queue
+func (q *ScheduleQueue) Remove(jobID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	path, err := q.path(jobID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List returns all queued jobs ordered by run time
+func (q *ScheduleQueue) List() ([]*ScheduledJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var scheduled []*ScheduledJob
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(q.dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+
+		var s ScheduledJob
+		if err := json.Unmarshal(data, &s); err != nil || s.Job == nil {
+			continue
+		}
+		scheduled = append(scheduled, &s)
+	}
+
+	sort.Slice(scheduled, func(i, j int) bool {
+		return scheduled[i].RunAt.Before(scheduled[j].RunAt)
+	})
+
+	return scheduled, nil
+}
+
+// Due returns the queued jobs whose run time is at or before now
+func (q *ScheduleQueue) Due(now time.Time) ([]*ScheduledJob, error) {
+	scheduled, err := q.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var due []*ScheduledJob
+	for _, s := range scheduled {
+		if s.RunAt.After(now) {
+			break
+		}
+		due = append(due, s)
+	}
+
+	return due, nil
+}
+
+// path returns the file for jobID, rejecting IDs that would escape the queue
+func (q *ScheduleQueue) path(jobID string) (string, error) {
+	if jobID == "" || strings.ContainsAny(jobID, `/\`) || jobID == "." || jobID == ".." {
+		return "", fmt.Errorf("invalid job id: %q", jobID)
+	}
+	return filepath.Join(q.dir, jobID+".json"), nil
+}
@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+func newTestQueue(t *testing.T, dir string) *ScheduleQueue {
+	t.Helper()
+	q, err := NewScheduleQueue(dir)
+	if err != nil {
+		t.Fatalf("NewScheduleQueue() error = %v", err)
+	}
+	return q
+}
+
+func jobIDs(scheduled []*ScheduledJob) []string {
+	var ids []string
+	for _, s := range scheduled {
+		ids = append(ids, s.Job.JobID)
+	}
+	return ids
+}
+
+func TestScheduleQueue_AddAndDue(t *testing.T) {
+	q := newTestQueue(t, t.TempDir())
+	now := time.Now()
+
+	for id, runAt := range map[string]time.Time{
+		"later":   now.Add(time.Hour),
+		"due":     now.Add(-time.Minute),
+		"overdue": now.Add(-time.Hour),
+	} {
+		if err := q.Add(&api.Job{JobID: id, Type: api.JobTypeExec}, runAt, "outside maintenance window nightly"); err != nil {
+			t.Fatalf("Add(%s) error = %v", id, err)
+		}
+	}
+
+	due, err := q.Due(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := jobIDs(due); len(ids) != 2 || ids[0] != "overdue" || ids[1] != "due" {
+		t.Errorf("Due() = %v, want overdue then due", ids)
+	}
+	if due[0].Reason != "outside maintenance window nightly" || due[0].QueuedAt.IsZero() || due[0].StartedAt != nil {
+		t.Errorf("Due()[0] = %+v", due[0])
+	}
+
+	// A job deferred again replaces its entry
+	if err := q.Add(&api.Job{JobID: "due", Type: api.JobTypeExec}, now.Add(2*time.Hour), "again"); err != nil {
+		t.Fatal(err)
+	}
+	all, err := q.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := jobIDs(all); len(ids) != 3 || ids[2] != "due" {
+		t.Errorf("List() after re-adding = %v, want due last", ids)
+	}
+}
+
+func TestScheduleQueue_Remove(t *testing.T) {
+	q := newTestQueue(t, t.TempDir())
+
+	if err := q.Add(&api.Job{JobID: "job-1"}, time.Now(), "window"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Remove("job-1"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := q.Remove("job-1"); err != nil {
+		t.Errorf("Remove() of a missing job error = %v", err)
+	}
+	if all, _ := q.List(); len(all) != 0 {
+		t.Errorf("List() after Remove() = %v", jobIDs(all))
+	}
+
+	for _, id := range []string{"", ".", "..", "../job", `a\b`} {
+		if err := q.Remove(id); err == nil {
+			t.Errorf("Remove(%q) accepted an invalid job id", id)
+		}
+	}
+}
+
+func TestScheduleQueue_PersistsAcrossReopen(t *testing.T) {
+	dir := t.TempDir()
+	runAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	q := newTestQueue(t, dir)
+	job := &api.Job{JobID: "job-1", Type: api.JobTypeScript, TimeoutSec: 30}
+	if err := q.Add(job, runAt, "window"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.MarkRunning("job-1"); err != nil {
+		t.Fatalf("MarkRunning() error = %v", err)
+	}
+
+	// The agent restarts while the job runs
+	due, err := newTestQueue(t, dir).Due(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 {
+		t.Fatalf("Due() after reopen = %v, want job-1", jobIDs(due))
+	}
+	got := due[0]
+	if got.Job.JobID != "job-1" || got.Job.Type != api.JobTypeScript || got.Job.TimeoutSec != 30 || !got.RunAt.Equal(runAt) {
+		t.Errorf("Due()[0] after reopen = %+v", got)
+	}
+	if got.StartedAt == nil {
+		t.Error("StartedAt was not kept across reopen")
+	}
+
+	if err := q.MarkRunning("missing"); err == nil {
+		t.Error("MarkRunning() of a missing job succeeded")
+	}
+}
@@ -48,13 +48,7 @@ func (h *ScriptHandler) Execute(ctx context.Context, job *api.Job) *api.JobResul
 	}
 
 	// Determine timeout
-	timeoutSec := payload.TimeoutSec
-	if timeoutSec == 0 {
-		timeoutSec = job.TimeoutSec
-	}
-	if timeoutSec == 0 {
-		timeoutSec = h.enforcer.GetMaxScriptTimeout()
-	}
+	timeoutSec := scriptTimeout(h.enforcer, job, &payload)
 
 	// Enforce policy
 	hasSignature := payload.ScriptSignature != ""
@@ -80,7 +74,7 @@ func (h *ScriptHandler) Execute(ctx context.Context, job *api.Job) *api.JobResul
 	defer cleanup()
 
 	// Execute script
-	return h.executeScript(ctx, scriptPath, payload.Interpreter, payload.EnvVars, timeoutSec, startedAt)
+	return h.executeScript(ctx, job.JobID, scriptPath, payload.Interpreter, payload.EnvVars, timeoutSec, startedAt)
 }
 
 func (h *ScriptHandler) verifyScriptSignature(script []byte, signatureB64 string) error {
@@ -137,7 +131,7 @@ func (h *ScriptHandler) createTempScript(content []byte, interpreter string) (st
 	return scriptPath, cleanup, nil
 }
 
-func (h *ScriptHandler) executeScript(ctx context.Context, scriptPath, interpreter string,
+func (h *ScriptHandler) executeScript(ctx context.Context, jobID, scriptPath, interpreter string,
 	envVars map[string]string, timeoutSec int, startedAt time.Time) *api.JobResult {
 
 	// Create context with timeout
@@ -172,8 +166,30 @@ func (h *ScriptHandler) executeScript(ctx context.Context, scriptPath, interpret
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 
+	// Give the script its job identity and a file for structured results
+	resultFile, err := newResultFile()
+	if err != nil {
+		return FormatResult(h.agentID, api.StatusError, startedAt, time.Now(),
+			-1, nil, nil, err, nil)
+	}
+	defer resultFile.remove()
+	resultFile.apply(cmd, jobID, h.agentID)
+
+	// Deliver the job's secrets
+	secretDirs := applySecrets(ctx, cmd)
+
+	// Confine the interpreter to the policy's filesystem view
+	sandboxStatus, cleanupSandbox, err := applySandbox(h.enforcer, cmd, []string{resultFile.dir}, append(secretDirs, scriptPath)...)
+	if err != nil {
+		result := FormatResult(h.agentID, api.StatusError, startedAt, time.Now(),
+			-1, nil, nil, fmt.Errorf("policy violation: %w", err), nil)
+		result.Sandbox = string(sandboxStatus)
+		return result
+	}
+	defer cleanupSandbox()
+
 	// Execute
-	err := cmd.Run()
+	err = cmd.Run()
 	finishedAt := time.Now()
 
 	// Determine status
@@ -194,6 +210,9 @@ func (h *ScriptHandler) executeScript(ctx context.Context, scriptPath, interpret
 		}
 	}
 
-	return FormatResult(h.agentID, status, startedAt, finishedAt,
+	result := FormatResult(h.agentID, status, startedAt, finishedAt,
 		exitCode, stdout, stderr, err, nil)
+	result.Sandbox = string(sandboxStatus)
+	resultFile.attachData(result)
+	return result
 }
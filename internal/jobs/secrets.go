@@ -0,0 +1,100 @@
+package jobs
+
+import (
+	"context"
+	"crypto/ecdh"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/secrets"
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+// secretsKey carries a job's opened secrets from the executor to its handler
+type secretsKey struct{}
+
+// SetSecretKey sets the key job secrets are decrypted with
+func (e *Executor) SetSecretKey(key *ecdh.PrivateKey) {
+	e.mu.Lock()
+	e.secretKey = key
+	e.mu.Unlock()
+}
+
+// openSecrets decrypts the secrets of job and prepares them for its
+// process. It returns the failed result when they cannot be delivered.
+func (e *Executor) openSecrets(job *api.Job) (*secrets.Delivery, *api.JobResult) {
+	now := time.Now()
+	fail := func(err error) (*secrets.Delivery, *api.JobResult) {
+		return nil, FormatResult(e.agentID, api.StatusError, now, time.Now(), -1, nil, nil, err, nil)
+	}
+
+	if job.Type != api.JobTypeExec && job.Type != api.JobTypeScript {
+		return fail(fmt.Errorf("secrets can only be delivered to exec and script jobs"))
+	}
+
+	e.mu.RLock()
+	key := e.secretKey
+	e.mu.RUnlock()
+	if key == nil {
+		return fail(fmt.Errorf("job carries secrets but the agent has no encryption key, re-enroll to issue one"))
+	}
+
+	list, err := secrets.Open(key, job.JobID, job.Secrets)
+	if err != nil {
+		return fail(fmt.Errorf("failed to open job secrets: %w", err))
+	}
+
+	delivery, err := secrets.Prepare(list)
+	if err != nil {
+		return fail(err)
+	}
+
+	names := make([]string, len(list))
+	for i, secret := range list {
+		names[i] = secret.Name
+	}
+	e.logger.Info("job", map[string]interface{}{
+		"message": "delivering job secrets",
+		"job_id":  job.JobID,
+		"names":   names,
+	})
+
+	return delivery, nil
+}
+
+// wipeSecrets removes what delivery left on disk once job has finished
+func (e *Executor) wipeSecrets(job *api.Job, delivery *secrets.Delivery) {
+	if err := delivery.Wipe(); err != nil {
+		e.logger.Error("job", map[string]interface{}{
+			"message": "failed to wipe job secrets",
+			"job_id":  job.JobID,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// withSecrets returns ctx carrying delivery to the job's handler
+func withSecrets(ctx context.Context, delivery *secrets.Delivery) context.Context {
+	return context.WithValue(ctx, secretsKey{}, delivery)
+}
+
+// applySecrets adds the secrets carried by ctx to cmd's environment and
+// returns the directories the sandbox must let it read
+func applySecrets(ctx context.Context, cmd *exec.Cmd) []string {
+	delivery, ok := ctx.Value(secretsKey{}).(*secrets.Delivery)
+	if !ok {
+		return nil
+	}
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, delivery.Env...)
+
+	if delivery.Dir == "" {
+		return nil
+	}
+	return []string{delivery.Dir}
+}
@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/tshojoshua/jtnt-agent/internal/policy"
+	"github.com/tshojoshua/jtnt-agent/internal/secrets"
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+// recordingLogger keeps the messages of Info entries
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) Info(component string, fields map[string]interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if message, ok := fields["message"].(string); ok {
+		l.messages = append(l.messages, message)
+	}
+}
+
+func (l *recordingLogger) Error(component string, fields map[string]interface{}) {}
+
+func (l *recordingLogger) Audit(jobID string, jobType string, status string, fields map[string]interface{}) {}
+
+func (l *recordingLogger) logged(message string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, m := range l.messages {
+		if m == message {
+			return true
+		}
+	}
+	return false
+}
+
+func TestExecutor_OpensSecretsOnlyForAllowedJobs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses Unix binaries")
+	}
+
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enforcer := newTestEnforcer(t, func(pol *policy.Policy) {
+		pol.Capabilities.Exec.AllowedBinaries = []string{"echo"}
+	})
+
+	run := func(jobID, binary string) *recordingLogger {
+		t.Helper()
+		envelope, err := secrets.Seal(key.PublicKey(), jobID, []api.JobSecret{{Name: "DB_PASSWORD", Value: "hunter22"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		logger := &recordingLogger{}
+		executor := NewExecutor("agent-1", enforcer, nil, nil, nil, nil, logger)
+		executor.SetSecretKey(key)
+		executor.Execute(context.Background(), &api.Job{
+			JobID:   jobID,
+			Type:    api.JobTypeExec,
+			Payload: map[string]interface{}{"binary": binary},
+			Secrets: envelope,
+		})
+		return logger
+	}
+
+	if !run("job-allowed", "echo").logged("delivering job secrets") {
+		t.Error("secrets of an allowed job were not delivered")
+	}
+	if run("job-denied", "rm").logged("delivering job secrets") {
+		t.Error("secrets of a job denied by policy were opened")
+	}
+}
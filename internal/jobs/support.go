@@ -0,0 +1,92 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/policy"
+	"github.com/tshojoshua/jtnt-agent/internal/support"
+	"github.com/tshojoshua/jtnt-agent/internal/transport"
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+// SupportBundleHandler collects a support bundle and uploads it
+type SupportBundleHandler struct {
+	enforcer *policy.Enforcer
+	agentID  string
+	client   *transport.Client
+	options  support.Options
+}
+
+// NewSupportBundleHandler creates a new support bundle handler
+func NewSupportBundleHandler(enforcer *policy.Enforcer, agentID string, client *transport.Client, options support.Options) *SupportBundleHandler {
+	return &SupportBundleHandler{
+		enforcer: enforcer,
+		agentID:  agentID,
+		client:   client,
+		options:  options,
+	}
+}
+
+// Execute builds the bundle in a temporary file and uploads it as the job's
+// artifact
+func (h *SupportBundleHandler) Execute(ctx context.Context, job *api.Job) *api.JobResult {
+	startedAt := time.Now()
+
+	// Parse payload
+	var payload api.SupportBundlePayload
+	if err := ParsePayload(job.Payload, &payload); err != nil {
+		return FormatResult(h.agentID, api.StatusError, startedAt, time.Now(),
+			-1, nil, nil, fmt.Errorf("invalid payload: %w", err), nil)
+	}
+
+	// Enforce policy
+	if err := h.enforcer.CanCollectSupportBundle(); err != nil {
+		return FormatResult(h.agentID, api.StatusError, startedAt, time.Now(),
+			-1, nil, nil, fmt.Errorf("policy violation: %w", err), nil)
+	}
+
+	options := h.options
+	if payload.MaxLogBytes > 0 {
+		options.MaxLogBytes = payload.MaxLogBytes
+	}
+	if payload.AuditEntries > 0 {
+		options.AuditEntries = payload.AuditEntries
+	}
+
+	file, err := os.CreateTemp("", "jtnt-support-*.zip")
+	if err != nil {
+		return FormatResult(h.agentID, api.StatusError, startedAt, time.Now(),
+			-1, nil, nil, fmt.Errorf("failed to create bundle: %w", err), nil)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	manifest, err := support.Write(ctx, file, options)
+	if err != nil {
+		return FormatResult(h.agentID, api.StatusError, startedAt, time.Now(),
+			-1, nil, nil, err, nil)
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return FormatResult(h.agentID, api.StatusError, startedAt, time.Now(),
+			-1, nil, nil, fmt.Errorf("failed to read bundle: %w", err), nil)
+	}
+
+	artifact, err := UploadArtifact(ctx, h.client, job.JobID, support.FileName(h.agentID, startedAt), file)
+	if err != nil {
+		return FormatResult(h.agentID, api.StatusError, startedAt, time.Now(),
+			-1, nil, nil, err, nil)
+	}
+
+	// Report sections that could not be collected
+	stdout := NewTailBuffer(maxTailBytes)
+	fmt.Fprintf(stdout, "collected %d files\n", len(manifest.Files))
+	for _, missing := range manifest.Errors {
+		fmt.Fprintf(stdout, "skipped %s\n", missing)
+	}
+
+	return FormatResult(h.agentID, api.StatusSuccess, startedAt, time.Now(),
+		0, stdout, nil, nil, []api.ArtifactInfo{*artifact})
+}
@@ -54,8 +54,15 @@ func (h *UploadHandler) Execute(ctx context.Context, job *api.Job) *api.JobResul
 			-1, nil, nil, fmt.Errorf("policy violation: %w", err), nil)
 	}
 
+	// Work on the symlink-free path that was checked
+	sourcePath, err := policy.CanonicalPath(payload.SourcePath)
+	if err != nil {
+		return FormatResult(h.agentID, api.StatusError, startedAt, time.Now(),
+			-1, nil, nil, fmt.Errorf("policy violation: %w", err), nil)
+	}
+
 	// Get file info
-	fileInfo, err := os.Stat(payload.SourcePath)
+	fileInfo, err := os.Stat(sourcePath)
 	if err != nil {
 		return FormatResult(h.agentID, api.StatusError, startedAt, time.Now(),
 			-1, nil, nil, fmt.Errorf("failed to stat file: %w", err), nil)
@@ -72,7 +79,7 @@ func (h *UploadHandler) Execute(ctx context.Context, job *api.Job) *api.JobResul
 	}
 
 	// Upload file(s)
-	artifacts, err := h.uploadPath(ctx, job.JobID, payload.SourcePath)
+	artifacts, err := h.uploadPath(ctx, job.JobID, sourcePath)
 	if err != nil {
 		return FormatResult(h.agentID, api.StatusError, startedAt, time.Now(),
 			-1, nil, nil, err, nil)
@@ -122,13 +129,21 @@ func (h *UploadHandler) uploadPath(ctx context.Context, jobID, path string) ([]a
 }
 
 func (h *UploadHandler) uploadFile(ctx context.Context, jobID, filePath string) (*api.ArtifactInfo, error) {
-	// Open file
-	file, err := os.Open(filePath)
+	// Open file; the read allowlist is re-checked for every file, including
+	// symlinks found while walking a directory
+	file, err := h.enforcer.OpenForRead(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
+	return UploadArtifact(ctx, h.client, jobID, filepath.Base(filePath), file)
+}
+
+// UploadArtifact uploads file as name through the hub's artifact pipeline
+// and returns its metadata. The caller is responsible for checking that the
+// file may be read.
+func UploadArtifact(ctx context.Context, client *transport.Client, jobID, name string, file *os.File) (*api.ArtifactInfo, error) {
 	// Get file info
 	fileInfo, err := file.Stat()
 	if err != nil {
@@ -149,13 +164,13 @@ func (h *UploadHandler) uploadFile(ctx context.Context, jobID, filePath string)
 
 	// Create artifact info
 	artifact := api.ArtifactInfo{
-		Name:   filepath.Base(filePath),
+		Name:   name,
 		Size:   fileInfo.Size(),
 		SHA256: sha256Hash,
 	}
 
 	// Initialize upload
-	uploadURL, err := h.initializeUpload(ctx, jobID, []api.ArtifactInfo{artifact})
+	uploadURL, err := initializeUpload(ctx, client, jobID, []api.ArtifactInfo{artifact})
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize upload: %w", err)
 	}
@@ -165,20 +180,20 @@ func (h *UploadHandler) uploadFile(ctx context.Context, jobID, filePath string)
 	}
 
 	// Upload file to presigned URL
-	if err := h.uploadToURL(ctx, uploadURL[0], file, fileInfo.Size()); err != nil {
+	if err := uploadToURL(ctx, uploadURL[0], file, fileInfo.Size()); err != nil {
 		return nil, fmt.Errorf("failed to upload: %w", err)
 	}
 
 	return &artifact, nil
 }
 
-func (h *UploadHandler) initializeUpload(ctx context.Context, jobID string, artifacts []api.ArtifactInfo) ([]api.UploadURL, error) {
+func initializeUpload(ctx context.Context, client *transport.Client, jobID string, artifacts []api.ArtifactInfo) ([]api.UploadURL, error) {
 	req := api.ArtifactInitRequest{
 		JobID: jobID,
 		Files: artifacts,
 	}
 
-	respData, err := h.client.Post(ctx, "/api/v1/agent/artifacts/init", req)
+	respData, err := client.Post(ctx, "/api/v1/agent/artifacts/init", req)
 	if err != nil {
 		return nil, err
 	}
@@ -191,7 +206,7 @@ func (h *UploadHandler) initializeUpload(ctx context.Context, jobID string, arti
 	return resp.UploadURLs, nil
 }
 
-func (h *UploadHandler) uploadToURL(ctx context.Context, uploadURL api.UploadURL, reader io.Reader, size int64) error {
+func uploadToURL(ctx context.Context, uploadURL api.UploadURL, reader io.Reader, size int64) error {
 	// Create request
 	req, err := http.NewRequestWithContext(ctx, uploadURL.Method, uploadURL.URL, reader)
 	if err != nil {
@@ -0,0 +1,284 @@
+// Package logfile writes a log file that rotates itself by size and day.
+// Rotated segments are renamed with their rotation time, compressed with
+// gzip in the background, and removed once they are too old or too many.
+package logfile
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxSize  = 10 << 20
+	defaultMaxAge   = 14 * 24 * time.Hour
+	defaultMaxFiles = 10
+
+	// segmentTime is the rotation time in segment names; it sorts
+	// chronologically and is valid on every platform
+	segmentTime = "2006-01-02T15-04-05.000"
+)
+
+// Options configures rotation
+type Options struct {
+	// MaxSize is the size in bytes at which the file is rotated; default
+	// 10 MiB
+	MaxSize int64
+
+	// MaxAge is how long rotated segments are kept; default 14 days
+	MaxAge time.Duration
+
+	// MaxFiles is how many rotated segments are kept; default 10
+	MaxFiles int
+}
+
+// File is an io.Writer that appends to a log file and rotates it when it
+// would exceed MaxSize or on the first write of a new local day. Each Write
+// goes to exactly one segment, so concurrent writers never interleave within
+// an entry.
+type File struct {
+	path string
+	opts Options
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	day  string
+
+	// Compression of rotated segments in progress
+	compressing sync.WaitGroup
+}
+
+// Open opens path for appending, creating it and its directory if needed
+func Open(path string, opts Options) (*File, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = defaultMaxSize
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = defaultMaxAge
+	}
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = defaultMaxFiles
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	f := &File{path: path, opts: opts}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	// Finish the work of a run that stopped mid-rotation
+	f.compressing.Add(1)
+	go f.cleanup()
+
+	return f, nil
+}
+
+// open opens the current file; the caller holds f.mu or has not shared f
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.day = info.ModTime().Format("2006-01-02")
+	if f.size == 0 {
+		f.day = time.Now().Format("2006-01-02")
+	}
+	return nil
+}
+
+// Write appends p, rotating first if p would not fit or the day changed
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	today := time.Now().Format("2006-01-02")
+	if f.size > 0 && (f.size+int64(len(p)) > f.opts.MaxSize || f.day != today) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	f.day = today
+	return n, err
+}
+
+// rotate renames the current file to a segment and opens a new one; the
+// caller holds f.mu
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	segment := f.segmentName(time.Now())
+	if err := os.Rename(f.path, segment); err != nil {
+		// Keep writing to the current file rather than losing entries
+		if openErr := f.open(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.compressing.Add(1)
+	go f.cleanup()
+	return nil
+}
+
+// segmentName returns an unused segment name for a rotation at t, moving
+// past segments rotated within the same millisecond
+func (f *File) segmentName(t time.Time) string {
+	ext := filepath.Ext(f.path)
+	for {
+		segment := strings.TrimSuffix(f.path, ext) + "-" + t.Format(segmentTime) + ext
+		_, err := os.Stat(segment)
+		_, gzErr := os.Stat(segment + ".gz")
+		if os.IsNotExist(err) && os.IsNotExist(gzErr) {
+			return segment
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// Close waits for compression to finish and closes the file
+func (f *File) Close() error {
+	f.mu.Lock()
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+
+	f.compressing.Wait()
+	return err
+}
+
+// cleanupMu runs one cleanup at a time across all files
+var cleanupMu sync.Mutex
+
+// cleanup compresses uncompressed segments and removes the ones past
+// MaxAge or MaxFiles
+func (f *File) cleanup() {
+	defer f.compressing.Done()
+
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+
+	segments, err := f.segments()
+	if err != nil {
+		return
+	}
+
+	cutoff := time.Now().Add(-f.opts.MaxAge)
+	keep := 0
+	for i := len(segments) - 1; i >= 0; i-- {
+		segment := segments[i]
+		info, err := os.Stat(segment)
+		if err != nil {
+			continue
+		}
+
+		if keep >= f.opts.MaxFiles || info.ModTime().Before(cutoff) {
+			os.Remove(segment)
+			continue
+		}
+		keep++
+
+		if !strings.HasSuffix(segment, ".gz") {
+			compress(segment)
+		}
+	}
+}
+
+// segments returns the rotated segments of the file, oldest first
+func (f *File) segments() ([]string, error) {
+	ext := filepath.Ext(f.path)
+	prefix := strings.TrimSuffix(filepath.Base(f.path), ext) + "-"
+
+	entries, err := os.ReadDir(filepath.Dir(f.path))
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []string
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".gz")
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		if _, err := time.Parse(segmentTime, stamp); err != nil {
+			continue
+		}
+		segments = append(segments, filepath.Join(filepath.Dir(f.path), entry.Name()))
+	}
+	sort.Strings(segments)
+	return segments, nil
+}
+
+// compress replaces path with path.gz, keeping its modification time
+func compress(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".gz.tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	os.Chtimes(path+".gz", info.ModTime(), info.ModTime())
+	in.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,144 @@
+package logfile
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFile_RotatesBySizeAndCompresses(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.log")
+
+	f, err := Open(path, Options{MaxSize: 100})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	line := strings.Repeat("x", 59) + "\n"
+	for i := 0; i < 3; i++ {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	current, _ := os.ReadFile(path)
+	if string(current) != line {
+		t.Errorf("current file = %q, want one line", current)
+	}
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "agent-*.log.gz"))
+	if len(segments) != 2 {
+		t.Fatalf("segments = %v, want 2 compressed", segments)
+	}
+	zr, err := openGzip(segments[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(zr) != line {
+		t.Errorf("segment holds %q", zr)
+	}
+}
+
+func TestFile_PrunesByCountAndAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.log")
+
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	for i := 0; i < 5; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("agent-2025-12-1%dT10-30-00.000.log", i))
+		os.WriteFile(name, []byte("entry\n"), 0640)
+		if i == 0 {
+			os.Chtimes(name, old, old)
+		}
+	}
+	os.WriteFile(filepath.Join(dir, "other.log"), nil, 0640)
+
+	f, err := Open(path, Options{MaxFiles: 3, MaxAge: 7 * 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "agent-*"))
+	want := []string{"agent-2025-12-12T10-30-00.000.log.gz", "agent-2025-12-13T10-30-00.000.log.gz", "agent-2025-12-14T10-30-00.000.log.gz"}
+	if len(segments) != len(want) {
+		t.Fatalf("segments = %v, want %v", segments, want)
+	}
+	for i, segment := range segments {
+		if filepath.Base(segment) != want[i] {
+			t.Errorf("segment %d = %s, want %s", i, filepath.Base(segment), want[i])
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "other.log")); err != nil {
+		t.Error("unrelated file removed")
+	}
+}
+
+func TestFile_ConcurrentWritesKeepEntriesWhole(t *testing.T) {
+	dir := t.TempDir()
+	f, err := Open(filepath.Join(dir, "agent.log"), Options{MaxSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				fmt.Fprintf(f, "writer %d entry %03d %s\n", w, i, strings.Repeat("y", 40))
+			}
+		}(w)
+	}
+	wg.Wait()
+	f.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "agent*"))
+	lines := 0
+	for _, file := range files {
+		var data []byte
+		if strings.HasSuffix(file, ".gz") {
+			data, err = openGzip(file)
+		} else {
+			data, err = os.ReadFile(file)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			if !strings.HasPrefix(line, "writer ") || !strings.HasSuffix(line, "y") {
+				t.Fatalf("torn entry %q in %s", line, file)
+			}
+			lines++
+		}
+	}
+	// Rotation keeps the 10 newest segments; each holds several entries
+	if lines == 0 {
+		t.Error("no entries written")
+	}
+}
+
+func openGzip(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(zr)
+}
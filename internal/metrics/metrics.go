@@ -33,6 +33,8 @@ type Metrics struct {
 	SystemCPUUsagePercent        prometheus.Gauge
 	SystemMemoryUsedBytes        prometheus.Gauge
 	SystemDiskUsedBytes          prometheus.Gauge
+	AuditForwardLagEntries       prometheus.Gauge
+	AuditForwardLagSeconds       prometheus.Gauge
 
 	// Histogram metrics
 	HeartbeatDuration        prometheus.Histogram
@@ -163,6 +165,20 @@ func NewMetrics(version string) *Metrics {
 			},
 		),
 
+		AuditForwardLagEntries: promauto.With(reg).NewGauge(
+			prometheus.GaugeOpts{
+				Name: "jtnt_agent_audit_forward_lag_entries",
+				Help: "Audit entries not yet acknowledged by the hub",
+			},
+		),
+
+		AuditForwardLagSeconds: promauto.With(reg).NewGauge(
+			prometheus.GaugeOpts{
+				Name: "jtnt_agent_audit_forward_lag_seconds",
+				Help: "Age of the oldest audit entry not yet acknowledged by the hub",
+			},
+		),
+
 		// Histograms
 		HeartbeatDuration: promauto.With(reg).NewHistogram(
 			prometheus.HistogramOpts{
@@ -292,3 +308,9 @@ func (m *Metrics) SetPolicyExpiration(expiresAt time.Time) {
 func (m *Metrics) SetCertExpiration(expiresAt time.Time) {
 	m.CertExpirationTimestamp.Set(float64(expiresAt.Unix()))
 }
+
+// SetAuditForwardLag sets the audit forwarding lag
+func (m *Metrics) SetAuditForwardLag(entries uint64, age time.Duration) {
+	m.AuditForwardLagEntries.Set(float64(entries))
+	m.AuditForwardLagSeconds.Set(age.Seconds())
+}
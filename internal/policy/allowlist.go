@@ -1,10 +1,17 @@
 package policy
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 )
 
+const (
+	// maxSymlinkDepth bounds dangling-symlink resolution
+	maxSymlinkDepth = 40
+)
+
 // Allowlist provides path and command matching
 type Allowlist struct {
 	patterns []string
@@ -15,25 +22,42 @@ func NewAllowlist(patterns []string) *Allowlist {
 	return &Allowlist{patterns: patterns}
 }
 
-// Allows checks if a path/command is allowed by any pattern
+// Allows checks if a path/command is allowed by any pattern. Absolute paths
+// are resolved through symlinks before matching, so a link inside an allowed
+// directory cannot point the check somewhere else.
 func (a *Allowlist) Allows(path string) bool {
+	_, ok := a.Match(path)
+	return ok
+}
+
+// Match returns the first pattern that allows path
+func (a *Allowlist) Match(path string) (string, bool) {
 	if len(a.patterns) == 0 {
-		return false
+		return "", false
 	}
 
 	// Normalize path separators
 	path = filepath.Clean(path)
 
+	if filepath.IsAbs(path) {
+		resolved, err := CanonicalPath(path)
+		if err != nil {
+			return "", false
+		}
+		path = resolved
+	}
+
 	for _, pattern := range a.patterns {
-		if a.matchPattern(pattern, path) {
-			return true
+		if a.matchPattern(canonicalPattern(pattern), path) {
+			return pattern, true
 		}
 	}
 
-	return false
+	return "", false
 }
 
-// matchPattern checks if path matches glob pattern
+// matchPattern checks if path matches glob pattern. "*" matches within a
+// single path component and "**" matches any number of components.
 func (a *Allowlist) matchPattern(pattern, path string) bool {
 	// Normalize pattern
 	pattern = filepath.Clean(pattern)
@@ -43,28 +67,135 @@ func (a *Allowlist) matchPattern(pattern, path string) bool {
 		return true
 	}
 
-	// Glob match
-	matched, err := filepath.Match(pattern, path)
-	if err == nil && matched {
-		return true
-	}
+	sep := string(filepath.Separator)
+	return matchSegments(strings.Split(pattern, sep), strings.Split(path, sep))
+}
+
+// matchSegments matches path components against pattern components
+func matchSegments(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			for i := 0; i <= len(path); i++ {
+				if matchSegments(rest, path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
 
-	// Directory prefix match for patterns ending with /*
-	if strings.HasSuffix(pattern, string(filepath.Separator)+"*") {
-		dir := strings.TrimSuffix(pattern, string(filepath.Separator)+"*")
-		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
-			return true
+		if len(path) == 0 {
+			return false
 		}
-		if path == dir {
-			return true
+
+		matched, err := filepath.Match(pattern[0], path[0])
+		if err != nil || !matched {
+			return false
 		}
+
+		pattern, path = pattern[1:], path[1:]
+	}
+
+	return len(path) == 0
+}
+
+// canonicalPattern resolves symlinks in the static prefix of an absolute
+// pattern so it is compared against canonical paths consistently
+// (e.g. "/tmp/*" on macOS becomes "/private/tmp/*")
+func canonicalPattern(pattern string) string {
+	if !filepath.IsAbs(pattern) {
+		return pattern
 	}
 
-	return false
+	prefix, rest := splitGlob(filepath.Clean(pattern))
+	resolved, err := CanonicalPath(prefix)
+	if err != nil {
+		return pattern
+	}
+
+	if rest == "" {
+		return resolved
+	}
+	return filepath.Join(resolved, rest)
+}
+
+// splitGlob splits pattern into the leading components without glob
+// metacharacters and the remainder
+func splitGlob(pattern string) (prefix, rest string) {
+	sep := string(filepath.Separator)
+	parts := strings.Split(pattern, sep)
+
+	for i, part := range parts {
+		if strings.ContainsAny(part, "*?[") {
+			prefix = strings.Join(parts[:i], sep)
+			if prefix == "" {
+				prefix = sep
+			}
+			return prefix, strings.Join(parts[i:], sep)
+		}
+	}
+
+	return pattern, ""
+}
+
+// CanonicalPath returns the absolute, symlink-free form of path. Components
+// that do not exist yet are appended to the resolved form of the nearest
+// existing parent, so paths of files about to be created can be checked too.
+func CanonicalPath(path string) (string, error) {
+	return canonicalPath(path, 0)
+}
+
+func canonicalPath(path string, depth int) (string, error) {
+	if depth > maxSymlinkDepth {
+		return "", fmt.Errorf("%w: too many levels of symbolic links: %s", ErrPathNotAllowed, path)
+	}
+
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("%w: path must be absolute: %s", ErrPathNotAllowed, path)
+	}
+
+	existing := filepath.Clean(path)
+	var missing []string
+
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to resolve %s: %w", existing, err)
+		}
+
+		// A dangling symlink would be followed on create; resolve its target
+		if info, lerr := os.Lstat(existing); lerr == nil && info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(existing)
+			if err != nil {
+				return "", fmt.Errorf("failed to read link %s: %w", existing, err)
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(existing), target)
+			}
+			return canonicalPath(filepath.Join(append([]string{target}, missing...)...), depth+1)
+		}
+
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return filepath.Join(append([]string{existing}, missing...)...), nil
+		}
+
+		missing = append([]string{filepath.Base(existing)}, missing...)
+		existing = parent
+	}
 }
 
 // AllowsBinary checks if a binary name is allowed
 func AllowsBinary(allowedBinaries []string, binary string) bool {
+	_, ok := MatchBinary(allowedBinaries, binary)
+	return ok
+}
+
+// MatchBinary returns the first allowed entry whose name matches binary
+func MatchBinary(allowedBinaries []string, binary string) (string, bool) {
 	// Extract binary name without path
 	binaryName := filepath.Base(binary)
 
@@ -80,15 +211,20 @@ func AllowsBinary(allowedBinaries []string, binary string) bool {
 		}
 
 		if strings.EqualFold(binaryName, allowedName) {
-			return true
+			return allowed, true
 		}
 	}
 
-	return false
+	return "", false
 }
 
-// ValidatePath checks if path is safe (no traversal attacks)
+// ValidatePath checks if path is safe (absolute, no traversal attacks)
 func ValidatePath(path string) error {
+	// Relative paths would resolve against the agent's working directory
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("%w: path must be absolute: %s", ErrPathNotAllowed, path)
+	}
+
 	// Clean the path
 	cleaned := filepath.Clean(path)
 
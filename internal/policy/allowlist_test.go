@@ -0,0 +1,238 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestAllowlist_GlobSemantics(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix path patterns")
+	}
+
+	allowlist := NewAllowlist([]string{"/opt/jtnt-test/logs/*", "/opt/jtnt-test/data/**", "/opt/jtnt-test/**/*.conf"})
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/opt/jtnt-test/logs/app.log", true},
+		{"/opt/jtnt-test/logs/nested/app.log", false},
+		{"/opt/jtnt-test/data", true},
+		{"/opt/jtnt-test/data/a/b/c.bin", true},
+		{"/opt/jtnt-test/x/y/z.conf", true},
+		{"/opt/jtnt-test/x/y/z.txt", false},
+		{"/opt/other/logs/app.log", false},
+	}
+
+	for _, tt := range tests {
+		if got := allowlist.Allows(tt.path); got != tt.want {
+			t.Errorf("Allows(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAllowlist_SymlinkEscape(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on windows")
+	}
+
+	root := t.TempDir()
+	allowed := filepath.Join(root, "allowed")
+	outside := filepath.Join(root, "outside")
+	for _, dir := range []string{allowed, outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// allowed/evil -> outside, allowed/dangling -> outside/new
+	if err := os.Symlink(outside, filepath.Join(allowed, "evil")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "new"), filepath.Join(allowed, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+
+	allowlist := NewAllowlist([]string{filepath.Join(allowed, "**")})
+
+	if !allowlist.Allows(filepath.Join(allowed, "file.txt")) {
+		t.Error("regular path inside allowed dir should be allowed")
+	}
+	if allowlist.Allows(filepath.Join(allowed, "evil", "passwd")) {
+		t.Error("path through symlink to outside dir should be rejected")
+	}
+	if allowlist.Allows(filepath.Join(allowed, "evil", "not-yet-created")) {
+		t.Error("not-yet-created path under escaping symlink should be rejected")
+	}
+	if allowlist.Allows(filepath.Join(allowed, "dangling")) {
+		t.Error("dangling symlink pointing outside should be rejected")
+	}
+}
+
+func TestCanonicalPath_MissingComponents(t *testing.T) {
+	root := t.TempDir()
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := CanonicalPath(filepath.Join(root, "a", "b", "c.txt"))
+	if err != nil {
+		t.Fatalf("CanonicalPath() error = %v", err)
+	}
+	if want := filepath.Join(resolvedRoot, "a", "b", "c.txt"); got != want {
+		t.Errorf("CanonicalPath() = %s, want %s", got, want)
+	}
+
+	if _, err := CanonicalPath("relative/path"); !errors.Is(err, ErrPathNotAllowed) {
+		t.Errorf("CanonicalPath(relative) error = %v, want ErrPathNotAllowed", err)
+	}
+}
+
+func TestOpenForRead_RejectsSymlinkEscape(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on windows")
+	}
+
+	root := t.TempDir()
+	allowed := filepath.Join(root, "allowed")
+	if err := os.MkdirAll(allowed, 0755); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(root, "secret")
+	if err := os.WriteFile(secret, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(allowed, "ok.txt"), []byte("ok"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(allowed, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	pol := DefaultPolicy()
+	pol.Capabilities.File.ReadPaths = []string{filepath.Join(allowed, "**")}
+	enforcer, err := NewEnforcer(pol)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := enforcer.OpenForRead(filepath.Join(allowed, "ok.txt"))
+	if err != nil {
+		t.Fatalf("OpenForRead(ok.txt) error = %v", err)
+	}
+	f.Close()
+
+	if _, err := enforcer.OpenForRead(filepath.Join(allowed, "link")); !errors.Is(err, ErrPathNotAllowed) {
+		t.Errorf("OpenForRead(link) error = %v, want ErrPathNotAllowed", err)
+	}
+}
+
+func TestCreateAtomic_DirectorySwappedBeforeCommit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on windows")
+	}
+
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed := filepath.Join(root, "allowed")
+	outside := filepath.Join(root, "outside")
+	for _, dir := range []string{allowed, outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pol := DefaultPolicy()
+	pol.Capabilities.File.WritePaths = []string{filepath.Join(allowed, "**")}
+	enforcer, err := NewEnforcer(pol)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An aborted file leaves nothing behind
+	f, err := enforcer.CreateAtomic(filepath.Join(allowed, "aborted.txt"), 0600)
+	if err != nil {
+		t.Fatalf("CreateAtomic() error = %v", err)
+	}
+	f.Abort()
+	if entries, _ := os.ReadDir(allowed); len(entries) != 0 {
+		t.Errorf("Abort() left %v", entries)
+	}
+
+	f, err = enforcer.CreateAtomic(filepath.Join(allowed, "out.txt"), 0600)
+	if err != nil {
+		t.Fatalf("CreateAtomic() error = %v", err)
+	}
+	defer f.Abort()
+	f.WriteString("data")
+
+	// The directory is replaced by a link out of the allowlist mid-write
+	moved := filepath.Join(root, "moved")
+	if err := os.Rename(allowed, moved); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, allowed); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "out.txt")); !os.IsNotExist(err) {
+		t.Errorf("Commit() followed the swapped directory: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(moved, "out.txt")); err != nil || string(data) != "data" {
+		t.Errorf("Commit() did not write the opened directory: %q, %v", data, err)
+	}
+}
+
+func TestCreateAtomic_ConcurrentWritesToOneTarget(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pol := DefaultPolicy()
+	pol.Capabilities.File.WritePaths = []string{filepath.Join(dir, "**")}
+	enforcer, err := NewEnforcer(pol)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(dir, "out.txt")
+	first, err := enforcer.CreateAtomic(target, 0600)
+	if err != nil {
+		t.Fatalf("CreateAtomic() error = %v", err)
+	}
+	defer first.Abort()
+	second, err := enforcer.CreateAtomic(target, 0600)
+	if err != nil {
+		t.Fatalf("second CreateAtomic() error = %v", err)
+	}
+	defer second.Abort()
+
+	// Each write has its own temporary file, so neither truncates the other
+	first.WriteString("first")
+	second.WriteString("second")
+	if err := first.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "first" {
+		t.Errorf("target after first commit = %q, %v", data, err)
+	}
+	if err := second.Commit(); err != nil {
+		t.Fatalf("second Commit() error = %v", err)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "second" {
+		t.Errorf("target after second commit = %q, %v", data, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
@@ -0,0 +1,158 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// checkArgRules applies every rule that targets one of binaries (the
+// requested binary and its canonical path) to args and returns the names of
+// the rules that were applied. compiled holds the rules' arg_patterns
+// compiled by NewEnforcer.
+func checkArgRules(rules []ArgRule, compiled map[string]*regexp.Regexp, binaries []string, args []string) ([]string, error) {
+	var applied []string
+
+	for i, rule := range rules {
+		if !matchesAnyBinary(rule.Binary, binaries) {
+			continue
+		}
+
+		ruleName := fmt.Sprintf("exec.arg_rules[%d]", i)
+		applied = append(applied, ruleName)
+
+		if rule.MaxArgs > 0 && len(args) > rule.MaxArgs {
+			return nil, &Violation{
+				Err:    ErrArgumentsNotAllowed,
+				Rule:   ruleName + ".max_args",
+				Detail: fmt.Sprintf("%d arguments > %d", len(args), rule.MaxArgs),
+			}
+		}
+
+		for _, arg := range args {
+			if flag, ok := matchForbiddenFlag(rule.ForbiddenFlags, arg); ok {
+				return nil, &Violation{
+					Err:    ErrArgumentsNotAllowed,
+					Rule:   ruleName + ".forbidden_flags",
+					Detail: fmt.Sprintf("flag %s is forbidden for %s", flag, rule.Binary),
+				}
+			}
+		}
+
+		if len(rule.AllowedArgs) == 0 && len(rule.ArgPatterns) == 0 {
+			continue
+		}
+
+		if matchesAllowedArgs(rule.AllowedArgs, args) {
+			continue
+		}
+
+		matched, err := matchesArgPatterns(compiled, rule.ArgPatterns, args)
+		if err != nil {
+			return nil, &Violation{
+				Err:    ErrArgumentsNotAllowed,
+				Rule:   ruleName + ".arg_patterns",
+				Detail: err.Error(),
+			}
+		}
+		if !matched {
+			return nil, &Violation{
+				Err:    ErrArgumentsNotAllowed,
+				Rule:   ruleName,
+				Detail: fmt.Sprintf("%s %s matches no allowed_args or arg_patterns entry", rule.Binary, strings.Join(args, " ")),
+			}
+		}
+	}
+
+	return applied, nil
+}
+
+// matchForbiddenFlag reports whether arg passes one of flags the way a
+// getopt-style parser would read it: "-p", "--flag" or "--flag=value", a
+// short flag bundled with others or with its value attached ("-tp",
+// "-oProxyCommand=x"), or an abbreviated long flag ("--prog"). Any letter
+// of a bundle counts, since a value attached to an earlier flag cannot be
+// told apart from more flags.
+func matchForbiddenFlag(flags []string, arg string) (string, bool) {
+	for _, flag := range flags {
+		if arg == flag || strings.HasPrefix(arg, flag+"=") {
+			return flag, true
+		}
+
+		switch {
+		case strings.HasPrefix(flag, "--"):
+			// Long options may be abbreviated to any prefix
+			name := strings.SplitN(arg, "=", 2)[0]
+			if strings.HasPrefix(name, "--") && len(name) > 2 && strings.HasPrefix(flag, name) {
+				return flag, true
+			}
+		case len(flag) == 2 && flag[0] == '-':
+			// Short options may be bundled or take an attached value
+			if len(arg) > 2 && arg[0] == '-' && arg[1] != '-' && strings.IndexByte(arg[1:], flag[1]) >= 0 {
+				return flag, true
+			}
+		}
+	}
+	return "", false
+}
+
+// matchesAllowedArgs reports whether args equals one of the allowed vectors
+func matchesAllowedArgs(allowed [][]string, args []string) bool {
+	for _, candidate := range allowed {
+		if len(candidate) != len(args) {
+			continue
+		}
+		equal := true
+		for i := range candidate {
+			if candidate[i] != args[i] {
+				equal = false
+				break
+			}
+		}
+		if equal {
+			return true
+		}
+	}
+	return false
+}
+
+// argSeparator joins args for arg_patterns. NUL cannot occur inside an
+// argument, so unlike a space it keeps "addr show" apart from "addr" "show".
+const argSeparator = "\x00"
+
+// matchesArgPatterns reports whether the NUL-joined args match any pattern
+func matchesArgPatterns(compiled map[string]*regexp.Regexp, patterns []string, args []string) (bool, error) {
+	joined := strings.Join(args, argSeparator)
+	for _, pattern := range patterns {
+		re, ok := compiled[pattern]
+		if !ok {
+			// Added to the policy after the enforcer was created
+			var err error
+			if re, err = compileArgPattern(pattern); err != nil {
+				return false, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+		}
+		if re.MatchString(joined) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// compileArgPatterns compiles every arg_patterns entry of policy; invalid
+// entries are left out, Validate reports them
+func compileArgPatterns(policy *Policy) map[string]*regexp.Regexp {
+	compiled := make(map[string]*regexp.Regexp)
+	exec := policy.Capabilities.Exec
+	if exec == nil {
+		return compiled
+	}
+	for _, rule := range exec.ArgRules {
+		for _, pattern := range rule.ArgPatterns {
+			if re, err := compileArgPattern(pattern); err == nil {
+				compiled[pattern] = re
+			}
+		}
+	}
+	return compiled
+}
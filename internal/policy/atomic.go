@@ -0,0 +1,93 @@
+package policy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// tempAttempts bounds the retries when a temporary name is already taken
+const tempAttempts = 10
+
+// AtomicFile is a temporary file that replaces its target on Commit. It is
+// created and renamed through the target's directory as it was opened when
+// the write was allowed, so a directory swapped for a symlink afterwards
+// cannot redirect the write.
+type AtomicFile struct {
+	*os.File
+
+	dir     *os.File // nil where directory handles are not used
+	dirPath string
+	name    string
+	tmpName string
+	done    bool
+}
+
+// CreateAtomic checks path against the write allowlist and creates a
+// uniquely named temporary file next to it with perm. The caller writes it and calls
+// Commit, and always Abort, which is a no-op after a successful Commit.
+func (e *Enforcer) CreateAtomic(path string, perm os.FileMode) (*AtomicFile, error) {
+	if err := e.CanWriteFile(path, 0); err != nil {
+		return nil, err
+	}
+
+	canonical, err := CanonicalPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &AtomicFile{
+		dirPath: filepath.Dir(canonical),
+		name:    filepath.Base(canonical),
+	}
+	if err := f.create(perm); err != nil {
+		f.Abort()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Commit closes the temporary file and renames it over the target
+func (f *AtomicFile) Commit() error {
+	if err := f.File.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", f.tmpName, err)
+	}
+	if err := f.rename(); err != nil {
+		return err
+	}
+	f.done = true
+	f.closeDir()
+	return nil
+}
+
+// Abort closes and removes the temporary file unless it was committed
+func (f *AtomicFile) Abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+	if f.File != nil {
+		f.File.Close()
+		f.remove()
+	}
+	f.closeDir()
+}
+
+// newTempName returns a random name for the temporary file, so concurrent
+// writes to one target never share it
+func (f *AtomicFile) newTempName() (string, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to generate temporary name: %w", err)
+	}
+	return "." + f.name + "." + hex.EncodeToString(suffix) + ".tmp", nil
+}
+
+func (f *AtomicFile) closeDir() {
+	if f.dir != nil {
+		f.dir.Close()
+		f.dir = nil
+	}
+}
@@ -0,0 +1,82 @@
+// +build !windows
+
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// create opens the target's directory and creates the temporary file in it
+func (f *AtomicFile) create(perm os.FileMode) error {
+	dir, err := openNoFollow(f.dirPath, os.O_RDONLY|unix.O_DIRECTORY, 0)
+	if err != nil {
+		return err
+	}
+	f.dir = dir
+	if err := verifyDir(dir, f.dirPath); err != nil {
+		return err
+	}
+
+	for attempt := 0; attempt < tempAttempts; attempt++ {
+		if f.tmpName, err = f.newTempName(); err != nil {
+			return err
+		}
+		fd, err := unix.Openat(int(dir.Fd()), f.tmpName,
+			unix.O_CREAT|unix.O_EXCL|unix.O_WRONLY|unix.O_NOFOLLOW|unix.O_CLOEXEC, uint32(perm.Perm()))
+		if errors.Is(err, unix.EEXIST) {
+			continue
+		}
+		if err != nil {
+			return &os.PathError{Op: "openat", Path: f.tmpName, Err: err}
+		}
+		f.File = os.NewFile(uintptr(fd), f.tmpName)
+		return nil
+	}
+	return fmt.Errorf("failed to create a temporary file for %s", f.name)
+}
+
+// rename replaces the target with the temporary file within the directory
+func (f *AtomicFile) rename() error {
+	dirfd := int(f.dir.Fd())
+	if err := unix.Renameat(dirfd, f.tmpName, dirfd, f.name); err != nil {
+		return fmt.Errorf("failed to move file: %w", &os.LinkError{Op: "renameat", Old: f.tmpName, New: f.name, Err: err})
+	}
+	return nil
+}
+
+func (f *AtomicFile) remove() {
+	unix.Unlinkat(int(f.dir.Fd()), f.tmpName, 0)
+}
+
+// verifyDir confirms the opened directory is the canonical one that was
+// checked
+func verifyDir(dir *os.File, canonical string) error {
+	if real, err := openedPath(dir); err == nil {
+		if real != canonical {
+			return &Violation{
+				Err:    ErrPathNotAllowed,
+				Rule:   "file.write_paths",
+				Detail: fmt.Sprintf("%s resolved to %s at open time", canonical, real),
+			}
+		}
+		return nil
+	}
+
+	opened, err := dir.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat opened directory: %w", err)
+	}
+	current, err := os.Lstat(canonical)
+	if err != nil || !os.SameFile(opened, current) {
+		return &Violation{
+			Err:    ErrPathNotAllowed,
+			Rule:   "file.write_paths",
+			Detail: fmt.Sprintf("%s changed between check and open", canonical),
+		}
+	}
+	return nil
+}
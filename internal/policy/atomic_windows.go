@@ -0,0 +1,53 @@
+// +build windows
+
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// create creates the temporary file by path; the directory is re-checked
+// before the rename instead
+func (f *AtomicFile) create(perm os.FileMode) error {
+	for attempt := 0; attempt < tempAttempts; attempt++ {
+		tmpName, err := f.newTempName()
+		if err != nil {
+			return err
+		}
+		file, err := openNoFollow(filepath.Join(f.dirPath, tmpName), os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		f.tmpName = tmpName
+		f.File = file
+		return nil
+	}
+	return fmt.Errorf("failed to create a temporary file for %s", f.name)
+}
+
+// rename replaces the target once the directory still resolves to the one
+// that was checked
+func (f *AtomicFile) rename() error {
+	resolved, err := filepath.EvalSymlinks(f.dirPath)
+	if err != nil || resolved != f.dirPath {
+		return &Violation{
+			Err:    ErrPathNotAllowed,
+			Rule:   "file.write_paths",
+			Detail: fmt.Sprintf("%s changed between check and rename", f.dirPath),
+		}
+	}
+	if err := os.Rename(filepath.Join(f.dirPath, f.tmpName), filepath.Join(f.dirPath, f.name)); err != nil {
+		return fmt.Errorf("failed to move file: %w", err)
+	}
+	return nil
+}
+
+func (f *AtomicFile) remove() {
+	os.Remove(filepath.Join(f.dirPath, f.tmpName))
+}
@@ -0,0 +1,74 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Decision explains the outcome of a policy check. An allowed decision names
+// the rule that granted the request; a denied one carries the error that
+// rejected it.
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Rule    string `json:"rule,omitempty"`
+	Reason  string `json:"reason"`
+	Err     error  `json:"-"`
+}
+
+// allow builds an allowed decision
+func allow(rule, reason string, args ...interface{}) *Decision {
+	return &Decision{
+		Allowed: true,
+		Rule:    rule,
+		Reason:  fmt.Sprintf(reason, args...),
+	}
+}
+
+// Deny builds a denied decision from err, taking the rule from a Violation
+// when err wraps one
+func Deny(err error) *Decision {
+	d := &Decision{Reason: err.Error(), Err: err}
+
+	var violation *Violation
+	if errors.As(err, &violation) {
+		d.Rule = violation.Rule
+		d.Reason = violation.Err.Error()
+		if violation.Detail != "" {
+			d.Reason += ": " + violation.Detail
+		}
+	}
+
+	return d
+}
+
+// violationTypes names each policy error for audit records
+var violationTypes = []struct {
+	err  error
+	name string
+}{
+	{ErrPolicyExpired, "policy_expired"},
+	{ErrCapabilityDisabled, "capability_disabled"},
+	{ErrBinaryDenied, "binary_denied"},
+	{ErrBinaryNotAllowed, "binary_not_allowed"},
+	{ErrArgumentsNotAllowed, "arguments_not_allowed"},
+	{ErrPathTraversal, "path_traversal"},
+	{ErrPathNotAllowed, "path_not_allowed"},
+	{ErrTimeoutExceeded, "timeout_exceeded"},
+	{ErrInterpreterNotAllowed, "interpreter_not_allowed"},
+	{ErrSignatureRequired, "signature_required"},
+	{ErrFileSizeExceeded, "file_size_exceeded"},
+	{ErrSandboxUnavailable, "sandbox_unavailable"},
+	{ErrOutsideWindow, "outside_window"},
+}
+
+// ViolationType returns the audit name of the policy error err wraps, or
+// "invalid_request" when the request was rejected before any policy rule
+// applied, such as a malformed payload
+func ViolationType(err error) string {
+	for _, v := range violationTypes {
+		if errors.Is(err, v.err) {
+			return v.name
+		}
+	}
+	return "invalid_request"
+}
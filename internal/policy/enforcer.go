@@ -3,6 +3,17 @@ package policy
 import (
 	"errors"
 	"fmt"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultConsentTimeout is how long a consent prompt waits for an answer
+	defaultConsentTimeout = 120 * time.Second
 )
 
 var (
@@ -32,11 +43,42 @@ var (
 
 	// ErrPathTraversal indicates path contains traversal attempt
 	ErrPathTraversal = errors.New("path traversal detected")
+
+	// ErrSandboxUnavailable indicates the policy requires a sandbox the host cannot provide
+	ErrSandboxUnavailable = errors.New("sandbox required but unavailable")
+
+	// ErrBinaryDenied indicates binary matches an explicit deny entry
+	ErrBinaryDenied = errors.New("binary denied")
+
+	// ErrArgumentsNotAllowed indicates arguments violate a binary's arg rules
+	ErrArgumentsNotAllowed = errors.New("arguments not allowed")
 )
 
+// Violation identifies the policy rule that rejected a request. It wraps
+// one of the Err* sentinels so callers can keep using errors.Is.
+type Violation struct {
+	Err    error
+	Rule   string // Policy location, e.g. "exec.arg_rules[0].forbidden_flags"
+	Detail string
+}
+
+func (v *Violation) Error() string {
+	if v.Detail == "" {
+		return fmt.Sprintf("%v (rule %s)", v.Err, v.Rule)
+	}
+	return fmt.Sprintf("%v: %s (rule %s)", v.Err, v.Detail, v.Rule)
+}
+
+func (v *Violation) Unwrap() error {
+	return v.Err
+}
+
 // Enforcer enforces policy rules
 type Enforcer struct {
 	policy *Policy
+
+	// argPatterns holds the compiled arg_patterns of the policy
+	argPatterns map[string]*regexp.Regexp
 }
 
 // NewEnforcer creates a new policy enforcer
@@ -45,38 +87,119 @@ func NewEnforcer(policy *Policy) (*Enforcer, error) {
 		return nil, err
 	}
 
-	return &Enforcer{policy: policy}, nil
+	return &Enforcer{policy: policy, argPatterns: compileArgPatterns(policy)}, nil
 }
 
-// CanExecuteBinary checks if binary execution is allowed
-func (e *Enforcer) CanExecuteBinary(binary string, timeoutSec int) error {
-	if e.policy.Capabilities.Exec == nil || !e.policy.Capabilities.Exec.Enabled {
-		return ErrCapabilityDisabled
+// CanExecuteBinary checks if binary execution with args is allowed
+func (e *Enforcer) CanExecuteBinary(binary string, args []string, timeoutSec int) error {
+	return e.ExplainExecuteBinary(binary, args, timeoutSec).Err
+}
+
+// ExplainExecuteBinary runs the CanExecuteBinary checks and reports the rule
+// that decided the outcome
+func (e *Enforcer) ExplainExecuteBinary(binary string, args []string, timeoutSec int) *Decision {
+	if !e.policy.Capabilities.Exec.IsEnabled() {
+		return Deny(&Violation{Err: ErrCapabilityDisabled, Rule: "exec.enabled"})
 	}
 
 	exec := e.policy.Capabilities.Exec
 
+	// Deny entries and arg rules see the program that actually runs, so a
+	// link with another name cannot slip past them
+	candidates := binaryCandidates(binary)
+
+	// Explicit denies override every allow entry
+	for i, denied := range exec.DeniedBinaries {
+		if matchesAnyBinary(denied, candidates) {
+			return Deny(&Violation{
+				Err:    ErrBinaryDenied,
+				Rule:   fmt.Sprintf("exec.denied_binaries[%d]", i),
+				Detail: fmt.Sprintf("%s matches %q", binary, denied),
+			})
+		}
+	}
+
 	// Check binary allowlist
-	if !AllowsBinary(exec.AllowedBinaries, binary) {
+	rule := "exec.allowed_binaries"
+	matched, ok := MatchBinary(exec.AllowedBinaries, binary)
+	if !ok {
 		// Check if binary path is in allowed paths
-		pathAllowlist := NewAllowlist(exec.AllowedPaths)
-		if !pathAllowlist.Allows(binary) {
-			return fmt.Errorf("%w: %s", ErrBinaryNotAllowed, binary)
+		rule = "exec.allowed_paths"
+		matched, ok = NewAllowlist(exec.AllowedPaths).Match(binary)
+		if !ok {
+			return Deny(&Violation{
+				Err:    ErrBinaryNotAllowed,
+				Rule:   "exec.allowed_binaries",
+				Detail: binary,
+			})
 		}
 	}
 
+	// Check argument rules
+	applied, err := checkArgRules(exec.ArgRules, e.argPatterns, candidates, args)
+	if err != nil {
+		return Deny(err)
+	}
+
 	// Check timeout
 	if timeoutSec > exec.MaxExecutionSec {
-		return fmt.Errorf("%w: %d > %d", ErrTimeoutExceeded, timeoutSec, exec.MaxExecutionSec)
+		return Deny(&Violation{
+			Err:    ErrTimeoutExceeded,
+			Rule:   "exec.max_execution_sec",
+			Detail: fmt.Sprintf("%d > %d", timeoutSec, exec.MaxExecutionSec),
+		})
 	}
 
-	return nil
+	decision := allow(rule, "%s matches %q", binary, matched)
+	if len(applied) > 0 {
+		decision.Reason += fmt.Sprintf("; arguments satisfy %s", strings.Join(applied, ", "))
+	}
+	return decision
+}
+
+// binaryCandidates returns binary as requested followed by the canonical
+// path of the file it names: a bare name is looked up in PATH the way the
+// job will be started, and symlinks are resolved
+func binaryCandidates(binary string) []string {
+	candidates := []string{binary}
+
+	path := binary
+	if !filepath.IsAbs(path) {
+		found, err := osexec.LookPath(binary)
+		if err != nil {
+			return candidates
+		}
+		if path, err = filepath.Abs(found); err != nil {
+			return candidates
+		}
+	}
+	if canonical, err := CanonicalPath(path); err == nil && canonical != binary {
+		candidates = append(candidates, canonical)
+	}
+	return candidates
+}
+
+// matchesAnyBinary reports whether entry, a name or a path pattern, matches
+// one of candidates
+func matchesAnyBinary(entry string, candidates []string) bool {
+	for _, candidate := range candidates {
+		if AllowsBinary([]string{entry}, candidate) || NewAllowlist([]string{entry}).Allows(candidate) {
+			return true
+		}
+	}
+	return false
 }
 
 // CanExecuteScript checks if script execution is allowed
 func (e *Enforcer) CanExecuteScript(interpreter string, scriptSize int, hasSignature bool, timeoutSec int) error {
-	if e.policy.Capabilities.Script == nil || !e.policy.Capabilities.Script.Enabled {
-		return ErrCapabilityDisabled
+	return e.ExplainExecuteScript(interpreter, scriptSize, hasSignature, timeoutSec).Err
+}
+
+// ExplainExecuteScript runs the CanExecuteScript checks and reports the rule
+// that decided the outcome
+func (e *Enforcer) ExplainExecuteScript(interpreter string, scriptSize int, hasSignature bool, timeoutSec int) *Decision {
+	if !e.policy.Capabilities.Script.IsEnabled() {
+		return Deny(&Violation{Err: ErrCapabilityDisabled, Rule: "script.enabled"})
 	}
 
 	script := e.policy.Capabilities.Script
@@ -90,70 +213,258 @@ func (e *Enforcer) CanExecuteScript(interpreter string, scriptSize int, hasSigna
 		}
 	}
 	if !interpreterAllowed {
-		return fmt.Errorf("%w: %s", ErrInterpreterNotAllowed, interpreter)
+		return Deny(&Violation{
+			Err:    ErrInterpreterNotAllowed,
+			Rule:   "script.allowed_interpreters",
+			Detail: interpreter,
+		})
 	}
 
 	// Check signature requirement
 	if script.RequireSignature && !hasSignature {
-		return ErrSignatureRequired
+		return Deny(&Violation{Err: ErrSignatureRequired, Rule: "script.require_signature"})
 	}
 
 	// Check script size
 	if scriptSize > script.MaxScriptSizeBytes {
-		return fmt.Errorf("%w: %d > %d", ErrFileSizeExceeded, scriptSize, script.MaxScriptSizeBytes)
+		return Deny(&Violation{
+			Err:    ErrFileSizeExceeded,
+			Rule:   "script.max_script_size_bytes",
+			Detail: fmt.Sprintf("%d > %d", scriptSize, script.MaxScriptSizeBytes),
+		})
 	}
 
 	// Check timeout
 	if timeoutSec > script.MaxExecutionSec {
-		return fmt.Errorf("%w: %d > %d", ErrTimeoutExceeded, timeoutSec, script.MaxExecutionSec)
+		return Deny(&Violation{
+			Err:    ErrTimeoutExceeded,
+			Rule:   "script.max_execution_sec",
+			Detail: fmt.Sprintf("%d > %d", timeoutSec, script.MaxExecutionSec),
+		})
 	}
 
-	return nil
+	return allow("script.allowed_interpreters", "interpreter %s is allowed", interpreter)
 }
 
-// CanReadFile checks if file read is allowed
+// CanReadFile checks if file read is allowed. The path is resolved through
+// symlinks before matching.
 func (e *Enforcer) CanReadFile(path string) error {
+	return e.ExplainReadFile(path).Err
+}
+
+// ExplainReadFile runs the CanReadFile checks and reports the rule that
+// decided the outcome
+func (e *Enforcer) ExplainReadFile(path string) *Decision {
 	if e.policy.Capabilities.File == nil {
-		return ErrCapabilityDisabled
+		return Deny(&Violation{Err: ErrCapabilityDisabled, Rule: "file"})
 	}
 
 	// Validate path for traversal
 	if err := ValidatePath(path); err != nil {
-		return err
+		return Deny(err)
 	}
 
-	allowlist := NewAllowlist(e.policy.Capabilities.File.ReadPaths)
-	if !allowlist.Allows(path) {
-		return fmt.Errorf("%w: %s", ErrPathNotAllowed, path)
+	matched, err := checkPath(e.policy.Capabilities.File.ReadPaths, "file.read_paths", path)
+	if err != nil {
+		return Deny(err)
 	}
 
-	return nil
+	return allow("file.read_paths", "%s matches %q", path, matched)
+}
+
+// CanCollectSupportBundle checks if support bundles may be collected
+func (e *Enforcer) CanCollectSupportBundle() error {
+	return e.ExplainCollectSupportBundle().Err
+}
+
+// ExplainCollectSupportBundle runs the CanCollectSupportBundle check and
+// reports the rule that decided the outcome
+func (e *Enforcer) ExplainCollectSupportBundle() *Decision {
+	if !e.policy.Capabilities.Support.IsEnabled() {
+		return Deny(&Violation{Err: ErrCapabilityDisabled, Rule: "support.enabled"})
+	}
+	return allow("support.enabled", "support bundles enabled")
 }
 
-// CanWriteFile checks if file write is allowed
+// CanWriteFile checks if file write is allowed. For files that do not exist
+// yet the nearest existing parent is resolved.
 func (e *Enforcer) CanWriteFile(path string, size int64) error {
+	return e.ExplainWriteFile(path, size).Err
+}
+
+// ExplainWriteFile runs the CanWriteFile checks and reports the rule that
+// decided the outcome
+func (e *Enforcer) ExplainWriteFile(path string, size int64) *Decision {
 	if e.policy.Capabilities.File == nil {
-		return ErrCapabilityDisabled
+		return Deny(&Violation{Err: ErrCapabilityDisabled, Rule: "file"})
 	}
 
 	// Validate path for traversal
 	if err := ValidatePath(path); err != nil {
-		return err
+		return Deny(err)
 	}
 
-	allowlist := NewAllowlist(e.policy.Capabilities.File.WritePaths)
-	if !allowlist.Allows(path) {
-		return fmt.Errorf("%w: %s", ErrPathNotAllowed, path)
+	matched, err := checkPath(e.policy.Capabilities.File.WritePaths, "file.write_paths", path)
+	if err != nil {
+		return Deny(err)
 	}
 
 	// Check file size
 	if size > e.policy.Capabilities.File.MaxFileSizeBytes {
-		return fmt.Errorf("%w: %d > %d", ErrFileSizeExceeded, size, e.policy.Capabilities.File.MaxFileSizeBytes)
+		return Deny(&Violation{
+			Err:    ErrFileSizeExceeded,
+			Rule:   "file.max_file_size_bytes",
+			Detail: fmt.Sprintf("%d > %d", size, e.policy.Capabilities.File.MaxFileSizeBytes),
+		})
+	}
+
+	return allow("file.write_paths", "%s matches %q", path, matched)
+}
+
+// OpenForRead checks path against the read allowlist and opens it without
+// following symlinks, then re-checks the opened file so a path swapped
+// between the check and the open is never read
+func (e *Enforcer) OpenForRead(path string) (*os.File, error) {
+	if err := e.CanReadFile(path); err != nil {
+		return nil, err
+	}
+
+	return openChecked(path, os.O_RDONLY, 0, e.policy.Capabilities.File.ReadPaths, "file.read_paths")
+}
+
+// OpenForWrite checks path against the write allowlist and opens it with
+// flag/perm under the same symlink and re-check rules as OpenForRead
+func (e *Enforcer) OpenForWrite(path string, flag int, perm os.FileMode) (*os.File, error) {
+	if err := e.CanWriteFile(path, 0); err != nil {
+		return nil, err
+	}
+
+	return openChecked(path, flag, perm, e.policy.Capabilities.File.WritePaths, "file.write_paths")
+}
+
+// checkPath matches the canonical form of path against patterns and returns
+// the pattern that allowed it
+func checkPath(patterns []string, rule, path string) (string, error) {
+	canonical, err := CanonicalPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	matched, ok := NewAllowlist(patterns).Match(canonical)
+	if !ok {
+		detail := path
+		if canonical != filepath.Clean(path) {
+			detail = fmt.Sprintf("%s (resolves to %s)", path, canonical)
+		}
+		return "", &Violation{Err: ErrPathNotAllowed, Rule: rule, Detail: detail}
+	}
+
+	return matched, nil
+}
+
+// openChecked opens the canonical form of path and verifies that what was
+// opened is still covered by patterns
+func openChecked(path string, flag int, perm os.FileMode, patterns []string, rule string) (*os.File, error) {
+	canonical, err := CanonicalPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The canonical path contains no symlinks, so any symlink seen now was
+	// planted after the check
+	f, err := openNoFollow(canonical, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyOpened(f, canonical, patterns, rule); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// verifyOpened re-checks the file behind f against patterns
+func verifyOpened(f *os.File, canonical string, patterns []string, rule string) error {
+	if real, err := openedPath(f); err == nil {
+		if !NewAllowlist(patterns).Allows(real) {
+			return &Violation{
+				Err:    ErrPathNotAllowed,
+				Rule:   rule,
+				Detail: fmt.Sprintf("%s resolved to %s at open time", canonical, real),
+			}
+		}
+		return nil
+	}
+
+	// Without a kernel path lookup, confirm the opened file is still the one
+	// at the checked location
+	opened, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat opened file: %w", err)
+	}
+	current, err := os.Lstat(canonical)
+	if err != nil || !os.SameFile(opened, current) {
+		return &Violation{
+			Err:    ErrPathNotAllowed,
+			Rule:   rule,
+			Detail: fmt.Sprintf("%s changed between check and open", canonical),
+		}
 	}
 
 	return nil
 }
 
+// SandboxMode reports whether exec and script children should be sandboxed
+// and whether running them unsandboxed is forbidden
+func (e *Enforcer) SandboxMode() (enabled, required bool) {
+	file := e.policy.Capabilities.File
+	if file == nil {
+		return false, false
+	}
+	return file.Sandbox || file.RequireSandbox, file.RequireSandbox
+}
+
+// SandboxPaths returns the read and write allowlists a sandbox is built from
+func (e *Enforcer) SandboxPaths() (readPaths, writePaths []string) {
+	file := e.policy.Capabilities.File
+	if file == nil {
+		return nil, nil
+	}
+	return file.ReadPaths, file.WritePaths
+}
+
+// ConsentRequirement reports whether jobs of jobType need the logged-in
+// user's approval and how long to wait for it
+func (e *Enforcer) ConsentRequirement(jobType string) (bool, time.Duration) {
+	var consent *Consent
+	switch capabilityFor(jobType) {
+	case "exec":
+		if e.policy.Capabilities.Exec != nil {
+			consent = &e.policy.Capabilities.Exec.Consent
+		}
+	case "script":
+		if e.policy.Capabilities.Script != nil {
+			consent = &e.policy.Capabilities.Script.Consent
+		}
+	case "file":
+		if e.policy.Capabilities.File != nil {
+			consent = &e.policy.Capabilities.File.Consent
+		}
+	}
+
+	if consent == nil || !consent.RequireConsent {
+		return false, 0
+	}
+
+	timeout := defaultConsentTimeout
+	if consent.ConsentTimeoutSec > 0 {
+		timeout = time.Duration(consent.ConsentTimeoutSec) * time.Second
+	}
+	return true, timeout
+}
+
 // GetMaxExecTimeout returns maximum execution timeout
 func (e *Enforcer) GetMaxExecTimeout() int {
 	if e.policy.Capabilities.Exec != nil {
@@ -0,0 +1,293 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func newTestEnforcer(t *testing.T, exec *ExecCapability) *Enforcer {
+	t.Helper()
+
+	pol := DefaultPolicy()
+	pol.Capabilities.Exec = exec
+
+	enforcer, err := NewEnforcer(pol)
+	if err != nil {
+		t.Fatalf("NewEnforcer() error = %v", err)
+	}
+	return enforcer
+}
+
+func TestCanExecuteBinary_ArgRules(t *testing.T) {
+	enforcer := newTestEnforcer(t, &ExecCapability{
+		Enabled:         Bool(true),
+		AllowedBinaries: []string{"ip", "netstat", "systemctl"},
+		MaxExecutionSec: 60,
+		ArgRules: []ArgRule{
+			{Binary: "ip", ArgPatterns: []string{`(addr|link|route)(\x00show(\x00[a-z0-9]+)?)?`}},
+			{Binary: "netstat", ForbiddenFlags: []string{"-p", "--program"}, MaxArgs: 2},
+			{Binary: "systemctl", AllowedArgs: [][]string{{"status", "nginx"}, {"is-active", "nginx"}}},
+		},
+	})
+
+	tests := []struct {
+		name     string
+		binary   string
+		args     []string
+		wantRule string
+	}{
+		{name: "ip show allowed", binary: "ip", args: []string{"addr", "show"}},
+		{name: "ip show device allowed", binary: "ip", args: []string{"addr", "show", "eth0"}},
+		{name: "space inside one argument rejected", binary: "ip", args: []string{"addr show"}, wantRule: "exec.arg_rules[0]"},
+		{name: "extra argument smuggled in a value rejected", binary: "ip", args: []string{"link", "show", "eth0 down"}, wantRule: "exec.arg_rules[0]"},
+		{name: "ip bare subcommand allowed", binary: "/usr/sbin/ip", args: []string{"route"}},
+		{name: "ip link down rejected", binary: "ip", args: []string{"link", "set", "eth0", "down"}, wantRule: "exec.arg_rules[0]"},
+		{name: "netstat allowed", binary: "netstat", args: []string{"-tn"}},
+		{name: "netstat forbidden flag", binary: "netstat", args: []string{"-p"}, wantRule: "exec.arg_rules[1].forbidden_flags"},
+		{name: "netstat forbidden long flag", binary: "netstat", args: []string{"--program=all"}, wantRule: "exec.arg_rules[1].forbidden_flags"},
+		{name: "netstat bundled forbidden flag", binary: "netstat", args: []string{"-tnp"}, wantRule: "exec.arg_rules[1].forbidden_flags"},
+		{name: "netstat abbreviated forbidden flag", binary: "netstat", args: []string{"--prog"}, wantRule: "exec.arg_rules[1].forbidden_flags"},
+		{name: "netstat too many args", binary: "netstat", args: []string{"-t", "-n", "-l"}, wantRule: "exec.arg_rules[1].max_args"},
+		{name: "systemctl exact args", binary: "systemctl", args: []string{"status", "nginx"}},
+		{name: "systemctl other args", binary: "systemctl", args: []string{"stop", "nginx"}, wantRule: "exec.arg_rules[2]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := enforcer.CanExecuteBinary(tt.binary, tt.args, 30)
+			if tt.wantRule == "" {
+				if err != nil {
+					t.Fatalf("CanExecuteBinary() unexpected error = %v", err)
+				}
+				return
+			}
+
+			var violation *Violation
+			if !errors.As(err, &violation) {
+				t.Fatalf("CanExecuteBinary() error = %v, want *Violation", err)
+			}
+			if !errors.Is(err, ErrArgumentsNotAllowed) {
+				t.Errorf("error should wrap ErrArgumentsNotAllowed: %v", err)
+			}
+			if violation.Rule != tt.wantRule {
+				t.Errorf("Rule = %q, want %q", violation.Rule, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestMatchForbiddenFlag(t *testing.T) {
+	flags := []string{"-p", "-o", "--program", "-exec"}
+
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{arg: "-p", want: "-p"},
+		{arg: "--program", want: "--program"},
+		{arg: "--program=all", want: "--program"},
+		{arg: "-exec", want: "-exec"},
+		{arg: "-exec=rm", want: "-exec"},
+
+		// Bundled short flags
+		{arg: "-tp", want: "-p"},
+		{arg: "-tnp", want: "-p"},
+
+		// Attached values
+		{arg: "-oProxyCommand=sh", want: "-o"},
+		{arg: "-pall", want: "-p"},
+
+		// GNU abbreviations of long flags
+		{arg: "--prog", want: "--program"},
+		{arg: "--p=all", want: "--program"},
+
+		// Not the forbidden flags
+		{arg: "-tn"},
+		{arg: "--programs"},
+		{arg: "--"},
+		{arg: "-"},
+		{arg: "--tcp"},
+		{arg: "-execdir"},
+		{arg: "program"},
+		{arg: "/tmp/p"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			flag, ok := matchForbiddenFlag(flags, tt.arg)
+			if ok != (tt.want != "") || flag != tt.want {
+				t.Errorf("matchForbiddenFlag(%q) = %q, %v, want %q", tt.arg, flag, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewEnforcer_CompilesArgPatterns(t *testing.T) {
+	enforcer := newTestEnforcer(t, &ExecCapability{
+		Enabled:         Bool(true),
+		AllowedBinaries: []string{"ip"},
+		MaxExecutionSec: 60,
+		ArgRules:        []ArgRule{{Binary: "ip", ArgPatterns: []string{`addr`, `route`}}},
+	})
+	if len(enforcer.argPatterns) != 2 {
+		t.Errorf("argPatterns = %v, want both patterns compiled", enforcer.argPatterns)
+	}
+
+	// A pattern added afterwards is still applied
+	rule := &enforcer.Policy().Capabilities.Exec.ArgRules[0]
+	rule.ArgPatterns = append(rule.ArgPatterns, `link`)
+	if err := enforcer.CanExecuteBinary("ip", []string{"link"}, 30); err != nil {
+		t.Errorf("CanExecuteBinary(ip link) error = %v", err)
+	}
+}
+
+func TestCanExecuteBinary_DenyOverridesAllow(t *testing.T) {
+	enforcer := newTestEnforcer(t, &ExecCapability{
+		Enabled:         Bool(true),
+		AllowedBinaries: []string{"rm"},
+		AllowedPaths:    []string{"/usr/bin/*"},
+		DeniedBinaries:  []string{"rm", "/usr/bin/shred"},
+		MaxExecutionSec: 60,
+	})
+
+	for _, binary := range []string{"rm", "/bin/rm", "/usr/bin/shred"} {
+		err := enforcer.CanExecuteBinary(binary, nil, 30)
+		if !errors.Is(err, ErrBinaryDenied) {
+			t.Errorf("CanExecuteBinary(%s) error = %v, want ErrBinaryDenied", binary, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "exec.denied_binaries") {
+			t.Errorf("error should name the deny rule: %v", err)
+		}
+	}
+
+	if err := enforcer.CanExecuteBinary("/usr/bin/uptime", nil, 30); err != nil {
+		t.Errorf("CanExecuteBinary(/usr/bin/uptime) unexpected error = %v", err)
+	}
+}
+
+func TestCanExecuteBinary_ResolvesSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "ip")
+	if err := os.WriteFile(target, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "x")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	enforcer := newTestEnforcer(t, &ExecCapability{
+		Enabled:         Bool(true),
+		AllowedPaths:    []string{filepath.Join(dir, "*")},
+		MaxExecutionSec: 60,
+		ArgRules:        []ArgRule{{Binary: "ip", AllowedArgs: [][]string{{"addr"}}}},
+	})
+
+	if err := enforcer.CanExecuteBinary(link, []string{"addr"}, 30); err != nil {
+		t.Errorf("CanExecuteBinary() through a link with allowed args error = %v", err)
+	}
+	if err := enforcer.CanExecuteBinary(link, []string{"link", "set", "eth0", "down"}, 30); !errors.Is(err, ErrArgumentsNotAllowed) {
+		t.Errorf("arg rules of the link target skipped: error = %v", err)
+	}
+
+	enforcer = newTestEnforcer(t, &ExecCapability{
+		Enabled:         Bool(true),
+		AllowedPaths:    []string{filepath.Join(dir, "*")},
+		DeniedBinaries:  []string{"ip"},
+		MaxExecutionSec: 60,
+	})
+	if err := enforcer.CanExecuteBinary(link, nil, 30); !errors.Is(err, ErrBinaryDenied) {
+		t.Errorf("deny entry of the link target skipped: error = %v", err)
+	}
+}
+
+func TestValidate_InvalidArgPattern(t *testing.T) {
+	pol := DefaultPolicy()
+	pol.Capabilities.Exec.ArgRules = []ArgRule{{Binary: "ip", ArgPatterns: []string{"(unclosed"}}}
+
+	if err := pol.Validate(); err == nil {
+		t.Error("Validate() should reject an invalid arg pattern")
+	}
+}
+
+func TestExplain_ReportsRule(t *testing.T) {
+	enforcer := newTestEnforcer(t, &ExecCapability{
+		Enabled:         Bool(true),
+		AllowedBinaries: []string{"systemctl"},
+		MaxExecutionSec: 60,
+		ArgRules:        []ArgRule{{Binary: "systemctl", AllowedArgs: [][]string{{"status", "nginx"}}}},
+	})
+
+	decision := enforcer.ExplainExecuteBinary("systemctl", []string{"status", "nginx"}, 30)
+	if !decision.Allowed || decision.Rule != "exec.allowed_binaries" {
+		t.Errorf("ExplainExecuteBinary() = %+v, want allowed by exec.allowed_binaries", decision)
+	}
+	if !strings.Contains(decision.Reason, "exec.arg_rules[0]") {
+		t.Errorf("reason should name the applied arg rule: %q", decision.Reason)
+	}
+
+	decision = enforcer.ExplainExecuteBinary("systemctl", []string{"stop", "nginx"}, 30)
+	if decision.Allowed || decision.Rule != "exec.arg_rules[0]" || !errors.Is(decision.Err, ErrArgumentsNotAllowed) {
+		t.Errorf("ExplainExecuteBinary() = %+v, want denied by exec.arg_rules[0]", decision)
+	}
+
+	decision = enforcer.ExplainExecuteScript("python3", 10, true, 30)
+	if decision.Allowed || decision.Rule != "script.allowed_interpreters" {
+		t.Errorf("ExplainExecuteScript() = %+v, want denied by script.allowed_interpreters", decision)
+	}
+}
+
+func TestViolationType(t *testing.T) {
+	enforcer := newTestEnforcer(t, &ExecCapability{
+		Enabled:         Bool(true),
+		AllowedBinaries: []string{"uptime"},
+		DeniedBinaries:  []string{"rm"},
+		MaxExecutionSec: 60,
+	})
+
+	tests := []struct {
+		binary string
+		want   string
+	}{
+		{"rm", "binary_denied"},
+		{"curl", "binary_not_allowed"},
+	}
+	for _, tt := range tests {
+		decision := enforcer.ExplainExecuteBinary(tt.binary, nil, 30)
+		if got := ViolationType(decision.Err); got != tt.want {
+			t.Errorf("ViolationType(%s) = %q, want %q", tt.binary, got, tt.want)
+		}
+	}
+
+	if got := ViolationType(errors.New("invalid payload")); got != "invalid_request" {
+		t.Errorf("ViolationType(invalid payload) = %q, want invalid_request", got)
+	}
+}
+
+func TestDenyAllPolicy(t *testing.T) {
+	enforcer, err := NewEnforcer(DenyAllPolicy())
+	if err != nil {
+		t.Fatalf("NewEnforcer() error = %v", err)
+	}
+
+	if err := enforcer.CanExecuteBinary("hostname", nil, 30); !errors.Is(err, ErrCapabilityDisabled) {
+		t.Errorf("CanExecuteBinary() error = %v, want ErrCapabilityDisabled", err)
+	}
+	if err := enforcer.CanExecuteScript("bash", 10, true, 30); err == nil {
+		t.Error("CanExecuteScript() allowed a script")
+	}
+	if err := enforcer.CanReadFile("/var/log/syslog"); err == nil {
+		t.Error("CanReadFile() allowed a read")
+	}
+	if err := enforcer.CanCollectSupportBundle(); err == nil {
+		t.Error("CanCollectSupportBundle() allowed a bundle")
+	}
+}
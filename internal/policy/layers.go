@@ -0,0 +1,328 @@
+package policy
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Allowlist keys a layer can list in Extendable
+const (
+	KeyExecAllowedBinaries       = "exec.allowed_binaries"
+	KeyExecAllowedPaths          = "exec.allowed_paths"
+	KeyScriptAllowedInterpreters = "script.allowed_interpreters"
+	KeyFileReadPaths             = "file.read_paths"
+	KeyFileWritePaths            = "file.write_paths"
+)
+
+var extendableKeys = map[string]bool{
+	KeyExecAllowedBinaries:       true,
+	KeyExecAllowedPaths:          true,
+	KeyScriptAllowedInterpreters: true,
+	KeyFileReadPaths:             true,
+	KeyFileWritePaths:            true,
+}
+
+// LayerInfo identifies one layer of a merged policy
+type LayerInfo struct {
+	Name      string    `json:"name"`
+	Version   int       `json:"version"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Merged is the effective policy composed from ordered layers
+type Merged struct {
+	Policy  *Policy     `json:"policy"`
+	Layers  []LayerInfo `json:"layers"`
+	Ignored []string    `json:"ignored,omitempty"` // Child entries the parent did not allow
+}
+
+// Merge composes layers ordered from broadest (global) to most specific
+// (host). Each child layer is applied to the result of its parents:
+//   - allowlist entries are added only if the parent lists the key in
+//     Extendable; otherwise they are dropped and reported in Ignored
+//   - numeric limits take the stricter (smaller) value
+//   - denied binaries, arg rules and maintenance windows accumulate, so
+//     denies always win
+//   - enabled flags are ANDed, unset ones inherit, and require/block flags
+//     are ORed
+//   - consent timeouts take the shorter value
+//   - the earliest expiry applies
+//
+// A child's Extendable can only narrow what its parent allowed.
+func Merge(layers []*Policy) (*Merged, error) {
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("no policy layers")
+	}
+
+	effective, err := copyPolicy(layers[0])
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &Merged{Policy: effective}
+	extendable := make(map[string]bool)
+	for _, key := range layers[0].Extendable {
+		extendable[key] = true
+	}
+
+	for i, layer := range layers {
+		name := layer.Layer
+		if name == "" {
+			name = fmt.Sprintf("layer[%d]", i)
+		}
+		merged.Layers = append(merged.Layers, LayerInfo{
+			Name:      name,
+			Version:   layer.Version,
+			ExpiresAt: layer.ExpiresAt,
+		})
+
+		if i == 0 {
+			continue
+		}
+
+		child, err := copyPolicy(layer)
+		if err != nil {
+			return nil, err
+		}
+		merged.Ignored = append(merged.Ignored, mergeLayer(effective, child, extendable, name)...)
+
+		if layer.Extendable != nil {
+			narrowed := make(map[string]bool)
+			for _, key := range layer.Extendable {
+				if extendable[key] {
+					narrowed[key] = true
+				}
+			}
+			extendable = narrowed
+		}
+	}
+
+	effective.Layer = ""
+	effective.Signature = ""
+	effective.Extendable = nil
+	for key := range extendable {
+		effective.Extendable = append(effective.Extendable, key)
+	}
+	sort.Strings(effective.Extendable)
+
+	return merged, nil
+}
+
+// mergeLayer applies child onto parent in place and returns the entries it
+// dropped
+func mergeLayer(parent, child *Policy, extendable map[string]bool, name string) []string {
+	var ignored []string
+
+	extend := func(key string, dst *[]string, src []string) {
+		for _, entry := range src {
+			if containsString(*dst, entry) {
+				continue
+			}
+			if !extendable[key] {
+				ignored = append(ignored, fmt.Sprintf("%s: %s %q", name, key, entry))
+				continue
+			}
+			*dst = append(*dst, entry)
+		}
+	}
+
+	if child.Version > parent.Version {
+		parent.Version = child.Version
+	}
+	if !child.ExpiresAt.IsZero() && child.ExpiresAt.Before(parent.ExpiresAt) {
+		parent.ExpiresAt = child.ExpiresAt
+	}
+
+	// A job must satisfy the windows of every layer
+	parent.MaintenanceWindows = append(parent.MaintenanceWindows, child.MaintenanceWindows...)
+
+	if c := child.Capabilities.Exec; c != nil {
+		if p := parent.Capabilities.Exec; p == nil {
+			ignored = append(ignored, fmt.Sprintf("%s: exec (not granted by parent)", name))
+		} else {
+			p.Enabled = mergeEnabled(p.IsEnabled(), c.Enabled)
+			extend(KeyExecAllowedBinaries, &p.AllowedBinaries, c.AllowedBinaries)
+			extend(KeyExecAllowedPaths, &p.AllowedPaths, c.AllowedPaths)
+			p.MaxExecutionSec = stricterLimit(p.MaxExecutionSec, c.MaxExecutionSec)
+			p.BlockNetworkAccess = p.BlockNetworkAccess || c.BlockNetworkAccess
+			for _, denied := range c.DeniedBinaries {
+				if !containsString(p.DeniedBinaries, denied) {
+					p.DeniedBinaries = append(p.DeniedBinaries, denied)
+				}
+			}
+			// Every matching arg rule must pass, so extra rules only restrict
+			p.ArgRules = append(p.ArgRules, c.ArgRules...)
+			mergeConsent(&p.Consent, &c.Consent)
+		}
+	}
+
+	if c := child.Capabilities.Script; c != nil {
+		if p := parent.Capabilities.Script; p == nil {
+			ignored = append(ignored, fmt.Sprintf("%s: script (not granted by parent)", name))
+		} else {
+			p.Enabled = mergeEnabled(p.IsEnabled(), c.Enabled)
+			extend(KeyScriptAllowedInterpreters, &p.AllowedInterpreters, c.AllowedInterpreters)
+			p.RequireSignature = p.RequireSignature || c.RequireSignature
+			p.MaxScriptSizeBytes = stricterLimit(p.MaxScriptSizeBytes, c.MaxScriptSizeBytes)
+			p.MaxExecutionSec = stricterLimit(p.MaxExecutionSec, c.MaxExecutionSec)
+			mergeConsent(&p.Consent, &c.Consent)
+		}
+	}
+
+	if c := child.Capabilities.File; c != nil {
+		if p := parent.Capabilities.File; p == nil {
+			ignored = append(ignored, fmt.Sprintf("%s: file (not granted by parent)", name))
+		} else {
+			extend(KeyFileReadPaths, &p.ReadPaths, c.ReadPaths)
+			extend(KeyFileWritePaths, &p.WritePaths, c.WritePaths)
+			if c.MaxFileSizeBytes > 0 && c.MaxFileSizeBytes < p.MaxFileSizeBytes {
+				p.MaxFileSizeBytes = c.MaxFileSizeBytes
+			}
+			p.Sandbox = p.Sandbox || c.Sandbox
+			p.RequireSandbox = p.RequireSandbox || c.RequireSandbox
+			mergeConsent(&p.Consent, &c.Consent)
+		}
+	}
+
+	if c := child.Capabilities.Support; c != nil {
+		if p := parent.Capabilities.Support; p == nil {
+			ignored = append(ignored, fmt.Sprintf("%s: support (not granted by parent)", name))
+		} else {
+			p.Enabled = mergeEnabled(p.IsEnabled(), c.Enabled)
+		}
+	}
+
+	return ignored
+}
+
+// mergeEnabled ANDs a child's enabled flag into its parent's. A child that
+// leaves it unset keeps the parent's value, so a layer that only adds
+// restrictions does not switch the capability off.
+func mergeEnabled(parent bool, child *bool) *bool {
+	if child == nil {
+		return Bool(parent)
+	}
+	return Bool(parent && *child)
+}
+
+// mergeConsent requires consent if either layer does, with the shorter timeout
+func mergeConsent(parent, child *Consent) {
+	parent.RequireConsent = parent.RequireConsent || child.RequireConsent
+	if child.ConsentTimeoutSec > 0 && (parent.ConsentTimeoutSec == 0 || child.ConsentTimeoutSec < parent.ConsentTimeoutSec) {
+		parent.ConsentTimeoutSec = child.ConsentTimeoutSec
+	}
+}
+
+// LoadLayers reads every *.json layer in dir in file name order (e.g.
+// "10-global.json", "50-group.json", "90-host.json") and verifies each
+// signature against publicKey. A missing or empty dir yields no layers.
+func LoadLayers(dir string, publicKey ed25519.PublicKey) ([]*Policy, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policy layers: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+	sort.Strings(files)
+
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("policy signing key not available, refusing %d unverified layers", len(files))
+	}
+
+	var layers []*Policy
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read policy layer: %w", err)
+		}
+
+		layer, err := Load(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+		if err := layer.VerifySignature(publicKey); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+		if err := layer.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+
+		if layer.Layer == "" {
+			layer.Layer = strings.TrimSuffix(filepath.Base(file), ".json")
+		}
+		layers = append(layers, layer)
+	}
+
+	return layers, nil
+}
+
+// LoadEffective loads the layers in dir and merges them. It returns nil
+// when dir holds no layers.
+func LoadEffective(dir string, publicKey ed25519.PublicKey) (*Merged, error) {
+	layers, err := LoadLayers(dir, publicKey)
+	if err != nil || layers == nil {
+		return nil, err
+	}
+
+	merged, err := Merge(layers)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := merged.Policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid effective policy: %w", err)
+	}
+
+	return merged, nil
+}
+
+// LoadPublicKey parses a base64-encoded Ed25519 public key
+func LoadPublicKey(data []byte) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key encoding: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key size: %d", len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// copyPolicy returns a deep copy of p
+func copyPolicy(p *Policy) (*Policy, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy policy: %w", err)
+	}
+	var c Policy
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to copy policy: %w", err)
+	}
+	return &c, nil
+}
+
+// stricterLimit returns the smaller limit; an unset (zero) child limit
+// inherits the parent's
+func stricterLimit(parent, child int) int {
+	if child > 0 && child < parent {
+		return child
+	}
+	return parent
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,276 @@
+package policy
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testLayers() (global, group, host *Policy) {
+	global = &Policy{
+		Version:    1,
+		ExpiresAt:  time.Now().Add(90 * 24 * time.Hour),
+		Layer:      "global",
+		Extendable: []string{KeyExecAllowedBinaries, KeyFileReadPaths},
+		Capabilities: Capabilities{
+			Exec: &ExecCapability{
+				Enabled:         Bool(true),
+				AllowedBinaries: []string{"hostname", "df"},
+				DeniedBinaries:  []string{"rm"},
+				MaxExecutionSec: 300,
+			},
+			File: &FileCapability{
+				ReadPaths:        []string{"/var/log/**"},
+				WritePaths:       []string{"/tmp/jtnt/**"},
+				MaxFileSizeBytes: 1000,
+			},
+		},
+	}
+
+	group = &Policy{
+		Version:    4,
+		ExpiresAt:  time.Now().Add(30 * 24 * time.Hour),
+		Layer:      "customer-acme",
+		Extendable: []string{KeyExecAllowedBinaries, KeyExecAllowedPaths},
+		Capabilities: Capabilities{
+			Exec: &ExecCapability{
+				Enabled:         Bool(true),
+				AllowedBinaries: []string{"systemctl"},
+				AllowedPaths:    []string{"/opt/acme/bin/*"},
+				DeniedBinaries:  []string{"shutdown"},
+				MaxExecutionSec: 600,
+			},
+			Script: &ScriptCapability{Enabled: Bool(true), AllowedInterpreters: []string{"bash"}},
+			File: &FileCapability{
+				ReadPaths:        []string{"/srv/acme/**"},
+				WritePaths:       []string{"/srv/acme/**"},
+				MaxFileSizeBytes: 500,
+			},
+		},
+	}
+
+	host = &Policy{
+		Version:   2,
+		ExpiresAt: time.Now().Add(60 * 24 * time.Hour),
+		Layer:     "host",
+		Capabilities: Capabilities{
+			Exec: &ExecCapability{
+				Enabled:         Bool(true),
+				AllowedBinaries: []string{"nginx", "hostname"},
+				MaxExecutionSec: 120,
+			},
+			File: &FileCapability{ReadPaths: []string{"/etc/nginx/**"}},
+		},
+	}
+
+	return global, group, host
+}
+
+func TestMerge(t *testing.T) {
+	global, group, host := testLayers()
+
+	merged, err := Merge([]*Policy{global, group, host})
+	if err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+	p := merged.Policy
+	exec := p.Capabilities.Exec
+
+	wantBinaries := []string{"hostname", "df", "systemctl", "nginx"}
+	if !equalStrings(exec.AllowedBinaries, wantBinaries) {
+		t.Errorf("AllowedBinaries = %v, want %v", exec.AllowedBinaries, wantBinaries)
+	}
+	// global does not list exec.allowed_paths as extendable
+	if len(exec.AllowedPaths) != 0 {
+		t.Errorf("AllowedPaths = %v, want none", exec.AllowedPaths)
+	}
+	if !equalStrings(exec.DeniedBinaries, []string{"rm", "shutdown"}) {
+		t.Errorf("DeniedBinaries = %v, want [rm shutdown]", exec.DeniedBinaries)
+	}
+	if exec.MaxExecutionSec != 120 {
+		t.Errorf("MaxExecutionSec = %d, want 120", exec.MaxExecutionSec)
+	}
+
+	// group narrowed Extendable to exec only, so host cannot add read paths
+	file := p.Capabilities.File
+	if !equalStrings(file.ReadPaths, []string{"/var/log/**", "/srv/acme/**"}) {
+		t.Errorf("ReadPaths = %v", file.ReadPaths)
+	}
+	if !equalStrings(file.WritePaths, []string{"/tmp/jtnt/**"}) {
+		t.Errorf("WritePaths = %v", file.WritePaths)
+	}
+	if file.MaxFileSizeBytes != 500 {
+		t.Errorf("MaxFileSizeBytes = %d, want 500", file.MaxFileSizeBytes)
+	}
+
+	if p.Capabilities.Script != nil {
+		t.Error("a child layer must not grant a capability its parent lacks")
+	}
+
+	if p.Version != 4 || !p.ExpiresAt.Equal(group.ExpiresAt) {
+		t.Errorf("Version = %d ExpiresAt = %v, want 4 and the group expiry", p.Version, p.ExpiresAt)
+	}
+	if len(merged.Layers) != 3 || merged.Layers[2].Name != "host" {
+		t.Errorf("Layers = %+v", merged.Layers)
+	}
+	if len(merged.Ignored) != 4 {
+		t.Errorf("Ignored = %v, want 4 entries", merged.Ignored)
+	}
+
+	// Merging must not modify the input layers
+	if len(global.Capabilities.Exec.AllowedBinaries) != 2 {
+		t.Error("Merge() modified its input")
+	}
+}
+
+func TestMerge_DenyWins(t *testing.T) {
+	global, group, _ := testLayers()
+	group.Capabilities.Exec.AllowedBinaries = []string{"rm"}
+
+	merged, err := Merge([]*Policy{global, group})
+	if err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+
+	enforcer, err := NewEnforcer(merged.Policy)
+	if err != nil {
+		t.Fatalf("NewEnforcer() error = %v", err)
+	}
+	if err := enforcer.CanExecuteBinary("rm", nil, 10); err == nil {
+		t.Error("a parent deny must win over a child allow")
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	global, _, host := testLayers()
+	host.Layer = ""
+	writeSignedLayer(t, filepath.Join(dir, "10-global.json"), global, priv)
+	writeSignedLayer(t, filepath.Join(dir, "90-host.json"), host, priv)
+
+	layers, err := LoadLayers(dir, pub)
+	if err != nil {
+		t.Fatalf("LoadLayers() error = %v", err)
+	}
+	if len(layers) != 2 || layers[0].Layer != "global" || layers[1].Layer != "90-host" {
+		t.Fatalf("LoadLayers() = %d layers, names %q", len(layers), layers[0].Layer)
+	}
+
+	if _, err := LoadLayers(dir, nil); err == nil {
+		t.Error("LoadLayers() without a key should refuse the layers")
+	}
+
+	// Tamper with a signed layer
+	data, _ := os.ReadFile(filepath.Join(dir, "90-host.json"))
+	var tampered Policy
+	json.Unmarshal(data, &tampered)
+	tampered.Capabilities.Exec.AllowedBinaries = append(tampered.Capabilities.Exec.AllowedBinaries, "bash")
+	data, _ = json.Marshal(tampered)
+	os.WriteFile(filepath.Join(dir, "90-host.json"), data, 0600)
+
+	if _, err := LoadLayers(dir, pub); err == nil {
+		t.Error("LoadLayers() should reject a tampered layer")
+	}
+}
+
+func TestVerifySignature_PolicySignedBeforeNewFields(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Canonical form of a policy signed by a hub that predates the
+	// optional fields added since, such as file.sandbox
+	canonical := `{"version":1,"expires_at":"2030-01-01T00:00:00Z","signature":"","capabilities":{` +
+		`"exec":{"enabled":true,"allowed_binaries":["hostname"],"allowed_paths":["/usr/bin/*"],"max_execution_sec":300,"block_network_access":false},` +
+		`"script":{"enabled":false,"allowed_interpreters":null,"require_signature":false,"max_script_size_bytes":0,"max_execution_sec":0},` +
+		`"file":{"read_paths":["/var/log/**"],"write_paths":null,"max_file_size_bytes":1000}}}`
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(canonical)))
+
+	p, err := Load([]byte(strings.Replace(canonical, `"signature":""`, `"signature":"`+signature+`"`, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.VerifySignature(pub); err != nil {
+		t.Errorf("VerifySignature() error = %v", err)
+	}
+}
+
+func writeSignedLayer(t *testing.T, path string, p *Policy, priv ed25519.PrivateKey) {
+	t.Helper()
+
+	p.Signature = ""
+	canonical, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, canonical))
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMerge_UnsetEnabledInherits(t *testing.T) {
+	global, _, _ := testLayers()
+	global.Capabilities.Script = &ScriptCapability{Enabled: Bool(false), AllowedInterpreters: []string{"bash"}}
+
+	// A host layer that only adds a deny entry, as the hub would send it
+	host, err := Load([]byte(`{"version": 2, "layer": "host",
+		"capabilities": {"exec": {"denied_binaries": ["ip"]}, "script": {"enabled": true}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	host.ExpiresAt = global.ExpiresAt
+
+	merged, err := Merge([]*Policy{global, host})
+	if err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+	caps := merged.Policy.Capabilities
+	if !caps.Exec.IsEnabled() {
+		t.Error("a layer without exec.enabled disabled exec")
+	}
+	if !equalStrings(caps.Exec.DeniedBinaries, []string{"rm", "ip"}) {
+		t.Errorf("DeniedBinaries = %v, want [rm ip]", caps.Exec.DeniedBinaries)
+	}
+	if caps.Script.IsEnabled() {
+		t.Error("a child layer enabled script the parent disabled")
+	}
+
+	host.Capabilities.Exec.Enabled = Bool(false)
+	merged, err = Merge([]*Policy{global, host})
+	if err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+	if merged.Policy.Capabilities.Exec.IsEnabled() {
+		t.Error("a layer with exec.enabled false left exec enabled")
+	}
+}
@@ -0,0 +1,43 @@
+// +build linux
+
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// openNoFollow opens path refusing to traverse any symlink. openat2 with
+// RESOLVE_NO_SYMLINKS covers every component; older kernels fall back to
+// O_NOFOLLOW on the final component and rely on openedPath for the rest.
+func openNoFollow(path string, flag int, perm os.FileMode) (*os.File, error) {
+	how := &unix.OpenHow{
+		Flags:   uint64(flag | unix.O_CLOEXEC),
+		Mode:    uint64(perm.Perm()),
+		Resolve: unix.RESOLVE_NO_SYMLINKS,
+	}
+	if flag&os.O_CREATE == 0 {
+		how.Mode = 0
+	}
+
+	fd, err := unix.Openat2(unix.AT_FDCWD, path, how)
+	if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EPERM) {
+		fd, err = unix.Open(path, flag|unix.O_NOFOLLOW|unix.O_CLOEXEC, uint32(perm.Perm()))
+	}
+	if err != nil {
+		if errors.Is(err, unix.ELOOP) {
+			return nil, fmt.Errorf("%w: symlink in path %s", ErrPathNotAllowed, path)
+		}
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+// openedPath returns the path the kernel associates with f
+func openedPath(f *os.File) (string, error) {
+	return os.Readlink(fmt.Sprintf("/proc/self/fd/%d", f.Fd()))
+}
@@ -0,0 +1,24 @@
+// +build !linux,!windows
+
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// openNoFollow opens path without following a symlink in the final component
+func openNoFollow(path string, flag int, perm os.FileMode) (*os.File, error) {
+	f, err := os.OpenFile(path, flag|syscall.O_NOFOLLOW, perm)
+	if err != nil && errors.Is(err, syscall.ELOOP) {
+		return nil, fmt.Errorf("%w: symlink in path %s", ErrPathNotAllowed, path)
+	}
+	return f, err
+}
+
+// openedPath is not available here; callers fall back to comparing inodes
+func openedPath(f *os.File) (string, error) {
+	return "", errors.ErrUnsupported
+}
@@ -0,0 +1,19 @@
+// +build windows
+
+package policy
+
+import (
+	"errors"
+	"os"
+)
+
+// openNoFollow opens path; reparse points are caught by the inode comparison
+// in openChecked
+func openNoFollow(path string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(path, flag, perm)
+}
+
+// openedPath is not available here; callers fall back to comparing inodes
+func openedPath(f *os.File) (string, error) {
+	return "", errors.ErrUnsupported
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"time"
 )
 
@@ -14,31 +15,64 @@ type Policy struct {
 	ExpiresAt    time.Time    `json:"expires_at"`
 	Signature    string       `json:"signature"` // Ed25519 signature of policy JSON
 	Capabilities Capabilities `json:"capabilities"`
+
+	// MaintenanceWindows limit when matching jobs may start; jobs outside
+	// their windows are deferred, not rejected
+	MaintenanceWindows []MaintenanceWindow `json:"maintenance_windows,omitempty"`
+
+	// Layer names this document when it is one of several merged layers
+	// (e.g. "global", "customer-acme", "host")
+	Layer string `json:"layer,omitempty"`
+	// Extendable lists the allowlists later layers may add entries to,
+	// e.g. "file.read_paths"
+	Extendable []string `json:"extendable,omitempty"`
 }
 
 // Capabilities defines what operations the agent can perform
 type Capabilities struct {
-	Exec   *ExecCapability   `json:"exec,omitempty"`
-	Script *ScriptCapability `json:"script,omitempty"`
-	File   *FileCapability   `json:"file,omitempty"`
+	Exec    *ExecCapability    `json:"exec,omitempty"`
+	Script  *ScriptCapability  `json:"script,omitempty"`
+	File    *FileCapability    `json:"file,omitempty"`
+	Support *SupportCapability `json:"support,omitempty"`
 }
 
 // ExecCapability controls binary execution
 type ExecCapability struct {
-	Enabled            bool     `json:"enabled"`
-	AllowedBinaries    []string `json:"allowed_binaries"`
-	AllowedPaths       []string `json:"allowed_paths"` // Glob patterns
-	MaxExecutionSec    int      `json:"max_execution_sec"`
-	BlockNetworkAccess bool     `json:"block_network_access"`
+	Enabled            *bool     `json:"enabled,omitempty"` // Unset inherits the parent layer's value; unset in every layer is disabled
+	AllowedBinaries    []string  `json:"allowed_binaries"`
+	AllowedPaths       []string  `json:"allowed_paths"` // Glob patterns
+	MaxExecutionSec    int       `json:"max_execution_sec"`
+	BlockNetworkAccess bool      `json:"block_network_access"`
+	DeniedBinaries     []string  `json:"denied_binaries,omitempty"` // Names or glob paths; override allow entries
+	ArgRules           []ArgRule `json:"arg_rules,omitempty"`
+	Consent
+}
+
+// Consent makes jobs of a capability wait for the logged-in user's approval
+type Consent struct {
+	RequireConsent    bool `json:"require_consent,omitempty"`
+	ConsentTimeoutSec int  `json:"consent_timeout_sec,omitempty"` // Default 120; unanswered prompts deny the job
+}
+
+// ArgRule constrains the arguments accepted for a binary. All rules whose
+// Binary matches are applied; a rule with no AllowedArgs and no ArgPatterns
+// only enforces ForbiddenFlags and MaxArgs.
+type ArgRule struct {
+	Binary         string     `json:"binary"`                    // Name or path, matched like allowed_binaries
+	AllowedArgs    [][]string `json:"allowed_args,omitempty"`    // Exact argument vectors
+	ArgPatterns    []string   `json:"arg_patterns,omitempty"`    // Regexes matched against the args joined with NUL (\x00)
+	ForbiddenFlags []string   `json:"forbidden_flags,omitempty"` // "-f", "--flag[=value]", bundled, attached or abbreviated
+	MaxArgs        int        `json:"max_args,omitempty"`        // 0 = unlimited
 }
 
 // ScriptCapability controls script execution
 type ScriptCapability struct {
-	Enabled             bool     `json:"enabled"`
+	Enabled             *bool    `json:"enabled,omitempty"` // Unset inherits the parent layer's value
 	AllowedInterpreters []string `json:"allowed_interpreters"`
 	RequireSignature    bool     `json:"require_signature"`
 	MaxScriptSizeBytes  int      `json:"max_script_size_bytes"`
 	MaxExecutionSec     int      `json:"max_execution_sec"`
+	Consent
 }
 
 // FileCapability controls file operations
@@ -46,6 +80,42 @@ type FileCapability struct {
 	ReadPaths       []string `json:"read_paths"`  // Glob patterns
 	WritePaths      []string `json:"write_paths"` // Glob patterns
 	MaxFileSizeBytes int64   `json:"max_file_size_bytes"`
+
+	// Sandbox restricts exec and script children to ReadPaths/WritePaths
+	// where the kernel supports it (Linux Landlock). Omitted when false so
+	// layers signed before it existed still verify.
+	Sandbox bool `json:"sandbox,omitempty"`
+	// RequireSandbox fails exec and script jobs when the sandbox cannot be
+	// applied instead of running them unrestricted
+	RequireSandbox bool `json:"require_sandbox,omitempty"`
+
+	Consent
+}
+
+// SupportCapability controls hub-triggered support bundles, which collect
+// the agent's own redacted logs, config and state
+type SupportCapability struct {
+	Enabled *bool `json:"enabled,omitempty"` // Unset inherits the parent layer's value
+}
+
+// Bool returns a pointer to v, for the Enabled fields
+func Bool(v bool) *bool {
+	return &v
+}
+
+// IsEnabled reports whether c is present and enabled
+func (c *ExecCapability) IsEnabled() bool {
+	return c != nil && c.Enabled != nil && *c.Enabled
+}
+
+// IsEnabled reports whether c is present and enabled
+func (c *ScriptCapability) IsEnabled() bool {
+	return c != nil && c.Enabled != nil && *c.Enabled
+}
+
+// IsEnabled reports whether c is present and enabled
+func (c *SupportCapability) IsEnabled() bool {
+	return c != nil && c.Enabled != nil && *c.Enabled
 }
 
 // Load parses policy from JSON
@@ -67,6 +137,31 @@ func (p *Policy) Validate() error {
 		return fmt.Errorf("policy expired at %s", p.ExpiresAt)
 	}
 
+	for _, key := range p.Extendable {
+		if !extendableKeys[key] {
+			return fmt.Errorf("extendable: unknown allowlist %q", key)
+		}
+	}
+
+	for i := range p.MaintenanceWindows {
+		if err := p.MaintenanceWindows[i].validate(); err != nil {
+			return fmt.Errorf("maintenance_windows[%d]: %w", i, err)
+		}
+	}
+
+	if exec := p.Capabilities.Exec; exec != nil {
+		for i, rule := range exec.ArgRules {
+			if rule.Binary == "" {
+				return fmt.Errorf("exec.arg_rules[%d]: binary is required", i)
+			}
+			for _, pattern := range rule.ArgPatterns {
+				if _, err := compileArgPattern(pattern); err != nil {
+					return fmt.Errorf("exec.arg_rules[%d]: invalid pattern %q: %w", i, pattern, err)
+				}
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -102,7 +197,7 @@ func DefaultPolicy() *Policy {
 		ExpiresAt: time.Now().Add(365 * 24 * time.Hour),
 		Capabilities: Capabilities{
 			Exec: &ExecCapability{
-				Enabled: true,
+				Enabled: Bool(true),
 				AllowedBinaries: []string{
 					"ipconfig", "whoami", "systeminfo", "hostname",
 					"uname", "df", "ip", "ifconfig", "netstat",
@@ -119,7 +214,7 @@ func DefaultPolicy() *Policy {
 				BlockNetworkAccess: false,
 			},
 			Script: &ScriptCapability{
-				Enabled:             true,
+				Enabled:             Bool(true),
 				AllowedInterpreters: []string{"powershell", "bash", "sh"},
 				RequireSignature:    true,
 				MaxScriptSizeBytes:  1048576, // 1MB
@@ -127,23 +222,43 @@ func DefaultPolicy() *Policy {
 			},
 			File: &FileCapability{
 				ReadPaths: []string{
-					"C:\\Logs\\*",
-					"C:\\ProgramData\\JTNT\\*",
-					"/var/log/*",
-					"/tmp/jtnt/*",
-					"/Library/Logs/*",
+					"C:\\Logs\\**",
+					"C:\\ProgramData\\JTNT\\**",
+					"/var/log/**",
+					"/tmp/jtnt/**",
+					"/Library/Logs/**",
 				},
 				WritePaths: []string{
-					"C:\\Temp\\JTNT\\*",
-					"/tmp/jtnt/*",
-					"/var/tmp/jtnt/*",
+					"C:\\Temp\\JTNT\\**",
+					"/tmp/jtnt/**",
+					"/var/tmp/jtnt/**",
 				},
 				MaxFileSizeBytes: 104857600, // 100MB
 			},
+			Support: &SupportCapability{
+				Enabled: Bool(true),
+			},
 		},
 	}
 }
 
+// DenyAllPolicy returns a policy that enables no capability. The agent runs
+// under it when the signed policy on disk is rejected, so tampering with a
+// layer can never widen what jobs may do.
+func DenyAllPolicy() *Policy {
+	return &Policy{
+		Version:   1,
+		ExpiresAt: time.Now().Add(365 * 24 * time.Hour),
+		Layer:     "deny-all",
+	}
+}
+
+// compileArgPattern compiles an arg_patterns entry anchored to the whole
+// argument string
+func compileArgPattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
 // ToJSON converts policy to JSON
 func (p *Policy) ToJSON() ([]byte, error) {
 	return json.MarshalIndent(p, "", "  ")
@@ -0,0 +1,239 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	// Embedded zone data for hosts without a system database (Windows)
+	_ "time/tzdata"
+)
+
+const (
+	// windowSearchDays bounds how far ahead a window opening is searched
+	windowSearchDays = 370
+
+	// maxWindowIterations bounds the search for a time when all windows
+	// matching a job are open together
+	maxWindowIterations = 64
+)
+
+// ErrOutsideWindow indicates a job can never start under its maintenance windows
+var ErrOutsideWindow = errors.New("no maintenance window available")
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// MaintenanceWindow limits when matching jobs may start. Filters that are
+// set must all match; a window with no filters applies to every job. A job
+// matched by several windows only starts when all of them are open.
+type MaintenanceWindow struct {
+	Name         string   `json:"name,omitempty"`
+	JobTypes     []string `json:"job_types,omitempty"`    // "exec", "script", "download", "upload", "support_bundle"
+	Capabilities []string `json:"capabilities,omitempty"` // "exec", "script", "file", "support"
+	Binaries     []string `json:"binaries,omitempty"`     // Exec binaries, matched like allowed_binaries
+	Timezone     string   `json:"timezone,omitempty"`     // IANA zone, default UTC
+	Days         []string `json:"days,omitempty"`         // "mon".."sun" the window starts on; default every day
+	Start        string   `json:"start"`                  // "HH:MM"
+	End          string   `json:"end"`                    // "HH:MM"; at or before Start wraps past midnight
+	Blackouts    []string `json:"blackouts,omitempty"`    // "YYYY-MM-DD" dates on which the window does not open
+}
+
+// validate checks the window's fields
+func (w *MaintenanceWindow) validate() error {
+	if _, err := w.location(); err != nil {
+		return err
+	}
+	if _, err := parseClock(w.Start); err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	if _, err := parseClock(w.End); err != nil {
+		return fmt.Errorf("end: %w", err)
+	}
+	for _, day := range w.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("invalid day %q", day)
+		}
+	}
+	for _, date := range w.Blackouts {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return fmt.Errorf("invalid blackout date %q", date)
+		}
+	}
+	for _, capability := range w.Capabilities {
+		if capability != "exec" && capability != "script" && capability != "file" && capability != "support" {
+			return fmt.Errorf("invalid capability %q", capability)
+		}
+	}
+	return nil
+}
+
+// applies reports whether the window restricts jobs of jobType running binary
+func (w *MaintenanceWindow) applies(jobType, binary string) bool {
+	if len(w.JobTypes) > 0 && !containsString(w.JobTypes, jobType) {
+		return false
+	}
+	if len(w.Capabilities) > 0 && !containsString(w.Capabilities, capabilityFor(jobType)) {
+		return false
+	}
+	if len(w.Binaries) > 0 && (binary == "" || !AllowsBinary(w.Binaries, binary)) {
+		return false
+	}
+	return true
+}
+
+// nextOpen returns t if the window is open at t, otherwise the next time it
+// opens. It returns false if the window does not open within the search range.
+func (w *MaintenanceWindow) nextOpen(t time.Time) (time.Time, bool) {
+	loc, err := w.location()
+	if err != nil {
+		return time.Time{}, false
+	}
+	start, _ := parseClock(w.Start)
+	end, _ := parseClock(w.End)
+
+	local := t.In(loc)
+
+	// Start a day early so a window that wrapped past midnight is seen
+	for offset := -1; offset <= windowSearchDays; offset++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, loc)
+		if !w.opensOn(day) {
+			continue
+		}
+
+		opens := time.Date(day.Year(), day.Month(), day.Day(), 0, start, 0, 0, loc)
+		closes := time.Date(day.Year(), day.Month(), day.Day(), 0, end, 0, 0, loc)
+		if end <= start {
+			closes = time.Date(day.Year(), day.Month(), day.Day()+1, 0, end, 0, 0, loc)
+		}
+
+		if !local.Before(opens) && local.Before(closes) {
+			return t, true
+		}
+		if opens.After(local) {
+			return opens, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// opensOn reports whether the window opens on the date of day
+func (w *MaintenanceWindow) opensOn(day time.Time) bool {
+	if len(w.Days) > 0 {
+		allowed := false
+		for _, name := range w.Days {
+			if weekdays[strings.ToLower(name)] == day.Weekday() {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+
+	return !containsString(w.Blackouts, day.Format("2006-01-02"))
+}
+
+func (w *MaintenanceWindow) location() (*time.Location, error) {
+	if w.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", w.Timezone, err)
+	}
+	return loc, nil
+}
+
+// parseClock converts "HH:MM" to minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// capabilityFor maps a job type to the capability that governs it
+func capabilityFor(jobType string) string {
+	switch jobType {
+	case "download", "upload":
+		return "file"
+	case "support_bundle":
+		return "support"
+	default:
+		return jobType
+	}
+}
+
+// windowRule names the i-th window for reports
+func windowRule(i int, w *MaintenanceWindow) string {
+	rule := fmt.Sprintf("maintenance_windows[%d]", i)
+	if w.Name != "" {
+		rule += " (" + w.Name + ")"
+	}
+	return rule
+}
+
+// NextStartTime returns the earliest time at or after now at which a job of
+// jobType (running binary, for exec jobs) may start under the policy's
+// maintenance windows, together with the windows that were closed at now.
+// It returns now when no window restricts the job.
+func (e *Enforcer) NextStartTime(jobType, binary string, now time.Time) (time.Time, []string, error) {
+	var applicable []int
+	for i := range e.policy.MaintenanceWindows {
+		if e.policy.MaintenanceWindows[i].applies(jobType, binary) {
+			applicable = append(applicable, i)
+		}
+	}
+	if len(applicable) == 0 {
+		return now, nil, nil
+	}
+
+	var closed []string
+	for _, i := range applicable {
+		w := &e.policy.MaintenanceWindows[i]
+		if next, ok := w.nextOpen(now); !ok || next.After(now) {
+			closed = append(closed, windowRule(i, w))
+		}
+	}
+
+	at := now
+	for iteration := 0; iteration < maxWindowIterations; iteration++ {
+		moved := false
+		for _, i := range applicable {
+			w := &e.policy.MaintenanceWindows[i]
+			next, ok := w.nextOpen(at)
+			if !ok {
+				return time.Time{}, closed, &Violation{
+					Err:    ErrOutsideWindow,
+					Rule:   windowRule(i, w),
+					Detail: fmt.Sprintf("window does not open within %d days", windowSearchDays),
+				}
+			}
+			if next.After(at) {
+				at = next
+				moved = true
+			}
+		}
+		if !moved {
+			return at, closed, nil
+		}
+	}
+
+	return time.Time{}, closed, &Violation{
+		Err:    ErrOutsideWindow,
+		Rule:   strings.Join(closed, ", "),
+		Detail: "matching windows never overlap",
+	}
+}
@@ -0,0 +1,148 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func windowEnforcer(t *testing.T, windows ...MaintenanceWindow) *Enforcer {
+	t.Helper()
+
+	pol := DefaultPolicy()
+	pol.MaintenanceWindows = windows
+
+	enforcer, err := NewEnforcer(pol)
+	if err != nil {
+		t.Fatalf("NewEnforcer() error = %v", err)
+	}
+	return enforcer
+}
+
+func TestNextStartTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enforcer := windowEnforcer(t,
+		MaintenanceWindow{
+			Name:      "nightly",
+			JobTypes:  []string{"exec", "download"},
+			Timezone:  "Europe/Berlin",
+			Days:      []string{"mon", "tue", "wed", "thu", "fri"},
+			Start:     "22:00",
+			End:       "04:00",
+			Blackouts: []string{"2026-12-24"},
+		},
+		MaintenanceWindow{
+			Name:     "reboots",
+			Binaries: []string{"shutdown"},
+			Timezone: "Europe/Berlin",
+			Days:     []string{"sat"},
+			Start:    "02:00",
+			End:      "03:00",
+		},
+	)
+
+	tests := []struct {
+		name    string
+		jobType string
+		binary  string
+		now     time.Time
+		want    time.Time
+	}{
+		{
+			name:    "script jobs are unrestricted",
+			jobType: "script",
+			now:     time.Date(2026, 12, 21, 12, 0, 0, 0, berlin),
+			want:    time.Date(2026, 12, 21, 12, 0, 0, 0, berlin),
+		},
+		{
+			name:    "inside window",
+			jobType: "exec",
+			binary:  "df",
+			now:     time.Date(2026, 12, 21, 23, 0, 0, 0, berlin),
+			want:    time.Date(2026, 12, 21, 23, 0, 0, 0, berlin),
+		},
+		{
+			name:    "after midnight in wrapped window",
+			jobType: "exec",
+			binary:  "df",
+			now:     time.Date(2026, 12, 22, 3, 0, 0, 0, berlin),
+			want:    time.Date(2026, 12, 22, 3, 0, 0, 0, berlin),
+		},
+		{
+			name:    "deferred to evening",
+			jobType: "download",
+			now:     time.Date(2026, 12, 21, 12, 0, 0, 0, berlin),
+			want:    time.Date(2026, 12, 21, 22, 0, 0, 0, berlin),
+		},
+		{
+			name:    "blackout skips to next weekday",
+			jobType: "exec",
+			binary:  "df",
+			now:     time.Date(2026, 12, 24, 12, 0, 0, 0, berlin),
+			want:    time.Date(2026, 12, 25, 22, 0, 0, 0, berlin),
+		},
+		{
+			name:    "weekend skips to monday",
+			jobType: "exec",
+			binary:  "df",
+			now:     time.Date(2026, 12, 26, 12, 0, 0, 0, berlin),
+			want:    time.Date(2026, 12, 28, 22, 0, 0, 0, berlin),
+		},
+		{
+			name:    "both windows must be open",
+			jobType: "exec",
+			binary:  "shutdown",
+			now:     time.Date(2026, 12, 21, 12, 0, 0, 0, berlin),
+			// Saturday 02:00 falls in Friday's nightly window
+			want: time.Date(2026, 12, 26, 2, 0, 0, 0, berlin),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, closed, err := enforcer.NextStartTime(tt.jobType, tt.binary, tt.now)
+			if err != nil {
+				t.Fatalf("NextStartTime() error = %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("NextStartTime() = %v, want %v", got.In(berlin), tt.want)
+			}
+			if got.Equal(tt.now) != (len(closed) == 0) {
+				t.Errorf("closed = %v, want none only when the job can start now", closed)
+			}
+		})
+	}
+}
+
+func TestNextStartTime_NeverOpens(t *testing.T) {
+	enforcer := windowEnforcer(t,
+		MaintenanceWindow{Days: []string{"mon"}, Start: "01:00", End: "02:00"},
+		MaintenanceWindow{Days: []string{"tue"}, Start: "01:00", End: "02:00"},
+	)
+
+	_, _, err := enforcer.NextStartTime("exec", "df", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	if !errors.Is(err, ErrOutsideWindow) {
+		t.Errorf("NextStartTime() error = %v, want ErrOutsideWindow", err)
+	}
+}
+
+func TestValidate_MaintenanceWindows(t *testing.T) {
+	invalid := []MaintenanceWindow{
+		{Start: "25:00", End: "02:00"},
+		{Start: "01:00", End: "02:00", Timezone: "Mars/Olympus"},
+		{Start: "01:00", End: "02:00", Days: []string{"someday"}},
+		{Start: "01:00", End: "02:00", Blackouts: []string{"24.12.2026"}},
+	}
+
+	for _, w := range invalid {
+		pol := DefaultPolicy()
+		pol.MaintenanceWindows = []MaintenanceWindow{w}
+		if err := pol.Validate(); err == nil {
+			t.Errorf("Validate() accepted %+v", w)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// HelperArg is the argv[1] marker that makes the agent binary act as the
+	// sandbox launcher instead of starting normally
+	HelperArg = "__jtnt-sandbox-exec"
+
+	// specEnvVar carries the JSON-encoded Spec from the agent to the launcher
+	specEnvVar = "JTNT_SANDBOX_SPEC"
+)
+
+// Status describes whether a child process ran inside the sandbox
+type Status string
+
+const (
+	StatusEnforced    Status = "enforced"
+	StatusUnavailable Status = "unavailable"
+	StatusDisabled    Status = "disabled"
+)
+
+// ErrUnsupported indicates the platform or kernel cannot sandbox children
+var ErrUnsupported = errors.New("filesystem sandbox not supported")
+
+// Spec describes the filesystem view granted to a sandboxed child
+type Spec struct {
+	ReadPaths  []string `json:"read_paths"`  // Read and execute access
+	WritePaths []string `json:"write_paths"` // Read, write, create and remove access
+}
+
+// Available reports whether children can be sandboxed on this host
+func Available() error {
+	_, err := abiVersion()
+	return err
+}
+
+// ABIVersion returns the kernel sandbox ABI version, or an error when the
+// kernel does not support it
+func ABIVersion() (int, error) {
+	return abiVersion()
+}
+
+// Wrap rewrites cmd so that it is started through the sandbox launcher.
+// The launcher restricts itself to spec and then execs the original binary,
+// so the child (and anything it spawns) inherits the restrictions.
+func Wrap(cmd *exec.Cmd, spec *Spec) error {
+	if err := Available(); err != nil {
+		return err
+	}
+
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate agent binary: %w", err)
+	}
+
+	encoded, err := json.Marshal(spec)
+	if err != nil {
+		return fmt.Errorf("failed to encode sandbox spec: %w", err)
+	}
+
+	// The launcher needs the resolved binary path and the original argv
+	args := append([]string{self, HelperArg, cmd.Path}, cmd.Args...)
+
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(env, specEnvVar+"="+string(encoded))
+	cmd.Path = self
+	cmd.Args = args
+
+	return nil
+}
+
+// RunHelperIfRequested turns the current process into the sandbox launcher
+// when it was started by Wrap. It never returns in that case. Binaries that
+// execute jobs must call it before doing anything else in main.
+func RunHelperIfRequested() {
+	if len(os.Args) < 4 || os.Args[1] != HelperArg {
+		return
+	}
+
+	if err := runHelper(os.Args[2], os.Args[3:]); err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+		os.Exit(126)
+	}
+	os.Exit(127) // unreachable: runHelper execs on success
+}
+
+// helperSpec extracts the Spec from the environment and removes it so the
+// sandboxed child never sees it
+func helperSpec() (*Spec, []string, error) {
+	var spec Spec
+	var env []string
+	found := false
+
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, specEnvVar+"=") {
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(kv, specEnvVar+"=")), &spec); err != nil {
+				return nil, nil, fmt.Errorf("invalid sandbox spec: %w", err)
+			}
+			found = true
+			continue
+		}
+		env = append(env, kv)
+	}
+
+	if !found {
+		return nil, nil, fmt.Errorf("missing sandbox spec")
+	}
+
+	return &spec, env, nil
+}
+
+// RootDirs converts policy glob patterns into the concrete directories a
+// sandbox rule can be attached to. The static prefix of each pattern is used
+// ("/var/log/*" becomes "/var/log"); relative and foreign-OS patterns are
+// dropped.
+func RootDirs(patterns []string) []string {
+	seen := make(map[string]bool)
+	var dirs []string
+
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			continue
+		}
+
+		root := staticPrefix(filepath.Clean(pattern))
+		if root == "" || seen[root] {
+			continue
+		}
+		seen[root] = true
+		dirs = append(dirs, root)
+	}
+
+	return dirs
+}
+
+// staticPrefix returns the leading path components that contain no glob
+// metacharacters
+func staticPrefix(pattern string) string {
+	sep := string(filepath.Separator)
+	parts := strings.Split(pattern, sep)
+
+	var kept []string
+	for _, part := range parts {
+		if strings.ContainsAny(part, "*?[") {
+			break
+		}
+		kept = append(kept, part)
+	}
+
+	prefix := strings.Join(kept, sep)
+	if prefix == "" && strings.HasPrefix(pattern, sep) {
+		return sep
+	}
+	return prefix
+}
@@ -0,0 +1,179 @@
+// +build linux
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Access rights available since Landlock ABI v1
+	accessFSv1 = unix.LANDLOCK_ACCESS_FS_EXECUTE |
+		unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_DIR |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_DIR |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+		unix.LANDLOCK_ACCESS_FS_MAKE_CHAR |
+		unix.LANDLOCK_ACCESS_FS_MAKE_DIR |
+		unix.LANDLOCK_ACCESS_FS_MAKE_REG |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_FIFO |
+		unix.LANDLOCK_ACCESS_FS_MAKE_BLOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SYM
+
+	accessRead = unix.LANDLOCK_ACCESS_FS_EXECUTE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_DIR
+
+	// Rights that may be granted on a non-directory
+	accessFile = unix.LANDLOCK_ACCESS_FS_EXECUTE |
+		unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_TRUNCATE
+)
+
+// systemReadPaths are needed by interpreters and dynamically linked binaries
+var systemReadPaths = []string{
+	"/bin", "/sbin", "/usr", "/lib", "/lib32", "/lib64", "/opt", "/proc", "/sys",
+	"/dev/urandom", "/dev/random",
+}
+
+// systemEtcPaths are the /etc entries that the loader, libc and shells read.
+// /etc as a whole is not granted: it holds the agent's config, enrollment
+// seed and host key, and the machine ID the store key is derived from.
+var systemEtcPaths = []string{
+	"/etc/ld.so.cache", "/etc/ld.so.conf", "/etc/ld.so.conf.d",
+	"/etc/passwd", "/etc/group", "/etc/nsswitch.conf",
+	"/etc/hosts", "/etc/host.conf", "/etc/resolv.conf", "/etc/gai.conf",
+	"/etc/services", "/etc/protocols",
+	"/etc/localtime", "/etc/timezone", "/etc/locale.alias", "/etc/locale.conf",
+	"/etc/profile", "/etc/profile.d", "/etc/bash.bashrc", "/etc/environment", "/etc/inputrc",
+	"/etc/terminfo", "/etc/alternatives", "/etc/os-release", "/etc/lsb-release", "/etc/hostname",
+	"/etc/ssl", "/etc/pki", "/etc/ca-certificates",
+}
+
+// systemWritePaths are device nodes that shells routinely write to
+var systemWritePaths = []string{
+	"/dev/null", "/dev/zero", "/dev/full", "/dev/tty",
+}
+
+func abiVersion() (int, error) {
+	abi, _, errno := syscall.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return 0, fmt.Errorf("%w: landlock unavailable: %v", ErrUnsupported, errno)
+	}
+	return int(abi), nil
+}
+
+// handledAccess returns every filesystem right the running kernel understands
+func handledAccess(abi int) uint64 {
+	access := uint64(accessFSv1)
+	if abi >= 2 {
+		access |= unix.LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi >= 3 {
+		access |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+	return access
+}
+
+func runHelper(binary string, argv []string) error {
+	spec, env, err := helperSpec()
+	if err != nil {
+		return err
+	}
+
+	abi, err := abiVersion()
+	if err != nil {
+		return err
+	}
+
+	// Landlock applies to the calling thread; exec from that same thread so
+	// the new program image inherits the domain.
+	runtime.LockOSThread()
+
+	if err := restrictSelf(abi, spec); err != nil {
+		return err
+	}
+
+	if err := syscall.Exec(binary, argv, env); err != nil {
+		return fmt.Errorf("exec %s: %w", binary, err)
+	}
+	return nil
+}
+
+func restrictSelf(abi int, spec *Spec) error {
+	handled := handledAccess(abi)
+
+	attr := unix.LandlockRulesetAttr{Access_fs: handled}
+	fd, _, errno := syscall.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET,
+		uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("failed to create ruleset: %v", errno)
+	}
+	rulesetFD := int(fd)
+	defer unix.Close(rulesetFD)
+
+	readAccess := uint64(accessRead)
+	readPaths := append(append([]string{}, systemReadPaths...), systemEtcPaths...)
+	for _, path := range append(readPaths, spec.ReadPaths...) {
+		if err := addPathRule(rulesetFD, path, readAccess&handled); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range append(append([]string{}, systemWritePaths...), spec.WritePaths...) {
+		if err := addPathRule(rulesetFD, path, handled); err != nil {
+			return err
+		}
+	}
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set no_new_privs: %w", err)
+	}
+
+	if _, _, errno := syscall.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, uintptr(rulesetFD), 0, 0); errno != 0 {
+		return fmt.Errorf("failed to enforce ruleset: %v", errno)
+	}
+
+	return nil
+}
+
+// addPathRule grants access beneath path. Missing paths are skipped since a
+// policy may list directories that do not exist on every host.
+func addPathRule(rulesetFD int, path string, access uint64) error {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer unix.Close(fd)
+
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+		access &= accessFile
+	}
+
+	rule := unix.LandlockPathBeneathAttr{
+		Allowed_access: access,
+		Parent_fd:      int32(fd),
+	}
+	if _, _, errno := syscall.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(rulesetFD),
+		unix.LANDLOCK_RULE_PATH_BENEATH, uintptr(unsafe.Pointer(&rule)), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("failed to add rule for %s: %v", path, errno)
+	}
+
+	return nil
+}
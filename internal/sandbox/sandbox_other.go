@@ -0,0 +1,13 @@
+// +build !linux
+
+package sandbox
+
+import "fmt"
+
+func abiVersion() (int, error) {
+	return 0, ErrUnsupported
+}
+
+func runHelper(binary string, argv []string) error {
+	return fmt.Errorf("%w on this platform", ErrUnsupported)
+}
@@ -0,0 +1,141 @@
+package sandbox
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// TestMain lets the test binary act as the sandbox launcher, as the agent
+// binaries do
+func TestMain(m *testing.M) {
+	RunHelperIfRequested()
+	os.Exit(m.Run())
+}
+
+func TestRootDirs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix path patterns")
+	}
+
+	patterns := []string{
+		"/var/log/*",
+		"/tmp/jtnt/*",
+		"/tmp/jtnt/**",
+		"/etc/nginx/*.conf",
+		"/opt/app/[ab]/data",
+		"C:\\Logs\\*",
+		"relative/*",
+		"/*",
+	}
+
+	got := RootDirs(patterns)
+	want := []string{"/var/log", "/tmp/jtnt", "/etc/nginx", "/opt/app", "/"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RootDirs() = %v, want %v", got, want)
+	}
+}
+
+func TestWrap_Unsupported(t *testing.T) {
+	if Available() == nil {
+		t.Skip("sandbox supported on this host")
+	}
+
+	cmd := exec.Command("true")
+	path := cmd.Path
+	if err := Wrap(cmd, &Spec{}); err == nil {
+		t.Fatal("Wrap() should fail when the sandbox is unavailable")
+	}
+	if cmd.Path != path {
+		t.Error("Wrap() must not rewrite the command on failure")
+	}
+}
+
+func TestWrap_RewritesCommand(t *testing.T) {
+	if err := Available(); err != nil {
+		t.Skipf("sandbox unavailable: %v", err)
+	}
+
+	cmd := exec.Command("true", "arg")
+	original := cmd.Path
+	if err := Wrap(cmd, &Spec{ReadPaths: []string{"/tmp"}}); err != nil {
+		t.Fatalf("Wrap() error = %v", err)
+	}
+
+	if len(cmd.Args) != 5 || cmd.Args[1] != HelperArg || cmd.Args[2] != original {
+		t.Errorf("unexpected wrapped args: %v", cmd.Args)
+	}
+}
+
+func TestWrap_DeniesReadsOutsideReadPaths(t *testing.T) {
+	if err := Available(); err != nil {
+		t.Skipf("sandbox unavailable: %v", err)
+	}
+	cat, err := exec.LookPath("cat")
+	if err != nil {
+		t.Skip("cat not found")
+	}
+
+	dir := t.TempDir()
+	allowed := filepath.Join(dir, "allowed")
+	denied := filepath.Join(dir, "denied")
+	for _, d := range []string{allowed, denied} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(d, "file"), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := func(path string) error {
+		cmd := exec.Command(cat, path)
+		if err := Wrap(cmd, &Spec{ReadPaths: []string{allowed}}); err != nil {
+			t.Fatalf("Wrap() error = %v", err)
+		}
+		return cmd.Run()
+	}
+
+	if err := run(filepath.Join(allowed, "file")); err != nil {
+		t.Errorf("reading inside ReadPaths failed: %v", err)
+	}
+	if err := run(filepath.Join(denied, "file")); err == nil {
+		t.Error("reading outside ReadPaths succeeded in the sandbox")
+	}
+}
+
+func TestWrap_SystemPaths(t *testing.T) {
+	if err := Available(); err != nil {
+		t.Skipf("sandbox unavailable: %v", err)
+	}
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not found")
+	}
+
+	tmpDir := t.TempDir()
+	run := func(script string) error {
+		cmd := exec.Command(bash, "-c", script)
+		if err := Wrap(cmd, &Spec{WritePaths: []string{tmpDir}}); err != nil {
+			t.Fatalf("Wrap() error = %v", err)
+		}
+		cmd.Env = append(cmd.Env, "TMPDIR="+tmpDir)
+		return cmd.Run()
+	}
+
+	if err := run("head -c 16 /dev/urandom >/dev/null"); err != nil {
+		t.Errorf("reading /dev/urandom failed: %v", err)
+	}
+	if err := run("cat >/dev/null <<END\nhere-doc\nEND"); err != nil {
+		t.Errorf("here-document in TMPDIR failed: %v", err)
+	}
+	if _, err := os.Stat("/etc/machine-id"); err == nil {
+		if err := run("cat /etc/machine-id"); err == nil {
+			t.Error("reading /etc/machine-id succeeded in the sandbox")
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+// ErrNoMemoryFS indicates no memory-backed directory is available for file
+// secrets
+var ErrNoMemoryFS = errors.New("no memory-backed filesystem for secret files")
+
+// baseDir returns the memory-backed directory file secrets are written
+// under; replaced in tests
+var baseDir = Dir
+
+// Delivery is a job's secrets prepared for its process
+type Delivery struct {
+	// Env holds NAME=value for env secrets and NAME_FILE=path for file
+	// secrets, to add to the process environment
+	Env []string
+
+	// Dir holds the job's secret files, empty when there are none. The
+	// process must be able to read it.
+	Dir string
+
+	values []string
+	files  []string
+}
+
+// Prepare writes file secrets to a new directory readable only by the
+// agent's user and builds the environment for the rest
+func Prepare(list []api.JobSecret) (*Delivery, error) {
+	d := &Delivery{}
+
+	for _, secret := range list {
+		d.values = append(d.values, secret.Value)
+
+		if secret.Target != api.SecretTargetFile {
+			d.Env = append(d.Env, secret.Name+"="+secret.Value)
+			continue
+		}
+
+		if d.Dir == "" {
+			base, err := baseDir()
+			if err != nil {
+				return nil, fmt.Errorf("cannot deliver secret %s as a file: %w", secret.Name, err)
+			}
+			if d.Dir, err = os.MkdirTemp(base, "job-"); err != nil {
+				return nil, fmt.Errorf("failed to create secret directory: %w", err)
+			}
+		}
+
+		path := filepath.Join(d.Dir, secret.Name)
+		if err := writeSecret(path, secret.Value); err != nil {
+			d.Wipe()
+			return nil, fmt.Errorf("failed to write secret %s: %w", secret.Name, err)
+		}
+		d.files = append(d.files, path)
+		d.Env = append(d.Env, secret.Name+"_FILE="+path)
+	}
+
+	return d, nil
+}
+
+// writeSecret writes value to a new file with mode 0400
+func writeSecret(path, value string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0400)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(value); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Values returns the secret values, to mask in logs and output
+func (d *Delivery) Values() []string {
+	return d.values
+}
+
+// Wipe overwrites and removes the secret files and drops the delivery's
+// copies of the values. The process environment is gone with the process.
+func (d *Delivery) Wipe() error {
+	var errs []string
+	for _, path := range d.files {
+		if err := overwrite(path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err.Error())
+		}
+	}
+	if d.Dir != "" {
+		if err := os.RemoveAll(d.Dir); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	d.Env = nil
+	d.values = nil
+	d.files = nil
+	d.Dir = ""
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to wipe secrets: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// overwrite replaces the contents of path with zeros
+func overwrite(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(make([]byte, info.Size())); err != nil {
+		return err
+	}
+	return file.Sync()
+}
@@ -0,0 +1,30 @@
+// +build linux
+
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+)
+
+// Dir returns a memory-backed directory for secret files: the runtime
+// directory when it is on tmpfs, as /run is, or /dev/shm
+func Dir() (string, error) {
+	for _, dir := range []string{
+		filepath.Join(config.GetRuntimeDir(), "secrets"),
+		"/dev/shm/jtnt-agent-secrets",
+	} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			continue
+		}
+		var fs unix.Statfs_t
+		if err := unix.Statfs(dir, &fs); err == nil && fs.Type == unix.TMPFS_MAGIC {
+			return dir, nil
+		}
+	}
+	return "", ErrNoMemoryFS
+}
@@ -0,0 +1,10 @@
+// +build !linux
+
+package secrets
+
+// Dir returns a memory-backed directory for secret files. Only Linux
+// provides one the agent can rely on, so elsewhere secrets are delivered as
+// environment variables only.
+func Dir() (string, error) {
+	return "", ErrNoMemoryFS
+}
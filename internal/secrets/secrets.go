@@ -0,0 +1,189 @@
+// Package secrets opens the per-job secrets the hub encrypts to the agent
+// and hands them to the job's process. Secrets are decrypted only when the
+// job runs, delivered as environment variables or memory-backed files, and
+// wiped when it finishes.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+const (
+	// Algorithm is the only envelope algorithm supported
+	Algorithm = "x25519-hkdf-sha256-aes256gcm"
+
+	// hkdfInfo separates these keys from any other use of the shared secret
+	hkdfInfo = "jtnt-agent job secrets v1"
+)
+
+// validName matches secret names usable as environment variables and file
+// names
+var validName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// DeriveKey returns the X25519 key job secrets are encrypted to. It is
+// derived from the agent's Ed25519 key the way RFC 8032 derives the signing
+// scalar, so its public key is the Montgomery form of the enrolled Ed25519
+// public key and a hub can compute it from either.
+func DeriveKey(priv ed25519.PrivateKey) (*ecdh.PrivateKey, error) {
+	h := sha512.Sum512(priv.Seed())
+	return ecdh.X25519().NewPrivateKey(h[:32])
+}
+
+// PublicKeyBase64 returns the base64 X25519 public key for priv
+func PublicKeyBase64(priv ed25519.PrivateKey) (string, error) {
+	key, err := DeriveKey(priv)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}
+
+// Seal encrypts secrets for the agent holding the private key of recipient,
+// bound to jobID. The hub does the same to deliver secrets.
+func Seal(recipient *ecdh.PublicKey, jobID string, list []api.JobSecret) (*api.SecretEnvelope, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(shared, ephemeral.PublicKey(), recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return &api.SecretEnvelope{
+		Algorithm:    Algorithm,
+		EphemeralKey: base64.StdEncoding.EncodeToString(ephemeral.PublicKey().Bytes()),
+		Nonce:        base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext:   base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, plaintext, []byte(jobID))),
+	}, nil
+}
+
+// Open decrypts the secrets of job jobID and validates them
+func Open(key *ecdh.PrivateKey, jobID string, envelope *api.SecretEnvelope) ([]api.JobSecret, error) {
+	if envelope.Algorithm != Algorithm {
+		return nil, fmt.Errorf("unsupported secret algorithm %q", envelope.Algorithm)
+	}
+
+	ephemeralKey, err := base64.StdEncoding.DecodeString(envelope.EphemeralKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral key: %w", err)
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(ephemeralKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral key: %w", err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(envelope.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(envelope.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext: %w", err)
+	}
+
+	// Fails for low-order points, which would give a known shared secret
+	shared, err := key.ECDH(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral key: %w", err)
+	}
+
+	aead, err := newAEAD(shared, ephemeral, key.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size %d", len(nonce))
+	}
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(jobID))
+	if err != nil {
+		return nil, fmt.Errorf("secrets were not encrypted to this agent for job %s", jobID)
+	}
+	defer wipe(plaintext)
+
+	var list []api.JobSecret
+	if err := json.Unmarshal(plaintext, &list); err != nil {
+		return nil, fmt.Errorf("invalid secrets: %w", err)
+	}
+	if err := validate(list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// validate checks names and targets and rejects duplicates
+func validate(list []api.JobSecret) error {
+	seen := make(map[string]bool, len(list))
+	for _, secret := range list {
+		if !validName.MatchString(secret.Name) {
+			return fmt.Errorf("invalid secret name %q", secret.Name)
+		}
+		switch secret.Target {
+		case "", api.SecretTargetEnv, api.SecretTargetFile:
+		default:
+			return fmt.Errorf("secret %s has unknown target %q", secret.Name, secret.Target)
+		}
+		if seen[secret.Name] {
+			return fmt.Errorf("duplicate secret %s", secret.Name)
+		}
+		seen[secret.Name] = true
+	}
+	return nil
+}
+
+// newAEAD derives the envelope key with HKDF-SHA256 (RFC 5869), salted
+// with both public keys
+func newAEAD(shared []byte, ephemeral, recipient *ecdh.PublicKey) (cipher.AEAD, error) {
+	salt := append(ephemeral.Bytes(), recipient.Bytes()...)
+
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(shared)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write([]byte(hkdfInfo))
+	expand.Write([]byte{1})
+	key := expand.Sum(nil)
+	defer wipe(key)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// wipe zeroes b
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,160 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+func testKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv
+}
+
+// montgomery converts an Ed25519 public key to its X25519 form,
+// u = (1 + y) / (1 - y) mod 2^255 - 19, as a hub holding only the enrolled
+// key would
+func montgomery(pub ed25519.PublicKey) []byte {
+	p := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+	le := append([]byte(nil), pub...)
+	le[31] &= 0x7f
+	for i, j := 0, len(le)-1; i < j; i, j = i+1, j-1 {
+		le[i], le[j] = le[j], le[i]
+	}
+	y := new(big.Int).SetBytes(le)
+
+	num := new(big.Int).Add(big.NewInt(1), y)
+	den := new(big.Int).Sub(big.NewInt(1), y)
+	den.Mod(den, p).ModInverse(den, p)
+	u := num.Mul(num, den).Mod(num, p).Bytes()
+
+	out := make([]byte, 32)
+	for i, b := range u {
+		out[len(u)-1-i] = b
+	}
+	return out
+}
+
+func TestDeriveKey_MatchesEnrolledPublicKey(t *testing.T) {
+	priv := testKey(t)
+	key, err := DeriveKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := montgomery(priv.Public().(ed25519.PublicKey))
+	if !bytes.Equal(key.PublicKey().Bytes(), want) {
+		t.Errorf("derived public key %x, want %x", key.PublicKey().Bytes(), want)
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	key, _ := DeriveKey(testKey(t))
+	list := []api.JobSecret{
+		{Name: "DB_PASSWORD", Value: "hunter22"},
+		{Name: "TLS_KEY", Value: "key-material", Target: api.SecretTargetFile},
+	}
+
+	envelope, err := Seal(key.PublicKey(), "job-1", list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(envelope.Ciphertext, "hunter22") {
+		t.Fatal("envelope holds the secret in the clear")
+	}
+
+	got, err := Open(key, "job-1", envelope)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Value != "hunter22" || got[1].Target != api.SecretTargetFile {
+		t.Errorf("Open() = %+v", got)
+	}
+
+	// Bound to the job and the agent
+	if _, err := Open(key, "job-2", envelope); err == nil {
+		t.Error("Open() accepted the envelope of another job")
+	}
+	other, _ := DeriveKey(testKey(t))
+	if _, err := Open(other, "job-1", envelope); err == nil {
+		t.Error("Open() accepted an envelope for another agent")
+	}
+}
+
+func TestOpen_RejectsInvalidSecrets(t *testing.T) {
+	key, _ := DeriveKey(testKey(t))
+	for _, list := range [][]api.JobSecret{
+		{{Name: "BAD NAME", Value: "x"}},
+		{{Name: "../etc/passwd", Value: "x", Target: api.SecretTargetFile}},
+		{{Name: "A", Value: "x", Target: "registry"}},
+		{{Name: "A", Value: "x"}, {Name: "A", Value: "y"}},
+	} {
+		envelope, _ := Seal(key.PublicKey(), "job-1", list)
+		if _, err := Open(key, "job-1", envelope); err == nil {
+			t.Errorf("Open() accepted %+v", list)
+		}
+	}
+}
+
+func TestPrepare_WritesAndWipesFiles(t *testing.T) {
+	base := t.TempDir()
+	baseDir = func() (string, error) { return base, nil }
+	defer func() { baseDir = Dir }()
+
+	d, err := Prepare([]api.JobSecret{
+		{Name: "API_TOKEN", Value: "tok-123456"},
+		{Name: "TLS_KEY", Value: "key-material", Target: api.SecretTargetFile},
+	})
+	if err != nil {
+		t.Fatalf("Prepare() error = %v", err)
+	}
+
+	path := filepath.Join(d.Dir, "TLS_KEY")
+	if d.Env[0] != "API_TOKEN=tok-123456" || d.Env[1] != "TLS_KEY_FILE="+path {
+		t.Errorf("Env = %v", d.Env)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0400 {
+		t.Errorf("secret file mode = %v, want 0400", info.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(path); string(data) != "key-material" {
+		t.Errorf("secret file holds %q", data)
+	}
+
+	dir := d.Dir
+	if err := d.Wipe(); err != nil {
+		t.Fatalf("Wipe() error = %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("secret directory left after Wipe()")
+	}
+	if d.Env != nil || d.Values() != nil {
+		t.Error("Wipe() kept the values")
+	}
+}
+
+func TestPrepare_FileWithoutMemoryFS(t *testing.T) {
+	baseDir = func() (string, error) { return "", ErrNoMemoryFS }
+	defer func() { baseDir = Dir }()
+
+	if _, err := Prepare([]api.JobSecret{{Name: "K", Value: "v", Target: api.SecretTargetFile}}); err == nil {
+		t.Error("Prepare() wrote a file secret without a memory-backed directory")
+	}
+	if _, err := Prepare([]api.JobSecret{{Name: "K", Value: "v"}}); err != nil {
+		t.Errorf("Prepare() env secret error = %v", err)
+	}
+}
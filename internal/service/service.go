@@ -0,0 +1,91 @@
+package service
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Name returns the name the daemon is installed under on this platform
+func Name() string {
+	switch runtime.GOOS {
+	case "windows":
+		return "JTNTAgent"
+	case "darwin":
+		return "us.jtnt.agentd"
+	default:
+		return "jtnt-agentd"
+	}
+}
+
+// launchdPlist is where the macOS package installs the daemon's job
+const launchdPlist = "/Library/LaunchDaemons/us.jtnt.agentd.plist"
+
+// Stop stops the installed daemon. Stopping a daemon that is not running
+// is not an error.
+func Stop() error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "linux":
+		// Try systemd first
+		cmd = exec.Command("systemctl", "stop", Name())
+		if err := cmd.Run(); err != nil {
+			// Try init.d
+			cmd = exec.Command("service", Name(), "stop")
+			return run(cmd)
+		}
+		return nil
+
+	case "darwin":
+		// Unload the job, otherwise launchd restarts it; fails if not loaded
+		cmd = exec.Command("launchctl", "bootout", "system/"+Name())
+		cmd.Run()
+		return nil
+
+	case "windows":
+		cmd = exec.Command("sc", "stop", Name())
+		cmd.Run() // Ignore errors - service might not be running
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported platform for service stop: %s", runtime.GOOS)
+	}
+}
+
+// Start starts the installed daemon
+func Start() error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "linux":
+		cmd = exec.Command("systemctl", "start", Name())
+		if err := cmd.Run(); err != nil {
+			cmd = exec.Command("service", Name(), "start")
+			return run(cmd)
+		}
+		return nil
+
+	case "darwin":
+		cmd = exec.Command("launchctl", "bootstrap", "system", launchdPlist)
+		return run(cmd)
+
+	case "windows":
+		cmd = exec.Command("sc", "start", Name())
+		return run(cmd)
+
+	default:
+		return fmt.Errorf("unsupported platform for service start: %s", runtime.GOOS)
+	}
+}
+
+func run(cmd *exec.Cmd) error {
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if output := strings.TrimSpace(string(output)); output != "" {
+			return fmt.Errorf("%s: %w: %s", cmd.Args[0], err, output)
+		}
+		return fmt.Errorf("%s: %w", cmd.Args[0], err)
+	}
+	return nil
+}
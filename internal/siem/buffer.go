@@ -0,0 +1,190 @@
+package siem
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// BufferFile holds messages waiting for the collector
+const BufferFile = "buffer.log"
+
+// ErrBufferFull is returned when a message does not fit in the buffer
+var ErrBufferFull = errors.New("syslog buffer full")
+
+// buffer is a disk queue of messages. Each record is the message length,
+// a space, the message and a newline, so messages may contain newlines.
+// It is used from one goroutine.
+type buffer struct {
+	path     string
+	maxBytes int64
+	size     int64
+	count    int
+}
+
+// openBuffer opens the buffer in dir, counting the messages left by a
+// previous run
+func openBuffer(dir string, maxBytes int64) (*buffer, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create buffer directory: %w", err)
+	}
+
+	b := &buffer{path: filepath.Join(dir, BufferFile), maxBytes: maxBytes}
+
+	f, err := os.Open(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open buffer: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		msg, err := readRecord(r)
+		if err != nil {
+			break
+		}
+		b.count++
+		b.size += recordSize(msg)
+	}
+
+	// Cut off a record torn by a crash
+	if info, err := f.Stat(); err == nil && info.Size() != b.size {
+		if err := os.Truncate(b.path, b.size); err != nil {
+			return nil, fmt.Errorf("failed to repair buffer: %w", err)
+		}
+	}
+
+	return b, nil
+}
+
+// Len returns the number of buffered messages
+func (b *buffer) Len() int {
+	return b.count
+}
+
+// Append adds msg to the end of the buffer
+func (b *buffer) Append(msg []byte) error {
+	if b.size+recordSize(msg) > b.maxBytes {
+		return ErrBufferFull
+	}
+
+	f, err := os.OpenFile(b.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%d %s\n", len(msg), msg)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	b.count++
+	b.size += recordSize(msg)
+	return nil
+}
+
+// Replay passes buffered messages to send in order. Messages sent are
+// removed; on the first error the rest stay buffered and the error is
+// returned.
+func (b *buffer) Replay(send func(msg []byte) error) error {
+	if b.count == 0 {
+		return nil
+	}
+
+	f, err := os.Open(b.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var sent int64
+	for {
+		msg, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("corrupt buffer: %w", err)
+		}
+
+		if err := send(msg); err != nil {
+			if sent > 0 {
+				if dropErr := b.dropFront(f, sent); dropErr != nil {
+					return dropErr
+				}
+			}
+			return err
+		}
+		sent += recordSize(msg)
+		b.count--
+	}
+
+	b.count, b.size = 0, 0
+	return os.Remove(b.path)
+}
+
+// dropFront rewrites the buffer without its first n bytes
+func (b *buffer) dropFront(f *os.File, n int64) error {
+	if _, err := f.Seek(n, io.SeekStart); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(b.path), "."+BufferFile+".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, f)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), b.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to rewrite buffer: %w", err)
+	}
+
+	b.size -= n
+	return nil
+}
+
+// readRecord reads one length-prefixed record
+func readRecord(r *bufio.Reader) ([]byte, error) {
+	prefix, err := r.ReadString(' ')
+	if err != nil {
+		if err == io.EOF && prefix == "" {
+			return nil, io.EOF
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	n, err := strconv.Atoi(prefix[:len(prefix)-1])
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid record length %q", prefix)
+	}
+
+	record := make([]byte, n+1)
+	if _, err := io.ReadFull(r, record); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if record[n] != '\n' {
+		return nil, fmt.Errorf("record not terminated")
+	}
+	return record[:n], nil
+}
+
+// recordSize is the size of msg as stored
+func recordSize(msg []byte) int64 {
+	return int64(len(strconv.Itoa(len(msg))) + 1 + len(msg) + 1)
+}
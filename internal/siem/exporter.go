@@ -0,0 +1,371 @@
+package siem
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/audit"
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/retry"
+)
+
+const (
+	ProtocolUDP = "udp"
+	ProtocolTCP = "tcp"
+	ProtocolTLS = "tls"
+
+	defaultFacility = "local0"
+	defaultLogLevel = "warn"
+	defaultBufferMB = 64
+
+	queueSize    = 1024
+	dialTimeout  = 10 * time.Second
+	writeTimeout = 10 * time.Second
+
+	// component is the log component of the exporter itself; its events
+	// are not exported, so a failing collector does not feed itself
+	component = "siem"
+)
+
+// Options configures an exporter
+type Options struct {
+	// Dir holds the disk buffer; default Dir()
+	Dir string
+
+	// Version is the agent version reported in CEF records
+	Version string
+
+	// Retry paces reconnection while the collector is unreachable;
+	// default retry.DefaultConfig()
+	Retry *retry.Config
+
+	// OnStatus is called when the connection state or buffer changes
+	OnStatus func(Status)
+}
+
+// Status describes delivery to the collector
+type Status struct {
+	Connected bool   `json:"connected"`
+	Buffered  int    `json:"buffered"`
+	Dropped   uint64 `json:"dropped"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Exporter sends events to a syslog collector. Export queues an event
+// without blocking; Run delivers the queue, falling back to the disk buffer
+// while the collector is unreachable and replaying it in order once it is
+// back.
+type Exporter struct {
+	settings  config.SyslogConfig
+	opts      Options
+	formatter *formatter
+	minLevel  Severity
+	tlsConfig *tls.Config
+	queue     chan []byte
+
+	// Owned by Run, and by Close once Run has returned
+	buffer *buffer
+	conn   net.Conn
+
+	mu     sync.Mutex
+	status Status
+}
+
+// NewExporter validates settings and opens the disk buffer
+func NewExporter(settings config.SyslogConfig, opts Options) (*Exporter, error) {
+	if opts.Dir == "" {
+		opts.Dir = Dir()
+	}
+	if opts.Retry == nil {
+		opts.Retry = retry.DefaultConfig()
+	}
+	if settings.Protocol == "" {
+		settings.Protocol = ProtocolTCP
+	}
+	if settings.Format == "" {
+		settings.Format = FormatRFC5424
+	}
+	if settings.Facility == "" {
+		settings.Facility = defaultFacility
+	}
+	if settings.LogLevel == "" {
+		settings.LogLevel = defaultLogLevel
+	}
+	if settings.BufferMB <= 0 {
+		settings.BufferMB = defaultBufferMB
+	}
+
+	host, _, err := net.SplitHostPort(settings.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog address %q: %w", settings.Address, err)
+	}
+
+	facility, ok := facilities[settings.Facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", settings.Facility)
+	}
+
+	switch settings.Format {
+	case FormatRFC5424, FormatCEF:
+	default:
+		return nil, fmt.Errorf("unknown syslog format %q, want %s or %s", settings.Format, FormatRFC5424, FormatCEF)
+	}
+
+	e := &Exporter{
+		settings: settings,
+		opts:     opts,
+		queue:    make(chan []byte, queueSize),
+	}
+
+	if settings.LogLevel == "none" {
+		e.minLevel = -1
+	} else if e.minLevel, ok = logLevels[settings.LogLevel]; !ok {
+		return nil, fmt.Errorf("unknown syslog log_level %q", settings.LogLevel)
+	}
+
+	switch settings.Protocol {
+	case ProtocolUDP, ProtocolTCP:
+	case ProtocolTLS:
+		if e.tlsConfig, err = tlsConfig(settings, host); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown syslog protocol %q, want %s, %s or %s", settings.Protocol, ProtocolUDP, ProtocolTCP, ProtocolTLS)
+	}
+
+	hostname, _ := os.Hostname()
+	e.formatter = &formatter{
+		format:   settings.Format,
+		facility: facility,
+		hostname: hostname,
+		procID:   strconv.Itoa(os.Getpid()),
+		version:  opts.Version,
+	}
+
+	e.buffer, err = openBuffer(opts.Dir, int64(settings.BufferMB)<<20)
+	if err != nil {
+		return nil, err
+	}
+	e.status.Buffered = e.buffer.Len()
+
+	return e, nil
+}
+
+// tlsConfig builds the client TLS configuration for the collector
+func tlsConfig(settings config.SyslogConfig, host string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName: host,
+		MinVersion: tls.VersionTLS12,
+	}
+	if settings.ServerName != "" {
+		cfg.ServerName = settings.ServerName
+	}
+
+	if settings.CAFile != "" {
+		pem, err := os.ReadFile(settings.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read syslog CA file: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in syslog CA file %s", settings.CAFile)
+		}
+	}
+
+	if settings.CertFile != "" || settings.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load syslog client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// Export queues event for delivery. It never blocks; when the queue is
+// full the event is dropped and counted.
+func (e *Exporter) Export(event *Event) {
+	select {
+	case e.queue <- e.formatter.message(event):
+	default:
+		e.updateStatus(func(s *Status) { s.Dropped++ })
+	}
+}
+
+// ExportAudit queues a signed audit entry
+func (e *Exporter) ExportAudit(entry *audit.Entry, line []byte) {
+	e.Export(AuditEvent(entry, line))
+}
+
+// ExportLog queues an agent log event at or above the configured level
+func (e *Exporter) ExportLog(level, comp, message string, fields map[string]interface{}) {
+	if comp == component {
+		return
+	}
+	event := LogEvent(level, comp, message, fields)
+	if event == nil || event.Severity > e.minLevel {
+		return
+	}
+	e.Export(event)
+}
+
+// Status returns the current delivery status
+func (e *Exporter) Status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.status
+}
+
+// Run delivers queued events until ctx is cancelled
+func (e *Exporter) Run(ctx context.Context) {
+	backoff := retry.NewBackoff(e.opts.Retry)
+
+	// Messages left by the previous run go first
+	var reconnect <-chan time.Time
+	if e.buffer.Len() > 0 {
+		reconnect = time.After(0)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			e.disconnect()
+			return
+
+		case msg := <-e.queue:
+			// Keep order: nothing overtakes the buffer
+			if reconnect != nil {
+				e.spill(msg)
+				continue
+			}
+			if err := e.send(msg); err != nil {
+				e.spill(msg)
+				e.setDown(err)
+				reconnect = time.After(backoff.Next())
+			}
+
+		case <-reconnect:
+			err := e.buffer.Replay(e.send)
+			e.updateStatus(func(s *Status) { s.Buffered = e.buffer.Len() })
+			if err != nil {
+				e.setDown(err)
+				reconnect = time.After(backoff.Next())
+				continue
+			}
+			backoff.Reset()
+			reconnect = nil
+			e.updateStatus(func(s *Status) {
+				s.Connected = true
+				s.LastError = ""
+			})
+		}
+	}
+}
+
+// Close moves events still queued to the disk buffer, so they are sent
+// after a restart. Call it after Run has returned.
+func (e *Exporter) Close() {
+	for {
+		select {
+		case msg := <-e.queue:
+			e.spill(msg)
+		default:
+			e.disconnect()
+			return
+		}
+	}
+}
+
+// send writes one message, connecting first if needed. TCP and TLS use
+// octet-counting framing (RFC 6587, RFC 5425).
+func (e *Exporter) send(msg []byte) error {
+	if e.conn == nil {
+		conn, err := e.dial()
+		if err != nil {
+			return err
+		}
+		e.conn = conn
+	}
+
+	frame := msg
+	if e.settings.Protocol != ProtocolUDP {
+		frame = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+
+	e.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := e.conn.Write(frame); err != nil {
+		e.disconnect()
+		return fmt.Errorf("failed to send to %s: %w", e.settings.Address, err)
+	}
+
+	e.mu.Lock()
+	connected := e.status.Connected
+	e.mu.Unlock()
+	if !connected {
+		e.updateStatus(func(s *Status) { s.Connected = true })
+	}
+	return nil
+}
+
+func (e *Exporter) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	var conn net.Conn
+	var err error
+	switch e.settings.Protocol {
+	case ProtocolTLS:
+		conn, err = tls.DialWithDialer(dialer, "tcp", e.settings.Address, e.tlsConfig)
+	default:
+		conn, err = dialer.Dial(e.settings.Protocol, e.settings.Address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", e.settings.Address, err)
+	}
+	return conn, nil
+}
+
+func (e *Exporter) disconnect() {
+	if e.conn != nil {
+		e.conn.Close()
+		e.conn = nil
+	}
+}
+
+// spill buffers msg on disk, counting it as dropped if the buffer is full
+func (e *Exporter) spill(msg []byte) {
+	err := e.buffer.Append(msg)
+	e.updateStatus(func(s *Status) {
+		s.Buffered = e.buffer.Len()
+		if err != nil {
+			s.Dropped++
+			s.LastError = err.Error()
+		}
+	})
+}
+
+func (e *Exporter) setDown(err error) {
+	e.updateStatus(func(s *Status) {
+		s.Connected = false
+		s.LastError = err.Error()
+	})
+}
+
+// updateStatus applies fn to the status and reports the result
+func (e *Exporter) updateStatus(fn func(*Status)) {
+	e.mu.Lock()
+	fn(&e.status)
+	status := e.status
+	e.mu.Unlock()
+
+	if e.opts.OnStatus != nil {
+		e.opts.OnStatus(status)
+	}
+}
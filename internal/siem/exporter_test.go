@@ -0,0 +1,226 @@
+package siem
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/retry"
+)
+
+// collector accepts octet-counted syslog messages over TCP
+type collector struct {
+	listener net.Listener
+	messages chan string
+}
+
+func newCollector(t *testing.T, addr string) *collector {
+	t.Helper()
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &collector{listener: listener, messages: make(chan string, 100)}
+	go c.serve()
+	t.Cleanup(func() { listener.Close() })
+	return c
+}
+
+func (c *collector) serve() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			for {
+				prefix, err := r.ReadString(' ')
+				if err != nil {
+					return
+				}
+				n, _ := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+				msg := make([]byte, n)
+				if _, err := io.ReadFull(r, msg); err != nil {
+					return
+				}
+				c.messages <- string(msg)
+			}
+		}()
+	}
+}
+
+func (c *collector) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case msg := <-c.messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return ""
+	}
+}
+
+func newTestExporter(t *testing.T, addr, dir string) *Exporter {
+	t.Helper()
+	e, err := NewExporter(config.SyslogConfig{Address: addr, LogLevel: "info"}, Options{
+		Dir:   dir,
+		Retry: &retry.Config{InitialDelay: 20 * time.Millisecond, MaxDelay: 50 * time.Millisecond, Multiplier: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewExporter() error = %v", err)
+	}
+	return e
+}
+
+// freeAddr returns a local TCP address nothing listens on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestExporter_DeliversOverTCP(t *testing.T) {
+	c := newCollector(t, "127.0.0.1:0")
+	e := newTestExporter(t, c.listener.Addr().String(), t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+
+	e.ExportLog("warn", "jobs", "job failed", map[string]interface{}{"job_id": "job-1"})
+	e.ExportLog("debug", "jobs", "below the configured level", nil)
+	e.ExportLog("error", component, "the exporter's own events are not exported", nil)
+	e.ExportLog("info", "agent", "last", nil)
+
+	if msg := c.next(t); !strings.Contains(msg, `[jtnt@32473 component="jobs" job_id="job-1"] job failed`) {
+		t.Errorf("first message = %s", msg)
+	}
+	if msg := c.next(t); !strings.HasSuffix(msg, "] last") {
+		t.Errorf("second message = %s, want the info event", msg)
+	}
+}
+
+func TestExporter_BuffersUntilCollectorReturns(t *testing.T) {
+	addr := freeAddr(t)
+	dir := t.TempDir()
+	e := newTestExporter(t, addr, dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+
+	for i := 0; i < 3; i++ {
+		e.ExportLog("warn", "agent", fmt.Sprintf("event %d", i), nil)
+	}
+	waitFor(t, func() bool { return e.Status().Buffered == 3 })
+
+	// A restart keeps the buffer; a queued event is moved to it by Close
+	cancel()
+	<-done
+	e.ExportLog("warn", "agent", "event 3", nil)
+	e.Close()
+
+	c := newCollector(t, addr)
+	e = newTestExporter(t, addr, dir)
+	if e.Status().Buffered != 4 {
+		t.Fatalf("Buffered after restart = %d, want 4", e.Status().Buffered)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+
+	for i := 0; i < 4; i++ {
+		if msg := c.next(t); !strings.HasSuffix(msg, fmt.Sprintf("event %d", i)) {
+			t.Errorf("message %d = %s", i, msg)
+		}
+	}
+	waitFor(t, func() bool { return e.Status().Buffered == 0 && e.Status().Connected })
+}
+
+func TestBuffer_ReplayKeepsUnsent(t *testing.T) {
+	b, err := openBuffer(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"one", "two\nlines", "three"} {
+		if err := b.Append([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var sent []string
+	err = b.Replay(func(msg []byte) error {
+		if len(sent) == 2 {
+			return fmt.Errorf("collector gone")
+		}
+		sent = append(sent, string(msg))
+		return nil
+	})
+	if err == nil || b.Len() != 1 || sent[1] != "two\nlines" {
+		t.Fatalf("Replay() error = %v, Len() = %d, sent = %q", err, b.Len(), sent)
+	}
+
+	sent = nil
+	if err := b.Replay(func(msg []byte) error { sent = append(sent, string(msg)); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 || sent[0] != "three" || b.Len() != 0 {
+		t.Errorf("second Replay() sent %q, Len() = %d", sent, b.Len())
+	}
+}
+
+func TestBuffer_Full(t *testing.T) {
+	b, err := openBuffer(t.TempDir(), 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Append([]byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Append([]byte("x")); err != ErrBufferFull {
+		t.Errorf("Append() error = %v, want ErrBufferFull", err)
+	}
+}
+
+func TestNewExporter_RejectsInvalidSettings(t *testing.T) {
+	for _, settings := range []config.SyslogConfig{
+		{Address: "collector"},
+		{Address: "collector:514", Protocol: "http"},
+		{Address: "collector:514", Format: "leef"},
+		{Address: "collector:514", Facility: "local9"},
+		{Address: "collector:514", LogLevel: "verbose"},
+	} {
+		if _, err := NewExporter(settings, Options{Dir: t.TempDir()}); err == nil {
+			t.Errorf("NewExporter(%+v) should fail", settings)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package siem
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatRFC5424 = "rfc5424"
+	FormatCEF     = "cef"
+
+	appName = "jtnt-agent"
+
+	// sdID names the structured data element. 32473 is the enterprise
+	// number reserved for documentation (RFC 5612); collectors match on
+	// the whole ID.
+	sdID = "jtnt@32473"
+
+	cefVendor  = "JTNT"
+	cefProduct = "jtnt-agent"
+)
+
+// facilities maps syslog facility names to their codes
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// cefKeys maps event params to CEF extension keys. Custom fields carry a
+// label naming them.
+var cefKeys = map[string]struct{ key, label string }{
+	"agent_id":       {"deviceExternalId", ""},
+	"user":           {"suser", ""},
+	"status":         {"outcome", ""},
+	"reason":         {"reason", ""},
+	"job_id":         {"cs1", "jobId"},
+	"command":        {"cs2", "command"},
+	"violation_type": {"cs3", "violationType"},
+	"component":      {"cs4", "component"},
+	"resource":       {"cs5", "resource"},
+	"version":        {"cs6", "agentVersion"},
+	"seq":            {"cn1", "seq"},
+	"policy_version": {"cn2", "policyVersion"},
+}
+
+// formatter renders events as syslog messages
+type formatter struct {
+	format   string
+	facility int
+	hostname string
+	procID   string
+	version  string
+}
+
+// message renders event as an RFC 5424 message, with a CEF body in CEF mode
+func (f *formatter) message(event *Event) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s %s ",
+		f.facility*8+int(event.Severity),
+		event.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		headerField(f.hostname, 255),
+		appName,
+		headerField(f.procID, 128),
+		headerField(event.Type, 32))
+
+	if f.format == FormatCEF {
+		b.WriteString("- ")
+		b.WriteString(f.cef(event))
+		return []byte(b.String())
+	}
+
+	b.WriteString(structuredData(event.Params))
+	if len(event.Raw) > 0 {
+		b.WriteByte(' ')
+		b.Write(event.Raw)
+	} else if event.Message != "" {
+		b.WriteByte(' ')
+		b.WriteString(event.Message)
+	}
+	return []byte(b.String())
+}
+
+// headerField makes value a valid RFC 5424 header field: printable ASCII
+// without spaces, at most max characters, "-" when empty
+func headerField(value string, max int) string {
+	field := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(field) > max {
+		field = field[:max]
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
+
+// structuredData renders params as one SD element
+func structuredData(params []Param) string {
+	if len(params) == 0 {
+		return "-"
+	}
+
+	var b strings.Builder
+	b.WriteString("[" + sdID)
+	for _, p := range params {
+		fmt.Fprintf(&b, " %s=\"%s\"", headerField(p.Name, 32), sdEscaper.Replace(p.Value))
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// cef renders event as a CEF record
+func (f *formatter) cef(event *Event) string {
+	ext := []string{
+		"rt=" + strconv.FormatInt(event.Time.UnixMilli(), 10),
+		"dvchost=" + cefValue(f.hostname),
+	}
+
+	var unmapped []string
+	for _, p := range event.Params {
+		k, ok := cefKeys[p.Name]
+		if !ok {
+			unmapped = append(unmapped, p.Name+"="+p.Value)
+			continue
+		}
+		ext = append(ext, k.key+"="+cefValue(p.Value))
+		if k.label != "" {
+			ext = append(ext, k.key+"Label="+k.label)
+		}
+	}
+
+	msg := event.Message
+	if len(unmapped) > 0 {
+		msg = strings.TrimSpace(msg + " " + strings.Join(unmapped, " "))
+	}
+	if msg != "" {
+		ext = append(ext, "msg="+cefValue(msg))
+	}
+
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefHeader(cefVendor), cefHeader(cefProduct), cefHeader(f.version),
+		cefHeader(event.Type), cefHeader(event.Name), cefSeverity(event.Severity),
+		strings.Join(ext, " "))
+}
+
+var (
+	cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefValueEscaper  = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+func cefHeader(value string) string {
+	return cefHeaderEscaper.Replace(value)
+}
+
+func cefValue(value string) string {
+	return cefValueEscaper.Replace(value)
+}
+
+// cefSeverity maps a syslog severity to the CEF scale of 0 to 10
+func cefSeverity(severity Severity) int {
+	switch severity {
+	case SeverityEmergency, SeverityAlert, SeverityCritical:
+		return 10
+	case SeverityError:
+		return 8
+	case SeverityWarning:
+		return 6
+	case SeverityNotice:
+		return 4
+	case SeverityInfo:
+		return 3
+	}
+	return 1
+}
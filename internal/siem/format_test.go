@@ -0,0 +1,74 @@
+package siem
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/audit"
+)
+
+func testFormatter(format string) *formatter {
+	return &formatter{format: format, facility: 16, hostname: "host-1", procID: "42", version: "1.0.0"}
+}
+
+func testAuditEvent() *Event {
+	entry := &audit.Entry{
+		Timestamp: "2025-12-16T10:30:00Z",
+		Event:     string(audit.EventPolicyViolation),
+		AgentID:   "agent-1",
+		JobID:     "job-1",
+		Seq:       7,
+		Details:   map[string]interface{}{"violation_type": "binary_denied", "resource": `rm -rf "/"`},
+	}
+	return AuditEvent(entry, []byte(`{"event":"policy_violation"}`))
+}
+
+func TestMessage_RFC5424(t *testing.T) {
+	got := string(testFormatter(FormatRFC5424).message(testAuditEvent()))
+
+	// local0 (16) * 8 + warning (4)
+	want := `<132>1 2025-12-16T10:30:00.000000Z host-1 jtnt-agent 42 policy_violation ` +
+		`[jtnt@32473 agent_id="agent-1" seq="7" job_id="job-1" violation_type="binary_denied" resource="rm -rf \"/\""] ` +
+		`{"event":"policy_violation"}`
+	if got != want {
+		t.Errorf("message() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMessage_CEF(t *testing.T) {
+	got := string(testFormatter(FormatCEF).message(testAuditEvent()))
+
+	prefix := `<132>1 2025-12-16T10:30:00.000000Z host-1 jtnt-agent 42 policy_violation - ` +
+		`CEF:0|JTNT|jtnt-agent|1.0.0|policy_violation|audit policy_violation|6|`
+	if !strings.HasPrefix(got, prefix) {
+		t.Fatalf("message() = %s, want prefix %s", got, prefix)
+	}
+	for _, want := range []string{
+		"rt=1765881000000", "dvchost=host-1", "deviceExternalId=agent-1",
+		"cs1=job-1 cs1Label=jobId", "cs3=binary_denied cs3Label=violationType", "cn1=7 cn1Label=seq",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("message() = %s, missing %s", got, want)
+		}
+	}
+}
+
+func TestMessage_CEFEscaping(t *testing.T) {
+	event := LogEvent("error", "jobs", "a|b=c\nd", map[string]interface{}{"path": `C:\temp`})
+	event.Time = time.Unix(0, 0)
+
+	got := string(testFormatter(FormatCEF).message(event))
+	if !strings.Contains(got, `|jobs: a\|b=c d|8|`) {
+		t.Errorf("header not escaped: %s", got)
+	}
+	if !strings.Contains(got, `msg=a|b\=c\nd path\=C:\\temp`) {
+		t.Errorf("extension not escaped: %s", got)
+	}
+}
+
+func TestLogEvent_UnknownLevel(t *testing.T) {
+	if event := LogEvent("trace", "agent", "x", nil); event != nil {
+		t.Errorf("LogEvent(trace) = %+v, want nil", event)
+	}
+}
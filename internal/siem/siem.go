@@ -0,0 +1,160 @@
+// Package siem exports audit entries and agent log events to a remote
+// syslog collector, as RFC 5424 messages or ArcSight CEF, over UDP, TCP or
+// TLS. Messages that cannot be delivered wait in a disk buffer until the
+// collector is reachable again.
+package siem
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/audit"
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+)
+
+// Severity is a syslog severity
+type Severity int
+
+const (
+	SeverityEmergency Severity = iota
+	SeverityAlert
+	SeverityCritical
+	SeverityError
+	SeverityWarning
+	SeverityNotice
+	SeverityInfo
+	SeverityDebug
+)
+
+// logLevels maps agent log levels to syslog severities
+var logLevels = map[string]Severity{
+	"debug": SeverityDebug,
+	"info":  SeverityInfo,
+	"warn":  SeverityWarning,
+	"error": SeverityError,
+	"fatal": SeverityCritical,
+}
+
+// Event is one message for the collector
+type Event struct {
+	Time     time.Time
+	Severity Severity
+
+	// Type identifies the event, e.g. "job_executed" or "log"
+	Type string
+
+	// Name is a short human-readable description
+	Name string
+
+	// Message is the free-form body
+	Message string
+
+	// Raw is the signed audit entry exactly as written, sent as the RFC
+	// 5424 body so the collector can verify it
+	Raw []byte
+
+	// Params are the structured fields, in order
+	Params []Param
+}
+
+// Param is one structured field of an event
+type Param struct {
+	Name  string
+	Value string
+}
+
+// Dir returns the directory holding the disk buffer
+func Dir() string {
+	return filepath.Join(config.GetStateDir(), "siem")
+}
+
+// AuditEvent converts a signed audit entry and its line as written
+func AuditEvent(entry *audit.Entry, line []byte) *Event {
+	event := &Event{
+		Time:     parseTime(entry.Timestamp),
+		Severity: auditSeverity(entry),
+		Type:     entry.Event,
+		Name:     "audit " + entry.Event,
+		Raw:      line,
+	}
+
+	event.add("agent_id", entry.AgentID)
+	if entry.Seq != 0 {
+		event.add("seq", strconv.FormatUint(entry.Seq, 10))
+	}
+	event.add("job_id", entry.JobID)
+	event.add("command", entry.Command)
+	event.add("status", entry.Status)
+	event.add("user", entry.User)
+	if entry.PolicyVersion != 0 {
+		event.add("policy_version", strconv.Itoa(entry.PolicyVersion))
+	}
+	for _, name := range []string{"violation_type", "resource", "version", "reason", "method", "requested_by"} {
+		if value, ok := entry.Details[name]; ok {
+			event.add(name, fmt.Sprint(value))
+		}
+	}
+
+	return event
+}
+
+// auditSeverity ranks audit events: violations and failures above routine
+// records
+func auditSeverity(entry *audit.Entry) Severity {
+	switch audit.EventType(entry.Event) {
+	case audit.EventPolicyViolation:
+		return SeverityWarning
+	case audit.EventCheckpoint, audit.EventLogPruned:
+		return SeverityInfo
+	}
+	if entry.Status == "failed" {
+		return SeverityWarning
+	}
+	return SeverityNotice
+}
+
+// LogEvent converts an agent log entry. It returns nil for unknown levels.
+func LogEvent(level, component, message string, fields map[string]interface{}) *Event {
+	severity, ok := logLevels[level]
+	if !ok {
+		return nil
+	}
+
+	event := &Event{
+		Time:     time.Now(),
+		Severity: severity,
+		Type:     "log",
+		Name:     component + ": " + message,
+		Message:  message,
+	}
+	event.add("component", component)
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		event.add(name, fmt.Sprint(fields[name]))
+	}
+
+	return event
+}
+
+// add appends a param unless value is empty
+func (e *Event) add(name, value string) {
+	if value != "" {
+		e.Params = append(e.Params, Param{Name: name, Value: value})
+	}
+}
+
+func parseTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Now()
+	}
+	return t
+}
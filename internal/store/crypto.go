@@ -0,0 +1,107 @@
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// sealedMagic prefixes every encrypted value. Files without it were written
+// by versions that stored plaintext.
+var sealedMagic = []byte("JTNTSEC1")
+
+// ErrCorrupt is returned when a stored value fails its integrity checksum,
+// for example after a torn write or disk corruption
+var ErrCorrupt = errors.New("stored value is corrupted: checksum mismatch")
+
+// ErrDecrypt is returned when a value cannot be decrypted with this host's
+// store key, for example after the store was copied to another machine
+var ErrDecrypt = errors.New("failed to decrypt value: wrong key or corrupted data")
+
+// deriveKey derives the AEAD key from the host's master secret
+func deriveKey(secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("jtnt-agent store v1"))
+	return mac.Sum(nil)
+}
+
+// seal encrypts plaintext with AES-256-GCM. The key name is bound as
+// additional data so sealed files cannot be swapped between keys. The
+// layout is magic, SHA-256 of the rest, nonce and ciphertext; the checksum
+// tells damaged files apart from ones sealed with another key.
+func seal(key []byte, name string, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	body := make([]byte, 0, len(nonce)+len(plaintext)+aead.Overhead())
+	body = append(body, nonce...)
+	body = aead.Seal(body, nonce, plaintext, []byte(name))
+
+	sum := sha256.Sum256(body)
+	out := make([]byte, 0, len(sealedMagic)+len(sum)+len(body))
+	out = append(out, sealedMagic...)
+	out = append(out, sum[:]...)
+	return append(out, body...), nil
+}
+
+// verify checks the integrity checksum of a sealed value
+func verify(data []byte) error {
+	data = data[len(sealedMagic):]
+	if len(data) < sha256.Size {
+		return ErrCorrupt
+	}
+
+	sum := sha256.Sum256(data[sha256.Size:])
+	if !hmac.Equal(sum[:], data[:sha256.Size]) {
+		return ErrCorrupt
+	}
+	return nil
+}
+
+// open decrypts a value written by seal
+func open(key []byte, name string, data []byte) ([]byte, error) {
+	if err := verify(data); err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data = data[len(sealedMagic)+sha256.Size:]
+	if len(data) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func isSealed(data []byte) bool {
+	return bytes.HasPrefix(data, sealedMagic)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,163 @@
+// +build !windows
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Keep the host key of tests away from the real one
+	dir, err := os.MkdirTemp("", "jtnt-store-test-")
+	if err != nil {
+		panic(err)
+	}
+	hostKeyFile = filepath.Join(dir, "host.key")
+	machineID = func() (string, error) { return "test-machine", nil }
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestMasterSecret_BoundToHost(t *testing.T) {
+	tmpDir := t.TempDir()
+	s, _ := NewStore(tmpDir)
+	if err := s.Save("token", []byte("secret-token")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, MasterKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isProtected(data) || data[len(hostKeyMagic)] != bindHostFile {
+		t.Fatalf("store key is not wrapped with the host key file alone")
+	}
+}
+
+// A clone gets a new machine ID but keeps the copied host key file; the
+// copied token must stay readable so the agent can ask the hub for a new
+// identity
+func TestMasterSecret_SurvivesMachineIDChange(t *testing.T) {
+	tmpDir := t.TempDir()
+	s, _ := NewStore(tmpDir)
+	if err := s.Save("token", []byte("secret-token")); err != nil {
+		t.Fatal(err)
+	}
+
+	setMachineID(t, "cloned-machine")
+
+	cloned, _ := NewStore(tmpDir)
+	if got, err := cloned.Load("token"); err != nil || string(got) != "secret-token" {
+		t.Errorf("Load() after a machine ID change = %q, %v", got, err)
+	}
+}
+
+func TestMasterSecret_RewrapsMachineIDBinding(t *testing.T) {
+	tmpDir := t.TempDir()
+	secret := make([]byte, masterSecretSize)
+	for i := range secret {
+		secret[i] = byte(i)
+	}
+	if _, err := loadHostFile(tmpDir, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wrapped as older versions did, with both host factors
+	flags := bindMachineID | bindHostFile
+	key, err := hostKey(flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := append(append([]byte(nil), hostKeyMagic...), flags)
+	nonce := make([]byte, aead.NonceSize())
+	keyPath := filepath.Join(tmpDir, MasterKeyFile)
+	os.WriteFile(keyPath, aead.Seal(append(header, nonce...), nonce, secret, header), 0600)
+
+	sealed, err := seal(deriveKey(secret), "token", []byte("secret-token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(tmpDir, "token"), sealed, 0600)
+
+	s, _ := NewStore(tmpDir)
+	if got, err := s.Load("token"); err != nil || string(got) != "secret-token" {
+		t.Fatalf("Load() = %q, %v", got, err)
+	}
+	if data, _ := os.ReadFile(keyPath); needsRewrap(data) {
+		t.Fatal("store key is still bound to the machine ID")
+	}
+
+	setMachineID(t, "cloned-machine")
+
+	cloned, _ := NewStore(tmpDir)
+	if got, err := cloned.Load("token"); err != nil || string(got) != "secret-token" {
+		t.Errorf("Load() after a machine ID change = %q, %v", got, err)
+	}
+}
+
+func setMachineID(t *testing.T, id string) {
+	t.Helper()
+	previous := machineID
+	machineID = func() (string, error) { return id, nil }
+	t.Cleanup(func() { machineID = previous })
+}
+
+func TestMasterSecret_NeedsHostKeyFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	s, _ := NewStore(tmpDir)
+	if err := s.Save("token", []byte("secret-token")); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := os.ReadFile(hostKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(hostKeyFile)
+	defer os.WriteFile(hostKeyFile, saved, 0640)
+
+	copied, _ := NewStore(tmpDir)
+	if _, err := copied.Load("token"); err == nil {
+		t.Error("Load() succeeded without the host key file")
+	}
+}
+
+func TestMasterSecret_WrapsLegacySecret(t *testing.T) {
+	tmpDir := t.TempDir()
+	secret := make([]byte, masterSecretSize)
+	for i := range secret {
+		secret[i] = byte(i)
+	}
+	keyPath := filepath.Join(tmpDir, MasterKeyFile)
+	os.WriteFile(keyPath, secret, 0600)
+
+	sealed, err := seal(deriveKey(secret), "token", []byte("secret-token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(tmpDir, "token"), sealed, 0600)
+
+	s, _ := NewStore(tmpDir)
+	got, err := s.Load("token")
+	if err != nil || string(got) != "secret-token" {
+		t.Fatalf("Load() = %q, %v", got, err)
+	}
+
+	data, _ := os.ReadFile(keyPath)
+	if !isProtected(data) {
+		t.Error("bare store key was not wrapped")
+	}
+	if again, _ := NewStore(tmpDir); again != nil {
+		if got, err := again.Load("token"); err != nil || string(got) != "secret-token" {
+			t.Errorf("Load() after wrapping = %q, %v", got, err)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// +build !windows
+
+package store
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// hostKeyMagic prefixes a master secret wrapped with the host key. Files
+// without it hold the bare secret, as written by older versions.
+var hostKeyMagic = []byte("JTNTHKY1")
+
+// Factors the host key is derived from, recorded in the wrapped file so a
+// secret created before the host key file existed stays readable. Secrets
+// are no longer bound to the machine ID: a cloned machine gets a new one,
+// and clone recovery needs the copied token to ask the hub for a new
+// identity. bindMachineID is only read, from secrets of older versions.
+const (
+	bindMachineID byte = 1 << iota
+	bindHostFile
+)
+
+const hostFileSize = 32
+
+var (
+	// hostKeyFile holds random bytes kept outside the state directory, so a
+	// copy of the store alone cannot be unwrapped; replaced in tests
+	hostKeyFile = defaultHostKeyFile
+
+	// machineID returns the host's stable identifier; replaced in tests
+	machineID = readMachineID
+)
+
+// HostKeyFile returns the host key file the master secret is bound to
+func HostKeyFile() string {
+	return hostKeyFile
+}
+
+// protectSecret wraps the master secret with AES-256-GCM under a key
+// derived from the host key file, creating it when it can. Without it the
+// secret is protected only by the file's permissions.
+func protectSecret(baseDir string, secret []byte) ([]byte, error) {
+	var flags byte
+	if _, err := loadHostFile(baseDir, true); err == nil {
+		flags |= bindHostFile
+	}
+
+	key, err := hostKey(flags)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	header := append(append([]byte(nil), hostKeyMagic...), flags)
+	out := append(header, nonce...)
+	return aead.Seal(out, nonce, secret, header), nil
+}
+
+// unprotectSecret unwraps a secret written by protectSecret. A bare secret
+// from an older version is returned as is.
+func unprotectSecret(data []byte) ([]byte, error) {
+	if !isProtected(data) {
+		return data, nil
+	}
+
+	header := data[:len(hostKeyMagic)+1]
+	key, err := hostKey(header[len(hostKeyMagic)])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data = data[len(header):]
+	if len(data) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	secret, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], header)
+	if err != nil {
+		if header[len(hostKeyMagic)]&bindMachineID != 0 {
+			return nil, fmt.Errorf("%w: the store key is bound to another machine ID; this machine may be a clone", ErrDecrypt)
+		}
+		return nil, fmt.Errorf("%w: the store key belongs to another host", ErrDecrypt)
+	}
+	return secret, nil
+}
+
+// isProtected reports whether data is a wrapped master secret
+func isProtected(data []byte) bool {
+	return len(data) > len(hostKeyMagic) && bytes.HasPrefix(data, hostKeyMagic)
+}
+
+// needsRewrap reports whether data should be wrapped again: it is bare, or
+// bound to the machine ID by an older version
+func needsRewrap(data []byte) bool {
+	return !isProtected(data) || data[len(hostKeyMagic)]&bindMachineID != 0
+}
+
+// hostKey derives the wrapping key from the factors in flags
+func hostKey(flags byte) ([]byte, error) {
+	var id string
+	if flags&bindMachineID != 0 {
+		var err error
+		if id, err = machineID(); err != nil || id == "" {
+			return nil, fmt.Errorf("store key is bound to the machine ID, which cannot be read: %v", err)
+		}
+	}
+
+	var hostSecret []byte
+	if flags&bindHostFile != 0 {
+		var err error
+		if hostSecret, err = loadHostFile("", false); err != nil {
+			return nil, fmt.Errorf("store key is bound to %s: %w", hostKeyFile, err)
+		}
+	}
+
+	mac := hmac.New(sha256.New, hostSecret)
+	mac.Write([]byte("jtnt-agent store key v1"))
+	mac.Write([]byte{0, flags, 0})
+	mac.Write([]byte(id))
+	return mac.Sum(nil), nil
+}
+
+// loadHostFile reads the host key file. With create it is made when
+// missing, readable by the group owning baseDir so an unprivileged daemon
+// in that group can use a store created by root.
+func loadHostFile(baseDir string, create bool) ([]byte, error) {
+	data, err := os.ReadFile(hostKeyFile)
+	if err == nil {
+		if len(data) != hostFileSize {
+			return nil, fmt.Errorf("invalid host key size")
+		}
+		return data, nil
+	}
+	if !create || !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(hostKeyFile), 0755); err != nil {
+		return nil, err
+	}
+
+	data = make([]byte, hostFileSize)
+	if _, err := io.ReadFull(rand.Reader, data); err != nil {
+		return nil, err
+	}
+
+	err = createExclusive(hostKeyFile, data, 0640)
+	if errors.Is(err, fs.ErrExist) {
+		return loadHostFile(baseDir, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Stat(baseDir); err == nil {
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			os.Chown(hostKeyFile, -1, int(stat.Gid))
+		}
+	}
+	return data, nil
+}
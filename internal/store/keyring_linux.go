@@ -0,0 +1,69 @@
+// +build linux
+
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// keyringTimeout bounds how long a cached store key outlives its last use
+const keyringTimeout = 3600 // seconds
+
+// keyringDescription names the cached key after the master secret file, so
+// a new secret (after unenroll) never picks up a stale cached key
+func keyringDescription(baseDir string) (string, error) {
+	info, err := os.Stat(filepath.Join(baseDir, MasterKeyFile))
+	if err != nil {
+		return "", err
+	}
+
+	id := fmt.Sprintf("%s:%d", baseDir, info.ModTime().UnixNano())
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		id = fmt.Sprintf("%s:%d:%d", id, stat.Dev, stat.Ino)
+	}
+	sum := sha256.Sum256([]byte(id))
+	return "jtnt-agent:store:" + hex.EncodeToString(sum[:8]), nil
+}
+
+// keyringGet returns the store key cached in the user keyring
+func keyringGet(baseDir string) ([]byte, bool) {
+	description, err := keyringDescription(baseDir)
+	if err != nil {
+		return nil, false
+	}
+
+	id, err := unix.KeyctlSearch(unix.KEY_SPEC_USER_KEYRING, "user", description, 0)
+	if err != nil {
+		return nil, false
+	}
+
+	key := make([]byte, 64)
+	n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, key, 0)
+	if err != nil || n != sha256.Size {
+		return nil, false
+	}
+	unix.KeyctlInt(unix.KEYCTL_SET_TIMEOUT, id, keyringTimeout, 0, 0)
+	return key[:n], true
+}
+
+// keyringPut caches the store key in the user keyring. Failures are
+// ignored; the key is derived from the master secret again next time.
+func keyringPut(baseDir string, key []byte) {
+	description, err := keyringDescription(baseDir)
+	if err != nil {
+		return
+	}
+
+	id, err := unix.AddKey("user", description, key, unix.KEY_SPEC_USER_KEYRING)
+	if err != nil {
+		return
+	}
+	unix.KeyctlInt(unix.KEYCTL_SET_TIMEOUT, id, keyringTimeout, 0, 0)
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// MasterKeyFile is the name of the host's master secret in the store
+// directory. Values in the store cannot be read without it.
+const MasterKeyFile = ".store.key"
+
+const masterSecretSize = 32
+
+// loadMasterSecret reads the host's master secret, creating it on first
+// use. The file is protected with a key the host holds outside the store
+// directory (DPAPI on Windows, the host key file elsewhere) so the store
+// directory alone is not usable elsewhere. A secret written unprotected, or
+// bound to the machine ID, by an older version is wrapped again in place. A
+// read-only store does neither: a missing secret means its values cannot be
+// decrypted.
+func (s *fileStore) loadMasterSecret() ([]byte, error) {
+	path := filepath.Join(s.baseDir, MasterKeyFile)
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		secret, err := unprotectSecret(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unprotect store key: %w", err)
+		}
+		if len(secret) != masterSecretSize {
+			return nil, fmt.Errorf("invalid store key size")
+		}
+		if needsRewrap(data) && !s.opts.ReadOnly {
+			if protected, err := protectSecret(s.baseDir, secret); err == nil {
+				s.writeAtomic(path, protected)
+			}
+		}
+		return secret, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read store key: %w", err)
+	}
+	if s.opts.ReadOnly {
+		return nil, fmt.Errorf("%w: %s is missing", ErrDecrypt, MasterKeyFile)
+	}
+
+	secret := make([]byte, masterSecretSize)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return nil, fmt.Errorf("failed to generate store key: %w", err)
+	}
+
+	protected, err := protectSecret(s.baseDir, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to protect store key: %w", err)
+	}
+
+	// Created exclusively so two processes starting at once cannot each
+	// create a key; the loser reads the winner's
+	err = createExclusive(path, protected, 0600)
+	if errors.Is(err, fs.ErrExist) {
+		return s.loadMasterSecret()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write store key: %w", err)
+	}
+
+	return secret, nil
+}
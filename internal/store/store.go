@@ -1,11 +1,20 @@
 package store
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 )
 
+// versionsDir holds retained previous values, one directory per key
+const versionsDir = ".versions"
+
 // Store provides secure file storage interface
 type Store interface {
 	Save(key string, data []byte) error
@@ -13,42 +22,85 @@ type Store interface {
 	Exists(key string) bool
 	Delete(key string) error
 	SetPermissions(path string) error
+
+	// List returns the keys starting with prefix, in lexical order
+	List(prefix string) ([]string, error)
+
+	// Versions returns the retained previous versions of key, oldest first
+	Versions(key string) ([]int, error)
+
+	// Restore makes a retained version of key current again
+	Restore(key string, version int) error
 }
 
+// Options configures a store
+type Options struct {
+	// Keyring caches the derived store key in the Linux kernel keyring so
+	// short-lived CLI processes do not re-read the master secret. Ignored
+	// on other platforms.
+	Keyring bool
+
+	// Versions is how many previous values of each key Save keeps for
+	// Restore. Zero keeps none.
+	Versions int
+
+	// ReadOnly opens the store for reading only: the master secret is never
+	// created, plaintext values are not migrated and writes fail with
+	// ErrReadOnly
+	ReadOnly bool
+}
+
+// ErrNotFound is returned by Load when a key has no value. It is
+// fs.ErrNotExist, so either can be tested for.
+var ErrNotFound = fs.ErrNotExist
+
+// ErrReadOnly is returned by writes to a store opened with ReadOnly
+var ErrReadOnly = errors.New("store is read-only")
+
 // NewStore creates a platform-specific store
 func NewStore(baseDir string) (Store, error) {
+	return NewStoreWithOptions(baseDir, Options{})
+}
+
+// NewStoreWithOptions creates a platform-specific store with options.
+// Values are encrypted at rest with a key derived from the host's master
+// secret in baseDir.
+func NewStoreWithOptions(baseDir string, opts Options) (Store, error) {
+	if opts.ReadOnly {
+		return &fileStore{baseDir: baseDir, opts: opts}, nil
+	}
 	if err := os.MkdirAll(baseDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create base directory: %w", err)
 	}
 	
-	return &fileStore{baseDir: baseDir}, nil
+	return &fileStore{baseDir: baseDir, opts: opts}, nil
 }
 
 // fileStore implements Store using filesystem
 type fileStore struct {
 	baseDir string
+	opts    Options
+
+	mu  sync.Mutex
+	key []byte
 }
 
 func (s *fileStore) Save(key string, data []byte) error {
-	path := s.getPath(key)
-	
-	// Ensure directory exists
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+	if s.opts.ReadOnly {
+		return ErrReadOnly
 	}
-	
-	// Write file
-	if err := os.WriteFile(path, data, 0600); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+
+	aeadKey, err := s.storeKey()
+	if err != nil {
+		return err
 	}
-	
-	// Set platform-specific permissions
-	if err := s.SetPermissions(path); err != nil {
-		return fmt.Errorf("failed to set permissions: %w", err)
+
+	sealed, err := seal(aeadKey, key, data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", key, err)
 	}
-	
-	return nil
+
+	return s.write(key, sealed)
 }
 
 func (s *fileStore) Load(key string) ([]byte, error) {
@@ -57,7 +109,105 @@ func (s *fileStore) Load(key string) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
-	return data, nil
+
+	// Values written before the store was encrypted are migrated on first
+	// read; a failed rewrite leaves the plaintext for the next attempt
+	if !isSealed(data) {
+		if !s.opts.ReadOnly {
+			s.Save(key, data)
+		}
+		return data, nil
+	}
+
+	aeadKey, err := s.storeKey()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := open(aeadKey, key, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	return plaintext, nil
+}
+
+// List returns the keys starting with prefix. Names starting with a dot are
+// the store's own files and are never listed.
+func (s *fileStore) List(prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(s.baseDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == s.baseDir {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.baseDir, path)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Versions returns the retained previous versions of key, oldest first
+func (s *fileStore) Versions(key string) ([]int, error) {
+	entries, err := os.ReadDir(s.versionDir(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read versions: %w", err)
+	}
+
+	var versions []int
+	for _, entry := range entries {
+		if version, err := strconv.Atoi(entry.Name()); err == nil && !entry.IsDir() {
+			versions = append(versions, version)
+		}
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// Restore makes a retained version of key current again. The value being
+// replaced is retained in turn, so a restore can itself be undone.
+func (s *fileStore) Restore(key string, version int) error {
+	if s.opts.ReadOnly {
+		return ErrReadOnly
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.versionDir(key), strconv.Itoa(version)))
+	if err != nil {
+		return fmt.Errorf("failed to read version %d of %s: %w", version, key, err)
+	}
+
+	// Check the version is usable before it replaces the current value
+	aeadKey, err := s.storeKey()
+	if err != nil {
+		return err
+	}
+	if _, err := open(aeadKey, key, data); err != nil {
+		return fmt.Errorf("version %d of %s: %w", version, key, err)
+	}
+
+	return s.write(key, data)
 }
 
 func (s *fileStore) Exists(key string) bool {
@@ -66,14 +216,178 @@ func (s *fileStore) Exists(key string) bool {
 	return err == nil
 }
 
+// Delete removes key and its retained versions
 func (s *fileStore) Delete(key string) error {
+	if s.opts.ReadOnly {
+		return ErrReadOnly
+	}
 	path := s.getPath(key)
 	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
+	if err := os.RemoveAll(s.versionDir(key)); err != nil {
+		return fmt.Errorf("failed to delete versions: %w", err)
+	}
+	return nil
+}
+
+// write stores already encrypted data under key, retaining the value it
+// replaces when versioning is enabled
+func (s *fileStore) write(key string, data []byte) error {
+	if s.opts.Versions > 0 {
+		if err := s.retain(key); err != nil {
+			return fmt.Errorf("failed to retain previous version: %w", err)
+		}
+	}
+
+	return s.writeAtomic(s.getPath(key), data)
+}
+
+// writeAtomic replaces path with data so that a crash leaves either the old
+// or the new file, never a partial one
+func (s *fileStore) writeAtomic(path string, data []byte) error {
+	// Ensure directory exists
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	
+	// Write to a temporary file in the same directory; the leading dot
+	// keeps it out of List
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	
+	// Set platform-specific permissions
+	if err := s.SetPermissions(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	if err := syncDir(dir); err != nil {
+		return fmt.Errorf("failed to sync directory: %w", err)
+	}
+	
 	return nil
 }
 
+// createExclusive writes data to path only if path does not exist yet. The
+// data is written and synced to a temporary file first and then linked into
+// place, so a concurrent reader sees either no file or the complete one.
+// An existing path is reported as fs.ErrExist and left untouched.
+func createExclusive(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	// Unlike a rename, a link never replaces an existing file
+	if err := os.Link(tmpPath, path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// retain copies the current value of key into its versions and drops the
+// oldest beyond the configured limit. Plaintext values are not retained so
+// migrating them leaves no unencrypted copy behind.
+func (s *fileStore) retain(key string) error {
+	data, err := os.ReadFile(s.getPath(key))
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && !isSealed(data)) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	versions, err := s.Versions(key)
+	if err != nil {
+		return err
+	}
+
+	next := 1
+	if len(versions) > 0 {
+		next = versions[len(versions)-1] + 1
+	}
+	if err := s.writeAtomic(filepath.Join(s.versionDir(key), strconv.Itoa(next)), data); err != nil {
+		return err
+	}
+
+	versions = append(versions, next)
+	for _, old := range versions[:max(len(versions)-s.opts.Versions, 0)] {
+		os.Remove(filepath.Join(s.versionDir(key), strconv.Itoa(old)))
+	}
+	return nil
+}
+
+// storeKey returns the AEAD key, loading the master secret on first use so
+// a store that is never read or written never creates one
+func (s *fileStore) storeKey() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.key != nil {
+		return s.key, nil
+	}
+
+	if s.opts.Keyring {
+		if key, ok := keyringGet(s.baseDir); ok {
+			s.key = key
+			return key, nil
+		}
+	}
+
+	secret, err := s.loadMasterSecret()
+	if err != nil {
+		return nil, err
+	}
+	s.key = deriveKey(secret)
+
+	if s.opts.Keyring {
+		keyringPut(s.baseDir, s.key)
+	}
+	return s.key, nil
+}
+
 func (s *fileStore) getPath(key string) string {
 	return filepath.Join(s.baseDir, key)
 }
+
+func (s *fileStore) versionDir(key string) string {
+	return filepath.Join(s.baseDir, versionsDir, key)
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"os"
 	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
 // SetPermissions sets secure permissions on macOS
@@ -33,3 +35,22 @@ func (s *fileStore) SetPermissions(path string) error {
 	
 	return nil
 }
+
+// defaultHostKeyFile is outside the agent's data directory, which holds
+// both state and configuration on macOS
+const defaultHostKeyFile = "/var/db/jtnt-agent/host.key"
+
+// readMachineID returns the hardware UUID
+func readMachineID() (string, error) {
+	return unix.Sysctl("kern.uuid")
+}
+
+// syncDir flushes a directory so a rename into it survives a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
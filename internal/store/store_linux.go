@@ -5,6 +5,7 @@ package store
 import (
 	"fmt"
 	"os"
+	"strings"
 	"syscall"
 )
 
@@ -33,3 +34,30 @@ func (s *fileStore) SetPermissions(path string) error {
 	
 	return nil
 }
+
+// defaultHostKeyFile is outside the state directory and read-only to the
+// daemon
+const defaultHostKeyFile = "/etc/jtnt-agent/host.key"
+
+// readMachineID returns the systemd machine ID, which stays the same across
+// reboots and differs between installs
+func readMachineID() (string, error) {
+	var err error
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		var data []byte
+		if data, err = os.ReadFile(path); err == nil {
+			return strings.TrimSpace(string(data)), nil
+		}
+	}
+	return "", err
+}
+
+// syncDir flushes a directory so a rename into it survives a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -1,8 +1,13 @@
 package store
 
 import (
+	"bytes"
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -141,3 +146,339 @@ func TestStore_Permissions(t *testing.T) {
 		}
 	}
 }
+
+func TestStore_EncryptedAtRest(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	s, err := NewStore(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret := []byte("agent-token-value")
+	if err := s.Save("agent.token", secret); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(tmpDir, "agent.token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, secret) {
+		t.Error("stored file contains the plaintext")
+	}
+	if !isSealed(raw) {
+		t.Error("stored file is not sealed")
+	}
+
+	// A second store on the same directory shares the master secret
+	other, err := NewStore(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := other.Load("agent.token")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !bytes.Equal(loaded, secret) {
+		t.Errorf("Load() = %q, want %q", loaded, secret)
+	}
+}
+
+func TestStore_MigratesPlaintext(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	path := filepath.Join(tmpDir, "agent.token")
+	if err := os.WriteFile(path, []byte("legacy"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStore(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := s.Load("agent.token")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if string(loaded) != "legacy" {
+		t.Errorf("Load() = %q, want legacy", loaded)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSealed(raw) {
+		t.Error("plaintext value was not re-encrypted")
+	}
+}
+
+func TestStore_ReadOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	path := filepath.Join(tmpDir, "agent.token")
+	if err := os.WriteFile(path, []byte("legacy"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStoreWithOptions(tmpDir, Options{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := s.Load("agent.token")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if string(loaded) != "legacy" {
+		t.Errorf("Load() = %q, want legacy", loaded)
+	}
+	if raw, _ := os.ReadFile(path); isSealed(raw) {
+		t.Error("read-only store migrated a plaintext value")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, MasterKeyFile)); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("read-only store created a master secret: %v", err)
+	}
+
+	if _, err := s.Load("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Load(missing) error = %v, want ErrNotFound", err)
+	}
+	if err := s.Save("other", []byte("x")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Save() error = %v, want ErrReadOnly", err)
+	}
+	if err := s.Delete("agent.token"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Delete() error = %v, want ErrReadOnly", err)
+	}
+
+	// A sealed value without the master secret cannot be decrypted
+	writable, err := NewStore(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writable.Save("agent.token", []byte("sealed")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(tmpDir, MasterKeyFile)); err != nil {
+		t.Fatal(err)
+	}
+	s, _ = NewStoreWithOptions(tmpDir, Options{ReadOnly: true})
+	if _, err := s.Load("agent.token"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Load() without master secret error = %v, want ErrDecrypt", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, MasterKeyFile)); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("read-only store recreated the master secret")
+	}
+}
+
+func TestStore_RejectsForeignValues(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	s, err := NewStore(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save("a", []byte("value a")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A sealed value moved to another key name fails authentication
+	raw, err := os.ReadFile(filepath.Join(tmpDir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "b"), raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load("b"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Load() of swapped value error = %v, want ErrDecrypt", err)
+	}
+
+	// So does a value sealed with another host's master secret
+	otherDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(otherDir, "a"), raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewStore(otherDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Load("a"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Load() with another master secret error = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestStore_List(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	s, err := NewStoreWithOptions(tmpDir, Options{Versions: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"agent.token", "agent.key", "jobs/a", "jobs/b", "fingerprint.json"} {
+		if err := s.Save(key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Retains a version, which must not be listed
+	if err := s.Save("agent.token", []byte("rotated")); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := s.List("agent.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(keys, ","); got != "agent.key,agent.token" {
+		t.Errorf("List(agent.) = %s", got)
+	}
+
+	keys, err = s.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(keys, ","); got != "agent.key,agent.token,fingerprint.json,jobs/a,jobs/b" {
+		t.Errorf("List() = %s", got)
+	}
+}
+
+func TestStore_VersionsRestore(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	s, err := NewStoreWithOptions(tmpDir, Options{Versions: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"v1", "v2", "v3", "v4"} {
+		if err := s.Save("agent.token", []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	versions, err := s.Versions("agent.token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0] != 2 || versions[1] != 3 {
+		t.Fatalf("Versions() = %v, want [2 3]", versions)
+	}
+
+	// Version 2 held "v2"
+	if err := s.Restore("agent.token", versions[0]); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	loaded, err := s.Load("agent.token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(loaded) != "v2" {
+		t.Errorf("Load() after Restore = %q, want v2", loaded)
+	}
+
+	if err := s.Restore("agent.token", 1); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Restore() of pruned version error = %v", err)
+	}
+
+	if err := s.Delete("agent.token"); err != nil {
+		t.Fatal(err)
+	}
+	if versions, _ := s.Versions("agent.token"); len(versions) != 0 {
+		t.Errorf("Versions() after Delete = %v", versions)
+	}
+}
+
+func TestStore_DetectsCorruption(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	s, err := NewStore(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save("agent.key", []byte("private key")); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(tmpDir, "agent.key")
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[len(raw)-1] ^= 0xff
+	if err := os.WriteFile(path, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Load("agent.key"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Load() of corrupted value error = %v, want ErrCorrupt", err)
+	}
+
+	// Truncated by a crash before writes were atomic
+	if err := os.WriteFile(path, raw[:len(sealedMagic)+4], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load("agent.key"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Load() of truncated value error = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestStore_AtomicWriteLeavesNoTemporaryFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	s, err := NewStore(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := s.Save("agent.token", []byte("token")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp-") {
+			t.Errorf("temporary file left behind: %s", entry.Name())
+		}
+	}
+}
+
+func TestMasterSecret_ConcurrentCreation(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	const workers = 8
+	secrets := make([][]byte, workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s := &fileStore{baseDir: tmpDir}
+			secrets[i], errs[i] = s.loadMasterSecret()
+		}(i)
+	}
+	wg.Wait()
+
+	// Every process ends up with the one key that was created, never an
+	// empty or half-written file
+	for i := range secrets {
+		if errs[i] != nil {
+			t.Fatalf("loadMasterSecret() error = %v", errs[i])
+		}
+		if !bytes.Equal(secrets[i], secrets[0]) {
+			t.Fatalf("concurrent loads returned different store keys")
+		}
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != MasterKeyFile {
+		t.Errorf("store directory = %v, want only %s", entries, MasterKeyFile)
+	}
+}
@@ -5,7 +5,6 @@ package store
 import (
 	"fmt"
 	"os"
-	"syscall"
 	"unsafe"
 
 	"golang.org/x/sys/windows"
@@ -19,32 +18,47 @@ func (s *fileStore) SetPermissions(path string) error {
 	}
 	
 	// Get current user SID
-	token, err := syscall.OpenCurrentProcessToken()
-	if err != nil {
-		return fmt.Errorf("failed to open process token: %w", err)
-	}
-	defer token.Close()
-	
+	token := windows.GetCurrentProcessToken()
 	tokenUser, err := token.GetTokenUser()
 	if err != nil {
 		return fmt.Errorf("failed to get token user: %w", err)
 	}
+
+	systemSID, err := windows.CreateWellKnownSid(windows.WinLocalSystemSid)
+	if err != nil {
+		return fmt.Errorf("failed to get SYSTEM SID: %w", err)
+	}
+	adminsSID, err := windows.CreateWellKnownSid(windows.WinBuiltinAdministratorsSid)
+	if err != nil {
+		return fmt.Errorf("failed to get Administrators SID: %w", err)
+	}
 	
-	// Convert path to UTF16
-	pathUTF16, err := syscall.UTF16PtrFromString(path)
+	// Replace inherited access with the owner, SYSTEM and Administrators
+	var entries []windows.EXPLICIT_ACCESS
+	for _, sid := range []*windows.SID{tokenUser.User.Sid, systemSID, adminsSID} {
+		entries = append(entries, windows.EXPLICIT_ACCESS{
+			AccessPermissions: windows.GENERIC_ALL,
+			AccessMode:        windows.GRANT_ACCESS,
+			Inheritance:       windows.NO_INHERITANCE,
+			Trustee: windows.TRUSTEE{
+				TrusteeForm:  windows.TRUSTEE_IS_SID,
+				TrusteeType:  windows.TRUSTEE_IS_UNKNOWN,
+				TrusteeValue: windows.TrusteeValueFromSID(sid),
+			},
+		})
+	}
+	acl, err := windows.ACLFromEntries(entries, nil)
 	if err != nil {
-		return fmt.Errorf("failed to convert path: %w", err)
+		return fmt.Errorf("failed to build ACL: %w", err)
 	}
 	
-	// Create DACL with only owner access
-	// This is a simplified approach - production code should use proper ACL manipulation
 	err = windows.SetNamedSecurityInfo(
-		pathUTF16,
+		path,
 		windows.SE_FILE_OBJECT,
 		windows.DACL_SECURITY_INFORMATION|windows.PROTECTED_DACL_SECURITY_INFORMATION,
-		tokenUser.User.Sid,
 		nil,
 		nil,
+		acl,
 		nil,
 	)
 	
@@ -55,6 +69,51 @@ func (s *fileStore) SetPermissions(path string) error {
 	return nil
 }
 
+// protectSecret encrypts the master secret with the machine's DPAPI key so
+// the file is useless on another machine
+func protectSecret(baseDir string, secret []byte) ([]byte, error) {
+	in := windows.DataBlob{Size: uint32(len(secret)), Data: &secret[0]}
+	var out windows.DataBlob
+
+	err := windows.CryptProtectData(&in, nil, nil, 0, nil,
+		windows.CRYPTPROTECT_LOCAL_MACHINE|windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+
+	return append([]byte(nil), unsafe.Slice(out.Data, out.Size)...), nil
+}
+
+func unprotectSecret(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty store key")
+	}
+
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	var out windows.DataBlob
+
+	err := windows.CryptUnprotectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+
+	return append([]byte(nil), unsafe.Slice(out.Data, out.Size)...), nil
+}
+
+// needsRewrap reports whether data should be wrapped again; never, as every
+// version has used DPAPI on Windows
+func needsRewrap(data []byte) bool {
+	return false
+}
+
+// syncDir is a no-op on Windows, where directories cannot be flushed and
+// renames are journaled by NTFS
+func syncDir(dir string) error {
+	return nil
+}
+
 // secureDelete overwrites file before deletion (Windows-specific)
 func secureDelete(path string) error {
 	// Open file
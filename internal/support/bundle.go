@@ -0,0 +1,423 @@
+// Package support assembles support bundles: a zip of the agent's logs,
+// masked config, effective policy, health report, metrics, recent audit
+// entries, result cache listing and system info for escalations. Secrets
+// are redacted before anything is written to the bundle.
+package support
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tshojoshua/jtnt-agent/internal/config"
+	"github.com/tshojoshua/jtnt-agent/internal/health"
+	"github.com/tshojoshua/jtnt-agent/internal/policy"
+	"github.com/tshojoshua/jtnt-agent/internal/redact"
+	"github.com/tshojoshua/jtnt-agent/internal/service"
+	"github.com/tshojoshua/jtnt-agent/internal/sysinfo"
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+const (
+	defaultMaxLogBytes  = 5 * 1024 * 1024 // 5MB per log file
+	defaultAuditEntries = 1000
+	journalLines        = 5000
+	sourceTimeout       = 10 * time.Second
+)
+
+// Options controls what goes into a bundle
+type Options struct {
+	Version        string
+	MaxLogBytes    int64  // Tail kept of each log file; default 5MB
+	AuditEntries   int    // Most recent audit entries; default 1000
+	ResultCacheDir string // Listed, never copied; results may hold job output
+
+	// Health returns the daemon's health report; nil leaves it out
+	Health func(ctx context.Context) (*health.Report, error)
+	// Policy returns the effective policy; nil loads the layers from disk
+	Policy func() (*policy.Merged, error)
+	// SysInfo collects system information; default sysinfo.NewCollector()
+	SysInfo func() (*api.SystemInfo, error)
+
+	// Sources on disk; defaults are the agent's own. The metrics endpoint
+	// is the metrics_addr of the config read from ConfigPath. The service
+	// journal is collected only with the default LogDir.
+	ConfigPath string
+	AuditDir   string
+	LogDir     string
+}
+
+// Manifest describes a bundle's contents
+type Manifest struct {
+	CreatedAt time.Time `json:"created_at"`
+	AgentID   string    `json:"agent_id"`
+	Version   string    `json:"version"`
+	Hostname  string    `json:"hostname"`
+	Platform  string    `json:"platform"`
+	Files     []string  `json:"files"`
+	Errors    []string  `json:"errors,omitempty"` // Sections that could not be collected
+}
+
+// CachedResult lists one cached job result without its content
+type CachedResult struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// bundle writes sections into a zip, recording failures in the manifest
+type bundle struct {
+	zip      *zip.Writer
+	manifest *Manifest
+}
+
+func (b *bundle) add(name string, data []byte, err error) {
+	if err != nil {
+		b.manifest.Errors = append(b.manifest.Errors, fmt.Sprintf("%s: %v", name, err))
+		return
+	}
+
+	w, err := b.zip.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err == nil {
+		_, err = w.Write(data)
+	}
+	if err != nil {
+		b.manifest.Errors = append(b.manifest.Errors, fmt.Sprintf("%s: %v", name, err))
+		return
+	}
+	b.manifest.Files = append(b.manifest.Files, name)
+}
+
+func (b *bundle) addJSON(name string, v interface{}, err error) {
+	if err != nil {
+		b.add(name, nil, err)
+		return
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	b.add(name, data, err)
+}
+
+// Write assembles a bundle into w. Sections that cannot be collected are
+// listed in the manifest's errors instead of failing the bundle.
+func Write(ctx context.Context, w io.Writer, opts Options) (*Manifest, error) {
+	if opts.MaxLogBytes <= 0 {
+		opts.MaxLogBytes = defaultMaxLogBytes
+	}
+	if opts.AuditEntries <= 0 {
+		opts.AuditEntries = defaultAuditEntries
+	}
+
+	if opts.SysInfo == nil {
+		opts.SysInfo = sysinfo.NewCollector().Collect
+	}
+	if opts.ConfigPath == "" {
+		opts.ConfigPath = config.GetConfigPath()
+	}
+	if opts.AuditDir == "" {
+		opts.AuditDir = filepath.Join(config.GetStateDir(), "audit")
+	}
+	journal := opts.LogDir == ""
+	if opts.LogDir == "" {
+		opts.LogDir = config.GetLogDir()
+	}
+
+	hostname, _ := os.Hostname()
+	b := &bundle{
+		zip: zip.NewWriter(w),
+		manifest: &Manifest{
+			CreatedAt: time.Now().UTC(),
+			Version:   opts.Version,
+			Hostname:  hostname,
+			Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		},
+	}
+
+	cfg, err := config.Load(opts.ConfigPath)
+	if cfg != nil {
+		b.manifest.AgentID = cfg.AgentID
+	}
+	if err == nil {
+		masked, err := redactedConfig(cfg)
+		b.addJSON("config.json", masked, err)
+	} else {
+		b.add("config.json", nil, err)
+	}
+
+	merged, err := effectivePolicy(opts)
+	b.addJSON("policy.json", merged, err)
+
+	if opts.Health != nil {
+		healthCtx, cancel := context.WithTimeout(ctx, sourceTimeout)
+		report, err := opts.Health(healthCtx)
+		cancel()
+		b.addJSON("health.json", report, err)
+	}
+
+	if cfg != nil && cfg.MetricsAddr != "" {
+		data, err := fetchMetrics(ctx, "http://"+cfg.MetricsAddr+"/metrics")
+		b.add("metrics.txt", data, err)
+	}
+
+	info, err := opts.SysInfo()
+	b.addJSON("sysinfo.json", info, err)
+
+	if opts.ResultCacheDir != "" {
+		listing, err := listResultCache(opts.ResultCacheDir)
+		b.addJSON("result_cache.json", listing, err)
+	}
+
+	data, err := recentAudit(opts.AuditDir, opts.AuditEntries)
+	b.add("audit/recent.jsonl", data, err)
+
+	collectLogs(ctx, b, opts.LogDir, journal, opts.MaxLogBytes)
+
+	b.addJSON("manifest.json", b.manifest, nil)
+
+	if err := b.zip.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish bundle: %w", err)
+	}
+
+	return b.manifest, nil
+}
+
+// WriteFile assembles a bundle at path, readable only by the owner
+func WriteFile(ctx context.Context, path string, opts Options) (*Manifest, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bundle: %w", err)
+	}
+
+	manifest, err := Write(ctx, file, opts)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// FileName returns the default bundle name for agentID
+func FileName(agentID string, now time.Time) string {
+	if agentID == "" {
+		agentID = "unenrolled"
+	}
+	return fmt.Sprintf("jtnt-support-%s-%s.zip", agentID, now.UTC().Format("20060102-150405"))
+}
+
+// redactedConfig returns the config.json section for cfg with every field
+// passed through redact.Fields, so secrets added to the config later are
+// masked too. The token keeps its ends for matching against the hub.
+func redactedConfig(cfg *config.Config) (map[string]interface{}, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	masked := redact.Fields(fields)
+	if cfg.AgentToken != "" {
+		masked["agent_token"] = maskSecret(cfg.AgentToken)
+	}
+	return masked, nil
+}
+
+func effectivePolicy(opts Options) (*policy.Merged, error) {
+	if opts.Policy != nil {
+		return opts.Policy()
+	}
+
+	var publicKey ed25519.PublicKey
+	if data, err := os.ReadFile(config.GetPolicyKeyPath()); err == nil {
+		publicKey, _ = policy.LoadPublicKey(data)
+	}
+
+	merged, err := policy.LoadEffective(config.GetPolicyDir(), publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if merged == nil {
+		def := policy.DefaultPolicy()
+		def.Layer = "default"
+		return policy.Merge([]*policy.Policy{def})
+	}
+	return merged, nil
+}
+
+func fetchMetrics(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, sourceTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("metrics endpoint unavailable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metrics endpoint returned %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, defaultMaxLogBytes))
+}
+
+func listResultCache(dir string) ([]CachedResult, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []CachedResult{}, nil
+		}
+		return nil, err
+	}
+
+	listing := []CachedResult{}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() {
+			continue
+		}
+		listing = append(listing, CachedResult{
+			Name:     entry.Name(),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+		})
+	}
+	return listing, nil
+}
+
+// recentAudit returns the last limit entries across the daily audit logs in
+// dir, oldest first
+func recentAudit(dir string, limit int) ([]byte, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "audit-*.log"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var lines []string
+	for i := len(files) - 1; i >= 0 && len(lines) < limit; i-- {
+		fileLines, err := readLines(files[i])
+		if err != nil {
+			return nil, err
+		}
+		if need := limit - len(lines); len(fileLines) > need {
+			fileLines = fileLines[len(fileLines)-need:]
+		}
+		lines = append(fileLines, lines...)
+	}
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(redact.String(line))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// collectLogs adds the tail of each current file in logDir and, with
+// journal on Linux, the service journal. Compressed segments are left out.
+func collectLogs(ctx context.Context, b *bundle, logDir string, journal bool, maxBytes int64) {
+	entries, err := os.ReadDir(logDir)
+	if err != nil && !os.IsNotExist(err) {
+		b.add("logs", nil, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".gz") {
+			continue
+		}
+		data, err := tailFile(filepath.Join(logDir, entry.Name()), maxBytes)
+		if err == nil {
+			data = redact.Bytes(data)
+		}
+		b.add("logs/"+entry.Name(), data, err)
+	}
+
+	if journal && runtime.GOOS == "linux" {
+		if _, err := exec.LookPath("journalctl"); err == nil {
+			ctx, cancel := context.WithTimeout(ctx, sourceTimeout)
+			defer cancel()
+
+			out, err := exec.CommandContext(ctx, "journalctl", "-u", service.Name(),
+				"-n", fmt.Sprint(journalLines), "--no-pager", "-o", "short-iso").Output()
+			if err == nil {
+				out = redact.Bytes(out)
+			}
+			b.add("logs/journal.txt", out, err)
+		}
+	}
+}
+
+// tailFile returns at most maxBytes from the end of path, starting at a
+// line boundary
+func tailFile(path string, maxBytes int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	offset := info.Size() - maxBytes
+	if offset <= 0 {
+		return io.ReadAll(file)
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data = data[i+1:]
+	}
+	return append([]byte(fmt.Sprintf("[truncated to last %d bytes]\n", maxBytes)), data...), nil
+}
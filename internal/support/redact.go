@@ -0,0 +1,10 @@
+package support
+
+// maskSecret keeps the ends of a secret so it can be matched against the
+// hub without revealing it
+func maskSecret(secret string) string {
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return secret[:4] + "****" + secret[len(secret)-4:]
+}
@@ -0,0 +1,114 @@
+package sysinfo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+// virtualInterfaces are name prefixes of interfaces created by container
+// and VM software, whose MACs change independently of the machine
+var virtualInterfaces = []string{"docker", "veth", "br-", "virbr", "vmnet", "vboxnet", "tun", "tap", "wg", "utun", "zt"}
+
+// Fingerprint returns the hashed identifiers of this machine
+func Fingerprint() *api.MachineFingerprint {
+	machineID, productUUID := machineIDs()
+
+	return &api.MachineFingerprint{
+		MachineID:   hashComponent(machineID),
+		ProductUUID: hashComponent(productUUID),
+		PrimaryMAC:  hashComponent(primaryMAC()),
+	}
+}
+
+// FingerprintDiff lists the components present in both fingerprints whose
+// values differ
+func FingerprintDiff(stored, current *api.MachineFingerprint) (compared int, changed []string) {
+	components := []struct {
+		name      string
+		old, curr string
+	}{
+		{"machine_id", stored.MachineID, current.MachineID},
+		{"product_uuid", stored.ProductUUID, current.ProductUUID},
+		{"primary_mac", stored.PrimaryMAC, current.PrimaryMAC},
+	}
+
+	for _, c := range components {
+		if c.old == "" || c.curr == "" {
+			continue
+		}
+		compared++
+		if c.old != c.curr {
+			changed = append(changed, c.name)
+		}
+	}
+	return compared, changed
+}
+
+// IsClone reports whether current looks like a different machine from
+// stored. One changed component alone (a replaced NIC, a regenerated
+// machine-id) is treated as the same machine unless it is the only one
+// that can be compared.
+func IsClone(stored, current *api.MachineFingerprint) bool {
+	compared, changed := FingerprintDiff(stored, current)
+	if len(changed) == 0 {
+		return false
+	}
+	return len(changed) >= 2 || len(changed) == compared
+}
+
+func hashComponent(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte("jtnt-agent:" + value))
+	return hex.EncodeToString(sum[:])
+}
+
+// primaryMAC returns the hardware address of the first physical-looking
+// interface, preferring ones that are up
+func primaryMAC() string {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+
+	var candidates []net.Interface
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) == 0 {
+			continue
+		}
+		if isVirtualInterface(iface.Name) {
+			continue
+		}
+		candidates = append(candidates, iface)
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		upI := candidates[i].Flags&net.FlagUp != 0
+		upJ := candidates[j].Flags&net.FlagUp != 0
+		if upI != upJ {
+			return upI
+		}
+		return candidates[i].Index < candidates[j].Index
+	})
+
+	return candidates[0].HardwareAddr.String()
+}
+
+func isVirtualInterface(name string) bool {
+	for _, prefix := range virtualInterfaces {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package sysinfo
+
+import (
+	"testing"
+
+	"github.com/tshojoshua/jtnt-agent/pkg/api"
+)
+
+func TestIsClone(t *testing.T) {
+	stored := &api.MachineFingerprint{MachineID: "m1", ProductUUID: "u1", PrimaryMAC: "a1"}
+
+	tests := []struct {
+		name    string
+		current api.MachineFingerprint
+		want    bool
+	}{
+		{"unchanged", api.MachineFingerprint{MachineID: "m1", ProductUUID: "u1", PrimaryMAC: "a1"}, false},
+		{"replaced nic", api.MachineFingerprint{MachineID: "m1", ProductUUID: "u1", PrimaryMAC: "a2"}, false},
+		{"vm clone keeping machine-id", api.MachineFingerprint{MachineID: "m1", ProductUUID: "u2", PrimaryMAC: "a2"}, true},
+		{"everything changed", api.MachineFingerprint{MachineID: "m2", ProductUUID: "u2", PrimaryMAC: "a2"}, true},
+		{"product uuid unreadable", api.MachineFingerprint{MachineID: "m1", PrimaryMAC: "a2"}, false},
+		{"only machine-id comparable", api.MachineFingerprint{MachineID: "m2"}, true},
+		{"nothing comparable", api.MachineFingerprint{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsClone(stored, &tt.current); got != tt.want {
+				t.Errorf("IsClone() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFingerprint_Hashed(t *testing.T) {
+	fp := Fingerprint()
+	for _, value := range []string{fp.MachineID, fp.ProductUUID, fp.PrimaryMAC} {
+		if value != "" && len(value) != 64 {
+			t.Errorf("Component %q should be a hex SHA-256", value)
+		}
+	}
+
+	if hashComponent(" ABC\n") != hashComponent("abc") {
+		t.Error("Components should be normalized before hashing")
+	}
+}
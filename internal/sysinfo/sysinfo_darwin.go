@@ -4,3 +4,15 @@ package sysinfo
 
 // Platform-specific system info collection for macOS
 // Additional macOS-specific metrics can be added here
+
+import "github.com/shirou/gopsutil/v3/host"
+
+// machineIDs returns the OS's persistent host ID. There is no separate
+// product UUID to read.
+func machineIDs() (machineID, productUUID string) {
+	id, err := host.HostID()
+	if err != nil {
+		return "", ""
+	}
+	return id, ""
+}
@@ -4,3 +4,25 @@ package sysinfo
 
 // Platform-specific system info collection for Linux
 // Additional Linux-specific metrics can be added here
+
+import (
+	"os"
+	"strings"
+)
+
+// machineIDs returns the systemd machine ID and the DMI product UUID. The
+// product UUID is only readable by root.
+func machineIDs() (machineID, productUUID string) {
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if data, err := os.ReadFile(path); err == nil {
+			machineID = strings.TrimSpace(string(data))
+			break
+		}
+	}
+
+	if data, err := os.ReadFile("/sys/class/dmi/id/product_uuid"); err == nil {
+		productUUID = strings.TrimSpace(string(data))
+	}
+
+	return machineID, productUUID
+}
@@ -77,6 +77,16 @@ func (c *Client) Post(ctx context.Context, path string, body interface{}) ([]byt
 	return respBody, nil
 }
 
+// PostOnce sends a POST request without retrying, for callers that pace
+// their own retries
+func (c *Client) PostOnce(ctx context.Context, path string, body interface{}) ([]byte, error) {
+	data, err := c.doPost(ctx, path, body)
+	if err != nil {
+		return nil, fmt.Errorf("post request failed: %w", err)
+	}
+	return data, nil
+}
+
 // Get sends a GET request with automatic retry
 func (c *Client) Get(ctx context.Context, path string) ([]byte, error) {
 	var respBody []byte
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -12,6 +13,10 @@ const (
 	JobTypeScript   JobType = "script"
 	JobTypeDownload JobType = "download"
 	JobTypeUpload   JobType = "upload"
+
+	// JobTypeSupportBundle collects a redacted diagnostics zip and uploads
+	// it as an artifact
+	JobTypeSupportBundle JobType = "support_bundle"
 )
 
 // Job represents a job to be executed
@@ -21,14 +26,48 @@ type Job struct {
 	CreatedAt  time.Time              `json:"created_at"`
 	TimeoutSec int                    `json:"timeout_sec"`
 	Payload    map[string]interface{} `json:"payload"`
+
+	RequestedBy string `json:"requested_by,omitempty"` // Hub user who queued the job, shown in consent prompts
+
+	// Secrets are encrypted to the agent's key and opened only to run an
+	// exec or script job
+	Secrets *SecretEnvelope `json:"secrets,omitempty"`
+}
+
+// SecretEnvelope holds a job's secrets encrypted to the agent. The hub
+// generates an ephemeral X25519 key, derives an AES-256-GCM key with
+// HKDF-SHA256 from its shared secret with the agent's encryption key, and
+// seals the JSON list of JobSecret with the job ID as additional data.
+type SecretEnvelope struct {
+	Algorithm    string `json:"alg"`           // "x25519-hkdf-sha256-aes256gcm"
+	EphemeralKey string `json:"ephemeral_key"` // base64 X25519 public key
+	Nonce        string `json:"nonce"`         // base64, 12 bytes
+	Ciphertext   string `json:"ciphertext"`    // base64
+}
+
+// JobSecret is one secret delivered to a job
+type JobSecret struct {
+	Name   string `json:"name"`             // Environment variable name
+	Value  string `json:"value"`            // Secret value
+	Target string `json:"target,omitempty"` // "env" (default) or "file"
 }
 
+const (
+	// SecretTargetEnv sets the secret as environment variable Name
+	SecretTargetEnv = "env"
+
+	// SecretTargetFile writes the secret to a memory-backed file readable
+	// only by the agent's user and sets Name_FILE to its path
+	SecretTargetFile = "file"
+)
+
 // ExecPayload represents exec job parameters
 type ExecPayload struct {
 	Binary     string   `json:"binary"`
 	Args       []string `json:"args"`
 	TimeoutSec int      `json:"timeout_sec"`
 	WorkingDir string   `json:"working_dir"`
+	Redact     []string `json:"redact,omitempty"` // Secret values masked in logs, audit and output
 }
 
 // ScriptPayload represents script job parameters
@@ -38,6 +77,7 @@ type ScriptPayload struct {
 	ScriptSignature string            `json:"script_signature"`
 	TimeoutSec      int               `json:"timeout_sec"`
 	EnvVars         map[string]string `json:"env_vars"`
+	Redact          []string          `json:"redact,omitempty"` // Secret values masked in logs, audit and output
 }
 
 // DownloadPayload represents download job parameters
@@ -53,6 +93,12 @@ type UploadPayload struct {
 	MaxSizeBytes int64  `json:"max_size_bytes"`
 }
 
+// SupportBundlePayload represents support bundle job parameters
+type SupportBundlePayload struct {
+	MaxLogBytes  int64 `json:"max_log_bytes"` // Per log file, 0 = default
+	AuditEntries int   `json:"audit_entries"` // Most recent entries, 0 = default
+}
+
 // JobStatus represents job execution status
 type JobStatus string
 
@@ -60,19 +106,28 @@ const (
 	StatusSuccess JobStatus = "success"
 	StatusError   JobStatus = "error"
 	StatusTimeout JobStatus = "timeout"
+
+	// StatusDeferred means the job is queued on the agent until its
+	// maintenance window opens; a final result follows
+	StatusDeferred JobStatus = "deferred"
 )
 
 // JobResult represents the result of job execution
 type JobResult struct {
-	AgentID      string         `json:"agent_id"`
-	Status       JobStatus      `json:"status"`
-	StartedAt    time.Time      `json:"started_at"`
-	FinishedAt   time.Time      `json:"finished_at"`
-	ExitCode     int            `json:"exit_code,omitempty"`
-	StdoutTail   string         `json:"stdout_tail,omitempty"` // base64, last 10KB
-	StderrTail   string         `json:"stderr_tail,omitempty"` // base64, last 10KB
-	ErrorMessage string         `json:"error_message,omitempty"`
-	Artifacts    []ArtifactInfo `json:"artifacts,omitempty"`
+	AgentID      string          `json:"agent_id"`
+	Status       JobStatus       `json:"status"`
+	StartedAt    time.Time       `json:"started_at"`
+	FinishedAt   time.Time       `json:"finished_at"`
+	ExitCode     int             `json:"exit_code,omitempty"`
+	StdoutTail   string          `json:"stdout_tail,omitempty"` // base64, last 10KB
+	StderrTail   string          `json:"stderr_tail,omitempty"` // base64, last 10KB
+	ErrorMessage string          `json:"error_message,omitempty"`
+	Artifacts    []ArtifactInfo  `json:"artifacts,omitempty"`
+	Sandbox      string          `json:"sandbox,omitempty"` // enforced, unavailable or disabled
+	Data         json.RawMessage `json:"data,omitempty"`    // JSON the job wrote to JTNT_RESULT_FILE
+
+	DeferredUntil  *time.Time `json:"deferred_until,omitempty"`  // Set with StatusDeferred
+	DeferredReason string     `json:"deferred_reason,omitempty"` // Windows that were closed
 }
 
 // ArtifactInfo represents uploaded artifact metadata
@@ -1,6 +1,9 @@
 package api
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // EnrollRequest is sent by agent during initial enrollment
 type EnrollRequest struct {
@@ -12,7 +15,10 @@ type EnrollRequest struct {
 	AgentVersion string   `json:"agent_version"`
 	Capabilities []string `json:"capabilities"`
 	OSVersion    string   `json:"os_version,omitempty"`
-	PublicKey    string   `json:"public_key"` // base64-encoded Ed25519 public key
+	PublicKey    string   `json:"public_key"`         // base64-encoded Ed25519 public key
+	AgentID      string   `json:"agent_id,omitempty"` // Requested when re-enrolling with the same identity
+
+	EncryptionKey string `json:"encryption_key,omitempty"` // base64 X25519 key job secrets are encrypted to
 }
 
 // EnrollResponse is returned by hub after successful enrollment
@@ -31,11 +37,50 @@ type EnrollmentPolicy struct {
 	Capabilities map[string]interface{} `json:"capabilities"`
 }
 
+// MachineFingerprint identifies the machine an agent was enrolled on. Each
+// component is a SHA-256 hash so raw hardware identifiers are not sent;
+// components that could not be read are empty.
+type MachineFingerprint struct {
+	MachineID   string `json:"machine_id,omitempty"`
+	ProductUUID string `json:"product_uuid,omitempty"`
+	PrimaryMAC  string `json:"primary_mac,omitempty"`
+}
+
+// CloneRecoveryRequest is sent by an agent that finds itself running on a
+// different machine than it enrolled on, asking the hub for a new identity.
+// It is authenticated with the credentials copied from the original.
+type CloneRecoveryRequest struct {
+	AgentID             string             `json:"agent_id"`
+	Hostname            string             `json:"hostname"`
+	PublicKey           string             `json:"public_key"` // New base64-encoded Ed25519 public key
+	PreviousFingerprint MachineFingerprint `json:"previous_fingerprint"`
+	Fingerprint         MachineFingerprint `json:"fingerprint"`
+
+	EncryptionKey string `json:"encryption_key,omitempty"` // New base64 X25519 key job secrets are encrypted to
+}
+
+// UnenrollRequest is sent by agent when it is removed from the hub
+type UnenrollRequest struct {
+	AgentID string `json:"agent_id"`
+	Reason  string `json:"reason,omitempty"`
+}
+
 // HeartbeatRequest is sent periodically by agent
 type HeartbeatRequest struct {
 	AgentID   string     `json:"agent_id"`
 	Timestamp time.Time  `json:"timestamp"`
 	SysInfo   SystemInfo `json:"sysinfo"`
+
+	DeferredJobs []DeferredJob `json:"deferred_jobs,omitempty"`
+
+	EncryptionKey string `json:"encryption_key,omitempty"` // base64 X25519 key job secrets are encrypted to
+}
+
+// DeferredJob is a job held on the agent until its maintenance window opens
+type DeferredJob struct {
+	JobID  string    `json:"job_id"`
+	RunAt  time.Time `json:"run_at"`
+	Reason string    `json:"reason"`
 }
 
 // HeartbeatResponse is returned by hub
@@ -44,6 +89,19 @@ type HeartbeatResponse struct {
 	NextHeartbeatSec int  `json:"next_heartbeat_sec"`
 }
 
+// AuditBatch carries audit log entries to the hub. Entries are the lines
+// exactly as written so the hub can verify signatures and the hash chain.
+type AuditBatch struct {
+	AgentID string            `json:"agent_id"`
+	Entries []json.RawMessage `json:"entries"`
+}
+
+// AuditAck is returned by the hub for an audit batch. AckedSeq is the
+// highest sequence number the hub has stored.
+type AuditAck struct {
+	AckedSeq uint64 `json:"acked_seq"`
+}
+
 // SystemInfo contains system metrics and information
 type SystemInfo struct {
 	Hostname    string    `json:"hostname"`
@@ -231,7 +231,7 @@ enroll_agent() {
     info "Enrolling agent with hub..."
     
     if command -v jtnt-agent &> /dev/null; then
-        if jtnt-agent enroll --token "$ENROLLMENT_TOKEN" --hub "$HUB_URL"; then
+        if JTNT_ENROLL_TOKEN="$ENROLLMENT_TOKEN" jtnt-agent enroll --hub "$HUB_URL"; then
             success "Agent enrolled successfully"
         else
             warning "Enrollment failed. You can enroll manually later."